@@ -0,0 +1,152 @@
+package board
+
+// This file contains helper functions to work with accelerometer values as
+// returned by Sensors.Acceleration. They are pure functions, so they work on
+// every board (and in tests).
+
+// GravityVector normalizes an acceleration vector in µg (as returned by
+// Sensors.Acceleration) to a unit vector, where 1_000_000 means 1.0. For a
+// device that isn't moving, this is the direction of gravity.
+//
+// It also returns the magnitude of the acceleration in µg. This is around
+// 1000000 (1g) when the device is at rest, values that are a lot higher or
+// lower indicate that the device is moving.
+//
+// If the acceleration is zero (which can happen in free fall), the returned
+// vector and magnitude are all zero.
+func GravityVector(x, y, z int32) (nx, ny, nz int32, magnitude uint32) {
+	sum := uint64(int64(x)*int64(x)) + uint64(int64(y)*int64(y)) + uint64(int64(z)*int64(z))
+	mag := isqrt64(sum)
+	if mag == 0 {
+		return 0, 0, 0, 0
+	}
+	nx = int32(int64(x) * 1000_000 / int64(mag))
+	ny = int32(int64(y) * 1000_000 / int64(mag))
+	nz = int32(int64(z) * 1000_000 / int64(mag))
+	return nx, ny, nz, uint32(mag)
+}
+
+// Integer square root, rounded down.
+func isqrt64(n uint64) uint64 {
+	// Newton's method, starting from a value that is guaranteed to be larger
+	// than the result so that it converges from above.
+	if n < 2 {
+		return n
+	}
+	x := n/2 + 1
+	y := (x + n/x) / 2
+	for y < x {
+		x = y
+		y = (x + n/x) / 2
+	}
+	return x
+}
+
+// AxisMapping describes how the axes of an accelerometer map to the standard
+// axes used by Sensors.Acceleration. Each element is the input axis that is
+// used for the X, Y and Z output axis respectively: 1 for X, 2 for Y and 3 for
+// Z. A negative value inverts the axis. For example, AxisMapping{-2, 1, 3}
+// rotates the X and Y axes by 90°.
+//
+// The zero value is the identity mapping, which leaves all axes unchanged.
+// Any other mapping must only contain the values 1, 2, 3, -1, -2 and -3.
+type AxisMapping [3]int8
+
+// Apply the axis mapping to the given acceleration vector. It panics when the
+// mapping contains an invalid axis, instead of silently returning 0 for it.
+func (m AxisMapping) Apply(x, y, z int32) (mx, my, mz int32) {
+	if m == (AxisMapping{}) {
+		return x, y, z
+	}
+	axes := [3]int32{x, y, z}
+	var mapped [3]int32
+	for i, axis := range m {
+		switch {
+		case axis >= 1 && axis <= 3:
+			mapped[i] = axes[axis-1]
+		case axis <= -1 && axis >= -3:
+			mapped[i] = -axes[-axis-1]
+		default:
+			panic("board: invalid axis in AxisMapping")
+		}
+	}
+	return mapped[0], mapped[1], mapped[2]
+}
+
+// PitchRoll returns the pitch and roll in degrees, calculated from an
+// acceleration vector in µg (as returned by Sensors.Acceleration). This is only
+// accurate while the device isn't moving, because only then the acceleration
+// is caused purely by gravity.
+//
+// The pitch is the rotation around the X axis: it is 0 when the device is lying
+// flat on a table and 90 when it is held upright (like a phone when taking a
+// selfie). It is in the range -90..90.
+//
+// The roll is the rotation around the Y axis: it is 0 when the device is lying
+// flat, 90 when it is rotated to the left so that the X axis points down, and
+// ±180 when it is lying upside down. It is in the range -180..180.
+//
+// When the device is (nearly) upright, the roll can't be determined reliably:
+// small sensor noise would cause large swings. In that case, the roll is
+// returned as 0.
+func PitchRoll(x, y, z int32) (pitch, roll int16) {
+	// Length of the acceleration vector projected on the X/Z plane.
+	horizontal := int64(isqrt64(uint64(int64(x)*int64(x)) + uint64(int64(z)*int64(z))))
+	pitch = atan2Degrees(int64(y), horizontal)
+
+	// Avoid gimbal lock: only calculate the roll when the device is tilted
+	// more than around 2° from upright.
+	_, _, _, magnitude := GravityVector(x, y, z)
+	if horizontal > int64(magnitude)/32 {
+		roll = atan2Degrees(int64(x), int64(z))
+	}
+	return pitch, roll
+}
+
+// Integer version of math.Atan2, returning the result in degrees (rounded to
+// the nearest integer) in the range -180..180.
+func atan2Degrees(y, x int64) int16 {
+	if x == 0 && y == 0 {
+		return 0
+	}
+	ax, ay := x, y
+	if ax < 0 {
+		ax = -ax
+	}
+	if ay < 0 {
+		ay = -ay
+	}
+
+	// Calculate the angle in the first quadrant, in millidegrees.
+	var angle int64
+	if ax >= ay {
+		angle = atanMillidegrees(ay << 16 / ax)
+	} else {
+		angle = 90_000 - atanMillidegrees(ax<<16/ay)
+	}
+
+	// Map the angle to the correct quadrant.
+	if x < 0 {
+		angle = 180_000 - angle
+	}
+	if y < 0 {
+		angle = -angle
+	}
+
+	// Round to whole degrees.
+	if angle < 0 {
+		return int16((angle - 500) / 1000)
+	}
+	return int16((angle + 500) / 1000)
+}
+
+// Approximate atan(r) in millidegrees for 0 ≤ r ≤ 1, where r is a 16.16 fixed
+// point value. This uses the approximation described in "Efficient
+// approximations for the arctangent function" (Rajan et al. 2006), which has a
+// maximum error of around 0.1°:
+//
+//	atan(r) = 45r - r(r-1)(14.02 + 3.79r)
+func atanMillidegrees(r int64) int64 {
+	const one = 1 << 16
+	return (45_000*r - r*(r-one)/one*(14_020+3_790*r/one)) / one
+}
@@ -0,0 +1,133 @@
+package board
+
+import (
+	"math"
+	"testing"
+)
+
+func TestGravityVector(t *testing.T) {
+	for _, tc := range []struct {
+		x, y, z    int32
+		nx, ny, nz int32
+		magnitude  uint32
+	}{
+		{0, 0, 0, 0, 0, 0, 0},                                 // free fall
+		{0, 0, 1000_000, 0, 0, 1000_000, 1000_000},            // lying flat on a table
+		{0, 0, -1000_000, 0, 0, -1000_000, 1000_000},          // lying upside down
+		{0, 1000_000, 0, 0, 1000_000, 0, 1000_000},            // upright
+		{1000_000, 0, 0, 1000_000, 0, 0, 1000_000},            // rotated to the left
+		{600_000, 0, 800_000, 600_000, 0, 800_000, 1000_000},  // tilted
+		{0, 0, 2000_000, 0, 0, 1000_000, 2000_000},            // accelerating upwards
+		{0, -300_000, 400_000, 0, -600_000, 800_000, 500_000}, // falling a bit
+	} {
+		nx, ny, nz, magnitude := GravityVector(tc.x, tc.y, tc.z)
+		if nx != tc.nx || ny != tc.ny || nz != tc.nz || magnitude != tc.magnitude {
+			t.Errorf("GravityVector(%d, %d, %d): expected (%d, %d, %d, %d), got (%d, %d, %d, %d)", tc.x, tc.y, tc.z, tc.nx, tc.ny, tc.nz, tc.magnitude, nx, ny, nz, magnitude)
+		}
+	}
+}
+
+func TestIsqrt64(t *testing.T) {
+	for _, n := range []uint64{0, 1, 2, 3, 4, 15, 16, 17, 1000_000, 1<<62 + 12345, 1<<64 - 1} {
+		root := isqrt64(n)
+		tooLarge := root*root > n
+		tooSmall := root+1 < 1<<32 && (root+1)*(root+1) <= n
+		if tooLarge || tooSmall {
+			t.Errorf("isqrt64(%d) = %d is not the rounded down square root", n, root)
+		}
+	}
+}
+
+func TestPitchRoll(t *testing.T) {
+	for _, tc := range []struct {
+		x, y, z     int32
+		pitch, roll int16
+	}{
+		{0, 0, 1000_000, 0, 0},             // lying flat on a table
+		{0, 0, -1000_000, 0, 180},          // lying upside down
+		{0, 1000_000, 0, 90, 0},            // upright
+		{0, -1000_000, 0, -90, 0},          // upright, but upside down
+		{1000_000, 0, 0, 0, 90},            // rotated to the left
+		{-1000_000, 0, 0, 0, -90},          // rotated to the right
+		{0, 707_107, 707_107, 45, 0},       // halfway upright
+		{0, 500_000, 866_025, 30, 0},       // tilted 30° towards the user
+		{500_000, 0, 866_025, 0, 30},       // tilted 30° to the left
+		{-866_025, 0, 500_000, 0, -60},     // tilted 60° to the right
+		{10_000, 1000_000, 10_000, 89, 0},  // nearly upright, noisy X/Z
+		{-10_000, 1000_000, -5_000, 89, 0}, // nearly upright, noisy X/Z
+	} {
+		pitch, roll := PitchRoll(tc.x, tc.y, tc.z)
+		if pitch != tc.pitch || roll != tc.roll {
+			t.Errorf("PitchRoll(%d, %d, %d): expected (%d, %d), got (%d, %d)", tc.x, tc.y, tc.z, tc.pitch, tc.roll, pitch, roll)
+		}
+	}
+}
+
+func TestAtan2Degrees(t *testing.T) {
+	// Compare against math.Atan2 for a whole circle.
+	for deg := -179; deg <= 180; deg++ {
+		rad := float64(deg) * math.Pi / 180
+		y := int64(math.Round(math.Sin(rad) * 1000_000))
+		x := int64(math.Round(math.Cos(rad) * 1000_000))
+		if result := atan2Degrees(y, x); int(result) != deg {
+			t.Errorf("atan2Degrees(%d, %d): expected %d, got %d", y, x, deg, result)
+		}
+	}
+}
+
+func TestAxisMapping(t *testing.T) {
+	const g = 1000_000
+	for _, tc := range []struct {
+		name       string
+		mapping    AxisMapping
+		x, y, z    int32 // input
+		mx, my, mz int32 // expected output
+	}{
+		{"identity", AxisMapping{}, 1, 2, 3, 1, 2, 3},
+		{"identity (explicit)", AxisMapping{1, 2, 3}, 1, 2, 3, 1, 2, 3},
+		{"swap X and Y", AxisMapping{2, 1, 3}, 1, 2, 3, 2, 1, 3},
+		// Mounted upside down: lying face down reads as lying flat.
+		{"upside down", AxisMapping{-1, 2, -3}, 0, 0, -g, 0, 0, g},
+		// Mounted rotated by 90°: the X axis of the board points up when the
+		// enclosure is held upright.
+		{"rotated 90°", AxisMapping{-2, 1, 3}, g, 0, 0, 0, g, 0},
+		// PineTime: BMA42x values of a watch lying flat on a table.
+		{"pinetime", AxisMapping{-2, -1, -3}, 0, 0, -g, 0, 0, g},
+		// PyBadge: LIS3DH values of a badge held upright.
+		{"pybadge", AxisMapping{-1, 2, -3}, 0, g, 0, 0, g, 0},
+	} {
+		mx, my, mz := tc.mapping.Apply(tc.x, tc.y, tc.z)
+		if mx != tc.mx || my != tc.my || mz != tc.mz {
+			t.Errorf("%s: expected (%d, %d, %d), got (%d, %d, %d)", tc.name, tc.mx, tc.my, tc.mz, mx, my, mz)
+		}
+	}
+
+	// Invalid axes are rejected, instead of reading as 0.
+	for _, mapping := range []AxisMapping{{1, 0, 3}, {1, 2, 4}, {-4, 2, 3}} {
+		func() {
+			defer func() {
+				if recover() == nil {
+					t.Errorf("%v: expected a panic for an invalid axis", mapping)
+				}
+			}()
+			mapping.Apply(1, 2, 3)
+		}()
+	}
+}
+
+func TestMapAcceleration(t *testing.T) {
+	defer func(mapping AxisMapping) {
+		SensorSettings.AxisMapping = mapping
+	}(SensorSettings.AxisMapping)
+
+	// The board mapping is applied first, then the user mapping.
+	boardAxes := AxisMapping{-2, -1, -3}
+	SensorSettings.AxisMapping = AxisMapping{}
+	if x, y, z := mapAcceleration(boardAxes, 1, 2, 3); x != -2 || y != -1 || z != -3 {
+		t.Errorf("unexpected board mapping: (%d, %d, %d)", x, y, z)
+	}
+	SensorSettings.AxisMapping = AxisMapping{-1, 2, -3}
+	if x, y, z := mapAcceleration(boardAxes, 1, 2, 3); x != 2 || y != -1 || z != 3 {
+		t.Errorf("unexpected combined mapping: (%d, %d, %d)", x, y, z)
+	}
+}
@@ -0,0 +1,70 @@
+package board
+
+// This file contains the software buffer for Sensors.ReadAccelBuffer.
+//
+// Sensors.ReadAccelBuffer copies the acceleration samples that were collected
+// since the last call into buf (oldest first), and returns the number of
+// samples. Samples are in µg with the axis mapping applied, like the values
+// returned by Sensors.Acceleration. The buffer is emptied by reading it, and
+// when it overflows the oldest samples are dropped. This is useful for gesture
+// recognition and motion logging, where short bursts of motion need to be
+// captured without polling the accelerometer at the sample rate:
+//
+//	var samples [32][3]int32
+//	n, err := board.Sensors.ReadAccelBuffer(samples[:])
+//	for _, sample := range samples[:n] {
+//		// process sample[0], sample[1], sample[2] (x, y, z)
+//	}
+//
+// How samples are collected depends on the accelerometer:
+//   - The BMA42x on the PineTime has a hardware FIFO of 1024 bytes, which is
+//     170 samples or 3.4 seconds at the 50Hz sample rate it is configured for.
+//     The FIFO fills up independently of Update, so samples are captured even
+//     while the app doesn't do anything.
+//   - The LIS3DH on the PyBadge and Gopher Badge also has a FIFO (of 32
+//     samples), but while it is enabled reading the current acceleration
+//     removes the oldest sample from it, which would break Acceleration. So
+//     these boards use a software buffer of 32 samples instead, which gets a
+//     new sample on every Update with drivers.Acceleration. Call Update at the
+//     sample rate you need.
+//   - The simulator behaves like a hardware FIFO of 32 samples at 50Hz.
+//   - Boards without an accelerometer always return 0 samples.
+//
+// Update and Acceleration work as usual: reading the buffer doesn't change the
+// value returned by Acceleration, and updating the acceleration doesn't take
+// samples out of the buffer.
+
+// Number of samples in accelBuffer.
+const accelBufferSize = 32
+
+// Ring buffer of acceleration samples, for boards that can't use the FIFO of
+// the accelerometer. It is not safe for concurrent use.
+type accelBuffer struct {
+	samples [accelBufferSize][3]int32
+	start   uint8 // index of the oldest sample
+	length  uint8 // number of samples in the buffer
+}
+
+// Add a sample to the buffer, dropping the oldest sample if it is full.
+func (b *accelBuffer) push(x, y, z int32) {
+	index := (int(b.start) + int(b.length)) % accelBufferSize
+	b.samples[index] = [3]int32{x, y, z}
+	if b.length < accelBufferSize {
+		b.length++
+	} else {
+		b.start = uint8((int(b.start) + 1) % accelBufferSize)
+	}
+}
+
+// Move samples from the buffer into buf, oldest first, and return the number
+// of samples. Samples that don't fit in buf stay in the buffer.
+func (b *accelBuffer) read(buf [][3]int32) int {
+	n := 0
+	for n < len(buf) && b.length > 0 {
+		buf[n] = b.samples[b.start]
+		b.start = uint8((int(b.start) + 1) % accelBufferSize)
+		b.length--
+		n++
+	}
+	return n
+}
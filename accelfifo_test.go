@@ -0,0 +1,38 @@
+package board
+
+import "testing"
+
+func TestAccelBuffer(t *testing.T) {
+	var b accelBuffer
+	var buf [accelBufferSize + 5][3]int32
+
+	// An empty buffer returns nothing.
+	if n := b.read(buf[:]); n != 0 {
+		t.Errorf("expected no samples, got %d", n)
+	}
+
+	// Samples are returned oldest first, and only as many as fit in buf.
+	for i := int32(0); i < 3; i++ {
+		b.push(i, i*10, i*100)
+	}
+	if n := b.read(buf[:2]); n != 2 || buf[0] != [3]int32{0, 0, 0} || buf[1] != [3]int32{1, 10, 100} {
+		t.Errorf("unexpected samples: %d %v", n, buf[:2])
+	}
+	if n := b.read(buf[:]); n != 1 || buf[0] != [3]int32{2, 20, 200} {
+		t.Errorf("unexpected samples: %d %v", n, buf[:1])
+	}
+
+	// When the buffer overflows, the oldest samples are dropped.
+	for i := int32(0); i < accelBufferSize+5; i++ {
+		b.push(i, 0, 0)
+	}
+	n := b.read(buf[:])
+	if n != accelBufferSize {
+		t.Fatalf("expected %d samples, got %d", accelBufferSize, n)
+	}
+	for i, sample := range buf[:n] {
+		if sample[0] != int32(i+5) {
+			t.Errorf("sample %d: expected %d, got %d", i, i+5, sample[0])
+		}
+	}
+}
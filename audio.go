@@ -0,0 +1,126 @@
+package board
+
+// This file contains helpers to analyze audio samples, as read from the
+// Microphone. They are pure functions that don't allocate memory and use only
+// integer math, so they are fast enough to run on a microcontroller.
+
+// SoundLevel returns the RMS (root mean square) level of the given samples,
+// which is a measure of how loud the sound is. A full scale sine wave has a
+// level of around 23170, a full scale square wave a level of 32767 or 32768.
+func SoundLevel(samples []int16) uint16 {
+	if len(samples) == 0 {
+		return 0
+	}
+	var sum uint64
+	for _, sample := range samples {
+		sum += uint64(int64(sample) * int64(sample))
+	}
+	return uint16(isqrt64(sum / uint64(len(samples))))
+}
+
+// Number of samples used by FrequencyBands.
+const fftSize = 64
+
+// Sine in the first quarter of a circle of fftSize steps, in Q15 fixed point.
+var fftSineTable = [fftSize/4 + 1]int16{0, 3212, 6393, 9512, 12539, 15446, 18204, 20787, 23170, 25329, 27245, 28898, 30273, 31356, 32137, 32609, 32767}
+
+// Return sin(2π·i/fftSize) in Q15 fixed point.
+func fftSin(i int) int64 {
+	i %= fftSize
+	switch {
+	case i <= fftSize/4:
+		return int64(fftSineTable[i])
+	case i <= fftSize/2:
+		return int64(fftSineTable[fftSize/2-i])
+	case i <= fftSize*3/4:
+		return -int64(fftSineTable[i-fftSize/2])
+	default:
+		return -int64(fftSineTable[fftSize-i])
+	}
+}
+
+// Return cos(2π·i/fftSize) in Q15 fixed point.
+func fftCos(i int) int64 {
+	return fftSin(i + fftSize/4)
+}
+
+// FrequencyBands calculates the magnitude of a number of frequency bands in
+// the given samples, for example to drive a spectrum visualizer on a row of
+// LEDs. The result is stored in bands, from low to high frequencies. A pure
+// sine wave results in a band value of around its amplitude (so up to 32767),
+// while sounds that are spread out over many frequencies result in lower
+// values.
+//
+// This uses a small fixed point FFT over the last 64 samples (with a Hann
+// window), which means the resolution is coarse: the frequencies from 0 to
+// half the sample rate are split in 32 equally sized bins, the first of which
+// (the DC offset) is ignored. The remaining 31 bins are evenly divided over
+// the bands, so at most 31 bands are useful. For example, at a sample rate of
+// 16kHz, each bin is 250Hz wide. Values are accurate to within a few percent,
+// which is plenty for visual effects but not for measurements.
+func FrequencyBands(samples []int16, bands []uint16) {
+	// Take the most recent samples, and apply a Hann window to reduce spectral
+	// leakage. The samples are stored in bit-reversed order, as needed by the
+	// FFT below.
+	var re, im [fftSize]int32
+	if len(samples) > fftSize {
+		samples = samples[len(samples)-fftSize:]
+	}
+	for i, sample := range samples {
+		window := (32767 - fftCos(i)) / 2
+		re[bitReverse6(i)] = int32(int64(sample) * window >> 15)
+	}
+
+	// Radix-2 decimation-in-time FFT. Each stage divides the values by two to
+	// avoid overflow, so the result is divided by fftSize. The values are
+	// stored as int32 to keep stack usage low (512 bytes).
+	for size := 2; size <= fftSize; size *= 2 {
+		half := size / 2
+		step := fftSize / size
+		for i := 0; i < fftSize; i += size {
+			for j := 0; j < half; j++ {
+				wr := fftCos(j * step)
+				wi := -fftSin(j * step)
+				a, b := i+j, i+j+half
+				tr := int32((int64(re[b])*wr - int64(im[b])*wi) >> 15)
+				ti := int32((int64(re[b])*wi + int64(im[b])*wr) >> 15)
+				re[b] = (re[a] - tr) >> 1
+				im[b] = (im[a] - ti) >> 1
+				re[a] = (re[a] + tr) >> 1
+				im[a] = (im[a] + ti) >> 1
+			}
+		}
+	}
+
+	// Combine the bins into bands, using the strongest bin in each band.
+	const bins = fftSize/2 - 1 // excluding the DC bin
+	for band := range bands {
+		first := 1 + band*bins/len(bands)
+		last := 1 + (band+1)*bins/len(bands)
+		if last <= first {
+			last = first + 1
+		}
+		var value uint64
+		for bin := first; bin < last && bin <= bins; bin++ {
+			// A sine wave ends up as two peaks of half its amplitude, and the
+			// Hann window halves it again. Compensate for that.
+			magnitude := isqrt64(uint64(int64(re[bin])*int64(re[bin])+int64(im[bin])*int64(im[bin]))) * 4
+			if magnitude > value {
+				value = magnitude
+			}
+		}
+		if value > 0xffff {
+			value = 0xffff
+		}
+		bands[band] = uint16(value)
+	}
+}
+
+// Reverse the lower 6 bits of i (log2(fftSize) = 6).
+func bitReverse6(i int) int {
+	var result int
+	for bit := 0; bit < 6; bit++ {
+		result = result<<1 | i>>bit&1
+	}
+	return result
+}
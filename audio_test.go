@@ -0,0 +1,104 @@
+package board
+
+import (
+	"math"
+	"testing"
+)
+
+// Create a sine wave with the given amplitude, that completes the given number
+// of periods every 64 samples.
+func sineWave(amplitude float64, periods int) []int16 {
+	samples := make([]int16, 256)
+	for i := range samples {
+		samples[i] = int16(amplitude * math.Sin(2*math.Pi*float64(periods*i)/fftSize))
+	}
+	return samples
+}
+
+func TestSoundLevel(t *testing.T) {
+	square := make([]int16, 64)
+	for i := range square {
+		square[i] = 1000
+		if i%2 == 0 {
+			square[i] = -1000
+		}
+	}
+	for _, tc := range []struct {
+		name    string
+		samples []int16
+		level   uint16
+	}{
+		{"empty", nil, 0},
+		{"silence", make([]int16, 64), 0},
+		{"square", square, 1000},
+		{"sine", sineWave(32767, 4), 23170},
+	} {
+		if level := int(SoundLevel(tc.samples)); level < int(tc.level)-10 || level > int(tc.level)+10 {
+			t.Errorf("%s: expected level %d, got %d", tc.name, tc.level, level)
+		}
+	}
+}
+
+func TestFrequencyBands(t *testing.T) {
+	bands := make([]uint16, 8)
+
+	// Silence has no energy in any band.
+	FrequencyBands(make([]int16, 64), bands)
+	for i, value := range bands {
+		if value != 0 {
+			t.Errorf("silence: band %d has value %d", i, value)
+		}
+	}
+
+	// A sine wave shows up in the right band, at around its amplitude.
+	for _, tc := range []struct {
+		periods int
+		band    int
+	}{
+		{2, 0},
+		{8, 2},
+		{20, 5},
+		{30, 7},
+	} {
+		FrequencyBands(sineWave(10000, tc.periods), bands)
+		for i, value := range bands {
+			switch {
+			case i == tc.band:
+				if value < 9500 || value > 10500 {
+					t.Errorf("sine at bin %d: expected band %d to be around 10000, got %d", tc.periods, i, value)
+				}
+			case i < tc.band-1 || i > tc.band+1:
+				if value > 500 {
+					t.Errorf("sine at bin %d: expected band %d to be near zero, got %d", tc.periods, i, value)
+				}
+			}
+		}
+	}
+
+	// Fewer samples than the FFT size are padded with silence at the end.
+	short := sineWave(10000, 8)[:fftSize/2]
+	padded := make([]int16, fftSize)
+	copy(padded, short)
+	FrequencyBands(short, bands)
+	expected := make([]uint16, len(bands))
+	FrequencyBands(padded, expected)
+	for i := range bands {
+		if bands[i] != expected[i] {
+			t.Errorf("padded: band %d is %d, expected %d as with explicit padding", i, bands[i], expected[i])
+		}
+	}
+	if bands[2] == 0 {
+		t.Errorf("padded: expected energy in band 2, got %v", bands)
+	}
+}
+
+func TestBitReverse6(t *testing.T) {
+	for i := 0; i < fftSize; i++ {
+		if bitReverse6(bitReverse6(i)) != i {
+			t.Errorf("bitReverse6 is not its own inverse for %d", i)
+		}
+	}
+	if bitReverse6(1) != 32 || bitReverse6(6) != 24 {
+		t.Errorf("unexpected bit reversal: %d %d", bitReverse6(1), bitReverse6(6))
+	}
+}
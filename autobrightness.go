@@ -0,0 +1,151 @@
+package board
+
+import (
+	"time"
+
+	"tinygo.org/x/drivers"
+)
+
+// BrightnessPoint is a single point on an auto-brightness curve: the display
+// brightness to use at a given ambient light level.
+type BrightnessPoint struct {
+	// Ambient light level, as returned by Sensors.Light (0-1000).
+	Light uint32
+
+	// Display brightness at this light level, in percent of
+	// Display.MaxBrightness.
+	Brightness int
+}
+
+// DefaultBrightnessCurve is a reasonable auto-brightness curve for most
+// displays: dim in the dark, and full brightness in a well lit room or
+// outside. Brightness levels in between are interpolated linearly.
+var DefaultBrightnessCurve = []BrightnessPoint{
+	{Light: 0, Brightness: 10},
+	{Light: 100, Brightness: 30},
+	{Light: 600, Brightness: 100},
+}
+
+// AutoBrightness sets the display brightness automatically based on the
+// ambient light level. It can be used on boards with a light sensor and a
+// backlight with adjustable brightness. Sensors.Configure must have been called
+// with drivers.Luminosity before using it.
+//
+// The brightness is never set to 0, so that the display stays readable in the
+// dark. On boards where the backlight can only be turned on or off
+// (MaxBrightness returns 1), this means the backlight simply stays on.
+type AutoBrightness struct {
+	// Curve that maps light levels to brightness, sorted by light level. Light
+	// levels before the first or after the last point use the brightness of
+	// that point.
+	Curve []BrightnessPoint
+
+	// How often the light sensor is read. Set to time.Second by
+	// NewAutoBrightness.
+	Interval time.Duration
+
+	// Number of light readings to smooth over, using an exponential moving
+	// average. This avoids changing the brightness when a shadow briefly
+	// falls over the sensor. The values 0 and 1 disable smoothing. Set to 4
+	// by NewAutoBrightness.
+	Smoothing int
+
+	smoothed int32 // smoothed light level, times 16
+	level    int   // brightness level that was last set, or -1
+	lastRead time.Time
+}
+
+// NewAutoBrightness returns a new auto-brightness controller using the given
+// curve, for example DefaultBrightnessCurve.
+func NewAutoBrightness(curve []BrightnessPoint) *AutoBrightness {
+	return &AutoBrightness{
+		Curve:     curve,
+		Interval:  time.Second,
+		Smoothing: 4,
+		level:     -1,
+	}
+}
+
+// Update reads the light sensor and adjusts the display brightness, if the
+// interval has passed since the last reading. It is cheap to call otherwise,
+// so it can be called every frame.
+func (a *AutoBrightness) Update() error {
+	now := time.Now()
+	if a.level >= 0 && now.Sub(a.lastRead) < a.Interval {
+		return nil
+	}
+	a.lastRead = now
+	if err := Sensors.Update(drivers.Luminosity); err != nil {
+		return err
+	}
+	if level, changed := a.next(Sensors.Light(), Display.MaxBrightness()); changed {
+		Display.SetBrightness(level)
+	}
+	return nil
+}
+
+// Level returns the brightness level that was last set by Update, or -1 if
+// Update didn't set the brightness yet.
+func (a *AutoBrightness) Level() int {
+	return a.level
+}
+
+// Process a single light reading, and return the new brightness level and
+// whether it changed.
+func (a *AutoBrightness) next(light uint32, maxLevel int) (level int, changed bool) {
+	if maxLevel <= 0 {
+		// The brightness can't be changed.
+		return a.level, false
+	}
+
+	// Smooth the light level.
+	sample := int32(light) * 16
+	if a.level < 0 || a.Smoothing <= 1 {
+		a.smoothed = sample
+	} else {
+		a.smoothed += (sample - a.smoothed) / int32(a.Smoothing)
+	}
+
+	// Calculate the brightness level, in 1/16 steps.
+	exact := a.curvePercent(a.smoothed) * int32(maxLevel) / 100
+
+	// Only change the level when the exact level is well past the halfway
+	// point between two levels, to avoid flickering back and forth when the
+	// light level is right at the boundary.
+	if a.level >= 0 {
+		diff := exact - int32(a.level)*16
+		if diff >= -12 && diff <= 12 {
+			return a.level, false
+		}
+	}
+	level = int((exact + 8) / 16)
+	if level < 1 {
+		level = 1
+	} else if level > maxLevel {
+		level = maxLevel
+	}
+	changed = level != a.level
+	a.level = level
+	return level, changed
+}
+
+// Return the brightness in percent (times 16) for the given light level (times
+// 16), interpolating between the points of the curve.
+func (a *AutoBrightness) curvePercent(light int32) int32 {
+	curve := a.Curve
+	if len(curve) == 0 {
+		curve = DefaultBrightnessCurve
+	}
+	if light <= int32(curve[0].Light)*16 {
+		return int32(curve[0].Brightness) * 16
+	}
+	for i := 1; i < len(curve); i++ {
+		p0, p1 := curve[i-1], curve[i]
+		if light < int32(p1.Light)*16 {
+			lightRange := int32(p1.Light-p0.Light) * 16
+			brightnessRange := int32(p1.Brightness-p0.Brightness) * 16
+			return int32(p0.Brightness)*16 + brightnessRange*(light-int32(p0.Light)*16)/lightRange
+		}
+	}
+	return int32(curve[len(curve)-1].Brightness) * 16
+}
@@ -0,0 +1,78 @@
+package board
+
+import "testing"
+
+func TestAutoBrightnessCurve(t *testing.T) {
+	a := NewAutoBrightness(DefaultBrightnessCurve)
+	a.Smoothing = 1
+	for _, tc := range []struct {
+		light uint32
+		level int
+	}{
+		{0, 10},     // first point
+		{50, 20},    // halfway between the first two points
+		{100, 30},   // second point
+		{350, 65},   // halfway between the last two points
+		{1000, 100}, // past the last point
+		{0, 10},
+	} {
+		if level, _ := a.next(tc.light, 100); level != tc.level {
+			t.Errorf("light %d: expected level %d, got %d", tc.light, tc.level, level)
+		}
+	}
+}
+
+func TestAutoBrightnessLevels(t *testing.T) {
+	// The level is never 0, even in the dark.
+	a := NewAutoBrightness([]BrightnessPoint{{Light: 0, Brightness: 0}, {Light: 1000, Brightness: 100}})
+	if level, changed := a.next(0, 1); level != 1 || !changed {
+		t.Errorf("expected level 1 to be set, got %d (changed=%v)", level, changed)
+	}
+
+	// With only one level, it never changes.
+	if level, changed := a.next(1000, 1); level != 1 || changed {
+		t.Errorf("expected level 1 to stay, got %d (changed=%v)", level, changed)
+	}
+
+	// Without brightness control, nothing is set.
+	a = NewAutoBrightness(DefaultBrightnessCurve)
+	if _, changed := a.next(500, 0); changed {
+		t.Error("brightness changed on a display without brightness control")
+	}
+}
+
+func TestAutoBrightnessStable(t *testing.T) {
+	// Light levels that jitter around the boundary between two levels must
+	// not cause flickering.
+	a := NewAutoBrightness([]BrightnessPoint{{Light: 0, Brightness: 0}, {Light: 1000, Brightness: 100}})
+	a.Smoothing = 1
+	a.next(150, 10) // level 1.5, rounded to 2
+	for _, light := range []uint32{140, 160, 145, 155, 130, 170} {
+		if level, changed := a.next(light, 10); changed {
+			t.Errorf("light %d: level changed to %d", light, level)
+		}
+	}
+
+	// A real change does change the level.
+	if level, changed := a.next(300, 10); level != 3 || !changed {
+		t.Errorf("expected level 3, got %d (changed=%v)", level, changed)
+	}
+}
+
+func TestAutoBrightnessSmoothing(t *testing.T) {
+	a := NewAutoBrightness([]BrightnessPoint{{Light: 0, Brightness: 0}, {Light: 1000, Brightness: 100}})
+	a.next(1000, 100)
+
+	// A brief shadow over the sensor only has a small effect.
+	if level, _ := a.next(0, 100); level < 70 {
+		t.Errorf("expected a level of at least 70 after a single dark reading, got %d", level)
+	}
+
+	// When it stays dark, the level goes down.
+	for i := 0; i < 30; i++ {
+		a.next(0, 100)
+	}
+	if level := a.Level(); level > 5 {
+		t.Errorf("expected a level of at most 5 after a long dark period, got %d", level)
+	}
+}
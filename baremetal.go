@@ -0,0 +1,136 @@
+//go:build baremetal
+
+package board
+
+import (
+	"machine"
+	"time"
+
+	"tinygo.org/x/drivers"
+)
+
+// This file contains helpers that are shared between all baremetal boards (as
+// opposed to the simulator).
+
+func playScript(path string) error {
+	return ErrOnlySimulator
+}
+
+func recordInput(path string) error {
+	return ErrOnlySimulator
+}
+
+func injectSensorError(which drivers.Measurement, err error) {
+}
+
+func injectDisplayError(err error) {
+}
+
+func stallBus(duration time.Duration) {
+}
+
+func tornFrames() int {
+	return 0
+}
+
+func pauseSimulator() {
+}
+
+func stepSimulator() {
+}
+
+func resumeSimulator() {
+}
+
+func runInProcess(app func()) {
+	app()
+}
+
+// Kinds of input that can wake up waitForInput early.
+const (
+	wakeButtons    = iota // button presses captured using pin interrupts
+	wakeTouch             // the start of a touch
+	numWakeSources        // number of wake sources
+)
+
+// Functions that return whether input of the given kind arrived that hasn't
+// been read yet, or nil if the board doesn't have it (or it isn't configured).
+// They're set by the board when configuring the input, and must be cheap to
+// call because waitForInput polls them.
+var wakeSources [numWakeSources]func() bool
+
+// How often waitForInput checks the wake sources.
+const wakeSourceInterval = 10 * time.Millisecond
+
+// Wait for new input, or until the given duration has passed. Most input on
+// baremetal boards is read by polling, so only the inputs in wakeSources can
+// end the wait early. Those are checked every wakeSourceInterval, and TinyGo
+// puts the CPU in a low-power sleep mode in between. Without any wake sources,
+// this simply sleeps.
+func waitForInput(d time.Duration) {
+	deadline := time.Now().Add(d)
+	for {
+		armed := false
+		for _, pending := range wakeSources {
+			if pending == nil {
+				continue
+			}
+			if pending() {
+				return
+			}
+			armed = true
+		}
+		remaining := time.Until(deadline)
+		if remaining <= 0 {
+			return
+		}
+		if armed && remaining > wakeSourceInterval {
+			remaining = wakeSourceInterval
+		}
+		time.Sleep(remaining)
+	}
+}
+
+// Single-color status LED connected directly to a GPIO pin, with the anode on
+// the pin (so high means on).
+type gpioLED struct {
+	pin machine.Pin
+}
+
+// Configure the LED pin as an output, and turn the LED off.
+func (l gpioLED) Configure() {
+	l.pin.Configure(machine.PinConfig{Mode: machine.PinOutput})
+	l.pin.Low()
+}
+
+// Turn the LED on or off.
+func (l gpioLED) Set(on bool) {
+	l.pin.Set(on)
+}
+
+// Set the LED color. As this LED only has a single color, it is turned on for
+// any color except black.
+func (l gpioLED) SetColor(r, g, b uint8) {
+	l.Set(r != 0 || g != 0 || b != 0)
+}
+
+// Return the deadline for the given timeout, or the zero time if the timeout
+// is 0 (meaning no timeout).
+func deadlineAfter(timeout time.Duration) time.Time {
+	if timeout <= 0 {
+		return time.Time{}
+	}
+	return time.Now().Add(timeout)
+}
+
+// Busy wait while cond returns true. It returns false if the deadline (if
+// non-zero) passed before that, for example because a hardware signal never
+// arrived.
+func waitWhile(deadline time.Time, cond func() bool) bool {
+	for cond() {
+		if !deadline.IsZero() && time.Now().After(deadline) {
+			return false
+		}
+	}
+	return true
+}
@@ -3,8 +3,8 @@
 package board
 
 import (
+	"image/color"
 	"machine"
-	"math/bits"
 	"time"
 
 	"tinygo.org/x/drivers"
@@ -17,24 +17,66 @@ const (
 )
 
 var (
-	Power   = dummyBattery{state: UnknownBattery}
-	Sensors = baseSensors{}
-	Display = mainDisplay{}
-	Buttons = &gpioButtons{}
+	Power      = dummyBattery{state: UnknownBattery, shutdown: shutdown, reboot: reboot}
+	Sensors    = &dieSensors{}
+	Display    = mainDisplay{}
+	Buttons    = &gpioButtons{}
+	Watchdog   = noWatchdog{}
+	StatusLED  = gpioLED{pin: machine.LED}
+	Vibration  = noVibration{}
+	Speaker    = noSpeaker{}
+	Microphone = dummyMicrophone{}
+	Encoder    = dummyEncoder{}
 )
 
+func boardInfo() BoardInfo {
+	return BoardInfo{
+		DisplayWidth:  296,
+		DisplayHeight: 128,
+		Keys:          append([]Key(nil), codes[:6]...),
+		NeedsFlush:    true,
+	}
+}
+
+// Cut power to the board using the 3.3V enable pin, which keeps the power on
+// after the board was woken up by a button press. This only works on battery
+// power: over USB, the board keeps running.
+func shutdown() error {
+	machine.ENABLE_3V3.Configure(machine.PinConfig{Mode: machine.PinOutput})
+	machine.ENABLE_3V3.Low()
+
+	// Give the power supply some time to turn off. If we're still running
+	// after that, we're powered over USB.
+	time.Sleep(100 * time.Millisecond)
+	machine.ENABLE_3V3.High()
+	return ErrNoShutdown
+}
+
 type mainDisplay struct{}
 
+// Pixel format used by the display.
+type displayColor = pixel.Monochrome
+
+// Convert an sRGB color to the pixel format of the display, see Color. A set
+// pixel is black on this e-paper display.
+func convertDisplayColor(c color.RGBA) displayColor {
+	return convertEpaperColor(c)
+}
+
 func (d mainDisplay) PPI() int {
-	return 102 // 296px wide display / 2.9 inches wide display
+	return displayPPI(102) // 296px wide display / 2.9 inches wide display
 }
 
 func (d mainDisplay) Configure() Displayer[pixel.Monochrome] {
+	// The display is powered from the main 3.3V rail, which also powers the
+	// microcontroller. So it can't be powered off separately (see shutdown),
+	// but an e-paper display doesn't use power while it isn't updated anyway.
 	machine.ENABLE_3V3.Configure(machine.PinConfig{Mode: machine.PinOutput})
 	machine.ENABLE_3V3.High()
 
 	machine.SPI0.Configure(machine.SPIConfig{
-		Frequency: 12 * machine.MHz,
+		// No higher frequency is known to work with the UC8151.
+		Frequency: displaySPIFrequency(12*machine.MHz, 12*machine.MHz),
 		SCK:       machine.EPD_SCK_PIN,
 		SDO:       machine.EPD_SDO_PIN,
 	})
@@ -64,45 +106,65 @@ func (d mainDisplay) WaitForVBlank(defaultInterval time.Duration) {
 	dummyWaitForVBlank(defaultInterval)
 }
 
+func (d mainDisplay) WaitForVBlankTimeout(defaultInterval, timeout time.Duration) bool {
+	endFrame()
+	return dummyWaitForVBlankTimeout(defaultInterval, timeout)
+}
+
+func (d mainDisplay) LastFrameDuration() time.Duration {
+	return lastFrameDuration()
+}
+
+// DrawBitmap only writes to the framebuffer of the driver, see
+// DrawTimeEstimate.
+func drawTimeEstimate(pixels int) time.Duration {
+	return 0
+}
+
 func (d mainDisplay) ConfigureTouch() TouchInput {
 	return noTouch{}
 }
 
 type gpioButtons struct {
-	state         uint8
-	previousState uint8
+	buttonState
+}
+
+// Button pins, in the same order as codes. The buttons are active low.
+var buttonPins = [6]machine.Pin{
+	machine.BUTTON_A,
+	machine.BUTTON_B,
+	machine.BUTTON_C,
+	machine.BUTTON_UP,
+	machine.BUTTON_DOWN,
+	machine.BUTTON_USER,
 }
 
 func (b *gpioButtons) Configure() {
-	machine.BUTTON_A.Configure(machine.PinConfig{Mode: machine.PinInput})
-	machine.BUTTON_B.Configure(machine.PinConfig{Mode: machine.PinInput})
-	machine.BUTTON_C.Configure(machine.PinConfig{Mode: machine.PinInput})
-	machine.BUTTON_UP.Configure(machine.PinConfig{Mode: machine.PinInput})
-	machine.BUTTON_DOWN.Configure(machine.PinConfig{Mode: machine.PinInput})
-	machine.BUTTON_USER.Configure(machine.PinConfig{Mode: machine.PinInput})
+	for _, pin := range buttonPins {
+		pin.Configure(machine.PinConfig{Mode: machine.PinInput})
+	}
+	if ButtonSettings.CaptureEdges {
+		captureButtonEdges(buttonPins[:])
+	}
 }
 
 func (b *gpioButtons) ReadInput() {
+	// Take the edges before reading the pins. Otherwise a press right after
+	// the pins were read would be taken as an edge (and reported as a short
+	// press and release) and then be reported again from the pins in the next
+	// call.
+	edges := takeButtonEdges()
 	state := uint8(0)
-	if !machine.BUTTON_A.Get() {
-		state |= 1
-	}
-	if !machine.BUTTON_B.Get() {
-		state |= 2
-	}
-	if !machine.BUTTON_C.Get() {
-		state |= 4
-	}
-	if !machine.BUTTON_UP.Get() {
-		state |= 8
-	}
-	if !machine.BUTTON_DOWN.Get() {
-		state |= 16
+	for i, pin := range buttonPins {
+		if !pin.Get() {
+			state |= 1 << i
+		}
 	}
-	if !machine.BUTTON_USER.Get() {
-		state |= 32
-	}
-	b.state = state
+	b.read(state, edges)
+}
+
+func (b *gpioButtons) Snapshot() {
+	b.ReadInput()
 }
 
 var codes = [8]Key{
@@ -115,25 +177,13 @@ var codes = [8]Key{
 }
 
 func (b *gpioButtons) NextEvent() KeyEvent {
-	// The xor between the previous state and the current state is the buttons
-	// that changed.
-	change := b.state ^ b.previousState
-	if change == 0 {
-		return NoKeyEvent
-	}
-
-	// Find the index of the button with the lowest index that changed state.
-	index := bits.TrailingZeros32(uint32(change))
-	e := KeyEvent(codes[index])
-	if b.state&(1<<index) == 0 {
-		// The button state change was from 1 to 0, so it was released.
-		e |= keyReleased
-	}
+	return b.nextEvent(&codes)
+}
 
-	// This button event was read, so mark it as such.
-	// By toggling the bit, the bit will be set to the value that is currently
-	// in b.state.
-	b.previousState ^= (1 << index)
+func (b *gpioButtons) PeekEvent() KeyEvent {
+	return b.peekEvent(&codes)
+}
 
-	return e
+func (b *gpioButtons) Remap(index int, key Key) {
+	remapKey(codes[:6], index, key)
 }
@@ -4,7 +4,7 @@ package board
 
 import (
 	"device/gba"
-	"errors"
+	"image/color"
 	"math/bits"
 	"runtime/volatile"
 	"time"
@@ -19,16 +19,38 @@ const (
 )
 
 var (
-	Power   = dummyBattery{state: UnknownBattery}
-	Sensors = baseSensors{}
-	Display = mainDisplay{}
-	Buttons = &gbaButtons{}
+	Power      = dummyBattery{state: UnknownBattery}
+	Sensors    = baseSensors{}
+	Display    = mainDisplay{}
+	Buttons    = &gbaButtons{}
+	Watchdog   = noWatchdog{}
+	StatusLED  = noStatusLED{}
+	Vibration  = noVibration{}
+	Speaker    = noSpeaker{}
+	Microphone = dummyMicrophone{}
+	Encoder    = dummyEncoder{}
 )
 
+func boardInfo() BoardInfo {
+	return BoardInfo{
+		DisplayWidth:  displayWidth,
+		DisplayHeight: displayHeight,
+		Keys:          append([]Key(nil), codes[:10]...),
+	}
+}
+
 type mainDisplay struct{}
 
+// Pixel format used by the display.
+type displayColor = pixel.RGB555
+
+// Convert an sRGB color to the pixel format of the display, see Color.
+func convertDisplayColor(c color.RGBA) displayColor {
+	return convertColor[displayColor](c)
+}
+
 func (d mainDisplay) PPI() int {
-	return 99
+	return displayPPI(99)
 }
 
 func (d mainDisplay) Configure() Displayer[pixel.RGB555] {
@@ -47,11 +69,26 @@ func (d mainDisplay) SetBrightness(level int) {
 }
 
 func (d mainDisplay) WaitForVBlank(time.Duration) {
+	d.WaitForVBlankTimeout(0, 0)
+}
+
+func (d mainDisplay) WaitForVBlankTimeout(defaultInterval, timeout time.Duration) bool {
+	endFrame()
 	// Wait until the VBlank flag is set.
 	// TODO: sleep until the next VBlank instead of busy waiting.
 	// (See VBlankIntrWait)
-	for gba.DISP.DISPSTAT.Get()&(1<<gba.DISPSTAT_VBLANK_Pos) == 0 {
-	}
+	return waitWhile(deadlineAfter(timeout), func() bool {
+		return gba.DISP.DISPSTAT.Get()&(1<<gba.DISPSTAT_VBLANK_Pos) == 0
+	})
+}
+
+func (d mainDisplay) LastFrameDuration() time.Duration {
+	return lastFrameDuration()
+}
+
+// The framebuffer is in VRAM, so drawing is only a memory copy.
+func drawTimeEstimate(pixels int) time.Duration {
+	return 0
 }
 
 func (d mainDisplay) ConfigureTouch() TouchInput {
@@ -62,8 +99,6 @@ type gbaDisplay struct{}
 
 var displayFrameBuffer = (*[160 * 240]volatile.Register16)(unsafe.Pointer(uintptr(gba.MEM_VRAM)))
 
-var errOutOfBounds = errors.New("rectangle coordinates outside display area")
-
 const (
 	displayWidth  = 240
 	displayHeight = 160
@@ -80,9 +115,13 @@ func (d gbaDisplay) Display() error {
 
 func (d gbaDisplay) DrawBitmap(x, y int16, buf pixel.Image[pixel.RGB555]) error {
 	width, height := buf.Size()
-	if x < 0 || y < 0 || int(x)+width > displayWidth || int(y)+height > displayHeight {
-		return errOutOfBounds
+	if !fitsDisplay(x, y, width, height, displayWidth, displayHeight) {
+		if DisplaySettings.ClipDrawBitmap {
+			return drawClipped(x, y, buf, displayWidth, displayHeight, d.DrawBitmap)
+		}
+		return ErrOutOfBounds
 	}
+	defer addFrameTime(time.Now())
 
 	// TODO: try to do a 4-byte memcpy if possible. That should significantly
 	// speed up the copying of this image.
@@ -96,18 +135,25 @@ func (d gbaDisplay) DrawBitmap(x, y int16, buf pixel.Image[pixel.RGB555]) error
 	return nil
 }
 
+// Set a single pixel in VRAM.
+func (d gbaDisplay) SetPixel(x, y int16, c pixel.RGB555) error {
+	if draw, err := checkPixel(x, y, displayWidth, displayHeight); !draw {
+		return err
+	}
+	displayFrameBuffer[int(y)*displayWidth+int(x)].Set(uint16(c))
+	return nil
+}
+
 func (d gbaDisplay) Sleep(sleepEnabled bool) error {
 	return nil // nothign to do here
 }
 
-var errNoRotation = errors.New("error: SetRotation isn't supported")
-
 func (d gbaDisplay) Rotation() drivers.Rotation {
 	return drivers.Rotation0
 }
 
 func (d gbaDisplay) SetRotation(rotation drivers.Rotation) error {
-	return errNoRotation
+	return ErrRotationUnsupported
 }
 
 type gbaButtons struct {
@@ -123,6 +169,10 @@ func (b *gbaButtons) ReadInput() {
 	b.state = gba.KEY.INPUT.Get() ^ 0x3ff
 }
 
+func (b *gbaButtons) Snapshot() {
+	b.ReadInput()
+}
+
 var codes = [16]Key{
 	KeyA,
 	KeyB,
@@ -159,3 +209,12 @@ func (b *gbaButtons) NextEvent() KeyEvent {
 
 	return e
 }
+
+func (b *gbaButtons) PeekEvent() KeyEvent {
+	state := *b
+	return state.NextEvent()
+}
+
+func (b *gbaButtons) Remap(index int, key Key) {
+	remapKey(codes[:10], index, key)
+}
@@ -3,8 +3,8 @@
 package board
 
 import (
+	"image/color"
 	"machine"
-	"math/bits"
 	"time"
 
 	"tinygo.org/x/drivers"
@@ -19,10 +19,16 @@ const (
 )
 
 var (
-	Power   = dummyBattery{state: UnknownBattery}
-	Sensors = &allSensors{}
-	Display = mainDisplay{}
-	Buttons = &gpioButtons{}
+	Power      = dummyBattery{state: UnknownBattery, reboot: reboot}
+	Sensors    = &allSensors{}
+	Display    = mainDisplay{}
+	Buttons    = &gpioButtons{}
+	Watchdog   = noWatchdog{}
+	StatusLED  = noStatusLED{}
+	Vibration  = noVibration{}
+	Speaker    = noSpeaker{}
+	Microphone = dummyMicrophone{}
+	Encoder    = dummyEncoder{}
 )
 
 func init() {
@@ -32,50 +38,124 @@ func init() {
 type allSensors struct {
 	baseSensors
 	accelX, accelY, accelZ int32
+	samples                accelBuffer // for ReadAccelBuffer
+	temp                   int32       // die temperature, see dieSensors
 }
 
-var accel lis3dh.Device
+var (
+	accel     lis3dh.Device
+	accelOnce configureOnce
+	i2cOnce   configureOnce
+)
 
-func (s *allSensors) Configure(which drivers.Measurement) error {
-	if which&(drivers.Acceleration|drivers.Temperature) != 0 {
-		machine.I2C0.Configure(machine.I2CConfig{
+// Configure the I2C bus of the accelerometer, if not already done.
+func configureI2C() {
+	i2cOnce.do(func() error {
+		return machine.I2C0.Configure(machine.I2CConfig{
 			Frequency: 400 * machine.KHz,
 			SCL:       machine.I2C0_SCL_PIN,
 			SDA:       machine.I2C0_SDA_PIN,
 		})
-		accel = lis3dh.New(machine.I2C0)
-		accel.Configure()
+	})
+}
+
+// Available returns the sensors that respond, by checking the WHO_AM_I
+// register of the accelerometer. The temperature sensor inside the RP2040 isn't
+// included, see dieSensors.
+func (s *allSensors) Available() drivers.Measurement {
+	configureI2C()
+	device := lis3dh.New(machine.I2C0)
+	if !device.Connected() {
+		return 0
+	}
+	return drivers.Acceleration
+}
+
+func (s *allSensors) Configure(which drivers.Measurement) error {
+	if which&drivers.Temperature != 0 {
+		configureDieTemperature()
+	}
+	if which&drivers.Acceleration != 0 {
+		return accelOnce.do(func() error {
+			configureI2C()
+			accel = lis3dh.New(machine.I2C0)
+			if !accel.Connected() {
+				return ErrSensorNotFound
+			}
+			accel.Configure()
+			return nil
+		})
 	}
 	return nil
 }
 
 func (s *allSensors) Update(which drivers.Measurement) error {
+	if which&drivers.Temperature != 0 {
+		// The LIS3DH has a temperature sensor too, but it only measures
+		// relative changes. So use the sensor inside the RP2040 instead.
+		s.temp = readDieTemperature()
+	}
 	if which&drivers.Acceleration != 0 {
+		if !accelOnce.done {
+			return ErrSensorNotFound
+		}
 		var err error
 		s.accelX, s.accelY, s.accelZ, err = accel.ReadAcceleration()
 		if err != nil {
 			return err
 		}
+		s.samples.push(s.Acceleration())
 	}
-	// TODO: read the temperature from the LIS3DH.
-	// I tried reading it uisng machine.ReadTemperature() but it was so
-	// inaccurate that it wasn't even usable (around -23°C in a >25°C room).
 	return nil
 }
 
+// Mapping from the LIS3DH axes to the standard axes.
+var accelAxes = AxisMapping{1, -2, -3}
+
 func (s *allSensors) Acceleration() (x, y, z int32) {
-	// Adjust accelerometer to match standard axes.
-	x = s.accelX
-	y = -s.accelY
-	z = -s.accelZ
-	return
+	return mapAcceleration(accelAxes, s.accelX, s.accelY, s.accelZ)
+}
+
+// Temperature returns the temperature of the RP2040 die in milli-degrees
+// Celsius, see dieSensors for how accurate it is.
+func (s *allSensors) Temperature() int32 {
+	return s.temp
+}
+
+// ReadAccelBuffer returns the samples that were read in Update since the last
+// call. The FIFO of the LIS3DH isn't used, see accelfifo.go.
+func (s *allSensors) ReadAccelBuffer(buf [][3]int32) (int, error) {
+	return s.samples.read(buf), nil
+}
+
+func boardInfo() BoardInfo {
+	return BoardInfo{
+		DisplayWidth:  320,
+		DisplayHeight: 240,
+		Sensors:       drivers.Acceleration,
+		Keys:          append([]Key(nil), codes[:6]...),
+		HasLEDs:       true,
+	}
 }
 
 type mainDisplay struct{}
 
+// Pixel format used by the display.
+type displayColor = pixel.RGB565BE
+
+// Convert an sRGB color to the pixel format of the display, see Color.
+func convertDisplayColor(c color.RGBA) displayColor {
+	return convertColor[displayColor](c)
+}
+
 var display st7789.DeviceOf[pixel.RGB565BE]
 
+// SPI frequency used for the display.
+var displayFrequency uint32
+
 func (d mainDisplay) Configure() Displayer[pixel.RGB565BE] {
+	// The datasheet for st7789 says 16ns (62.5MHz) is the max clock speed.
+	displayFrequency = displaySPIFrequency(62_500_000, 62_500_000)
 	machine.SPI0.Configure(machine.SPIConfig{
 		// Mode 3 appears to be compatible with mode 0, but is slightly
 		// faster: each byte takes 9 clock cycles instead of 10.
@@ -89,7 +169,7 @@ func (d mainDisplay) Configure() Displayer[pixel.RGB565BE] {
 		SCK:       machine.SPI0_SCK_PIN,
 		SDO:       machine.SPI0_SDO_PIN,
 		SDI:       machine.SPI0_SDI_PIN,
-		Frequency: 62_500_000, // datasheet for st7789 says 16ns (62.5MHz) is the max clock speed
+		Frequency: displayFrequency,
 	})
 
 	display = st7789.NewOf[pixel.RGB565BE](machine.SPI0,
@@ -98,6 +178,7 @@ func (d mainDisplay) Configure() Displayer[pixel.RGB565BE] {
 		machine.TFT_CS,        // TFT_CS
 		machine.TFT_BACKLIGHT) // TFT_LITE
 
+	display.IsBGR(DisplaySettings.SwapRedBlue)
 	display.Configure(st7789.Config{
 		Rotation: st7789.ROTATION_270,
 		Height:   320,
@@ -109,36 +190,74 @@ func (d mainDisplay) Configure() Displayer[pixel.RGB565BE] {
 		NVGAMCTRL: []byte{0xF0, 0x07, 0x0A, 0x0D, 0x0B, 0x07, 0x28, 0x33, 0x3E, 0x36, 0x14, 0x14, 0x29, 0x32},
 	})
 	display.EnableBacklight(false)
+	displayBacklight.setInitialBrightness(d.MaxBrightness())
+
+	return sleepDisplay{&display}
+}
+
+// Wrapper for the display driver that turns off the backlight while sleeping,
+// and clips images when needed.
+type sleepDisplay struct {
+	*st7789.DeviceOf[pixel.RGB565BE]
+}
+
+// Draw the image, clipping it if DisplaySettings.ClipDrawBitmap is enabled.
+func (d sleepDisplay) DrawBitmap(x, y int16, buf pixel.Image[pixel.RGB565BE]) error {
+	width, height := d.Size()
+	return drawBitmapClipped(x, y, buf, width, height, d.DeviceOf.DrawBitmap)
+}
 
-	return &display
+// Set sleep mode for the display. The backlight is turned off while sleeping.
+func (d sleepDisplay) Sleep(sleepEnabled bool) error {
+	return displayBacklight.sleep(sleepEnabled, d.DeviceOf.Sleep)
 }
 
 func (d mainDisplay) MaxBrightness() int {
 	return 1
 }
 
+var displayBacklight = backlight{
+	set: func(level int) {
+		machine.TFT_BACKLIGHT.Set(level > 0)
+	},
+}
+
 func (d mainDisplay) SetBrightness(level int) {
-	machine.TFT_BACKLIGHT.Set(level > 0)
+	displayBacklight.setBrightness(level)
 }
 
 func (d mainDisplay) WaitForVBlank(defaultInterval time.Duration) {
+	d.WaitForVBlankTimeout(defaultInterval, 0)
+}
+
+func (d mainDisplay) WaitForVBlankTimeout(defaultInterval, timeout time.Duration) bool {
+	endFrame()
 	// Lower the SPI frequency for reading: the ST7789 supports high frequency
 	// writes but reading is much slower.
 	machine.SPI0.SetBaudRate(10_000_000)
 
 	// Wait until the scanline wraps around to 0.
 	// This is also what the TE line does internally.
-	for display.GetScanLine() == 0 {
-	}
-	for display.GetScanLine() != 0 {
-	}
+	deadline := deadlineAfter(timeout)
+	ok := waitWhile(deadline, func() bool { return display.GetScanLine() == 0 }) &&
+		waitWhile(deadline, func() bool { return display.GetScanLine() != 0 })
 
 	// Restore old baud rate.
-	machine.SPI0.SetBaudRate(62_500_000)
+	machine.SPI0.SetBaudRate(displayFrequency)
+	return ok
+}
+
+func (d mainDisplay) LastFrameDuration() time.Duration {
+	return lastFrameDuration()
+}
+
+// Each byte takes 9 clock cycles in SPI mode 3, see Configure.
+func drawTimeEstimate(pixels int) time.Duration {
+	return busDrawTime(pixels, 16, displayFrequency, 9)
 }
 
 func (d mainDisplay) PPI() int {
-	return 166 // 320px / (48.96mm / 25.4)
+	return displayPPI(166) // 320px / (48.96mm / 25.4)
 }
 
 func (d mainDisplay) ConfigureTouch() TouchInput {
@@ -146,40 +265,45 @@ func (d mainDisplay) ConfigureTouch() TouchInput {
 }
 
 type gpioButtons struct {
-	state         uint8
-	previousState uint8
+	buttonState
+}
+
+// Button pins, in the same order as codes. The buttons are active low.
+var buttonPins = [6]machine.Pin{
+	machine.BUTTON_A,
+	machine.BUTTON_B,
+	machine.BUTTON_UP,
+	machine.BUTTON_LEFT,
+	machine.BUTTON_DOWN,
+	machine.BUTTON_RIGHT,
 }
 
 func (b *gpioButtons) Configure() {
-	machine.BUTTON_A.Configure(machine.PinConfig{Mode: machine.PinInput})
-	machine.BUTTON_B.Configure(machine.PinConfig{Mode: machine.PinInput})
-	machine.BUTTON_UP.Configure(machine.PinConfig{Mode: machine.PinInput})
-	machine.BUTTON_LEFT.Configure(machine.PinConfig{Mode: machine.PinInput})
-	machine.BUTTON_DOWN.Configure(machine.PinConfig{Mode: machine.PinInput})
-	machine.BUTTON_RIGHT.Configure(machine.PinConfig{Mode: machine.PinInput})
+	for _, pin := range buttonPins {
+		pin.Configure(machine.PinConfig{Mode: machine.PinInput})
+	}
+	if ButtonSettings.CaptureEdges {
+		captureButtonEdges(buttonPins[:])
+	}
 }
 
 func (b *gpioButtons) ReadInput() {
+	// Take the edges before reading the pins. Otherwise a press right after
+	// the pins were read would be taken as an edge (and reported as a short
+	// press and release) and then be reported again from the pins in the next
+	// call.
+	edges := takeButtonEdges()
 	state := uint8(0)
-	if !machine.BUTTON_A.Get() {
-		state |= 1
-	}
-	if !machine.BUTTON_B.Get() {
-		state |= 2
-	}
-	if !machine.BUTTON_UP.Get() {
-		state |= 4
-	}
-	if !machine.BUTTON_LEFT.Get() {
-		state |= 8
-	}
-	if !machine.BUTTON_DOWN.Get() {
-		state |= 16
-	}
-	if !machine.BUTTON_RIGHT.Get() {
-		state |= 32
+	for i, pin := range buttonPins {
+		if !pin.Get() {
+			state |= 1 << i
+		}
 	}
-	b.state = state
+	b.read(state, edges)
+}
+
+func (b *gpioButtons) Snapshot() {
+	b.ReadInput()
 }
 
 var codes = [8]Key{
@@ -192,31 +316,22 @@ var codes = [8]Key{
 }
 
 func (b *gpioButtons) NextEvent() KeyEvent {
-	// The xor between the previous state and the current state is the buttons
-	// that changed.
-	change := b.state ^ b.previousState
-	if change == 0 {
-		return NoKeyEvent
-	}
-
-	// Find the index of the button with the lowest index that changed state.
-	index := bits.TrailingZeros32(uint32(change))
-	e := KeyEvent(codes[index])
-	if b.state&(1<<index) == 0 {
-		// The button state change was from 1 to 0, so it was released.
-		e |= keyReleased
-	}
+	return b.nextEvent(&codes)
+}
 
-	// This button event was read, so mark it as such.
-	// By toggling the bit, the bit will be set to the value that is currently
-	// in b.state.
-	b.previousState ^= (1 << index)
+func (b *gpioButtons) PeekEvent() KeyEvent {
+	return b.peekEvent(&codes)
+}
 
-	return e
+func (b *gpioButtons) Remap(index int, key Key) {
+	remapKey(codes[:6], index, key)
 }
 
 type ws2812LEDs struct {
-	data [2]colorGRB
+	data   [2]colorGRB
+	dirty  bool  // changed since the last update
+	dim    uint8 // 255 minus the brightness, so the zero value is full brightness
+	asleep bool  // turned off using Sleep
 }
 
 func (l *ws2812LEDs) Configure() {
@@ -228,15 +343,49 @@ func (l *ws2812LEDs) Len() int {
 }
 
 func (l *ws2812LEDs) SetRGB(i int, r, g, b uint8) {
-	l.data[i] = colorGRB{
+	c := colorGRB{
 		R: r,
 		G: g,
 		B: b,
 	}
+	if l.data[i] != c {
+		l.data[i] = c
+		l.dirty = true
+	}
 }
 
-// Send pixel data to the LEDs.
+func (l *ws2812LEDs) SetBrightness(brightness uint8) {
+	if l.dim != 255-brightness {
+		l.dim = 255 - brightness
+		l.dirty = true
+	}
+}
+
+// Send pixel data to the LEDs, if it changed.
 func (l *ws2812LEDs) Update() {
+	if l.dirty && !l.asleep {
+		l.ForceUpdate()
+	}
+}
+
+// Send pixel data to the LEDs.
+func (l *ws2812LEDs) ForceUpdate() {
+	var scaled [len(l.data)]colorGRB
+	buf := pixelsToBytes(scaled[:])
+	brightness := 255 - l.dim
+	if l.asleep {
+		brightness = 0
+	}
+	scaleLEDBrightness(buf, pixelsToBytes(l.data[:]), brightness)
 	ws := ws2812.Device{Pin: machine.WS2812}
-	ws.Write(pixelsToBytes(l.data[:]))
+	ws.Write(buf)
+	l.dirty = false
+}
+
+// There is no way to cut the power to the LEDs on this board, so they are
+// only turned off. They still draw a little bit of current while off.
+func (l *ws2812LEDs) Sleep(sleepEnabled bool) error {
+	l.asleep = sleepEnabled
+	l.ForceUpdate()
+	return nil
 }
@@ -0,0 +1,438 @@
+//go:build macropad_rp2040
+
+package board
+
+import (
+	"image/color"
+	"machine"
+	"time"
+
+	"tinygo.org/x/drivers"
+	"tinygo.org/x/drivers/pixel"
+	"tinygo.org/x/drivers/sh1106"
+	"tinygo.org/x/drivers/ws2812"
+)
+
+// The Adafruit MacroPad RP2040 has 12 mechanical keys (each with an RGB LED
+// underneath), a rotary encoder with a push switch, and a 128x64 OLED display.
+//
+// The keys are reported as KeyF1 to KeyF12, from the top left to the bottom
+// right. The rotary encoder is reported as key events too: every step clockwise
+// is a press and release of KeyDown, every step counterclockwise of KeyUp, and
+// pushing the encoder is KeyEnter. This way, the encoder can be used to
+// navigate a menu without special code. Use Buttons.Remap to change any of
+// these. The encoder can also be read directly using Encoder.Read, which is
+// independent of these key events.
+
+const (
+	Name = "macropad-rp2040"
+)
+
+var (
+	Power      = dummyBattery{state: NoBattery, reboot: reboot}
+	Sensors    = &dieSensors{}
+	Display    = mainDisplay{}
+	Buttons    = &keypadButtons{}
+	Watchdog   = noWatchdog{}
+	StatusLED  = gpioLED{pin: machine.GPIO13}
+	Vibration  = noVibration{}
+	Speaker    = pwmSpeaker{}
+	Microphone = dummyMicrophone{}
+	Encoder    = &rotaryEncoder{}
+)
+
+func init() {
+	AddressableLEDs = &ws2812LEDs{}
+}
+
+func boardInfo() BoardInfo {
+	return BoardInfo{
+		DisplayWidth:  128,
+		DisplayHeight: 64,
+		Keys:          append([]Key(nil), codes[:15]...),
+		HasLEDs:       true,
+		HasEncoder:    true,
+		NeedsFlush:    true,
+	}
+}
+
+// Small speaker with an amplifier, driven using PWM. The amplifier is enabled
+// using a separate pin.
+type pwmSpeaker struct{}
+
+const (
+	speakerPin       = machine.GPIO16
+	speakerEnablePin = machine.GPIO14
+)
+
+func (s pwmSpeaker) Configure() {
+	speakerEnablePin.Configure(machine.PinConfig{Mode: machine.PinOutput})
+	speakerEnablePin.Low()
+	machine.PWM0.Configure(machine.PWMConfig{})
+}
+
+func (s pwmSpeaker) Tone(frequency uint32, duration time.Duration) {
+	<-s.StartTone(frequency, duration)
+}
+
+var speakerPlayer tonePlayer
+
+// Start playing a tone in the background. A new tone cuts off the current one.
+// The amplifier is only enabled while a tone is playing.
+func (s pwmSpeaker) StartTone(frequency uint32, duration time.Duration) <-chan struct{} {
+	pwm := machine.PWM0
+	ch, err := pwm.Channel(speakerPin)
+	return speakerPlayer.play(duration, func() {
+		if err != nil || frequency == 0 {
+			pwm.Set(ch, 0)
+			speakerEnablePin.Low()
+			return
+		}
+		pwm.SetPeriod(uint64(time.Second) / uint64(frequency))
+		pwm.Set(ch, pwm.Top()/2) // square wave
+		speakerEnablePin.High()
+	}, func() {
+		pwm.Set(ch, 0)
+		speakerEnablePin.Low()
+	})
+}
+
+func (s pwmSpeaker) PlayNote(note uint8, duration time.Duration) {
+	playNote(s, note, duration)
+}
+
+func (s pwmSpeaker) PlaySequence(notes []Note) {
+	playSequence(s, notes)
+}
+
+type mainDisplay struct{}
+
+// Pixel format used by the display.
+type displayColor = pixel.Monochrome
+
+// Convert an sRGB color to the pixel format of the display, see Color.
+func convertDisplayColor(c color.RGBA) displayColor {
+	return convertColor[displayColor](c)
+}
+
+func (d mainDisplay) PPI() int {
+	return displayPPI(110) // 128px / (29.42mm / 25.4)
+}
+
+func (d mainDisplay) Configure() Displayer[pixel.Monochrome] {
+	machine.SPI1.Configure(machine.SPIConfig{
+		// The SH1106 supports up to 4MHz (250ns clock cycle).
+		Frequency: displaySPIFrequency(4*machine.MHz, 4*machine.MHz),
+		SCK:       machine.GPIO26,
+		SDO:       machine.GPIO27,
+		SDI:       machine.GPIO28,
+	})
+
+	// The display is often described as an SSD1306, but it's actually an
+	// SH1106 which is similar but needs a different driver.
+	display := sh1106.NewSPI(machine.SPI1, machine.GPIO24, machine.GPIO23, machine.GPIO22)
+	display.Configure(sh1106.Config{
+		Width:  128,
+		Height: 64,
+	})
+	display.ClearDisplay()
+
+	return oledDisplay{&display}
+}
+
+// Wrapper for the OLED display driver, which only provides the basics.
+type oledDisplay struct {
+	*sh1106.Device
+}
+
+// Draw the image, clipping it if DisplaySettings.ClipDrawBitmap is enabled.
+func (d oledDisplay) DrawBitmap(x, y int16, buf pixel.Image[pixel.Monochrome]) error {
+	width, height := d.Size()
+	return drawBitmapClipped(x, y, buf, width, height, d.drawBitmap)
+}
+
+func (d oledDisplay) drawBitmap(x, y int16, buf pixel.Image[pixel.Monochrome]) error {
+	width, height := d.Size()
+	return drawBitmapPixels(x, y, buf, width, height, d.SetPixel)
+}
+
+// Turn the display off while sleeping. The contents of the display are kept.
+func (d oledDisplay) Sleep(sleepEnabled bool) error {
+	if sleepEnabled {
+		d.Command(sh1106.DISPLAYOFF)
+	} else {
+		d.Command(sh1106.DISPLAYON)
+	}
+	return nil
+}
+
+func (d oledDisplay) Rotation() drivers.Rotation {
+	return drivers.Rotation0
+}
+
+func (d oledDisplay) SetRotation(rotation drivers.Rotation) error {
+	if rotation != drivers.Rotation0 {
+		return ErrRotationUnsupported
+	}
+	return nil
+}
+
+func (d mainDisplay) MaxBrightness() int {
+	return 0
+}
+
+func (d mainDisplay) SetBrightness(level int) {
+	// The OLED display has no backlight.
+}
+
+func (d mainDisplay) WaitForVBlank(defaultInterval time.Duration) {
+	dummyWaitForVBlank(defaultInterval)
+}
+
+func (d mainDisplay) WaitForVBlankTimeout(defaultInterval, timeout time.Duration) bool {
+	endFrame()
+	return dummyWaitForVBlankTimeout(defaultInterval, timeout)
+}
+
+func (d mainDisplay) LastFrameDuration() time.Duration {
+	return lastFrameDuration()
+}
+
+// DrawBitmap only writes to the framebuffer of the driver, see
+// DrawTimeEstimate.
+func drawTimeEstimate(pixels int) time.Duration {
+	return 0
+}
+
+func (d mainDisplay) ConfigureTouch() TouchInput {
+	return noTouch{}
+}
+
+// The 12 keys and the rotary encoder. There are more buttons than fit in a
+// single buttonState, so the first 8 keys are tracked in one and the rest
+// (including the encoder) in the other.
+type keypadButtons struct {
+	keys  buttonState
+	other buttonState
+
+	position int // encoder position at the last read
+	steps    int // encoder steps that weren't reported yet
+}
+
+// Key pins, in the same order as codes. The keys are active low.
+var keyPins = [12]machine.Pin{
+	machine.GPIO1,
+	machine.GPIO2,
+	machine.GPIO3,
+	machine.GPIO4,
+	machine.GPIO5,
+	machine.GPIO6,
+	machine.GPIO7,
+	machine.GPIO8,
+	machine.GPIO9,
+	machine.GPIO10,
+	machine.GPIO11,
+	machine.GPIO12,
+}
+
+// Pins of the rotary encoder. The push switch is active low, and is also the
+// BOOT button of the RP2040.
+const (
+	encoderPinA      = machine.GPIO17
+	encoderPinB      = machine.GPIO18
+	encoderSwitchPin = machine.GPIO0
+)
+
+var (
+	encoderOnce    configureOnce
+	encoderDecoder quadratureDecoder
+)
+
+// Configure the rotary encoder pins, if not already done. The encoder is
+// decoded in pin interrupts, so that no steps are missed.
+func configureEncoder() {
+	encoderOnce.do(func() error {
+		encoderSwitchPin.Configure(machine.PinConfig{Mode: machine.PinInputPullup})
+		for _, pin := range [2]machine.Pin{encoderPinA, encoderPinB} {
+			pin.Configure(machine.PinConfig{Mode: machine.PinInputPullup})
+			pin.SetInterrupt(machine.PinToggle, func(machine.Pin) {
+				encoderDecoder.update(encoderPinA.Get(), encoderPinB.Get())
+			})
+		}
+		return nil
+	})
+}
+
+// The rotary encoder, as returned by Encoder.
+type rotaryEncoder struct {
+	position int // position at the last read
+}
+
+func (e *rotaryEncoder) Configure() {
+	configureEncoder()
+	e.position = encoderDecoder.steps()
+}
+
+// Read returns the number of steps since the last read (positive is clockwise)
+// and whether the encoder is pushed in.
+func (e *rotaryEncoder) Read() (delta int, pressed bool) {
+	position := encoderDecoder.steps()
+	delta = position - e.position
+	e.position = position
+	return delta, !encoderSwitchPin.Get()
+}
+
+// Bits in the second buttonState, after the last 4 keys.
+const (
+	encoderSwitchBit    = 1 << 4
+	encoderClockwiseBit = 1 << 5
+	encoderCounterBit   = 1 << 6
+)
+
+func (b *keypadButtons) Configure() {
+	for _, pin := range keyPins {
+		pin.Configure(machine.PinConfig{Mode: machine.PinInputPullup})
+	}
+	configureEncoder()
+	b.position = encoderDecoder.steps()
+}
+
+func (b *keypadButtons) ReadInput() {
+	var keys, other uint8
+	for i, pin := range keyPins {
+		if !pin.Get() {
+			if i < 8 {
+				keys |= 1 << i
+			} else {
+				other |= 1 << (i - 8)
+			}
+		}
+	}
+	if !encoderSwitchPin.Get() {
+		other |= encoderSwitchBit
+	}
+	b.keys.read(keys, 0)
+
+	// Report encoder steps one at a time, as a press and release of a key.
+	// Steps are queued while the previous step is still being reported, so
+	// that no steps are lost when turning the encoder quickly.
+	position := encoderDecoder.steps()
+	b.steps += position - b.position
+	b.position = position
+	var step uint8
+	if (b.other.previous|b.other.pulses)&(encoderClockwiseBit|encoderCounterBit) == 0 {
+		if b.steps > 0 {
+			step = encoderClockwiseBit
+			b.steps--
+		} else if b.steps < 0 {
+			step = encoderCounterBit
+			b.steps++
+		}
+	}
+	b.other.read(other, step)
+}
+
+func (b *keypadButtons) Snapshot() {
+	b.ReadInput()
+}
+
+var codes = [16]Key{
+	KeyF1,
+	KeyF2,
+	KeyF3,
+	KeyF4,
+	KeyF5,
+	KeyF6,
+	KeyF7,
+	KeyF8,
+	KeyF9,
+	KeyF10,
+	KeyF11,
+	KeyF12,
+	KeyEnter, // encoder switch
+	KeyDown,  // encoder clockwise
+	KeyUp,    // encoder counterclockwise
+}
+
+func (b *keypadButtons) NextEvent() KeyEvent {
+	if event := b.keys.nextEvent((*[8]Key)(codes[:8])); event != NoKeyEvent {
+		return event
+	}
+	return b.other.nextEvent((*[8]Key)(codes[8:]))
+}
+
+func (b *keypadButtons) PeekEvent() KeyEvent {
+	if event := b.keys.peekEvent((*[8]Key)(codes[:8])); event != NoKeyEvent {
+		return event
+	}
+	return b.other.peekEvent((*[8]Key)(codes[8:]))
+}
+
+func (b *keypadButtons) Remap(index int, key Key) {
+	remapKey(codes[:15], index, key)
+}
+
+type ws2812LEDs struct {
+	data   [12]colorGRB
+	dirty  bool  // changed since the last update
+	dim    uint8 // 255 minus the brightness, so the zero value is full brightness
+	asleep bool  // turned off using Sleep
+}
+
+const ledPin = machine.GPIO19
+
+func (l *ws2812LEDs) Configure() {
+	ledPin.Configure(machine.PinConfig{Mode: machine.PinOutput})
+}
+
+func (l *ws2812LEDs) Len() int {
+	return len(l.data)
+}
+
+func (l *ws2812LEDs) SetRGB(i int, r, g, b uint8) {
+	c := colorGRB{
+		R: r,
+		G: g,
+		B: b,
+	}
+	if l.data[i] != c {
+		l.data[i] = c
+		l.dirty = true
+	}
+}
+
+func (l *ws2812LEDs) SetBrightness(brightness uint8) {
+	if l.dim != 255-brightness {
+		l.dim = 255 - brightness
+		l.dirty = true
+	}
+}
+
+// Send pixel data to the LEDs, if it changed.
+func (l *ws2812LEDs) Update() {
+	if l.dirty && !l.asleep {
+		l.ForceUpdate()
+	}
+}
+
+// Send pixel data to the LEDs.
+func (l *ws2812LEDs) ForceUpdate() {
+	var scaled [len(l.data)]colorGRB
+	buf := pixelsToBytes(scaled[:])
+	brightness := 255 - l.dim
+	if l.asleep {
+		brightness = 0
+	}
+	scaleLEDBrightness(buf, pixelsToBytes(l.data[:]), brightness)
+	ws := ws2812.Device{Pin: ledPin}
+	ws.Write(buf)
+	l.dirty = false
+}
+
+// There is no way to cut the power to the LEDs on this board, so they are
+// only turned off. They still draw a little bit of current while off.
+func (l *ws2812LEDs) Sleep(sleepEnabled bool) error {
+	l.asleep = sleepEnabled
+	l.ForceUpdate()
+	return nil
+}
@@ -3,6 +3,7 @@
 package board
 
 import (
+	"image/color"
 	"machine"
 	"time"
 
@@ -16,30 +17,62 @@ const (
 )
 
 var (
-	Power   = dummyBattery{state: UnknownBattery} // unimplemented
-	Sensors = baseSensors{}
-	Display = mainDisplay{}
-	Buttons = noButtons{}
+	Power      = dummyBattery{state: UnknownBattery} // unimplemented
+	Sensors    = baseSensors{}
+	Display    = mainDisplay{}
+	Buttons    = noButtons{}
+	Watchdog   = noWatchdog{}
+	StatusLED  = noStatusLED{}
+	Vibration  = noVibration{}
+	Speaker    = noSpeaker{}
+	Microphone = dummyMicrophone{}
+	Encoder    = dummyEncoder{}
 )
 
 func init() {
 	AddressableLEDs = &ws2812LEDs{}
 }
 
+func boardInfo() BoardInfo {
+	return BoardInfo{
+		DisplayWidth:  320,
+		DisplayHeight: 240,
+		HasLEDs:       true,
+	}
+}
+
 type mainDisplay struct{}
 
+// Pixel format used by the display.
+type displayColor = pixel.RGB565BE
+
+// Convert an sRGB color to the pixel format of the display, see Color.
+func convertDisplayColor(c color.RGBA) displayColor {
+	return convertColor[displayColor](c)
+}
+
+// SPI frequency used for the display.
+var displayFrequency uint32
+
 func (d mainDisplay) Configure() Displayer[pixel.RGB565BE] {
 	machine.LCD_MODE.Configure(machine.PinConfig{Mode: machine.PinOutput})
 	machine.LCD_MODE.Low()
 
+	// This is probably overclocking the ILI9341 but it seems to work.
+	// 80MHz is also the maximum the ESP32 SPI peripheral supports.
+	displayFrequency = displaySPIFrequency(80_000_000, 80_000_000)
 	machine.SPI2.Configure(machine.SPIConfig{
-		Frequency: 80_000_000, // This is probably overclocking the ILI9341 but it seems to work.
+		Frequency: displayFrequency,
 		SCK:       18,
 		SDO:       23,
 		SDI:       35,
 	})
 
 	display := ili9341.NewSPI(machine.SPI2, machine.LCD_DC, machine.SPI0_CS_LCD_PIN, machine.LCD_RESET)
+	// TODO: support DisplaySettings.SwapRedBlue, see the PyPortal. 18-bit
+	// color (RGB666) isn't supported for the same reason. It would also need
+	// 3 instead of 2 bytes per pixel, which at 80MHz means a full screen
+	// update takes 23.0ms instead of 15.4ms.
 	display.Configure(ili9341.Config{
 		Rotation: ili9341.Rotation90,
 	})
@@ -61,8 +94,21 @@ func (d mainDisplay) WaitForVBlank(defaultInterval time.Duration) {
 	dummyWaitForVBlank(defaultInterval)
 }
 
+func (d mainDisplay) WaitForVBlankTimeout(defaultInterval, timeout time.Duration) bool {
+	endFrame()
+	return dummyWaitForVBlankTimeout(defaultInterval, timeout)
+}
+
+func (d mainDisplay) LastFrameDuration() time.Duration {
+	return lastFrameDuration()
+}
+
+func drawTimeEstimate(pixels int) time.Duration {
+	return busDrawTime(pixels, 16, displayFrequency, 8)
+}
+
 func (d mainDisplay) PPI() int {
-	return 166 // 320px / (48.96mm / 25.4)
+	return displayPPI(166) // 320px / (48.96mm / 25.4)
 }
 
 func (d mainDisplay) ConfigureTouch() TouchInput {
@@ -70,14 +116,19 @@ func (d mainDisplay) ConfigureTouch() TouchInput {
 }
 
 type ws2812LEDs struct {
-	data [5]colorGRB
+	data   [5]colorGRB
+	dirty  bool  // changed since the last update
+	dim    uint8 // 255 minus the brightness, so the zero value is full brightness
+	asleep bool  // powered off using Sleep
 }
 
+// Pin that enables the power to the LEDs. Nothing else is powered through it.
+const ledPowerPin = machine.PowerOn
+
 func (l *ws2812LEDs) Configure() {
 	// Enable power to the LEDs
-	power := machine.PowerOn
-	power.Configure(machine.PinConfig{Mode: machine.PinOutput})
-	power.High()
+	ledPowerPin.Configure(machine.PinConfig{Mode: machine.PinOutput})
+	ledPowerPin.Set(!l.asleep)
 
 	// Initialize the WS2812 data pin.
 	machine.WS2812.Configure(machine.PinConfig{Mode: machine.PinOutput})
@@ -88,15 +139,55 @@ func (l *ws2812LEDs) Len() int {
 }
 
 func (l *ws2812LEDs) SetRGB(i int, r, g, b uint8) {
-	l.data[i] = colorGRB{
+	c := colorGRB{
 		R: r,
 		G: g,
 		B: b,
 	}
+	if l.data[i] != c {
+		l.data[i] = c
+		l.dirty = true
+	}
+}
+
+func (l *ws2812LEDs) SetBrightness(brightness uint8) {
+	if l.dim != 255-brightness {
+		l.dim = 255 - brightness
+		l.dirty = true
+	}
 }
 
-// Send pixel data to the LEDs.
+// Send pixel data to the LEDs, if it changed.
 func (l *ws2812LEDs) Update() {
+	if l.dirty {
+		l.ForceUpdate()
+	}
+}
+
+// Send pixel data to the LEDs. This does nothing while the LEDs are powered
+// off, the data is sent once they are powered on again.
+func (l *ws2812LEDs) ForceUpdate() {
+	if l.asleep {
+		return
+	}
+	var scaled [len(l.data)]colorGRB
+	buf := pixelsToBytes(scaled[:])
+	scaleLEDBrightness(buf, pixelsToBytes(l.data[:]), 255-l.dim)
 	ws := ws2812.Device{Pin: machine.WS2812}
-	ws.Write(pixelsToBytes(l.data[:]))
+	ws.Write(buf)
+	l.dirty = false
+}
+
+// Cut the power to the LEDs, or restore it and send the last set colors again.
+// The LEDs draw around 1mA each even when they are off, so this saves power
+// while the LEDs aren't used.
+func (l *ws2812LEDs) Sleep(sleepEnabled bool) error {
+	l.asleep = sleepEnabled
+	ledPowerPin.Set(!sleepEnabled)
+	if !sleepEnabled {
+		// Give the LEDs some time to power up before sending data.
+		time.Sleep(time.Millisecond)
+		l.ForceUpdate()
+	}
+	return nil
 }
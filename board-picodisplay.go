@@ -0,0 +1,293 @@
+//go:build picodisplay
+
+package board
+
+import (
+	"image/color"
+	"machine"
+	"time"
+
+	"tinygo.org/x/drivers"
+	"tinygo.org/x/drivers/pixel"
+	"tinygo.org/x/drivers/st7789"
+)
+
+// The Pimoroni Pico Display Pack, on a Raspberry Pi Pico. It has a 1.14"
+// 240x135 IPS display, four buttons, and an RGB LED. There is no TinyGo target
+// for it (it's an add-on board), so use the Pico target with the picodisplay
+// build tag:
+//
+//	tinygo flash -target=pico -tags=picodisplay
+//
+// Some quirks of this board:
+//   - The display isn't square, and it sits in the middle of the 240x320
+//     memory of the ST7789 controller. So every coordinate sent to the
+//     controller needs an offset, in both directions. The st7789 driver only
+//     applies the configured offsets in some rotations (it was written for
+//     displays that are aligned to a corner of the controller memory), so
+//     only the default landscape rotation is supported.
+//   - The buttons are labeled A, B, X and Y, with A and B on the left of the
+//     display and X and Y on the right. X and Y are reported as KeyUp and
+//     KeyDown, so that menus can be navigated. Use Buttons.Remap to change
+//     this.
+//   - The display controller can't be read (its data output isn't connected),
+//     so it's not possible to wait for vblank.
+
+const (
+	Name = "picodisplay"
+)
+
+var (
+	Power      = dummyBattery{state: UnknownBattery, reboot: reboot}
+	Sensors    = &dieSensors{}
+	Display    = mainDisplay{}
+	Buttons    = &gpioButtons{}
+	Watchdog   = noWatchdog{}
+	StatusLED  = pwmLED{}
+	Vibration  = noVibration{}
+	Speaker    = noSpeaker{}
+	Microphone = dummyMicrophone{}
+	Encoder    = dummyEncoder{}
+)
+
+func boardInfo() BoardInfo {
+	return BoardInfo{
+		DisplayWidth:  240,
+		DisplayHeight: 135,
+		Keys:          append([]Key(nil), codes[:4]...),
+	}
+}
+
+type mainDisplay struct{}
+
+// Pixel format used by the display.
+type displayColor = pixel.RGB565BE
+
+// Convert an sRGB color to the pixel format of the display, see Color.
+func convertDisplayColor(c color.RGBA) displayColor {
+	return convertColor[displayColor](c)
+}
+
+var display st7789.DeviceOf[pixel.RGB565BE]
+
+const displayBacklightPin = machine.GPIO20
+
+// SPI frequency used for the display.
+var displayFrequency uint32
+
+func (d mainDisplay) Configure() Displayer[pixel.RGB565BE] {
+	displayFrequency = displaySPIFrequency(62_500_000, 62_500_000)
+	// Use the default SPI0 pins of the Pico. The SDI pin (GPIO16) isn't used
+	// for SPI on this board but as the DC pin, which is configured as such by
+	// the display driver afterwards.
+	machine.SPI0.Configure(machine.SPIConfig{
+		// Mode 3 is slightly faster than mode 0, see the Gopher Badge.
+		Mode:      3,
+		Frequency: displayFrequency,
+	})
+
+	// The reset pin of the display is connected to the RUN pin of the Pico,
+	// so it's reset together with the microcontroller.
+	display = st7789.NewOf[pixel.RGB565BE](machine.SPI0,
+		machine.NoPin,       // TFT_RESET
+		machine.GPIO16,      // TFT_DC
+		machine.GPIO17,      // TFT_CS
+		displayBacklightPin) // TFT_LITE
+
+	display.IsBGR(DisplaySettings.SwapRedBlue)
+	display.Configure(st7789.Config{
+		// Size and offsets in the native (portrait) orientation of the
+		// display. In ROTATION_270, the driver swaps the offsets so that the
+		// visible area starts at column 40 and row 53 of the controller
+		// memory, which is the landscape orientation with the buttons on the
+		// sides.
+		Rotation:     st7789.ROTATION_270,
+		Width:        135,
+		Height:       240,
+		RowOffset:    40,
+		ColumnOffset: 53,
+	})
+	display.EnableBacklight(false)
+	displayBacklight.setInitialBrightness(d.MaxBrightness())
+
+	return picoDisplay{&display}
+}
+
+// Wrapper for the display driver that turns off the backlight while sleeping,
+// clips images when needed, and only allows the rotation that has the right
+// offsets.
+type picoDisplay struct {
+	*st7789.DeviceOf[pixel.RGB565BE]
+}
+
+// Draw the image, clipping it if DisplaySettings.ClipDrawBitmap is enabled.
+func (d picoDisplay) DrawBitmap(x, y int16, buf pixel.Image[pixel.RGB565BE]) error {
+	width, height := d.Size()
+	return drawBitmapClipped(x, y, buf, width, height, d.DeviceOf.DrawBitmap)
+}
+
+// Set sleep mode for the display. The backlight is turned off while sleeping.
+func (d picoDisplay) Sleep(sleepEnabled bool) error {
+	return displayBacklight.sleep(sleepEnabled, d.DeviceOf.Sleep)
+}
+
+// The default landscape orientation is the only supported rotation, see the
+// comment at the top of this file.
+func (d picoDisplay) Rotation() drivers.Rotation {
+	return drivers.Rotation0
+}
+
+func (d picoDisplay) SetRotation(rotation drivers.Rotation) error {
+	if rotation != drivers.Rotation0 {
+		return ErrRotationUnsupported
+	}
+	return nil
+}
+
+func (d mainDisplay) MaxBrightness() int {
+	return 1
+}
+
+var displayBacklight = backlight{
+	set: func(level int) {
+		displayBacklightPin.Set(level > 0)
+	},
+}
+
+func (d mainDisplay) SetBrightness(level int) {
+	displayBacklight.setBrightness(level)
+}
+
+func (d mainDisplay) WaitForVBlank(defaultInterval time.Duration) {
+	dummyWaitForVBlank(defaultInterval)
+}
+
+func (d mainDisplay) WaitForVBlankTimeout(defaultInterval, timeout time.Duration) bool {
+	endFrame()
+	return dummyWaitForVBlankTimeout(defaultInterval, timeout)
+}
+
+func (d mainDisplay) LastFrameDuration() time.Duration {
+	return lastFrameDuration()
+}
+
+// Each byte takes 9 clock cycles in SPI mode 3, like on the Gopher Badge.
+func drawTimeEstimate(pixels int) time.Duration {
+	return busDrawTime(pixels, 16, displayFrequency, 9)
+}
+
+func (d mainDisplay) PPI() int {
+	return displayPPI(242) // 240px / (25.2mm / 25.4)
+}
+
+func (d mainDisplay) ConfigureTouch() TouchInput {
+	return noTouch{}
+}
+
+type gpioButtons struct {
+	buttonState
+}
+
+// Button pins, in the same order as codes. The buttons are active low.
+var buttonPins = [4]machine.Pin{
+	machine.GPIO12, // A
+	machine.GPIO13, // B
+	machine.GPIO14, // X
+	machine.GPIO15, // Y
+}
+
+func (b *gpioButtons) Configure() {
+	for _, pin := range buttonPins {
+		pin.Configure(machine.PinConfig{Mode: machine.PinInputPullup})
+	}
+	if ButtonSettings.CaptureEdges {
+		captureButtonEdges(buttonPins[:])
+	}
+}
+
+func (b *gpioButtons) ReadInput() {
+	// Take the edges before reading the pins. Otherwise a press right after
+	// the pins were read would be taken as an edge (and reported as a short
+	// press and release) and then be reported again from the pins in the next
+	// call.
+	edges := takeButtonEdges()
+	state := uint8(0)
+	for i, pin := range buttonPins {
+		if !pin.Get() {
+			state |= 1 << i
+		}
+	}
+	b.read(state, edges)
+}
+
+func (b *gpioButtons) Snapshot() {
+	b.ReadInput()
+}
+
+var codes = [8]Key{
+	KeyA,
+	KeyB,
+	KeyUp,   // X
+	KeyDown, // Y
+}
+
+func (b *gpioButtons) NextEvent() KeyEvent {
+	return b.nextEvent(&codes)
+}
+
+func (b *gpioButtons) PeekEvent() KeyEvent {
+	return b.peekEvent(&codes)
+}
+
+func (b *gpioButtons) Remap(index int, key Key) {
+	remapKey(codes[:4], index, key)
+}
+
+// RGB status LED, with each color driven using PWM so that any color can be
+// shown. The LED has a common anode, so the pins are active low.
+type pwmLED struct{}
+
+// Pins of the red, green and blue parts of the LED.
+var ledPins = [3]machine.Pin{machine.GPIO6, machine.GPIO7, machine.GPIO8}
+
+// PWM peripherals for each of ledPins, and the channel for the pin.
+var (
+	ledPWMs     = [3]ledPWM{machine.PWM3, machine.PWM3, machine.PWM4}
+	ledChannels [3]uint8
+)
+
+// The methods of the RP2040 PWM peripherals used for the LED.
+type ledPWM interface {
+	Configure(config machine.PWMConfig) error
+	Channel(pin machine.Pin) (uint8, error)
+	SetInverting(channel uint8, inverting bool)
+	Top() uint32
+	Set(channel uint8, value uint32)
+}
+
+// Configure the PWM peripherals for the LED, and turn the LED off.
+func (l pwmLED) Configure() {
+	for i, pwm := range ledPWMs {
+		pwm.Configure(machine.PWMConfig{})
+		ledChannels[i], _ = pwm.Channel(ledPins[i])
+		pwm.SetInverting(ledChannels[i], true) // active low
+	}
+	l.SetColor(0, 0, 0)
+}
+
+// Turn the LED on (white) or off.
+func (l pwmLED) Set(on bool) {
+	if on {
+		l.SetColor(255, 255, 255)
+	} else {
+		l.SetColor(0, 0, 0)
+	}
+}
+
+// Set the LED color, with 0 meaning off and 255 fully on for each color.
+func (l pwmLED) SetColor(r, g, b uint8) {
+	for i, value := range [3]uint8{r, g, b} {
+		pwm := ledPWMs[i]
+		pwm.Set(ledChannels[i], pwm.Top()*uint32(value)/255)
+	}
+}
@@ -5,7 +5,10 @@ package board
 import (
 	"device/arm"
 	"device/nrf"
+	"image/color"
 	"machine"
+	"runtime/interrupt"
+	"sync"
 	"time"
 
 	"tinygo.org/x/drivers"
@@ -22,13 +25,22 @@ const (
 	chargeIndicationPin = machine.Pin(12)
 	powerPresencePin    = machine.Pin(19)
 	batteryVoltagePin   = machine.Pin(31)
+	vibrationMotorPin   = machine.Pin(16)
+	i2cSDAPin           = machine.Pin(6)
+	i2cSCLPin           = machine.Pin(7)
 )
 
 var (
-	Power   = &mainBattery{}
-	Sensors = allSensors{}
-	Display = mainDisplay{}
-	Buttons = &singleButton{}
+	Power      = &mainBattery{}
+	Sensors    = allSensors{}
+	Display    = mainDisplay{}
+	Buttons    = &singleButton{}
+	Watchdog   = bootloaderWatchdog{}
+	StatusLED  = noStatusLED{}
+	Vibration  = &vibrationMotor{}
+	Speaker    = noSpeaker{}
+	Microphone = dummyMicrophone{}
+	Encoder    = dummyEncoder{}
 )
 
 func init() {
@@ -42,6 +54,45 @@ func init() {
 	// This causes a 1.25mA increase in current consumption.
 	// https://github.com/wasp-os/wasp-bootloader/pull/3
 	nrf.UART0.ENABLE.Set(0)
+
+	startUptimeRTC()
+}
+
+// Number of times RTC2 overflowed, which happens every 512 seconds.
+var rtc2Overflows uint32
+
+// Start RTC2 for Uptime. TinyGo uses RTC1 for its own timer, so RTC2 is free
+// for this. It runs from the low frequency clock (which TinyGo starts) at
+// 32768Hz, so it keeps counting while the CPU sleeps.
+func startUptimeRTC() {
+	nrf.RTC2.PRESCALER.Set(0)
+	nrf.RTC2.INTENSET.Set(nrf.RTC_INTENSET_OVRFLW)
+	intr := interrupt.New(nrf.IRQ_RTC2, func(interrupt.Interrupt) {
+		nrf.RTC2.EVENTS_OVRFLW.Set(0)
+		rtc2Overflows++
+	})
+	intr.SetPriority(0xc0) // low priority
+	intr.Enable()
+	nrf.RTC2.TASKS_START.Set(1)
+	boardUptime = rtc2Uptime
+}
+
+// Return the time since RTC2 was started. The counter is only 24 bits, so the
+// overflows counted in the interrupt make up the upper bits.
+func rtc2Uptime() time.Duration {
+	mask := interrupt.Disable()
+	overflows := rtc2Overflows
+	counter := nrf.RTC2.COUNTER.Get()
+	if nrf.RTC2.EVENTS_OVRFLW.Get() != 0 {
+		// The counter overflowed, but the interrupt hasn't handled it yet.
+		// Read the counter again, in case it was read just before the
+		// overflow.
+		overflows++
+		counter = nrf.RTC2.COUNTER.Get()
+	}
+	interrupt.Restore(mask)
+	ticks := uint64(overflows)<<24 | uint64(counter)
+	return time.Duration(ticks>>15)*time.Second + time.Duration(ticks&0x7fff)*time.Second/32768
 }
 
 type mainBattery struct {
@@ -57,6 +108,7 @@ var batteryPercent = batteryApproximation{
 }
 
 func (b *mainBattery) Configure() {
+	defer traceEnd(TraceConfigure, traceStart(), int32(TraceBatteryRead), nil)
 	chargeIndicationPin.Configure(machine.PinConfig{Mode: machine.PinInput})
 	powerPresencePin.Configure(machine.PinConfig{Mode: machine.PinInput})
 
@@ -64,7 +116,7 @@ func (b *mainBattery) Configure() {
 	// Using just one sample (instead of 256 for example), because we have our
 	// own filtering and long sample times actually drain a lot of power: around
 	// 6µA when measuing the battery every 5 seconds.
-	machine.InitADC()
+	initADC()
 	machine.ADC{Pin: batteryVoltagePin}.Configure(machine.ADCConfig{
 		Reference:  3000,
 		SampleTime: 40, // use the longest acquisition time
@@ -73,13 +125,14 @@ func (b *mainBattery) Configure() {
 }
 
 func (b *mainBattery) Status() (status ChargeState, microvolts uint32, percent int8) {
+	start := traceStart()
 	rawValue := machine.ADC{Pin: batteryVoltagePin}.Get()
 	// Formula to calculate microvolts:
 	//   rawValue * 6000_000 / 0x10000
 	// Simlified, to fit in 32-bit integers:
 	//   rawValue * (6000_000/128) / (0x1000/128)
 	//   rawValue * 46875 / 512
-	microvolts = uint32(rawValue) * 46875 / 512
+	microvolts = calibrateBatteryVoltage(uint32(rawValue) * 46875 / 512)
 	isCharging := chargeIndicationPin.Get() == false  // low when charging
 	isPowerPresent := powerPresencePin.Get() == false // low when present
 	if isCharging {
@@ -104,15 +157,115 @@ func (b *mainBattery) Status() (status ChargeState, microvolts uint32, percent i
 		b.lastPercent = int8(newPercent)
 	}
 	percent = b.lastPercent
+	traceEnd(TraceBatteryRead, start, int32(microvolts), nil)
 	return
 }
 
-var spi0Configured bool
+// The PineTime has no battery temperature sensor.
+func (b *mainBattery) BatteryTemperature() int32 {
+	return 0
+}
+
+func (b *mainBattery) NextEvent() PowerEvent {
+	return NoPowerEvent
+}
+
+// The PineTime can't cut its own power, so instead it enters System OFF mode:
+// the deepest sleep mode of the nRF52, from which it only wakes up (by
+// resetting) when the button is pressed or the watch is put on the charger.
+// While on the charger it would wake up right away, so then it returns
+// ErrNoShutdown instead.
+func (b *mainBattery) Shutdown() error {
+	powerPresencePin.Configure(machine.PinConfig{Mode: machine.PinInput})
+	if !powerPresencePin.Get() { // low when present
+		return ErrNoShutdown
+	}
+
+	// Turn off the backlight and the vibration motor. Pins keep their state in
+	// System OFF mode.
+	machine.LCD_BACKLIGHT_HIGH.Configure(machine.PinConfig{Mode: machine.PinOutput})
+	machine.LCD_BACKLIGHT_HIGH.High()
+	vibrationMotorPin.Configure(machine.PinConfig{Mode: machine.PinOutput})
+	vibrationMotorPin.High()
+
+	// Wake up on a button press, and when power is connected. BUTTON_OUT must
+	// be kept high for this, which costs a little bit of current (see
+	// readButton) but is needed to be able to turn the watch on again.
+	configureButton()
+	machine.BUTTON_OUT.High()
+	nrf.P0.PIN_CNF[machine.BUTTON_IN].Set(nrf.GPIO_PIN_CNF_DIR_Input<<nrf.GPIO_PIN_CNF_DIR_Pos | nrf.GPIO_PIN_CNF_INPUT_Connect<<nrf.GPIO_PIN_CNF_INPUT_Pos | nrf.GPIO_PIN_CNF_SENSE_High<<nrf.GPIO_PIN_CNF_SENSE_Pos)
+	nrf.P0.PIN_CNF[powerPresencePin].Set(nrf.GPIO_PIN_CNF_DIR_Input<<nrf.GPIO_PIN_CNF_DIR_Pos | nrf.GPIO_PIN_CNF_INPUT_Connect<<nrf.GPIO_PIN_CNF_INPUT_Pos | nrf.GPIO_PIN_CNF_SENSE_Low<<nrf.GPIO_PIN_CNF_SENSE_Pos)
+
+	nrf.POWER.SYSTEMOFF.Set(nrf.POWER_SYSTEMOFF_SYSTEMOFF_Enter)
+	for {
+		// System OFF mode is entered once the CPU has nothing left to do.
+		arm.Asm("wfe")
+	}
+}
+
+// The Wasp-OS bootloader starts the watchdog before starting the app, and
+// stays in recovery mode (for firmware updates over BLE) after every watchdog
+// reset. So to enter the bootloader, stop feeding the watchdog and wait for it
+// to expire, like when the button is held down (see bootloaderWatchdog.Feed).
+// If the watchdog isn't running, the app wasn't started by the Wasp-OS
+// bootloader and there is no known way to enter the bootloader, so this
+// returns ErrNoReboot.
+func (b *mainBattery) Reboot(toBootloader bool) error {
+	if !toBootloader {
+		arm.SystemReset()
+	}
+	if nrf.WDT.RUNSTATUS.Get()&nrf.WDT_RUNSTATUS_RUNSTATUS == 0 {
+		return ErrNoReboot
+	}
+	arm.DisableInterrupts()
+	for {
+		// Wait for the watchdog reset, which takes a few seconds.
+	}
+}
+
+// SPI0 is shared between the display and the external SPI flash chip. To avoid
+// corrupting transfers when both are used (for example, reading from flash in
+// a goroutine while the display is being updated), every user of the bus must
+// follow this contract:
+//
+//   - Call acquireSPI0 with the SPI configuration the chip needs before
+//     asserting its chip select line.
+//   - Deassert the chip select line and call releaseSPI0 when done.
+//
+// The bus is reconfigured only when the configuration differs from the one
+// used last, so switching between chips with the same configuration is cheap.
+//
+// The nRF52 drives the clock of the SPI bus, so the bus itself can't get stuck
+// like I2C can. But a user of the bus can hang while holding it (for example,
+// while waiting for a flash chip that doesn't respond). In that case
+// acquireSPI0 returns ErrBusTimeout, which is returned by the display methods
+// that return an error. Methods that can't return an error skip the operation.
+// The operation can be retried once the bus is released. The exception is
+// Display.Configure, which tries spi0ConfigureAttempts times and then panics.
+var (
+	spi0Once   configureOnce
+	spi0Lock   busLock
+	spi0Config machine.SPIConfig // configuration currently in use
+)
+
+// Number of times Display.Configure tries to acquire SPI0 before giving up.
+// Each attempt waits up to busTimeout.
+const spi0ConfigureAttempts = 3
+
+// SPI configuration used by the display.
+var spi0DisplayConfig = machine.SPIConfig{
+	Frequency: 8_000_000, // 8MHz is the maximum the nrf52832 supports
+	SCK:       machine.SPI0_SCK_PIN,
+	SDO:       machine.SPI0_SDO_PIN,
+	SDI:       machine.SPI0_SDI_PIN,
+	Mode:      3,
+}
 
 // Return SPI0 initialized and ready to use, configuring it if not already done.
+// Use acquireSPI0 instead when actually sending data over the bus.
 func getSPI0() machine.SPI {
 	spi := machine.SPI0
-	if !spi0Configured {
+	spi0Once.do(func() error {
 		// Set the chip select line for the flash chip to inactive.
 		spiFlashCSPin.Configure(machine.PinConfig{Mode: machine.PinOutput})
 		spiFlashCSPin.High()
@@ -122,13 +275,8 @@ func getSPI0() machine.SPI {
 		machine.LCD_CS.High()
 
 		// Configure the SPI bus.
-		spi.Configure(machine.SPIConfig{
-			Frequency: 8_000_000, // 8MHz is the maximum the nrf52832 supports
-			SCK:       machine.SPI0_SCK_PIN,
-			SDO:       machine.SPI0_SDO_PIN,
-			SDI:       machine.SPI0_SDI_PIN,
-			Mode:      3,
-		})
+		spi.Configure(spi0DisplayConfig)
+		spi0Config = spi0DisplayConfig
 
 		// Put the flash controller in deep power-down.
 		// This is done so that as long as the SPI flash isn't explicitly
@@ -136,24 +284,81 @@ func getSPI0() machine.SPI {
 		spiFlashCSPin.Low()
 		spi.Tx([]byte{0xB9}, nil) // deep power down
 		spiFlashCSPin.High()
-	}
+		return nil
+	})
 	return spi
 }
 
+// Get exclusive access to SPI0, configured with the given configuration.
+// releaseSPI0 must be called when done, but only when there was no error.
+func acquireSPI0(config machine.SPIConfig) error {
+	spi := getSPI0()
+	if err := spi0Lock.acquire(); err != nil {
+		return err
+	}
+	if config != spi0Config {
+		spi.Configure(config)
+		spi0Config = config
+	}
+	return nil
+}
+
+// Release SPI0 after a successful call to acquireSPI0.
+func releaseSPI0() {
+	spi0Lock.release()
+}
+
+func boardInfo() BoardInfo {
+	return BoardInfo{
+		DisplayWidth:  240,
+		DisplayHeight: 240,
+		Sensors:       drivers.Acceleration | drivers.Temperature,
+		Keys:          append([]Key(nil), codes[:]...),
+		HasTouch:      true,
+		HasBattery:    true,
+	}
+}
+
 type mainDisplay struct{}
 
+// Pixel format used by the display.
+type displayColor = pixel.RGB444BE
+
+// Convert an sRGB color to the pixel format of the display, see Color.
+func convertDisplayColor(c color.RGBA) displayColor {
+	return convertColor[displayColor](c)
+}
+
 var display *st7789.DeviceOf[pixel.RGB444BE]
 
 func (d mainDisplay) Configure() Displayer[pixel.RGB444BE] {
+	defer traceEnd(TraceConfigure, traceStart(), int32(TraceDisplayDraw), nil)
 	// Configure the display.
 	// RGB444 reduces theoretic update time by up to 25%, from 115.2ms to 86.4ms
 	// (28.8ms reduction).
+	// 8MHz is both the default and the maximum the nrf52832 supports.
+	spi0DisplayConfig.Frequency = displaySPIFrequency(8_000_000, 8_000_000)
+	var err error
+	for i := 0; i < spi0ConfigureAttempts; i++ {
+		if err = acquireSPI0(spi0DisplayConfig); err == nil {
+			break
+		}
+	}
+	if err != nil {
+		// Configure can't return an error. Nothing else should be using the
+		// bus this early, so something is badly wrong: panic instead of
+		// hanging forever or returning a display that doesn't work.
+		panic("board: could not configure display: " + err.Error())
+	}
+	defer releaseSPI0()
 	spi := getSPI0()
 	disp := st7789.NewOf[pixel.RGB444BE](spi,
 		machine.LCD_RESET,
 		machine.LCD_RS, // data/command
 		machine.LCD_CS,
 		machine.LCD_BACKLIGHT_HIGH) // TODO: allow better backlight control
+	disp.IsBGR(DisplaySettings.SwapRedBlue)
+	display = &disp
 	disp.Configure(st7789.Config{
 		Width:      240,
 		Height:     240,
@@ -169,32 +374,168 @@ func (d mainDisplay) Configure() Displayer[pixel.RGB444BE] {
 	machine.LCD_SCK.Low()
 	machine.LCD_SDI.Configure(machine.PinConfig{Mode: machine.PinOutput})
 
-	display = &disp
-	return display
+	displayBacklight.setInitialBrightness(d.MaxBrightness())
+	return sharedBusDisplay{display}
+}
+
+// Wrapper for the display driver that makes sure the SPI bus isn't used by
+// anything else (like the flash chip) while talking to the display. The driver
+// isn't embedded, so that apps can only use the methods below: the ones that
+// use the bus hold it while doing so.
+type sharedBusDisplay struct {
+	device *st7789.DeviceOf[pixel.RGB444BE]
+}
+
+func (d sharedBusDisplay) Size() (width, height int16) {
+	return d.device.Size()
+}
+
+func (d sharedBusDisplay) Rotation() drivers.Rotation {
+	return d.device.Rotation()
+}
+
+func (d sharedBusDisplay) DrawBitmap(x, y int16, buf pixel.Image[pixel.RGB444BE]) error {
+	if err := acquireSPI0(spi0DisplayConfig); err != nil {
+		return err
+	}
+	defer releaseSPI0()
+	width, height := d.Size()
+	return drawBitmapClipped(x, y, buf, width, height, d.device.DrawBitmap)
+}
+
+func (d sharedBusDisplay) Display() error {
+	defer endFrame()
+	defer addFrameTime(time.Now())
+	start := traceStart()
+	err := d.display()
+	traceEnd(TraceDisplayFlush, start, 0, err)
+	return err
+}
+
+func (d sharedBusDisplay) display() error {
+	if err := acquireSPI0(spi0DisplayConfig); err != nil {
+		return err
+	}
+	defer releaseSPI0()
+	return d.device.Display()
+}
+
+// Set sleep mode for the display. The backlight is turned off while sleeping.
+func (d sharedBusDisplay) Sleep(sleepEnabled bool) error {
+	if err := acquireSPI0(spi0DisplayConfig); err != nil {
+		return err
+	}
+	defer releaseSPI0()
+	return displayBacklight.sleep(sleepEnabled, d.device.Sleep)
+}
+
+func (d sharedBusDisplay) SetRotation(rotation drivers.Rotation) error {
+	if err := acquireSPI0(spi0DisplayConfig); err != nil {
+		return err
+	}
+	defer releaseSPI0()
+	return d.device.SetRotation(rotation)
+}
+
+func (d sharedBusDisplay) SetScrollArea(topFixedArea, bottomFixedArea int16) {
+	if acquireSPI0(spi0DisplayConfig) != nil {
+		return
+	}
+	defer releaseSPI0()
+	d.device.SetScrollArea(topFixedArea, bottomFixedArea)
+}
+
+func (d sharedBusDisplay) SetScroll(line int16) {
+	if acquireSPI0(spi0DisplayConfig) != nil {
+		return
+	}
+	defer releaseSPI0()
+	d.device.SetScroll(line)
+}
+
+func (d sharedBusDisplay) StopScroll() {
+	if acquireSPI0(spi0DisplayConfig) != nil {
+		return
+	}
+	defer releaseSPI0()
+	d.device.StopScroll()
+}
+
+func (d sharedBusDisplay) InvertColors(invert bool) {
+	if acquireSPI0(spi0DisplayConfig) != nil {
+		return
+	}
+	defer releaseSPI0()
+	d.device.InvertColors(invert)
+}
+
+// Return the line that is currently being refreshed, or 0 if the bus couldn't
+// be acquired.
+func (d sharedBusDisplay) GetScanLine() uint16 {
+	if acquireSPI0(spi0DisplayConfig) != nil {
+		return 0
+	}
+	defer releaseSPI0()
+	return d.device.GetScanLine()
+}
+
+// Wait until the given line is being refreshed. The bus is held while waiting,
+// which can take up to a frame.
+func (d sharedBusDisplay) SyncToScanLine(scanline uint16) {
+	if acquireSPI0(spi0DisplayConfig) != nil {
+		return
+	}
+	defer releaseSPI0()
+	d.device.SyncToScanLine(scanline)
 }
 
 func (d mainDisplay) MaxBrightness() int {
 	return 1 // TODO: 0-7 is supported
 }
 
+var displayBacklight = backlight{
+	set: func(level int) {
+		machine.LCD_BACKLIGHT_HIGH.Set(!(level > 0)) // low means on, high means off
+	},
+}
+
 func (d mainDisplay) SetBrightness(level int) {
-	machine.LCD_BACKLIGHT_HIGH.Set(!(level > 0)) // low means on, high means off
+	displayBacklight.setBrightness(level)
 }
 
 func (d mainDisplay) WaitForVBlank(defaultInterval time.Duration) {
+	d.WaitForVBlankTimeout(defaultInterval, 0)
+}
+
+func (d mainDisplay) WaitForVBlankTimeout(defaultInterval, timeout time.Duration) bool {
+	endFrame()
+	// Make sure nothing else uses the SPI bus while we bitbang it.
+	if acquireSPI0(spi0DisplayConfig) != nil {
+		return false
+	}
+	defer releaseSPI0()
+
 	// Disable the SPI so we can manually communicate with the display.
 	machine.SPI0.Bus.ENABLE.Set(nrf.SPIM_ENABLE_ENABLE_Disabled)
 
 	// Wait until the scanline wraps around to 0.
 	// This is also what the TE line does internally.
 	// TODO: use time.Sleep() if we can, to save power.
-	for readDisplayValue(st7789.GSCAN, 16) == 0 {
-	}
-	for readDisplayValue(st7789.GSCAN, 16) != 0 {
-	}
+	deadline := deadlineAfter(timeout)
+	ok := waitWhile(deadline, func() bool { return readDisplayValue(st7789.GSCAN, 16) == 0 }) &&
+		waitWhile(deadline, func() bool { return readDisplayValue(st7789.GSCAN, 16) != 0 })
 
 	// Re-enable the SPI.
 	machine.SPI0.Bus.ENABLE.Set(nrf.SPIM_ENABLE_ENABLE_Enabled)
+	return ok
+}
+
+func (d mainDisplay) LastFrameDuration() time.Duration {
+	return lastFrameDuration()
+}
+
+func drawTimeEstimate(pixels int) time.Duration {
+	return busDrawTime(pixels, 12, spi0DisplayConfig.Frequency, 8)
 }
 
 // Wait for enough time between bitbanged high and low SPI pulses.
@@ -272,10 +613,11 @@ func readDisplayValue(cmd uint8, bits int) uint32 {
 }
 
 func (d mainDisplay) PPI() int {
-	return 261
+	return displayPPI(261)
 }
 
 func (d mainDisplay) ConfigureTouch() TouchInput {
+	defer traceEnd(TraceConfigure, traceStart(), int32(TraceTouchRead), nil)
 	// Configure touch interrupt pin.
 	// After the pin goes low (for a very short time), the touch controller is
 	// accessible over I2C for as long as a finger touches the screen and a
@@ -294,6 +636,10 @@ func (d mainDisplay) ConfigureTouch() TouchInput {
 
 	configureI2CBus()
 
+	// Let Idle return early on a touch. This only reads the LATCH register,
+	// so it doesn't need an interrupt either.
+	wakeSources[wakeTouch] = touchInput{}.touchStarted
+
 	return touchInput{}
 }
 
@@ -307,19 +653,48 @@ var touchData = make([]byte, 6)
 
 var touchInitialized bool
 
+// Whether a touch is in progress, so that the touch controller is read even
+// when there is no new report in the LATCH register.
+var touchActive bool
+
 const touchI2CAddress = 0x15
 
 func (input touchInput) ReadTouch() []TouchPoint {
+	start := traceStart()
+	touches := input.readTouch()
+	traceEnd(TraceTouchRead, start, int32(len(touches)), nil)
+	return touches
+}
+
+func (input touchInput) readTouch() []TouchPoint {
 	// The touch controller is very sparsely documented. You can find datasheet
 	// in English and Chinese on the PineTime wiki:
 	// https://wiki.pine64.org/wiki/PineTime#Component_Datasheets
 	// The best documentation is in the Chinese documentation, you can use
 	// Google Translate to translate it to English.
 
-	// Read the bit from the LATCH reister, which is set to high when TP_INT
-	// goes high but doesn't go low on its own. We do that manually once no more
-	// touches are read from the touch controller.
-	if nrf.P0.LATCH.Get()&(1<<touchInterruptPin) != 0 {
+	// The bit in the LATCH register is set when the touch controller pulls
+	// TP_INT low (which it does for every new touch report), and stays set
+	// until it is cleared. Clear it before reading the touch data, like the
+	// button edges on the RP2040 boards: a report that arrives while the data
+	// is read sets it again, so that it is read in the next call instead of
+	// being lost. touchActive keeps the touch being read until the touch
+	// controller reports that it ended.
+	latched := nrf.P0.LATCH.Get()&(1<<touchInterruptPin) != 0
+	if latched {
+		nrf.P0.LATCH.Set(1 << touchInterruptPin)
+	}
+	if latched || touchActive {
+		touchActive = true
+		if err := i2cLock.acquire(); err != nil {
+			// Another goroutine is using the bus. Return the previous value,
+			// and try again next time.
+			if touchPoints[0].ID != 0 {
+				return touchPoints[:1]
+			}
+			return nil
+		}
+		defer i2cLock.release()
 		if !touchInitialized {
 			// Initialize the touch controller once we get the first touch.
 			// Doing it this way as the I2C bus appears unresponsive outside a
@@ -345,14 +720,20 @@ func (input touchInput) ReadTouch() []TouchPoint {
 			i2cBus.Tx(touchI2CAddress, []byte{0xFA, 0b0111_0000}, nil)
 		}
 
-		i2cBus.ReadRegister(touchI2CAddress, 1, touchData)
+		if err := i2cBus.ReadRegister(touchI2CAddress, 1, touchData); err != nil {
+			// The bus may be stuck, so recover it and try again next time.
+			// Until then, return the previous value as a fallback.
+			recoverI2CBus()
+			if touchPoints[0].ID != 0 {
+				return touchPoints[:1]
+			}
+			return nil
+		}
 		num := touchData[1] & 0x0f
 		if num == 0 {
 			touchID++ // for the next time
-			// Stop reading touch events.
-			// There may be a small race condition here, if the touch controller
-			// detects another touch while reading the touch data over I2C.
-			nrf.P0.LATCH.Set(1 << touchInterruptPin)
+			// Stop reading touch events, until the next report.
+			touchActive = false
 			touchPoints[0].ID = 0
 			return nil
 		}
@@ -387,6 +768,16 @@ func (input touchInput) ReadTouch() []TouchPoint {
 	return nil
 }
 
+// Return whether a touch started that hasn't been fully read by ReadTouch yet.
+// The touch controller only pulls TP_INT low for a very short time, but the
+// LATCH register remembers it until ReadTouch reads the report, and
+// touchActive until ReadTouch sees the touch has ended. This way,
+// StandbyUntilTouch doesn't miss a short tap that ended before it polled the
+// touch controller.
+func (input touchInput) touchStarted() bool {
+	return touchActive || nrf.P0.LATCH.Get()&(1<<touchInterruptPin) != 0
+}
+
 // State for the one and only button on the PineTime.
 type singleButton struct {
 	state         bool
@@ -394,13 +785,50 @@ type singleButton struct {
 }
 
 func (b *singleButton) Configure() {
+	configureButton()
+}
+
+func (b *singleButton) ReadInput() {
+	b.state = readButton()
+}
+
+func (b *singleButton) Snapshot() {
+	b.ReadInput()
+}
+
+var codes = [1]Key{KeyEnter}
+
+func (b *singleButton) NextEvent() KeyEvent {
+	if b.state == b.previousState {
+		return NoKeyEvent
+	}
+	e := KeyEvent(codes[0])
+	if !b.state {
+		e |= keyReleased
+	}
+	b.previousState = b.state
+	return e
+}
+
+func (b *singleButton) PeekEvent() KeyEvent {
+	state := *b
+	return state.NextEvent()
+}
+
+func (b *singleButton) Remap(index int, key Key) {
+	remapKey(codes[:], index, key)
+}
+
+// Configure the pins needed to read the button.
+func configureButton() {
 	// BUTTON_OUT must be held high for BUTTON_IN to read anything useful.
 	machine.BUTTON_OUT.Configure(machine.PinConfig{Mode: machine.PinOutput})
 	machine.BUTTON_OUT.Low()
 	machine.BUTTON_IN.Configure(machine.PinConfig{Mode: machine.PinInput})
 }
 
-func (b *singleButton) ReadInput() {
+// Read the current button state, returning true if the button is pressed.
+func readButton() bool {
 	// BUTTON_OUT needs to be kept low most of the time to avoid a ~34µA current
 	// increase. However, setting it to high just before reading doesn't appear
 	// to be enough: a small delay is needed. This can be done by setting
@@ -419,103 +847,365 @@ func (b *singleButton) ReadInput() {
 	machine.BUTTON_OUT.High()
 	state := machine.BUTTON_IN.Get()
 	machine.BUTTON_OUT.Low()
-	b.state = state
-
-	// Reset the watchdog timer only when the button is not pressed.
-	// The watchdog is configured in the Wasp-OS bootloader, and we have to be
-	// careful not to reset the watchdog while the button is pressed so that a
-	// long press forces a WDT reset and lets us enter the bootloader.
-	// For details, see:
-	// https://wasp-os.readthedocs.io/en/latest/wasp.html#watchdog-protocol
-	if !state {
+	return state
+}
+
+// The watchdog timer is started by the Wasp-OS bootloader and can't be stopped
+// once started. Therefore, applications must call Watchdog.Feed regularly or
+// the watch will reset.
+type bootloaderWatchdog struct{}
+
+// Configure the watchdog. The hardware watchdog is already running, this only
+// prepares the button so that it can be read in Feed.
+func (w bootloaderWatchdog) Configure() {
+	configureButton()
+}
+
+// Feed the watchdog, to prevent it from resetting the watch.
+//
+// The watchdog is only fed while the button is not pressed. The Wasp-OS
+// watchdog protocol relies on this: holding the button for longer than the
+// watchdog timeout (a few seconds) forces a watchdog reset, and the bootloader
+// stays in recovery mode after every watchdog reset (regardless of the state
+// of the button by then). This only works when Feed reads the button itself,
+// so don't change this to use the state last read by Buttons.ReadInput. For
+// details, see:
+// https://wasp-os.readthedocs.io/en/latest/wasp.html#watchdog-protocol
+func (w bootloaderWatchdog) Feed() {
+	if !readButton() {
 		nrf.WDT.RR[0].Set(0x6E524635)
 	}
 }
 
-func (b *singleButton) NextEvent() KeyEvent {
-	if b.state == b.previousState {
-		return NoKeyEvent
-	}
-	e := KeyEvent(KeyEnter)
-	if !b.state {
-		e |= keyReleased
+// Vibration motor, which is switched using a transistor. The pin is active low.
+type vibrationMotor struct {
+	lock     sync.Mutex
+	until    time.Time // time at which the current pulse ends
+	patterns patternPlayer
+}
+
+func (v *vibrationMotor) Configure() {
+	vibrationMotorPin.Configure(machine.PinConfig{Mode: machine.PinOutput})
+	vibrationMotorPin.High() // off
+}
+
+// Turn on the vibration motor for the given duration. It returns immediately.
+// A new pulse extends the current pulse, if there is one. A pulse that would
+// end before the current pulse doesn't shorten it.
+func (v *vibrationMotor) Pulse(duration time.Duration) {
+	v.lock.Lock()
+	if until := time.Now().Add(duration); until.After(v.until) {
+		v.until = until
 	}
-	b.previousState = b.state
-	return e
+	v.lock.Unlock()
+	vibrationMotorPin.Low() // on
+	go func() {
+		time.Sleep(duration)
+		v.lock.Lock()
+		if !time.Now().Before(v.until) {
+			vibrationMotorPin.High() // off
+		}
+		v.lock.Unlock()
+	}()
+}
+
+// Play a vibration pattern in the background, alternating between vibrating
+// and pausing for the given durations (starting with vibrating). A new pattern
+// cuts off the current one. The returned channel is closed when the pattern
+// is done, or when it was cut off.
+func (v *vibrationMotor) Pattern(pattern []time.Duration) <-chan struct{} {
+	return v.patterns.play(pattern, v.on, v.off)
+}
+
+// Stop the vibration pattern that is currently playing, for example when the
+// user acknowledges an alarm.
+func (v *vibrationMotor) Stop() {
+	v.patterns.stop(v.off)
+}
+
+func (v *vibrationMotor) on(duration time.Duration) {
+	vibrationMotorPin.Low()
+}
+
+func (v *vibrationMotor) off() {
+	vibrationMotorPin.High()
 }
 
-var i2cBus *machine.I2C
+// The I2C bus is shared by the touch controller, the accelerometer, and the
+// heart rate sensor, which may be used from different goroutines. i2cLock
+// arbitrates it the same way as spi0Lock arbitrates SPI0: a call that has to
+// wait longer than busTimeout returns ErrBusTimeout. ReadTouch can't return an
+// error, so it returns the previous touch point instead and tries again in the
+// next call.
+var (
+	i2cBus     = machine.I2C1
+	i2cBusOnce configureOnce
+	i2cLock    busLock
+)
 
 func initI2CBus() {
 	// Run I2C at a high speed (400KHz).
 	i2cBus.Configure(machine.I2CConfig{
 		Frequency: 400 * machine.KHz,
-		SDA:       machine.Pin(6),
-		SCL:       machine.Pin(7),
+		SDA:       i2cSDAPin,
+		SCL:       i2cSCLPin,
 	})
 }
 
+// Recover the I2C bus after a failed transaction. A chip can keep SDA low when
+// a transaction was interrupted (for example, by a reset in the middle of a
+// read), which makes every transaction after that fail. The standard way to
+// free the bus is to clock SCL until the chip releases SDA (at most 9 clock
+// pulses), send a stop condition, and then start the I2C peripheral again.
+// i2cLock must be held while calling this.
+func recoverI2CBus() {
+	// Disable the I2C peripheral, so that the pins can be used as GPIOs.
+	i2cBus.Bus.ENABLE.Set(0)
+	i2cSDAPin.Configure(machine.PinConfig{Mode: machine.PinInputPullup})
+	i2cSCLPin.Configure(machine.PinConfig{Mode: machine.PinOutput})
+	i2cSCLPin.High()
+	for i := 0; i < 9 && !i2cSDAPin.Get(); i++ {
+		i2cSCLPin.Low()
+		time.Sleep(5 * time.Microsecond)
+		i2cSCLPin.High()
+		time.Sleep(5 * time.Microsecond)
+	}
+
+	// Stop condition: SDA goes high while SCL is high.
+	i2cSCLPin.Low()
+	i2cSDAPin.Configure(machine.PinConfig{Mode: machine.PinOutput})
+	i2cSDAPin.Low()
+	time.Sleep(5 * time.Microsecond)
+	i2cSCLPin.High()
+	time.Sleep(5 * time.Microsecond)
+	i2cSDAPin.High()
+
+	initI2CBus()
+}
+
+// Configure the I2C bus shared by the touch controller, the accelerometer, and
+// the heart rate sensor, if not already done.
 func configureI2CBus() {
-	if i2cBus == nil {
-		i2cBus = machine.I2C1
+	i2cBusOnce.do(func() error {
+		if err := i2cLock.acquire(); err != nil {
+			return err
+		}
+		defer i2cLock.release()
 		initI2CBus()
 
 		// Disable the heart rate sensor on startup, to be enabled when a driver
 		// configures it. It consumes around 110µA when left enabled.
-		machine.I2C1.WriteRegister(0x44, 0x0C, []byte{0x00})
-	}
+		i2cBus.WriteRegister(0x44, 0x0C, []byte{0x00})
+		return nil
+	})
+}
+
+var adcOnce configureOnce
+
+// Initialize the ADC peripheral, if not already done.
+func initADC() {
+	adcOnce.do(func() error {
+		machine.InitADC()
+		return nil
+	})
 }
 
 type allSensors struct {
+	baseSensors // the PineTime has no light sensor
 }
 
-var accel *bma42x.Device
+var (
+	accel     *bma42x.Device
+	accelOnce configureOnce
+)
+
+// Available returns the sensors that respond, by checking the chip ID of the
+// accelerometer (which also provides the temperature).
+func (s allSensors) Available() drivers.Measurement {
+	configureI2CBus()
+	if err := i2cLock.acquire(); err != nil {
+		// The bus is busy, so there is no way to tell right now.
+		return 0
+	}
+	defer i2cLock.release()
+	device := accel
+	if device == nil {
+		device = bma42x.NewI2C(i2cBus, bma42x.Address)
+	}
+	if !device.Connected() {
+		return 0
+	}
+	return drivers.Acceleration | drivers.Temperature
+}
 
 func (s allSensors) Configure(which drivers.Measurement) error {
+	start := traceStart()
+	err := s.configure(which)
+	traceEnd(TraceConfigure, start, int32(TraceSensorUpdate), err)
+	return err
+}
+
+func (s allSensors) configure(which drivers.Measurement) error {
+	configureI2CBus()
+
 	// Configure the accelerometer (either BMA421 or BMA425, depending on the
-	// PineTime variant).
-	accel = bma42x.NewI2C(machine.I2C1, bma42x.Address)
-	err := accel.Configure(bma42x.Config{
-		Device:   bma42x.DeviceBMA421 | bma42x.DeviceBMA425,
-		Features: bma42x.FeatureStepCounting,
-	})
-	if err != nil {
-		// Restart the I2C bus.
-		// I don't know why, but configuring the BMA421 while it is already
-		// configured freezes the I2C bus. The only recovery appears to be to
-		// restart the I2C bus entirely.
-		initI2CBus()
-		err = accel.Configure(bma42x.Config{
+	// PineTime variant). This is only done once: configuring it again while
+	// it's running can freeze the I2C bus.
+	// The accel variable is only set once the accelerometer is configured, so
+	// that a missing accelerometer isn't accessed afterwards.
+	return accelOnce.do(func() error {
+		if err := i2cLock.acquire(); err != nil {
+			return err
+		}
+		defer i2cLock.release()
+		device := bma42x.NewI2C(i2cBus, bma42x.Address)
+		if !device.Connected() {
+			// Maybe the bus is frozen (see below), so check again after
+			// recovering it before giving up.
+			recoverI2CBus()
+			if !device.Connected() {
+				return ErrSensorNotFound
+			}
+		}
+		err := device.Configure(bma42x.Config{
 			Device:   bma42x.DeviceBMA421 | bma42x.DeviceBMA425,
 			Features: bma42x.FeatureStepCounting,
 		})
-	}
-	return err
+		if err != nil {
+			// Restart the I2C bus.
+			// I don't know why, but configuring the BMA421 while it is already
+			// configured (for example, after a reset) freezes the I2C bus. The
+			// only recovery appears to be to restart the I2C bus entirely.
+			recoverI2CBus()
+			err = device.Configure(bma42x.Config{
+				Device:   bma42x.DeviceBMA421 | bma42x.DeviceBMA425,
+				Features: bma42x.FeatureStepCounting,
+			})
+		}
+		if err != nil {
+			return err
+		}
+
+		// Enable the FIFO for ReadAccelBuffer, with only accelerometer data
+		// and without headers: every frame is then the 6 bytes of a single
+		// sample, in the same format as the acceleration data registers.
+		err = i2cBus.WriteRegister(bma42x.Address, bma42xFIFOConfig1, []byte{bma42xFIFOAccelEnable})
+		if err != nil {
+			return err
+		}
+		accel = device
+		return nil
+	})
 }
 
 func (s allSensors) Update(which drivers.Measurement) error {
+	start := traceStart()
+	err := s.update(which)
+	traceEnd(TraceSensorUpdate, start, int32(which), err)
+	return err
+}
+
+func (s allSensors) update(which drivers.Measurement) error {
 	if which&(drivers.Acceleration|drivers.Temperature) != 0 {
+		if accel == nil {
+			return ErrSensorNotFound
+		}
+		if err := i2cLock.acquire(); err != nil {
+			return err
+		}
+		defer i2cLock.release()
 		err := accel.Update(which & (drivers.Acceleration | drivers.Temperature))
 		if err != nil {
+			// Make sure the next update can succeed, in case the bus got
+			// stuck.
+			recoverI2CBus()
 			return err
 		}
 	}
 	return nil
 }
 
+// Mapping from the BMA42x axes to the standard axes.
+var accelAxes = AxisMapping{-2, -1, -3}
+
 func (s allSensors) Acceleration() (x, y, z int32) {
+	if accel == nil {
+		return 0, 0, 0
+	}
 	rawX, rawY, rawZ := accel.Acceleration()
-	// Adjust accelerometer to match standard axes.
-	x = -rawY
-	y = -rawX
-	z = -rawZ
-	return
+	return mapAcceleration(accelAxes, rawX, rawY, rawZ)
+}
+
+// Registers and values to use the FIFO of the BMA42x. The driver doesn't
+// support it (yet).
+const (
+	bma42xFIFOLength0     = 0x24 // FIFO length in bytes, 14 bits over 2 registers
+	bma42xFIFOData        = 0x26
+	bma42xFIFOConfig1     = 0x49
+	bma42xFIFOAccelEnable = 0x40 // fifo_acc_en, with fifo_header_en cleared
+	bma42xFIFOFrameSize   = 6
+)
+
+// ReadAccelBuffer drains the hardware FIFO of the BMA42x, see accelfifo.go.
+func (s allSensors) ReadAccelBuffer(buf [][3]int32) (int, error) {
+	if accel == nil {
+		return 0, ErrSensorNotFound
+	}
+	if err := i2cLock.acquire(); err != nil {
+		return 0, err
+	}
+	defer i2cLock.release()
+	var lengthData [2]byte
+	if err := i2cBus.ReadRegister(bma42x.Address, bma42xFIFOLength0, lengthData[:]); err != nil {
+		recoverI2CBus()
+		return 0, err
+	}
+	frames := (int(lengthData[0]) | int(lengthData[1]&0x3f)<<8) / bma42xFIFOFrameSize
+	if frames > len(buf) {
+		frames = len(buf)
+	}
+
+	// Read the FIFO in small chunks, to avoid a large buffer.
+	var data [16 * bma42xFIFOFrameSize]byte
+	n := 0
+	for n < frames {
+		chunk := data[:]
+		if remaining := (frames - n) * bma42xFIFOFrameSize; remaining < len(chunk) {
+			chunk = chunk[:remaining]
+		}
+		if err := i2cBus.ReadRegister(bma42x.Address, bma42xFIFOData, chunk); err != nil {
+			recoverI2CBus()
+			return n, err
+		}
+		for i := 0; i < len(chunk); i += bma42xFIFOFrameSize {
+			x, y, z := bma42xAcceleration(chunk[i : i+bma42xFIFOFrameSize])
+			buf[n][0], buf[n][1], buf[n][2] = mapAcceleration(accelAxes, x, y, z)
+			n++
+		}
+	}
+	return n, nil
+}
+
+// Convert a single sample of acceleration data to µg, like the driver does in
+// Acceleration: three 12-bit values stored in the upper bits of 16-bit little
+// endian values, where 512 is 1g.
+func bma42xAcceleration(data []byte) (x, y, z int32) {
+	x = int32(int16(uint16(data[0])|uint16(data[1])<<8) >> 4)
+	y = int32(int16(uint16(data[2])|uint16(data[3])<<8) >> 4)
+	z = int32(int16(uint16(data[4])|uint16(data[5])<<8) >> 4)
+	return x * 15625 / 8, y * 15625 / 8, z * 15625 / 8
 }
 
 func (s allSensors) Steps() (steps uint32) {
+	if accel == nil {
+		return 0
+	}
 	return accel.Steps()
 }
 
 func (s allSensors) Temperature() int32 {
+	if accel == nil {
+		return 0
+	}
 	return accel.Temperature()
 }
@@ -3,8 +3,9 @@
 package board
 
 import (
+	"image/color"
 	"machine"
-	"math/bits"
+	"sync/atomic"
 	"time"
 
 	"tinygo.org/x/drivers"
@@ -20,10 +21,16 @@ const (
 )
 
 var (
-	Power   = mainBattery{}
-	Sensors = &allSensors{}
-	Display = mainDisplay{}
-	Buttons = &buttonsConfig{}
+	Power      = mainBattery{}
+	Sensors    = &allSensors{}
+	Display    = mainDisplay{}
+	Buttons    = &buttonsConfig{}
+	Watchdog   = noWatchdog{}
+	StatusLED  = gpioLED{pin: machine.LED}
+	Vibration  = noVibration{}
+	Speaker    = dacSpeaker{}
+	Microphone = dummyMicrophone{}
+	Encoder    = dummyEncoder{}
 )
 
 func init() {
@@ -34,105 +41,344 @@ type mainBattery struct {
 }
 
 func (b mainBattery) Configure() {
-	machine.InitADC()
+	defer traceEnd(TraceConfigure, traceStart(), int32(TraceBatteryRead), nil)
+	initADC()
 	machine.ADC{Pin: machine.A6}.Configure(machine.ADCConfig{
 		Samples: 4, // 4 seems to be good enough
 	})
 }
 
 func (b mainBattery) Status() (ChargeState, uint32, int8) {
+	start := traceStart()
 	rawValue := machine.ADC{Pin: machine.A6}.Get()
 	// Formula to calculate microvolts:
 	//   rawValue * 6600_000 / 0x10000
 	// Simlified, to fit in 32-bit integers:
 	//   rawValue * 51562 / 512
-	microvolts := uint32(rawValue) * 51562 / 512
+	microvolts := calibrateBatteryVoltage(uint32(rawValue) * 51562 / 512)
+	traceEnd(TraceBatteryRead, start, int32(microvolts), nil)
 	return UnknownBattery, microvolts, lithumBatteryApproximation.approximate(microvolts)
 }
 
+// The PyBadge has no battery temperature sensor.
+func (b mainBattery) BatteryTemperature() int32 {
+	return 0
+}
+
+func (b mainBattery) NextEvent() PowerEvent {
+	return NoPowerEvent
+}
+
+// The PyBadge has a physical power switch, but can't turn itself off.
+func (b mainBattery) Shutdown() error {
+	return ErrNoShutdown
+}
+
+func (b mainBattery) Reboot(toBootloader bool) error {
+	return reboot(toBootloader)
+}
+
+// Speaker with a class D amplifier, which is enabled using a separate pin.
+// The speaker is connected to A0, which is a DAC output and not connected to
+// any timer, so the square wave is made by a goroutine that switches the DAC
+// between its lowest and highest value.
+type dacSpeaker struct{}
+
+const (
+	speakerPin       = machine.A0
+	speakerEnablePin = machine.PA27
+)
+
+func (s dacSpeaker) Configure() {
+	speakerEnablePin.Configure(machine.PinConfig{Mode: machine.PinOutput})
+	speakerEnablePin.Low()
+	speakerPin.Configure(machine.PinConfig{Mode: machine.PinOutput})
+	machine.DAC0.Configure(machine.DACConfig{})
+}
+
+func (s dacSpeaker) Tone(frequency uint32, duration time.Duration) {
+	<-s.StartTone(frequency, duration)
+}
+
+var (
+	speakerPlayer tonePlayer
+
+	// Incremented for every new tone, to stop the goroutine that plays the
+	// previous one.
+	speakerWave uint32
+)
+
+// Start playing a tone in the background. A new tone cuts off the current one.
+// The amplifier is only enabled while a tone is playing.
+func (s dacSpeaker) StartTone(frequency uint32, duration time.Duration) <-chan struct{} {
+	return speakerPlayer.play(duration, func() {
+		wave := atomic.AddUint32(&speakerWave, 1)
+		if frequency == 0 {
+			speakerEnablePin.Low()
+			return
+		}
+		speakerEnablePin.High()
+		go playSquareWave(wave, time.Second/time.Duration(frequency)/2)
+	}, func() {
+		atomic.AddUint32(&speakerWave, 1)
+		speakerEnablePin.Low()
+	})
+}
+
+// Switch the DAC between its lowest and highest value until a new tone is
+// started or the current one is stopped.
+func playSquareWave(wave uint32, halfPeriod time.Duration) {
+	for atomic.LoadUint32(&speakerWave) == wave {
+		machine.DAC0.Set(0xffff)
+		time.Sleep(halfPeriod)
+		machine.DAC0.Set(0)
+		time.Sleep(halfPeriod)
+	}
+}
+
+func (s dacSpeaker) PlayNote(note uint8, duration time.Duration) {
+	playNote(s, note, duration)
+}
+
+func (s dacSpeaker) PlaySequence(notes []Note) {
+	playSequence(s, notes)
+}
+
 type allSensors struct {
 	baseSensors
 	accelX, accelY, accelZ int32
+	light                  uint32
+	samples                accelBuffer // for ReadAccelBuffer
 }
 
-var accel lis3dh.Device
+var (
+	accel     lis3dh.Device
+	accelOnce configureOnce
+	i2cOnce   configureOnce
+)
 
-func (s *allSensors) Configure(which drivers.Measurement) error {
-	if which&drivers.Acceleration != 0 {
-		machine.I2C0.Configure(machine.I2CConfig{
+// Configure the I2C bus of the accelerometer, if not already done.
+func configureI2C() {
+	i2cOnce.do(func() error {
+		return machine.I2C0.Configure(machine.I2CConfig{
 			Frequency: 400 * machine.KHz,
 			SCL:       machine.SCL_PIN,
 			SDA:       machine.SDA_PIN,
 		})
-		accel = lis3dh.New(machine.I2C0)
-		accel.Configure()
+	})
+}
+
+// Available returns the sensors that respond, by checking the WHO_AM_I
+// register of the accelerometer. The light sensor is a phototransistor on an
+// ADC pin, which can't be detected and is always reported as available.
+func (s *allSensors) Available() drivers.Measurement {
+	available := drivers.Luminosity
+	configureI2C()
+	device := lis3dh.New(machine.I2C0)
+	if device.Connected() {
+		available |= drivers.Acceleration
 	}
-	return nil
+	return available
+}
+
+func (s *allSensors) Configure(which drivers.Measurement) error {
+	start := traceStart()
+	err := s.configure(which)
+	traceEnd(TraceConfigure, start, int32(TraceSensorUpdate), err)
+	return err
+}
+
+func (s *allSensors) configure(which drivers.Measurement) error {
+	// A missing accelerometer is reported at the end, after configuring the
+	// light sensor.
+	var err error
+	if which&drivers.Acceleration != 0 {
+		err = accelOnce.do(func() error {
+			configureI2C()
+			accel = lis3dh.New(machine.I2C0)
+			if !accel.Connected() {
+				return ErrSensorNotFound
+			}
+			accel.Configure()
+			return nil
+		})
+	}
+	if which&drivers.Luminosity != 0 {
+		initADC()
+		lightSensor.Configure(machine.ADCConfig{
+			Samples: 4,
+		})
+	}
+	return err
 }
 
 func (s *allSensors) Update(which drivers.Measurement) error {
-	// TODO:
-	// - read temperature from LIS3DH
-	// - read brightness value
+	start := traceStart()
+	err := s.update(which)
+	traceEnd(TraceSensorUpdate, start, int32(which), err)
+	return err
+}
+
+func (s *allSensors) update(which drivers.Measurement) error {
+	// TODO: read temperature from LIS3DH
+	var err error
 	if which&drivers.Acceleration != 0 {
-		var err error
-		s.accelX, s.accelY, s.accelZ, err = accel.ReadAcceleration()
-		if err != nil {
-			return err
+		if accelOnce.done {
+			s.accelX, s.accelY, s.accelZ, err = accel.ReadAcceleration()
+			if err == nil {
+				s.samples.push(s.Acceleration())
+			}
+		} else {
+			err = ErrSensorNotFound
 		}
 	}
-	return nil
+	if which&drivers.Luminosity != 0 {
+		// The light sensor is a phototransistor (ALS-PT19) with a pulldown
+		// resistor, so the voltage rises linearly with the amount of light.
+		// Scale the 16-bit ADC value to the range 0..1000. Direct sunlight
+		// saturates the sensor, while normal indoor lighting is somewhere
+		// around 50-300.
+		s.light = uint32(lightSensor.Get()) * 1000 / 0xffff
+	}
+	return err
 }
 
+// Mapping from the LIS3DH axes to the standard axes.
+var accelAxes = AxisMapping{-1, 2, -3}
+
 func (s *allSensors) Acceleration() (x, y, z int32) {
-	// Adjust accelerometer to match standard axes.
-	x = -s.accelX
-	y = s.accelY
-	z = -s.accelZ
-	return
+	return mapAcceleration(accelAxes, s.accelX, s.accelY, s.accelZ)
+}
+
+// ReadAccelBuffer returns the samples that were read in Update since the last
+// call. The FIFO of the LIS3DH isn't used, see accelfifo.go.
+func (s *allSensors) ReadAccelBuffer(buf [][3]int32) (int, error) {
+	return s.samples.read(buf), nil
+}
+
+// The light sensor, on the front next to the display.
+var lightSensor = machine.ADC{Pin: machine.A7}
+
+// Light returns the relative ambient light level, in the range 0..1000. It is
+// not calibrated to lux.
+func (s *allSensors) Light() uint32 {
+	return s.light
+}
+
+var adcOnce configureOnce
+
+// Initialize the ADC peripheral, if not already done.
+func initADC() {
+	adcOnce.do(func() error {
+		machine.InitADC()
+		return nil
+	})
+}
+
+func boardInfo() BoardInfo {
+	return BoardInfo{
+		DisplayWidth:  160,
+		DisplayHeight: 128,
+		Sensors:       drivers.Acceleration | drivers.Luminosity,
+		Keys:          append([]Key(nil), codes[:]...),
+		HasLEDs:       true,
+		HasBattery:    true,
+	}
 }
 
 type mainDisplay struct{}
 
+// Pixel format used by the display.
+type displayColor = pixel.RGB565BE
+
+// Convert an sRGB color to the pixel format of the display, see Color.
+func convertDisplayColor(c color.RGBA) displayColor {
+	return convertColor[displayColor](c)
+}
+
 func (d mainDisplay) PPI() int {
-	return 116 // 160px / (35.04mm / 25.4)
+	return displayPPI(116) // 160px / (35.04mm / 25.4)
 }
 
+// SPI frequency used for the display.
+var displayFrequency uint32
+
 func (d mainDisplay) Configure() Displayer[pixel.RGB565BE] {
+	defer traceEnd(TraceConfigure, traceStart(), int32(TraceDisplayDraw), nil)
+	// The datasheet for st7735 says 66ns (~15.15MHz) is the max speed.
+	displayFrequency = displaySPIFrequency(15_000_000, 15_000_000)
 	machine.SPI1.Configure(machine.SPIConfig{
 		SCK:       machine.SPI1_SCK_PIN,
 		SDO:       machine.SPI1_SDO_PIN,
 		SDI:       machine.SPI1_SDI_PIN,
-		Frequency: 15_000_000, // datasheet for st7735 says 66ns (~15.15MHz) is the max speed
+		Frequency: displayFrequency,
 	})
 
 	display := st7735.New(machine.SPI1, machine.TFT_RST, machine.TFT_DC, machine.TFT_CS, machine.TFT_LITE)
+	display.IsBGR(DisplaySettings.SwapRedBlue)
 	display.Configure(st7735.Config{
 		Rotation: st7735.ROTATION_90,
 	})
 	display.EnableBacklight(false)
-	return &display
+	displayBacklight.setInitialBrightness(d.MaxBrightness())
+	return sleepDisplay{&display}
+}
+
+// Wrapper for the display driver that turns off the backlight while sleeping,
+// and clips images when needed.
+type sleepDisplay struct {
+	*st7735.Device
+}
+
+// Draw the image, clipping it if DisplaySettings.ClipDrawBitmap is enabled.
+func (d sleepDisplay) DrawBitmap(x, y int16, buf pixel.Image[pixel.RGB565BE]) error {
+	width, height := d.Size()
+	return drawBitmapClipped(x, y, buf, width, height, d.Device.DrawBitmap)
+}
+
+// Set sleep mode for the display. The backlight is turned off while sleeping.
+func (d sleepDisplay) Sleep(sleepEnabled bool) error {
+	return displayBacklight.sleep(sleepEnabled, d.Device.Sleep)
 }
 
 func (d mainDisplay) MaxBrightness() int {
 	return 1
 }
 
+var displayBacklight = backlight{
+	set: func(level int) {
+		machine.TFT_LITE.Set(level > 0)
+	},
+}
+
 func (d mainDisplay) SetBrightness(level int) {
-	machine.TFT_LITE.Set(level > 0)
+	displayBacklight.setBrightness(level)
 }
 
 func (d mainDisplay) WaitForVBlank(defaultInterval time.Duration) {
 	dummyWaitForVBlank(defaultInterval)
 }
 
+func (d mainDisplay) WaitForVBlankTimeout(defaultInterval, timeout time.Duration) bool {
+	endFrame()
+	return dummyWaitForVBlankTimeout(defaultInterval, timeout)
+}
+
+func (d mainDisplay) LastFrameDuration() time.Duration {
+	return lastFrameDuration()
+}
+
+func drawTimeEstimate(pixels int) time.Duration {
+	return busDrawTime(pixels, 16, displayFrequency, 8)
+}
+
 func (d mainDisplay) ConfigureTouch() TouchInput {
 	return noTouch{}
 }
 
 type buttonsConfig struct {
 	shifter.Device
-	lastState, currentState uint8
+	buttonState
 }
 
 func (b *buttonsConfig) Configure() {
@@ -141,7 +387,14 @@ func (b *buttonsConfig) Configure() {
 }
 
 func (b *buttonsConfig) ReadInput() {
-	b.currentState, _ = b.Device.ReadInput()
+	// All buttons are read at once from the shift register, so multiple
+	// buttons may have changed since the last read. They are reported one by
+	// one through NextEvent.
+	b.current, _ = b.Device.ReadInput()
+}
+
+func (b *buttonsConfig) Snapshot() {
+	b.ReadInput()
 }
 
 var codes = [8]Key{
@@ -156,31 +409,22 @@ var codes = [8]Key{
 }
 
 func (b *buttonsConfig) NextEvent() KeyEvent {
-	// The xor between the previous state and the current state is the buttons
-	// that changed.
-	change := b.currentState ^ b.lastState
-	if change == 0 {
-		return NoKeyEvent
-	}
-
-	// Find the index of the button with the lowest index that changed state.
-	index := bits.TrailingZeros32(uint32(change))
-	e := KeyEvent(codes[index])
-	if b.currentState&(1<<index) == 0 {
-		// The button state change was from 1 to 0, so it was released.
-		e |= keyReleased
-	}
+	return b.nextEvent(&codes)
+}
 
-	// This button event was read, so mark it as such.
-	// By toggling the bit, the bit will be set to the value that is currently
-	// in currentState.
-	b.lastState ^= (1 << index)
+func (b *buttonsConfig) PeekEvent() KeyEvent {
+	return b.peekEvent(&codes)
+}
 
-	return e
+func (b *buttonsConfig) Remap(index int, key Key) {
+	remapKey(codes[:], index, key)
 }
 
 type ws2812LEDs struct {
-	data [5]colorGRB
+	data   [5]colorGRB
+	dirty  bool  // changed since the last update
+	dim    uint8 // 255 minus the brightness, so the zero value is full brightness
+	asleep bool  // turned off using Sleep
 }
 
 func (l *ws2812LEDs) Configure() {
@@ -192,15 +436,49 @@ func (l *ws2812LEDs) Len() int {
 }
 
 func (l *ws2812LEDs) SetRGB(i int, r, g, b uint8) {
-	l.data[i] = colorGRB{
+	c := colorGRB{
 		R: r,
 		G: g,
 		B: b,
 	}
+	if l.data[i] != c {
+		l.data[i] = c
+		l.dirty = true
+	}
 }
 
-// Send pixel data to the LEDs.
+func (l *ws2812LEDs) SetBrightness(brightness uint8) {
+	if l.dim != 255-brightness {
+		l.dim = 255 - brightness
+		l.dirty = true
+	}
+}
+
+// Send pixel data to the LEDs, if it changed.
 func (l *ws2812LEDs) Update() {
+	if l.dirty && !l.asleep {
+		l.ForceUpdate()
+	}
+}
+
+// Send pixel data to the LEDs.
+func (l *ws2812LEDs) ForceUpdate() {
+	var scaled [len(l.data)]colorGRB
+	buf := pixelsToBytes(scaled[:])
+	brightness := 255 - l.dim
+	if l.asleep {
+		brightness = 0
+	}
+	scaleLEDBrightness(buf, pixelsToBytes(l.data[:]), brightness)
 	ws := ws2812.Device{Pin: machine.WS2812}
-	ws.Write(pixelsToBytes(l.data[:]))
+	ws.Write(buf)
+	l.dirty = false
+}
+
+// There is no way to cut the power to the LEDs on this board, so they are
+// only turned off. They still draw a little bit of current while off.
+func (l *ws2812LEDs) Sleep(sleepEnabled bool) error {
+	l.asleep = sleepEnabled
+	l.ForceUpdate()
+	return nil
 }
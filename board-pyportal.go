@@ -3,6 +3,7 @@
 package board
 
 import (
+	"image/color"
 	"machine"
 	"time"
 
@@ -17,21 +18,66 @@ const (
 )
 
 var (
-	Power   = dummyBattery{state: NoBattery}
-	Sensors = baseSensors{} // TODO: light, temperature
-	Display = mainDisplay{}
-	Buttons = noButtons{}
+	Power      = dummyBattery{state: NoBattery, reboot: reboot}
+	Sensors    = baseSensors{} // TODO: light, temperature
+	Display    = mainDisplay{}
+	Buttons    = noButtons{}
+	Watchdog   = noWatchdog{}
+	StatusLED  = gpioLED{pin: machine.LED}
+	Vibration  = noVibration{}
+	Speaker    = noSpeaker{}
+	Microphone = dummyMicrophone{}
+	Encoder    = dummyEncoder{}
 )
 
+func boardInfo() BoardInfo {
+	return BoardInfo{
+		DisplayWidth:  320,
+		DisplayHeight: 240,
+		HasTouch:      true,
+	}
+}
+
 type mainDisplay struct{}
 
+// Pixel format used by the display.
+type displayColor = pixel.RGB565BE
+
+// Convert an sRGB color to the pixel format of the display, see Color.
+func convertDisplayColor(c color.RGBA) displayColor {
+	return convertColor[displayColor](c)
+}
+
 var display *ili9341.Device
 
+// The backlight is dimmed using PWM on TCC0, which isn't used for anything
+// else on this board. The PWM signal is generated in hardware, so it doesn't
+// interfere with polling the TE pin in WaitForVBlank.
+var (
+	backlightPWM     = machine.TCC0
+	backlightChannel uint8
+)
+
+// PWM frequency of the backlight. The backlight LED driver is turned on and
+// off at this frequency, which is fast enough to not be visible as flicker.
+const backlightFrequency = 1000 // Hz
+
+// Highest brightness level of the backlight, returned by MaxBrightness.
+const backlightMaxBrightness = 255
+
 func (d mainDisplay) Configure() Displayer[pixel.RGB565BE] {
-	// Initialize backlight and disable at startup.
-	backlight := machine.TFT_BACKLIGHT
-	backlight.Configure(machine.PinConfig{Mode: machine.PinOutput})
-	backlight.Low()
+	// Initialize the backlight PWM, with the backlight off at startup.
+	backlightPWM.Configure(machine.PWMConfig{
+		Period: uint64(time.Second / backlightFrequency),
+	})
+	channel, err := backlightPWM.Channel(machine.TFT_BACKLIGHT)
+	if err != nil {
+		// Configure can't return an error. This only happens when the
+		// backlight pin isn't connected to backlightPWM, which is a bug.
+		panic("board: could not configure display backlight: " + err.Error())
+	}
+	backlightChannel = channel
+	backlightPWM.Set(backlightChannel, 0)
 
 	// Enable and configure display.
 	display = ili9341.NewParallel(
@@ -42,6 +88,16 @@ func (d mainDisplay) Configure() Displayer[pixel.RGB565BE] {
 		machine.TFT_RESET,
 		machine.TFT_RD,
 	)
+	// TODO: support DisplaySettings.SwapRedBlue. The ili9341 driver always
+	// sets the BGR bit in MADCTL, and has no way to change it.
+	//
+	// The ILI9341 also supports 18-bit color (RGB666, COLMOD 0x66), but this
+	// can't be offered either: the driver always sets COLMOD to 0x55 (RGB565)
+	// and has no way to change it, DrawBitmap only accepts RGB565 images, and
+	// the pixel package has no 18-bit color type. It would also cost 3 instead
+	// of 2 bytes per pixel, so updating the screen would take 50% longer.
+	// Simulator.WindowColorDepth can be set to 18 to preview what it would
+	// look like.
 	display.Configure(ili9341.Config{
 		Rotation: ili9341.Rotation270,
 	})
@@ -51,34 +107,82 @@ func (d mainDisplay) Configure() Displayer[pixel.RGB565BE] {
 	te.Configure(machine.PinConfig{Mode: machine.PinInput})
 	display.EnableTEOutput(true)
 
-	return display
+	displayBacklight.setInitialBrightness(d.MaxBrightness())
+	return sleepDisplay{display}
+}
+
+// Wrapper for the display driver that turns off the backlight while sleeping,
+// and clips images when needed.
+type sleepDisplay struct {
+	*ili9341.Device
+}
+
+// Draw the image, clipping it if DisplaySettings.ClipDrawBitmap is enabled.
+func (d sleepDisplay) DrawBitmap(x, y int16, buf pixel.Image[pixel.RGB565BE]) error {
+	width, height := d.Size()
+	return drawBitmapClipped(x, y, buf, width, height, d.Device.DrawBitmap)
+}
+
+// Set sleep mode for the display. The backlight is turned off while sleeping.
+func (d sleepDisplay) Sleep(sleepEnabled bool) error {
+	return displayBacklight.sleep(sleepEnabled, d.Device.Sleep)
 }
 
 func (d mainDisplay) MaxBrightness() int {
-	return 1
+	return backlightMaxBrightness
+}
+
+var displayBacklight = backlight{
+	set: func(level int) {
+		if level < 0 {
+			level = 0
+		} else if level > backlightMaxBrightness {
+			level = backlightMaxBrightness
+		}
+		// The perceived brightness isn't linear in the duty cycle: low duty
+		// cycles look much brighter than expected. Squaring the level
+		// roughly corrects for this, and keeps the lowest levels usable in a
+		// dark room.
+		top := uint64(backlightPWM.Top())
+		value := top * uint64(level*level) / (backlightMaxBrightness * backlightMaxBrightness)
+		backlightPWM.Set(backlightChannel, uint32(value))
+	},
 }
 
 func (d mainDisplay) SetBrightness(level int) {
-	machine.TFT_BACKLIGHT.Set(level > 0)
+	displayBacklight.setBrightness(level)
 }
 
 func (d mainDisplay) WaitForVBlank(defaultInterval time.Duration) {
+	d.WaitForVBlankTimeout(defaultInterval, 0)
+}
+
+func (d mainDisplay) WaitForVBlankTimeout(defaultInterval, timeout time.Duration) bool {
+	endFrame()
 	// Wait until the display has finished updating.
 	// TODO: wait for a pin interrupt instead of blocking.
-	for machine.TFT_TE.Get() == true {
-	}
-	for machine.TFT_TE.Get() == false {
-	}
+	deadline := deadlineAfter(timeout)
+	return waitWhile(deadline, func() bool { return machine.TFT_TE.Get() == true }) &&
+		waitWhile(deadline, func() bool { return machine.TFT_TE.Get() == false })
+}
+
+func (d mainDisplay) LastFrameDuration() time.Duration {
+	return lastFrameDuration()
+}
 
+// The display is connected over an 8-bit parallel bus that is driven by the
+// CPU, and its speed hasn't been measured.
+func drawTimeEstimate(pixels int) time.Duration {
+	return 0
 }
 
 func (d mainDisplay) PPI() int {
-	return 166 // appears to be the same size/resolution as the Gopher Badge and the MCH2022 badge
+	return displayPPI(166) // appears to be the same size/resolution as the Gopher Badge and the MCH2022 badge
 }
 
 // Configure the resistive touch input on this display.
 func (d mainDisplay) ConfigureTouch() TouchInput {
-	machine.InitADC()
+	initADC()
 	resistiveTouch.Configure(&resistive.FourWireConfig{
 		YP: machine.TOUCH_YD,
 		YM: machine.TOUCH_YU,
@@ -89,6 +193,16 @@ func (d mainDisplay) ConfigureTouch() TouchInput {
 	return touchInput{}
 }
 
+var adcOnce configureOnce
+
+// Initialize the ADC peripheral, if not already done.
+func initADC() {
+	adcOnce.do(func() error {
+		machine.InitADC()
+		return nil
+	})
+}
+
 var resistiveTouch resistive.FourWire
 
 var touchPoints [1]TouchPoint
@@ -183,6 +297,16 @@ func (input touchInput) ReadTouch() []TouchPoint {
 	return nil
 }
 
+// Read the raw touch screen values, without filtering or calibration.
+func (input touchInput) ReadRawTouch() RawTouch {
+	point := resistiveTouch.ReadTouchPoint()
+	return RawTouch{
+		X: uint16(point.X),
+		Y: uint16(point.Y),
+		Z: uint16(point.Z),
+	}
+}
+
 // Map and clamp an input value to an output range.
 func clamp(value, lowIn, highIn, lowOut, highOut int) int {
 	rangeIn := highIn - lowIn
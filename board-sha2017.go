@@ -0,0 +1,376 @@
+//go:build sha2017
+
+package board
+
+import (
+	"image/color"
+	"machine"
+	"time"
+
+	"tinygo.org/x/drivers"
+	"tinygo.org/x/drivers/pixel"
+	"tinygo.org/x/drivers/waveshare-epd/epd2in9"
+	"tinygo.org/x/drivers/ws2812"
+)
+
+// The SHA2017 badge, made for the SHA2017 hacker camp. It is based on the
+// ESP32, with a 2.9" e-paper display, capacitive touch buttons, and 6 RGBW
+// LEDs. There is no TinyGo target for it (yet), so use the generic ESP32 target
+// with the sha2017 build tag:
+//
+//	tinygo flash -target=esp32 -tags=sha2017
+//
+// Some quirks of this badge:
+//   - The buttons are capacitive touch pads, read through an MPR121 touch
+//     controller over I2C. Touching them with a glove or through a case
+//     doesn't work.
+//   - The MPR121 also switches the power to the LEDs (with one of its unused
+//     electrodes as a GPIO pin), so configuring the LEDs also configures the
+//     touch controller.
+//   - The LEDs are SK6812 RGBW LEDs, which need 4 bytes per LED instead of 3.
+//     They implement RGBWLEDArray.
+//   - The e-paper display has an SSD1608 compatible controller, like the IL3820
+//     on the Waveshare 2.9" (V1) display. Every update is a full refresh, which
+//     takes around 2 seconds and makes the display flash. Display returns
+//     immediately, while the display keeps refreshing in the background.
+//   - The flash button (GPIO0) is used to enter the bootloader, and isn't
+//     available as a key.
+
+const (
+	Name = "sha2017"
+)
+
+var (
+	Power      = dummyBattery{state: UnknownBattery} // TODO: battery voltage ADC
+	Sensors    = baseSensors{}
+	Display    = mainDisplay{}
+	Buttons    = &touchButtons{}
+	Watchdog   = noWatchdog{}
+	StatusLED  = noStatusLED{}
+	Vibration  = noVibration{}
+	Speaker    = noSpeaker{}
+	Microphone = dummyMicrophone{}
+	Encoder    = dummyEncoder{}
+)
+
+func init() {
+	AddressableLEDs = &sk6812LEDs{}
+}
+
+func boardInfo() BoardInfo {
+	return BoardInfo{
+		DisplayWidth:  296,
+		DisplayHeight: 128,
+		Keys:          append([]Key(nil), codes[:]...),
+		HasLEDs:       true,
+		NeedsFlush:    true,
+	}
+}
+
+type mainDisplay struct{}
+
+// Pixel format used by the display.
+type displayColor = pixel.Monochrome
+
+// Convert an sRGB color to the pixel format of the display, see Color. A set
+// pixel is black on this e-paper display.
+func convertDisplayColor(c color.RGBA) displayColor {
+	return convertEpaperColor(c)
+}
+
+func (d mainDisplay) PPI() int {
+	return displayPPI(112) // 296px / (66.9mm / 25.4)
+}
+
+func (d mainDisplay) Configure() Displayer[pixel.Monochrome] {
+	machine.SPI2.Configure(machine.SPIConfig{
+		// The SSD1608 datasheet lists a minimum clock cycle of 50ns for writes.
+		Frequency: displaySPIFrequency(20*machine.MHz, 20*machine.MHz),
+		SCK:       machine.GPIO18,
+		SDO:       machine.GPIO5,
+	})
+
+	display := epd2in9.New(machine.SPI2, machine.GPIO19, machine.GPIO21, machine.GPIO23, machine.GPIO22)
+	display.Configure(epd2in9.Config{
+		Rotation: epd2in9.ROTATION_270,
+	})
+
+	display.ClearDisplay()
+
+	return epaperDisplay{&display}
+}
+
+// Wrapper for the e-paper display driver, which doesn't implement DrawBitmap
+// itself.
+type epaperDisplay struct {
+	*epd2in9.Device
+}
+
+// Draw the image, clipping it if DisplaySettings.ClipDrawBitmap is enabled.
+func (d epaperDisplay) DrawBitmap(x, y int16, buf pixel.Image[pixel.Monochrome]) error {
+	width, height := d.Size()
+	return drawBitmapClipped(x, y, buf, width, height, d.drawBitmap)
+}
+
+func (d epaperDisplay) drawBitmap(x, y int16, buf pixel.Image[pixel.Monochrome]) error {
+	// Like on the Badger 2040, a set pixel is black and the zero value is
+	// white. The driver draws RGBA(0, 0, 0) as white and any other color as
+	// black, so the pixels can be passed as-is.
+	width, height := d.Size()
+	return drawBitmapPixels(x, y, buf, width, height, d.SetPixel)
+}
+
+// The e-paper display doesn't use any power while it isn't refreshing, so
+// there is nothing to do here. (The deep sleep mode of the controller can only
+// be left with a reset, which would clear the display).
+func (d epaperDisplay) Sleep(sleepEnabled bool) error {
+	return nil
+}
+
+func (d epaperDisplay) Rotation() drivers.Rotation {
+	return epaperRotation
+}
+
+func (d epaperDisplay) SetRotation(rotation drivers.Rotation) error {
+	// The driver rotation is relative to the native portrait orientation, while
+	// the board rotation is relative to the landscape orientation of the badge.
+	d.Device.SetRotation(epd2in9.Rotation((rotation + 3) % 4))
+	epaperRotation = rotation
+	return nil
+}
+
+// Current rotation of the display, as the driver doesn't provide a way to read
+// it back.
+var epaperRotation drivers.Rotation = drivers.Rotation0
+
+func (d mainDisplay) MaxBrightness() int {
+	return 0
+}
+
+func (d mainDisplay) SetBrightness(level int) {
+	// The e-paper display has no backlight.
+}
+
+func (d mainDisplay) WaitForVBlank(defaultInterval time.Duration) {
+	dummyWaitForVBlank(defaultInterval)
+}
+
+func (d mainDisplay) WaitForVBlankTimeout(defaultInterval, timeout time.Duration) bool {
+	endFrame()
+	return dummyWaitForVBlankTimeout(defaultInterval, timeout)
+}
+
+func (d mainDisplay) LastFrameDuration() time.Duration {
+	return lastFrameDuration()
+}
+
+// DrawBitmap only writes to the framebuffer of the driver, see
+// DrawTimeEstimate.
+func drawTimeEstimate(pixels int) time.Duration {
+	return 0
+}
+
+func (d mainDisplay) ConfigureTouch() TouchInput {
+	return noTouch{}
+}
+
+const mpr121Address = 0x5A
+
+// Registers of the MPR121 touch controller that are used here.
+const (
+	mpr121TouchStatus      = 0x00
+	mpr121FilterRising     = 0x2B // start of the baseline filter registers
+	mpr121TouchThreshold   = 0x41 // alternates with the release threshold
+	mpr121Debounce         = 0x5B
+	mpr121Config1          = 0x5C
+	mpr121Config2          = 0x5D
+	mpr121ElectrodeConfig  = 0x5E
+	mpr121GPIODirection    = 0x76
+	mpr121GPIOEnable       = 0x77
+	mpr121GPIOSet          = 0x78
+	mpr121GPIOClear        = 0x79
+	mpr121SoftReset        = 0x80
+	mpr121SoftResetCommand = 0x63
+)
+
+// Bit in the MPR121 GPIO registers that controls the power to the LEDs. The
+// GPIO pins start at electrode 4, so this is electrode 10.
+const mpr121LEDPower = 1 << 6
+
+var mpr121Once configureOnce
+
+// Configure the MPR121 touch controller, if not already done. Electrode 0-7
+// are used for the touch buttons, and 8-11 as GPIO pins.
+func configureMPR121() {
+	mpr121Once.do(func() error {
+		machine.I2C0.Configure(machine.I2CConfig{
+			Frequency: 400 * machine.KHz,
+			SDA:       machine.GPIO26,
+			SCL:       machine.GPIO27,
+		})
+
+		// The MPR121 can only be configured in stop mode, which is the mode it
+		// is in after a reset.
+		mpr121Write(mpr121SoftReset, mpr121SoftResetCommand)
+
+		// Baseline filter settings (rising, falling, and touched), using the
+		// values from the Adafruit MPR121 library which are known to work.
+		filter := []byte{0x01, 0x01, 0x0E, 0x00, 0x01, 0x05, 0x01, 0x00, 0x00, 0x00, 0x00}
+		machine.I2C0.WriteRegister(mpr121Address, mpr121FilterRising, filter)
+
+		// Touch and release thresholds. Lower values are more sensitive.
+		for i := 0; i < 8; i++ {
+			mpr121Write(mpr121TouchThreshold+uint8(i)*2, 12)
+			mpr121Write(mpr121TouchThreshold+uint8(i)*2+1, 6)
+		}
+		mpr121Write(mpr121Debounce, 0)
+		mpr121Write(mpr121Config1, 0x10) // 16µA charge current
+		mpr121Write(mpr121Config2, 0x20) // 0.5µs charge time
+
+		// Configure the LED power pin as an output (off for now).
+		mpr121Write(mpr121GPIODirection, mpr121LEDPower)
+		mpr121Write(mpr121GPIOEnable, mpr121LEDPower)
+
+		// Enter run mode with baseline tracking and electrodes 0-7 enabled.
+		mpr121Write(mpr121ElectrodeConfig, 0x88)
+		return nil
+	})
+}
+
+func mpr121Write(register, value uint8) error {
+	return machine.I2C0.WriteRegister(mpr121Address, register, []byte{value})
+}
+
+// Capacitive touch buttons, read through the MPR121.
+type touchButtons struct {
+	buttonState
+}
+
+func (b *touchButtons) Configure() {
+	configureMPR121()
+}
+
+func (b *touchButtons) ReadInput() {
+	// The touch status register has one bit per electrode, in the same order
+	// as codes. Keep the previous state if the read failed.
+	var status [1]byte
+	if err := machine.I2C0.ReadRegister(mpr121Address, mpr121TouchStatus, status[:]); err != nil {
+		return
+	}
+	b.read(status[0], 0)
+}
+
+func (b *touchButtons) Snapshot() {
+	b.ReadInput()
+}
+
+var codes = [8]Key{
+	KeyA,
+	KeyB,
+	KeyStart,
+	KeySelect,
+	KeyDown,
+	KeyRight,
+	KeyUp,
+	KeyLeft,
+}
+
+func (b *touchButtons) NextEvent() KeyEvent {
+	return b.nextEvent(&codes)
+}
+
+func (b *touchButtons) PeekEvent() KeyEvent {
+	return b.peekEvent(&codes)
+}
+
+func (b *touchButtons) Remap(index int, key Key) {
+	remapKey(codes[:], index, key)
+}
+
+// The 6 SK6812 RGBW LEDs on the front of the badge.
+type sk6812LEDs struct {
+	data   [6]colorGRBW
+	dirty  bool  // changed since the last update
+	dim    uint8 // 255 minus the brightness, so the zero value is full brightness
+	asleep bool  // powered off using Sleep
+}
+
+const ledPin = machine.GPIO32
+
+func (l *sk6812LEDs) Configure() {
+	// Enable power to the LEDs.
+	configureMPR121()
+	if !l.asleep {
+		mpr121Write(mpr121GPIOSet, mpr121LEDPower)
+	}
+
+	// Initialize the data pin.
+	ledPin.Configure(machine.PinConfig{Mode: machine.PinOutput})
+}
+
+func (l *sk6812LEDs) Len() int {
+	return len(l.data)
+}
+
+// Set the LED to the given color, with the white LED turned off.
+func (l *sk6812LEDs) SetRGB(i int, r, g, b uint8) {
+	l.SetRGBW(i, r, g, b, 0)
+}
+
+func (l *sk6812LEDs) SetRGBW(i int, r, g, b, w uint8) {
+	c := colorGRBW{
+		R: r,
+		G: g,
+		B: b,
+		W: w,
+	}
+	if l.data[i] != c {
+		l.data[i] = c
+		l.dirty = true
+	}
+}
+
+func (l *sk6812LEDs) SetBrightness(brightness uint8) {
+	if l.dim != 255-brightness {
+		l.dim = 255 - brightness
+		l.dirty = true
+	}
+}
+
+// Send pixel data to the LEDs, if it changed.
+func (l *sk6812LEDs) Update() {
+	if l.dirty {
+		l.ForceUpdate()
+	}
+}
+
+// Send pixel data to the LEDs. This does nothing while the LEDs are powered
+// off, the data is sent once they are powered on again.
+func (l *sk6812LEDs) ForceUpdate() {
+	if l.asleep {
+		return
+	}
+	var scaled [len(l.data)]colorGRBW
+	buf := pixelsToBytes(scaled[:])
+	scaleLEDBrightness(buf, pixelsToBytes(l.data[:]), 255-l.dim)
+	ws := ws2812.Device{Pin: ledPin}
+	ws.Write(buf)
+	l.dirty = false
+}
+
+// Cut the power to the LEDs, or restore it and send the last set colors again.
+// The LED power is switched using a GPIO pin of the MPR121 touch controller,
+// which stays powered (the touch buttons keep working).
+func (l *sk6812LEDs) Sleep(sleepEnabled bool) error {
+	l.asleep = sleepEnabled
+	if sleepEnabled {
+		return mpr121Write(mpr121GPIOClear, mpr121LEDPower)
+	}
+	if err := mpr121Write(mpr121GPIOSet, mpr121LEDPower); err != nil {
+		return err
+	}
+	// Give the LEDs some time to power up before sending data.
+	time.Sleep(time.Millisecond)
+	l.ForceUpdate()
+	return nil
+}
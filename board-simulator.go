@@ -9,10 +9,12 @@ import (
 	"bufio"
 	"errors"
 	"fmt"
+	"image/color"
 	"io"
 	"math/rand"
 	"os"
 	"os/exec"
+	"strconv"
 	"strings"
 	"sync"
 	"time"
@@ -32,22 +34,87 @@ const (
 // Support varies by board, but all boards have the following peripherals
 // defined.
 var (
-	Power   = simulatedPower{}
-	Sensors = &simulatedSensors{}
-	Display = mainDisplay{}
-	Buttons = buttonsConfig{}
+	Power   = &simulatedPower{temperature: 25_000}
+	Sensors = &simulatedSensors{
+		lightSource:    300,
+		tempSource:     20_000,
+		magneticSource: [3]float64{0, -40, -20}, // upright, facing north
+		pressureSource: 101_325_000,             // sea level
+		humiditySource: 50_00,
+	}
+	Display    = mainDisplay{}
+	Buttons    = buttonsConfig{}
+	Watchdog   = &simulatedWatchdog{}
+	StatusLED  = &simulatedStatusLED{}
+	Vibration  = &simulatedVibration{}
+	Speaker    = &simulatedSpeaker{}
+	Microphone = &simulatedMicrophone{}
+	Encoder    = &simulatedEncoder{}
 )
 
 func init() {
 	AddressableLEDs = &simulatedLEDs{}
+	SecondaryDisplay = secondaryDisplay{}
+}
+
+type simulatedPower struct {
+	lock            sync.Mutex
+	temperature     int32 // battery temperature in milli-degrees Celsius
+	overTemperature bool  // last reported by NextEvent
+	noise           noiseSource
+}
+
+// Source of random noise for simulated peripherals, seeded using
+// Simulator.RandSeed. Each peripheral has its own, so that the noise of one
+// doesn't depend on how often another is read. It is safe for concurrent use.
+type noiseSource struct {
+	lock sync.Mutex
+	rand *rand.Rand
+	seed int64 // value of Simulator.RandSeed used for rand
+}
+
+// Return a random number in the range [0, n).
+func (s *noiseSource) Int31n(n int32) int32 {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return s.source().Int31n(n)
 }
 
-type simulatedPower struct{}
+// Return a random number in the range [0, n).
+func (s *noiseSource) Intn(n int) int {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return s.source().Intn(n)
+}
+
+// Return random sensor noise in the range [-amount, amount], or 0 if
+// Simulator.SensorNoise is disabled.
+func (s *noiseSource) sensorNoise(amount int32) int32 {
+	if !Simulator.SensorNoise {
+		return 0
+	}
+	return s.Int31n(amount*2+1) - amount
+}
+
+// Return the random number generator, (re)seeding it when needed. The lock
+// must be held.
+func (s *noiseSource) source() *rand.Rand {
+	if s.rand == nil || s.seed != Simulator.RandSeed {
+		s.seed = Simulator.RandSeed
+		seed := s.seed
+		if seed == 0 {
+			seed = time.Now().UnixNano()
+		}
+		s.rand = rand.New(rand.NewSource(seed))
+	}
+	return s.rand
+}
 
 // Configure the battery status reader. This must be called before calling
 // Status.
-func (p simulatedPower) Configure() {
-	// Nothing to do here.
+func (p *simulatedPower) Configure() {
+	// Nothing to configure, but trace it like on the boards.
+	traceEnd(TraceConfigure, traceStart(), int32(TraceBatteryRead), nil)
 }
 
 // Status returns the current charge status (charging, discharging) and the
@@ -59,29 +126,134 @@ func (p simulatedPower) Configure() {
 // The value -1 means the state of charge is unknown.
 // It is often inaccurate while charging. It may be best to just show "charging"
 // instead of a specific percentage.
-func (p simulatedPower) Status() (state ChargeState, microvolts uint32, percent int8) {
+func (p *simulatedPower) Status() (state ChargeState, microvolts uint32, percent int8) {
+	start := traceStart()
 	// Pretend we're running on battery power and the battery is at 3.7V
 	// (typical lipo voltage).
-	actualMicrovolts := uint32(3700_000)
+	// The calibration is applied as usual, so that it can be tested in the
+	// simulator.
+	actualMicrovolts := calibrateBatteryVoltage(3700_000)
 	// Randomize the output a bit to fake ADC noise (programs should be able to
 	// deal with that).
-	microvolts = actualMicrovolts + rand.Uint32()%16384 - 8192
+	microvolts = actualMicrovolts + uint32(p.noise.sensorNoise(8192))
 	// Use a stable percent though, otherwise BLE battery level notifications
 	// will fluctuate way too much.
 	percent = lithumBatteryApproximation.approximate(actualMicrovolts)
+	traceEnd(TraceBatteryRead, start, int32(microvolts), nil)
 	return Discharging, microvolts, percent
 }
 
+// BatteryTemperature returns the battery temperature in milli-degrees Celsius.
+// It can be changed in the simulator window, or using a battery-temperature
+// event in a script (see Simulator.PlayScript).
+func (p *simulatedPower) BatteryTemperature() int32 {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	return p.temperature
+}
+
+// NextEvent returns an event when the battery temperature crossed
+// PowerSettings.OverTemperature since the last call.
+func (p *simulatedPower) NextEvent() PowerEvent {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	overTemperature := p.temperature >= PowerSettings.OverTemperature
+	if overTemperature == p.overTemperature {
+		return NoPowerEvent
+	}
+	p.overTemperature = overTemperature
+	if overTemperature {
+		return BatteryOverTemperature
+	}
+	return BatteryTemperatureNormal
+}
+
+// Shutdown turns off the board, if supported. Boards that can cut their own
+// power (for example, using a latching power circuit) do so, and boards that
+// can't but have a very low power sleep mode (like the PineTime) enter that
+// mode instead. Either way, Shutdown doesn't return when it succeeds: the
+// board starts from the beginning when it is turned on again, just like after
+// a reset. This is unlike sleeping the display or waiting for an event, where
+// the program keeps running and keeps its state.
+//
+// On boards that can't turn themselves off, Shutdown returns ErrNoShutdown.
+// In the simulator, the program exits.
+func (p *simulatedPower) Shutdown() error {
+	fmt.Fprintln(os.Stderr, "shutting down")
+	os.Exit(0)
+	return nil
+}
+
+// Reboot resets the board, like pressing the reset button. If toBootloader is
+// set, it enters the bootloader instead, so that new firmware can be flashed
+// (for example, from a "firmware update" menu). Reboot doesn't return when it
+// succeeds, and returns ErrNoReboot on boards where it isn't supported.
+//
+// How to flash new firmware from the bootloader depends on the board:
+//
+//   - Boards with a UF2 bootloader (Badger 2040, Gopher Badge, PyBadge,
+//     PyPortal, Thumby) show up as a USB drive, to which a .uf2 file can be
+//     copied.
+//   - The PineTime enters the bootloader after a watchdog reset, so it takes a
+//     few seconds until the watchdog expires. Firmware is then flashed over
+//     BLE. The bootloader must be the Wasp-OS bootloader (or another one that
+//     behaves the same way).
+//
+// In the simulator, Reboot only logs a message and returns nil.
+func (p *simulatedPower) Reboot(toBootloader bool) error {
+	if toBootloader {
+		fmt.Fprintln(os.Stderr, "reboot to bootloader requested")
+	} else {
+		fmt.Fprintln(os.Stderr, "reboot requested")
+	}
+	return nil
+}
+
+func boardInfo() BoardInfo {
+	return BoardInfo{
+		DisplayWidth:  int16(Simulator.WindowWidth),
+		DisplayHeight: int16(Simulator.WindowHeight),
+		Sensors:       drivers.Acceleration | drivers.Temperature | drivers.Luminosity | drivers.Distance | drivers.AngularVelocity | drivers.MagneticField | drivers.Pressure | drivers.Humidity,
+		Keys:          append([]Key(nil), codes[:]...),
+		HasLEDs:       Simulator.AddressableLEDs != 0,
+		HasTouch:      true,
+		HasBattery:    true,
+		HasEncoder:    true,
+	}
+}
+
 type mainDisplay struct{}
 
+// Pixel format used by the display.
+type displayColor = pixel.RGB888
+
+// Convert an sRGB color to the pixel format of the display, see Color.
+func convertDisplayColor(c color.RGBA) displayColor {
+	return convertColor[displayColor](c)
+}
+
 type fyneScreen struct {
 	width         int
 	height        int
 	keyevents     []KeyEvent
 	keyeventsLock sync.Mutex
-	touchID       uint32
-	touches       [1]TouchPoint
-	touchesLock   sync.Mutex
+
+	// Number of events in keyevents that arrived before the last snapshot,
+	// when Buttons.Snapshot was used.
+	keyeventsLatched  int
+	keyeventsSnapshot bool
+
+	touchID     uint32
+	touches     [1]TouchPoint
+	newTouch    bool // a touch started since the last call to touchStarted
+	touchesLock sync.Mutex
+
+	// Last touch report, for Simulator.TouchReportRate and TouchJitter.
+	reportedTouches [1]TouchPoint
+	lastTouchReport time.Time
+
+	// Noise for Simulator.TouchJitter.
+	noise noiseSource
 }
 
 var screen = &fyneScreen{}
@@ -90,17 +262,32 @@ var screen = &fyneScreen{}
 //
 // Boards without a display will return nil.
 func (d mainDisplay) Configure() Displayer[pixel.RGB888] {
+	defer traceEnd(TraceConfigure, traceStart(), int32(TraceDisplayDraw), nil)
 	startWindow()
 	screen.width = Simulator.WindowWidth
 	screen.height = Simulator.WindowHeight
 	windowSendCommand(fmt.Sprintf("display %d %d", screen.width, screen.height), nil)
+	mask := Simulator.WindowCircleMask
+	windowSendCommand(fmt.Sprintf("display-mask %d %d %d", mask.X, mask.Y, mask.Radius), nil)
+	outline := Simulator.WindowOutline
+	windowSendCommand(fmt.Sprintf("display-outline %d %d %d", outline.CornerRadius, outline.NotchWidth, outline.NotchHeight), nil)
+	swapRedBlue := 0
+	if DisplaySettings.SwapRedBlue {
+		swapRedBlue = 1
+	}
+	windowSendCommand(fmt.Sprintf("display-swap-rb %d", swapRedBlue), nil)
+	windowSendCommand(fmt.Sprintf("display-depth %d", Simulator.WindowColorDepth), nil)
+	displayBacklight.setInitialBrightness(d.MaxBrightness())
 	return screen
 }
 
 // MaxBrightness returns the maximum brightness value. A maximum brightness
 // value of 0 means that this display doesn't support changing the brightness.
 func (d mainDisplay) MaxBrightness() int {
-	return 1
+	if Simulator.WindowMaxBrightness <= 0 {
+		return 1
+	}
+	return Simulator.WindowMaxBrightness
 }
 
 // SetBrightness sets brightness level of the display. It should be:
@@ -110,8 +297,14 @@ func (d mainDisplay) MaxBrightness() int {
 // A value of 0 turns the backlight off entirely (but may leave the display
 // running with nothing visible).
 func (d mainDisplay) SetBrightness(level int) {
-	// Send the current and max brightness levels.
-	windowSendCommand(fmt.Sprintf("display-brightness %d %d", level, 1), nil)
+	displayBacklight.setBrightness(level)
+}
+
+var displayBacklight = backlight{
+	set: func(level int) {
+		// Send the current and max brightness levels.
+		windowSendCommand(fmt.Sprintf("display-brightness %d %d", level, Display.MaxBrightness()), nil)
+	},
 }
 
 // Wait until the next vertical blanking interval (vblank) interrupt is
@@ -123,48 +316,223 @@ func (d mainDisplay) SetBrightness(level int) {
 // period where the framebuffer is not being touched and can be updated without
 // tearing.
 //
+// In the simulator, Simulator.EmulateTE can be used to emulate the vblank
+// timing of a display with a TE signal instead.
+//
 // Don't use this method for timing, because vblank varies by hardware. Instead,
 // use time.Now() to determine the current time and the amount of time since the
 // last screen refresh.
 //
 // TODO: this is not a great API (it's blocking), it may change in the future.
 func (d mainDisplay) WaitForVBlank(defaultInterval time.Duration) {
+	d.WaitForVBlankTimeout(defaultInterval, 0)
+}
+
+// WaitForVBlankTimeout is like WaitForVBlank, but waits at most the given
+// timeout (0 means no timeout). It returns true when vblank was reached, and
+// false when the timeout passed first. On boards that detect vblank by polling
+// the display (like the PyPortal, Gopher Badge, and PineTime), this avoids
+// hanging forever when the display doesn't respond.
+func (d mainDisplay) WaitForVBlankTimeout(defaultInterval, timeout time.Duration) bool {
+	endFrame()
+	waitWhilePaused()
+	if Simulator.EmulateTE {
+		return waitForEmulatedTE(scaledDuration(timeout))
+	}
 	// I'm sure there is some SDL2 API we could use here, but I couldn't find
 	// one easily so just emulate it.
-	dummyWaitForVBlank(defaultInterval)
+	return dummyWaitForVBlankTimeout(scaledDuration(defaultInterval), scaledDuration(timeout))
+}
+
+// LastFrameDuration returns how long it took to draw the last frame: the time
+// spent in DrawBitmap and Display calls between the last two calls to
+// WaitForVBlank (or up to the last Display call). Time spent in the app
+// itself, for example to prepare the image buffers, is not included. This is
+// useful to show performance information like an FPS counter.
+//
+// It returns 0 if no frame was drawn yet, and on boards where drawing isn't
+// measured (the MCH2022 badge, Badger 2040, and Thumby, which use the display
+// driver directly). The simulator measures the time it takes to send all rows
+// of the image to the window, including the delay from WindowDrawSpeed.
+func (d mainDisplay) LastFrameDuration() time.Duration {
+	return lastFrameDuration()
+}
+
+// Drawing is delayed by Simulator.WindowDrawSpeed for every pixel.
+func drawTimeEstimate(pixels int) time.Duration {
+	return scaledDuration(Simulator.WindowDrawSpeed * time.Duration(pixels))
+}
+
+// Convert a duration in simulated time to real time, see Simulator.TimeScale.
+func scaledDuration(duration time.Duration) time.Duration {
+	if Simulator.TimeScale <= 0 {
+		return duration
+	}
+	return time.Duration(float64(duration) / Simulator.TimeScale)
 }
 
 // Pixels per inch for this display.
 func (d mainDisplay) PPI() int {
-	return Simulator.WindowPPI
+	return displayPPI(Simulator.WindowPPI)
 }
 
 func (d mainDisplay) ConfigureTouch() TouchInput {
+	defer traceEnd(TraceConfigure, traceStart(), int32(TraceTouchRead), nil)
 	startWindow()
 
 	return sdltouch{}
 }
 
+// Error injected using Simulator.InjectDisplayError, returned by the next call
+// to DrawBitmap or Display.
+var injectedDisplayError struct {
+	lock sync.Mutex
+	err  error
+}
+
+func injectDisplayError(err error) {
+	injectedDisplayError.lock.Lock()
+	injectedDisplayError.err = err
+	injectedDisplayError.lock.Unlock()
+}
+
+// Return the injected display error (if any), and clear it.
+func takeDisplayError() error {
+	injectedDisplayError.lock.Lock()
+	defer injectedDisplayError.lock.Unlock()
+	err := injectedDisplayError.err
+	injectedDisplayError.err = nil
+	return err
+}
+
+// Simulated bus that is shared by the displays and the sensors, like SPI0 and
+// I2C1 on the PineTime. It is normally never busy for long, except when
+// stalled using Simulator.StallBus.
+var simulatedBus busLock
+
+func stallBus(duration time.Duration) {
+	simulatedBus.lock.Lock()
+	time.AfterFunc(duration, simulatedBus.release)
+}
+
+// State of the emulated tearing effect signal, see Simulator.EmulateTE.
+var emulatedTE struct {
+	lock       sync.Mutex
+	epoch      time.Time // reference point for the start of every frame
+	frameStart time.Time // start of the frame when WaitForVBlank returned
+	torn       bool      // whether this frame was already counted as torn
+	tornFrames int
+}
+
+func init() {
+	emulatedTE.epoch = time.Now()
+}
+
+// Return the frame time and blanking time for Simulator.EmulateTE.
+func emulatedTETiming() (frame, blanking time.Duration) {
+	rate := Simulator.TERefreshRate
+	if rate <= 0 {
+		rate = 60
+	}
+	frame = time.Second / time.Duration(rate)
+	blanking = Simulator.TEBlankingTime
+	if blanking <= 0 {
+		blanking = frame / 10
+	}
+	return scaledDuration(frame), scaledDuration(blanking)
+}
+
+// Wait for the start of the next frame of the emulated display, like waiting
+// for the TE signal on a real display. It returns false if the timeout (when
+// non-zero) passes first.
+func waitForEmulatedTE(timeout time.Duration) bool {
+	frame, _ := emulatedTETiming()
+	now := time.Now()
+	wait := frame - now.Sub(emulatedTE.epoch)%frame
+	if timeout > 0 && wait > timeout {
+		time.Sleep(timeout)
+		return false
+	}
+	time.Sleep(wait)
+	emulatedTE.lock.Lock()
+	emulatedTE.frameStart = now.Add(wait)
+	emulatedTE.torn = false
+	emulatedTE.lock.Unlock()
+	return true
+}
+
+// Count the current frame as torn when drawing isn't done within the blanking
+// period of the frame.
+func checkEmulatedTE() {
+	if !Simulator.EmulateTE {
+		return
+	}
+	_, blanking := emulatedTETiming()
+	emulatedTE.lock.Lock()
+	defer emulatedTE.lock.Unlock()
+	if !emulatedTE.frameStart.IsZero() && !emulatedTE.torn && time.Since(emulatedTE.frameStart) > blanking {
+		emulatedTE.torn = true
+		emulatedTE.tornFrames++
+	}
+}
+
+func tornFrames() int {
+	emulatedTE.lock.Lock()
+	defer emulatedTE.lock.Unlock()
+	return emulatedTE.tornFrames
+}
+
 func (s *fyneScreen) Display() error {
-	// Nothing to do here.
-	return nil
+	// Nothing to do here, except for simulated errors.
+	defer endFrame()
+	start := traceStart()
+	err := s.display()
+	traceEnd(TraceDisplayFlush, start, 0, err)
+	return err
+}
+
+func (s *fyneScreen) display() error {
+	if err := simulatedBus.acquire(); err != nil {
+		return err
+	}
+	defer simulatedBus.release()
+	checkEmulatedTE()
+	return takeDisplayError()
 }
 
 func (s *fyneScreen) DrawBitmap(x, y int16, image pixel.Image[pixel.RGB888]) error {
+	start := traceStart()
+	err := s.drawBitmap(x, y, image)
+	width, height := image.Size()
+	traceEnd(TraceDisplayDraw, start, int32(width*height), err)
+	return err
+}
+
+func (s *fyneScreen) drawBitmap(x, y int16, image pixel.Image[pixel.RGB888]) error {
+	if err := takeDisplayError(); err != nil {
+		return err
+	}
 	displayWidth, displayHeight := s.Size()
 	width, height := image.Size()
-	if x < 0 || y < 0 || width <= 0 || height <= 0 ||
-		int(x)+width > int(displayWidth) || int(y)+height > int(displayHeight) {
-		return errors.New("board: drawing out of bounds")
+	if !fitsDisplay(x, y, width, height, displayWidth, displayHeight) {
+		if DisplaySettings.ClipDrawBitmap {
+			return drawClipped(x, y, image, displayWidth, displayHeight, s.drawBitmap)
+		}
+		return ErrOutOfBounds
+	}
+	if err := simulatedBus.acquire(); err != nil {
+		return err
 	}
+	defer simulatedBus.release()
 	buf := image.RawBuffer()
 	drawStart := time.Now()
+	defer addFrameTime(drawStart)
 	lastUpdate := drawStart
 	for bufy := 0; bufy < int(height); bufy++ {
 		// Delay drawing a bit, to simulate a slow SPI bus.
 		if Simulator.WindowDrawSpeed != 0 {
 			now := time.Now()
-			expected := drawStart.Add(Simulator.WindowDrawSpeed * time.Duration(bufy*int(width)))
+			expected := drawStart.Add(scaledDuration(Simulator.WindowDrawSpeed * time.Duration(bufy*int(width))))
 			delay := expected.Sub(now)
 			if delay > 0 {
 				time.Sleep(delay)
@@ -180,30 +548,43 @@ func (s *fyneScreen) DrawBitmap(x, y int16, image pixel.Image[pixel.RGB888]) err
 		lineBuf := buf[index : index+int(width)*3]
 		windowSendCommand(fmt.Sprintf("draw %d %d %d", x, int(y)+bufy, width), lineBuf)
 	}
+	checkEmulatedTE()
 	return nil
 }
 
+// Set a single pixel, see PixelSetter.
+func (s *fyneScreen) SetPixel(x, y int16, c pixel.RGB888) error {
+	img := pixel.NewImage[pixel.RGB888](1, 1)
+	img.Set(0, 0, c)
+	return s.DrawBitmap(x, y, img)
+}
+
 func (s *fyneScreen) Size() (width, height int16) {
 	return int16(s.width), int16(s.height)
 }
 
 // Set sleep mode for this screen.
+// The backlight is turned off while sleeping.
 func (s *fyneScreen) Sleep(sleepEnabled bool) error {
-	// This is a no-op.
-	// TODO: use a different gray than when the backlight is set to zero, to
-	// indicate sleep mode.
-	return nil
+	return displayBacklight.sleep(sleepEnabled, func(sleepEnabled bool) error {
+		// There is no display controller to put to sleep, but the window
+		// shows a different gray than when only the backlight is off.
+		sleeping := 0
+		if sleepEnabled {
+			sleeping = 1
+		}
+		windowSendCommand(fmt.Sprintf("sleep %d", sleeping), nil)
+		return nil
+	})
 }
 
-var errNoRotation = errors.New("error: SetRotation isn't supported")
-
 func (s *fyneScreen) Rotation() drivers.Rotation {
 	return drivers.Rotation0
 }
 
 func (s *fyneScreen) SetRotation(rotation drivers.Rotation) error {
 	// TODO: implement this, to be able to test rotation support.
-	return errNoRotation
+	return ErrRotationUnsupported
 }
 
 func (s *fyneScreen) SetScrollArea(topFixedArea, bottomFixedArea int16) {
@@ -218,82 +599,507 @@ func (s *fyneScreen) StopScroll() {
 	windowSendCommand(fmt.Sprintf("scroll-stop"), nil)
 }
 
+type secondaryDisplay struct{}
+
+var secondaryScreen = &fyneSecondaryScreen{}
+
+// Configure returns the secondary display, if Simulator.SecondaryDisplayWidth
+// and Simulator.SecondaryDisplayHeight are set. Otherwise it returns nil.
+func (d secondaryDisplay) Configure() Displayer[pixel.Monochrome] {
+	if Simulator.SecondaryDisplayWidth <= 0 || Simulator.SecondaryDisplayHeight <= 0 {
+		return nil
+	}
+	startWindow()
+	secondaryScreen.width = Simulator.SecondaryDisplayWidth
+	secondaryScreen.height = Simulator.SecondaryDisplayHeight
+	windowSendCommand(fmt.Sprintf("secondary-display %d %d", secondaryScreen.width, secondaryScreen.height), nil)
+	return secondaryScreen
+}
+
+// Simulated secondary display, a monochrome display like a small OLED. It
+// shares simulatedBus with the main display.
+type fyneSecondaryScreen struct {
+	width  int
+	height int
+}
+
+func (s *fyneSecondaryScreen) Size() (width, height int16) {
+	return int16(s.width), int16(s.height)
+}
+
+func (s *fyneSecondaryScreen) DrawBitmap(x, y int16, image pixel.Image[pixel.Monochrome]) error {
+	displayWidth, displayHeight := s.Size()
+	width, height := image.Size()
+	if !fitsDisplay(x, y, width, height, displayWidth, displayHeight) {
+		if DisplaySettings.ClipDrawBitmap {
+			return drawClipped(x, y, image, displayWidth, displayHeight, s.DrawBitmap)
+		}
+		return ErrOutOfBounds
+	}
+	if err := simulatedBus.acquire(); err != nil {
+		return err
+	}
+	defer simulatedBus.release()
+	// Send every row with one byte per pixel, 0 for off and 1 for on.
+	lineBuf := make([]byte, width)
+	for row := 0; row < height; row++ {
+		for col := 0; col < width; col++ {
+			lineBuf[col] = 0
+			if image.Get(col, row) {
+				lineBuf[col] = 1
+			}
+		}
+		windowSendCommand(fmt.Sprintf("secondary-draw %d %d %d", x, int(y)+row, width), lineBuf)
+	}
+	return nil
+}
+
+// Set a single pixel, see PixelSetter.
+func (s *fyneSecondaryScreen) SetPixel(x, y int16, c pixel.Monochrome) error {
+	img := pixel.NewImage[pixel.Monochrome](1, 1)
+	img.Set(0, 0, c)
+	return s.DrawBitmap(x, y, img)
+}
+
+func (s *fyneSecondaryScreen) Display() error {
+	// Nothing to do here, DrawBitmap updates the window directly.
+	return nil
+}
+
+// Set sleep mode, which turns the display black in the window.
+func (s *fyneSecondaryScreen) Sleep(sleepEnabled bool) error {
+	sleeping := 0
+	if sleepEnabled {
+		sleeping = 1
+	}
+	windowSendCommand(fmt.Sprintf("secondary-sleep %d", sleeping), nil)
+	return nil
+}
+
+func (s *fyneSecondaryScreen) Rotation() drivers.Rotation {
+	return drivers.Rotation0
+}
+
+func (s *fyneSecondaryScreen) SetRotation(rotation drivers.Rotation) error {
+	return ErrRotationUnsupported
+}
+
 type sdltouch struct{}
 
+// Return the current touch as if it was read from a resistive touch screen
+// covering the window, see RawTouchReader.
+func (s sdltouch) ReadRawTouch() RawTouch {
+	screen.touchesLock.Lock()
+	defer screen.touchesLock.Unlock()
+	point := screen.touches[0]
+	if point.ID == 0 {
+		return RawTouch{}
+	}
+	return RawTouch{
+		X: uint16(clampInt(int(point.X)*65535/clampInt(Simulator.WindowWidth-1, 1, 65535), 0, 65535)),
+		Y: uint16(clampInt(int(point.Y)*65535/clampInt(Simulator.WindowHeight-1, 1, 65535), 0, 65535)),
+		Z: 65535,
+	}
+}
+
 func (s sdltouch) ReadTouch() []TouchPoint {
+	start := traceStart()
+	touches := s.readTouch()
+	traceEnd(TraceTouchRead, start, int32(len(touches)), nil)
+	return touches
+}
+
+func (s sdltouch) readTouch() []TouchPoint {
 	screen.touchesLock.Lock()
 	defer screen.touchesLock.Unlock()
 
-	if screen.touches[0].ID != 0 {
-		return screen.touches[:1]
+	if Simulator.TouchReportRate <= 0 && Simulator.TouchJitter <= 0 {
+		// Report touches as-is.
+		if screen.touches[0].ID != 0 {
+			return screen.touches[:1]
+		}
+		return nil
+	}
+
+	// Only make a new report once per report interval, like a real touch
+	// controller.
+	now := time.Now()
+	if Simulator.TouchReportRate > 0 && now.Sub(screen.lastTouchReport) < scaledDuration(time.Second/time.Duration(Simulator.TouchReportRate)) {
+		if screen.reportedTouches[0].ID != 0 {
+			return screen.reportedTouches[:1]
+		}
+		return nil
+	}
+	screen.lastTouchReport = now
+
+	point := screen.touches[0]
+	if point.ID != 0 && Simulator.TouchJitter > 0 {
+		// Add some noise, while keeping the point on the screen.
+		jitter := Simulator.TouchJitter
+		point.X = int16(clampInt(int(point.X)+screen.noise.Intn(jitter*2+1)-jitter, 0, Simulator.WindowWidth-1))
+		point.Y = int16(clampInt(int(point.Y)+screen.noise.Intn(jitter*2+1)-jitter, 0, Simulator.WindowHeight-1))
+	}
+	screen.reportedTouches[0] = point
+	if point.ID != 0 {
+		return screen.reportedTouches[:1]
 	}
 	return nil
 }
 
+// Limit value to the range low..high (inclusive).
+func clampInt(value, low, high int) int {
+	if value < low {
+		return low
+	}
+	if value > high {
+		return high
+	}
+	return value
+}
+
+// Return whether a touch started since the last call, even if it has already
+// ended. Used by StandbyUntilTouch so that short taps aren't missed.
+func (s sdltouch) touchStarted() bool {
+	screen.touchesLock.Lock()
+	defer screen.touchesLock.Unlock()
+
+	started := screen.newTouch
+	screen.newTouch = false
+	return started
+}
+
 type buttonsConfig struct{}
 
+// Keys that can be sent by the simulator window, which act as the physical
+// buttons of the simulator.
+var simulatorKeys = [34]Key{
+	KeyLeft, KeyRight, KeyUp, KeyDown, KeyEscape, KeyEnter, KeySpace, KeyA, KeyB,
+	KeyF1, KeyF2, KeyF3, KeyF4, KeyF5, KeyF6, KeyF7, KeyF8, KeyF9, KeyF10, KeyF11, KeyF12,
+	Key0, Key1, Key2, Key3, Key4, Key5, Key6, Key7, Key8, Key9,
+	KeyTab, KeyBackspace, KeyDelete,
+}
+
+// Key codes returned by NextEvent for each of simulatorKeys.
+var codes = simulatorKeys
+
 func (b buttonsConfig) Configure() {
 }
 
 func (b buttonsConfig) ReadInput() {
+	screen.keyeventsLock.Lock()
+	defer screen.keyeventsLock.Unlock()
+	screen.keyeventsLatched = len(screen.keyevents)
+}
+
+// Snapshot reads the buttons and latches their state, so that NextEvent and
+// PeekEvent only return the changes up to this instant until the next call to
+// Snapshot. Input that changes halfway through a frame (for example, while
+// drawing) is then only seen at the start of the next frame:
+//
+//	for {
+//		board.Buttons.Snapshot()
+//		for event := board.Buttons.NextEvent(); event != board.NoKeyEvent; event = board.Buttons.NextEvent() {
+//			// handle event
+//		}
+//		// update and draw the frame
+//	}
+//
+// On real boards ReadInput already latches the button state in the same way,
+// so there Snapshot is the same as ReadInput. The simulator however normally
+// returns key events from NextEvent as soon as they arrive from the window.
+// After the first call to Snapshot, it latches the key events like real boards
+// do, on each call to Snapshot or ReadInput.
+func (b buttonsConfig) Snapshot() {
+	screen.keyeventsLock.Lock()
+	defer screen.keyeventsLock.Unlock()
+	screen.keyeventsLatched = len(screen.keyevents)
+	screen.keyeventsSnapshot = true
+}
+
+// Return whether there is a key event that can be returned by NextEvent. The
+// keyeventsLock must be held.
+func (s *fyneScreen) hasKeyEvent() bool {
+	if s.keyeventsSnapshot {
+		return s.keyeventsLatched != 0
+	}
+	return len(s.keyevents) != 0
 }
 
 func (b buttonsConfig) NextEvent() KeyEvent {
 	screen.keyeventsLock.Lock()
 	defer screen.keyeventsLock.Unlock()
 
-	if len(screen.keyevents) != 0 {
+	if screen.hasKeyEvent() {
 		event := screen.keyevents[0]
 		copy(screen.keyevents, screen.keyevents[1:])
 		screen.keyevents = screen.keyevents[:len(screen.keyevents)-1]
-		return event
+		if screen.keyeventsLatched > 0 {
+			screen.keyeventsLatched--
+		}
+		return remapKeyEvent(event)
 	}
 	return NoKeyEvent
 }
 
+// PeekEvent returns the event that the next call to NextEvent will return,
+// without consuming it. This can be used to look ahead, for example to handle
+// a press and release of the same key in a single frame differently.
+func (b buttonsConfig) PeekEvent() KeyEvent {
+	screen.keyeventsLock.Lock()
+	defer screen.keyeventsLock.Unlock()
+
+	if screen.hasKeyEvent() {
+		return remapKeyEvent(screen.keyevents[0])
+	}
+	return NoKeyEvent
+}
+
+// Replace the key in an event from the window with the key it is remapped to.
+func remapKeyEvent(event KeyEvent) KeyEvent {
+	for i, key := range simulatorKeys {
+		if event.Key() == key {
+			return event&keyReleased | KeyEvent(codes[i])
+		}
+	}
+	return event
+}
+
+func (b buttonsConfig) Remap(index int, key Key) {
+	remapKey(codes[:], index, key)
+}
+
+// Signalled when a new input event arrives, to wake up waitForInput.
+var inputSignal = make(chan struct{}, 1)
+
+// Add a key event to the queue of key events to be returned by NextEvent.
+func addKeyEvent(key KeyEvent) {
+	screen.keyeventsLock.Lock()
+	screen.keyevents = append(screen.keyevents, key)
+	screen.keyeventsLock.Unlock()
+	signalInput()
+}
+
+// Wake up waitForInput, if it is waiting.
+func signalInput() {
+	select {
+	case inputSignal <- struct{}{}:
+	default:
+		// Already signalled.
+	}
+}
+
+// Wait for new input, or until the given duration has passed. Both key presses
+// and the start of a touch wake it up.
+func waitForInput(d time.Duration) {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-inputSignal:
+	case <-timer.C:
+	}
+}
+
 type simulatedSensors struct {
-	configured  drivers.Measurement
-	lock        sync.Mutex
-	accelSource [3]float64
-	stepsSource uint32
-	accel       [3]int32
-	steps       uint32
-	temp        int32
+	configured      drivers.Measurement
+	lock            sync.Mutex
+	accelSource     [3]float64
+	stepsSource     uint32
+	lightSource     int32
+	proximitySource int32
+	gyroSource      [3]float64 // in °/s
+	magneticSource  [3]float64 // in µT
+	tempSource      int32
+	pressureSource  int32
+	humiditySource  int32
+	accel           [3]int32
+	steps           uint32
+	temp            int32
+	light           uint32
+	proximity       uint32
+	gyro            [3]int32
+	magnetic        [3]int32
+	pressure        int32
+	humidity        int32
+
+	noise noiseSource
+
+	// State of the simulated accelerometer FIFO, for ReadAccelBuffer.
+	fifoTime    time.Time // time of the oldest sample in the FIFO
+	shakeFrames int       // number of samples left in the current shake
+
+	// Errors injected using Simulator.InjectSensorError, one per measurement
+	// bit.
+	injectedErrors [32]error
+}
+
+func injectSensorError(which drivers.Measurement, err error) {
+	Sensors.lock.Lock()
+	defer Sensors.lock.Unlock()
+	for i := range Sensors.injectedErrors {
+		if which&(1<<i) != 0 {
+			Sensors.injectedErrors[i] = err
+		}
+	}
+}
+
+// Return the sensors that have an injected error.
+func (s *simulatedSensors) failing() drivers.Measurement {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	var failing drivers.Measurement
+	for i, err := range s.injectedErrors {
+		if err != nil {
+			failing |= 1 << i
+		}
+	}
+	return failing
+}
+
+// Return the first injected error for the given sensors, if there is one.
+func (s *simulatedSensors) injectedError(which drivers.Measurement) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	for i, err := range s.injectedErrors {
+		if which&(1<<i) != 0 && err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Available returns the sensors that are actually present, which can be
+// configured and used. On real boards, this is checked by asking each sensor
+// for its identity (like the WHO_AM_I register of many sensors), so it can
+// differ from Info().Sensors for example when a sensor is broken or when a
+// board comes in variants with different sensors. Available may be called
+// before Configure.
+//
+// The simulator has all sensors listed in Info().Sensors, except those that
+// fail with an error injected with Simulator.InjectSensorError.
+func (s *simulatedSensors) Available() drivers.Measurement {
+	return boardInfo().Sensors &^ s.failing()
 }
 
 // Configure configures all sensors as specified in the which parameter.
 // If there is an error, none of the sensors can be relied upon to work.
+//
+// Configure can be called multiple times, sensors that were configured before
+// stay configured.
 func (s *simulatedSensors) Configure(which drivers.Measurement) error {
-	s.configured = which
-	return nil
+	start := traceStart()
+	err := s.configure(which)
+	traceEnd(TraceConfigure, start, int32(TraceSensorUpdate), err)
+	return err
+}
+
+func (s *simulatedSensors) configure(which drivers.Measurement) error {
+	// Sensors with an injected error aren't configured, but the others are.
+	injected := s.injectedError(which)
+	which &^= s.failing()
+	if err := simulatedBus.acquire(); err != nil {
+		return err
+	}
+	defer simulatedBus.release()
+	s.lock.Lock()
+	if which&drivers.Acceleration != 0 && s.fifoTime.IsZero() {
+		s.fifoTime = time.Now()
+	}
+	s.lock.Unlock()
+	s.configured |= which
+	return injected
 }
 
 // Update updates the sensor values as given in the which parameter.
 // All sensors in the which parameter must have been configured before, or the
 // behavior may be unpredictable.
 func (s *simulatedSensors) Update(which drivers.Measurement) error {
+	start := traceStart()
+	err := s.update(which)
+	traceEnd(TraceSensorUpdate, start, int32(which), err)
+	return err
+}
+
+func (s *simulatedSensors) update(which drivers.Measurement) error {
+	// Sensors with an injected error aren't updated, but the others are.
+	injected := s.injectedError(which)
+	which &^= s.failing()
 	if which != s.configured&which {
 		// This is a bug. Don't check it on each board, but do check it in the
 		// simulator.
 		panic("asked to update sensors that weren't configured")
 	}
+	if which == 0 {
+		return injected
+	}
+	if err := simulatedBus.acquire(); err != nil {
+		return err
+	}
+	defer simulatedBus.release()
 
 	if which&drivers.Acceleration != 0 {
 		s.lock.Lock()
 		// Add some noise to the accelerometer to make the values more
 		// realistic.
-		s.accel[0] = rand.Int31n(30_000) - 15_000 + int32(s.accelSource[0]*1000_000) // x
-		s.accel[1] = rand.Int31n(30_000) - 15_000 + int32(s.accelSource[1]*1000_000) // y
-		s.accel[2] = rand.Int31n(30_000) - 15_000 + int32(s.accelSource[2]*1000_000) // z
+		s.accel[0] = s.noise.sensorNoise(15_000) + int32(s.accelSource[0]*1000_000) // x
+		s.accel[1] = s.noise.sensorNoise(15_000) + int32(s.accelSource[1]*1000_000) // y
+		s.accel[2] = s.noise.sensorNoise(15_000) + int32(s.accelSource[2]*1000_000) // z
 		s.steps = s.stepsSource
 		s.lock.Unlock()
 	}
 	if which&drivers.Temperature != 0 {
-		// Temperature around 20°C (with some jitter thrown in for a good
-		// simulation).
-		s.temp = 20000 + rand.Int31n(200) - 100
+		// Temperature set in the window (by default 20°C), with some jitter
+		// thrown in for a good simulation.
+		s.lock.Lock()
+		s.temp = s.tempSource + s.noise.sensorNoise(100)
+		s.lock.Unlock()
 	}
-	return nil
+	if which&drivers.Luminosity != 0 {
+		// Light level set in the window (by default a moderately lit room),
+		// with some jitter.
+		s.lock.Lock()
+		s.light = uint32(clampInt(int(s.lightSource+s.noise.sensorNoise(10)), 0, 1000))
+		s.lock.Unlock()
+	}
+	if which&drivers.Distance != 0 {
+		// Proximity set in the window (by default nothing is near), with
+		// a little jitter like the noise of a real sensor.
+		s.lock.Lock()
+		s.proximity = uint32(clampInt(int(s.proximitySource+s.noise.sensorNoise(2)), 0, 255))
+		s.lock.Unlock()
+	}
+	if which&drivers.AngularVelocity != 0 {
+		// Rotation set in the window (by default not rotating), with noise of
+		// around 0.1°/s like a MEMS gyroscope.
+		s.lock.Lock()
+		for i, source := range s.gyroSource {
+			s.gyro[i] = s.noise.sensorNoise(100_000) + int32(source*1000_000)
+		}
+		s.lock.Unlock()
+	}
+	if which&drivers.MagneticField != 0 {
+		// Magnetic field set in the window (by default the field of the Earth
+		// in Europe), with noise of around 0.5µT.
+		s.lock.Lock()
+		for i, source := range s.magneticSource {
+			s.magnetic[i] = s.noise.sensorNoise(500) + int32(source*1000)
+		}
+		s.lock.Unlock()
+	}
+	if which&drivers.Pressure != 0 {
+		// Air pressure set in the window (by default at sea level), with a
+		// few Pascal of noise.
+		s.lock.Lock()
+		s.pressure = s.pressureSource + s.noise.sensorNoise(2000)
+		s.lock.Unlock()
+	}
+	if which&drivers.Humidity != 0 {
+		// Relative humidity set in the window (by default 50%), with a bit of
+		// noise.
+		s.lock.Lock()
+		s.humidity = int32(clampInt(int(s.humiditySource+s.noise.sensorNoise(20)), 0, 100_00))
+		s.lock.Unlock()
+	}
+	return injected
 }
 
 // Acceleration returns the last read acceleration in µg (micro-gravity). This
@@ -306,9 +1112,66 @@ func (s *simulatedSensors) Update(which drivers.Measurement) error {
 // the left (counter-clockwise), the X axis is around 1g.
 //
 // The simulator returns values as if the device is held upright like you'd hold
-// a phone while taking a selfie.
+// a phone while taking a selfie. SensorSettings.AxisMapping is applied to these
+// values, like on real boards.
 func (s *simulatedSensors) Acceleration() (x, y, z int32) {
-	return s.accel[0], s.accel[1], s.accel[2]
+	return mapAcceleration(AxisMapping{}, s.accel[0], s.accel[1], s.accel[2])
+}
+
+// Sample rate and FIFO depth of the simulated accelerometer.
+const (
+	simulatedAccelRate      = 50 // Hz
+	simulatedAccelFIFODepth = 32
+)
+
+// ReadAccelBuffer returns the samples that the simulated accelerometer
+// collected since the last call, like a hardware FIFO of 32 samples at 50Hz
+// (see accelfifo.go). The samples are around the acceleration set in the
+// window, with noise. After the Shake button in the window is pressed, the
+// next samples move strongly back and forth along the X axis.
+func (s *simulatedSensors) ReadAccelBuffer(buf [][3]int32) (int, error) {
+	if err := s.injectedError(drivers.Acceleration); err != nil {
+		return 0, err
+	}
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if s.fifoTime.IsZero() {
+		// The accelerometer wasn't configured.
+		return 0, nil
+	}
+
+	// Determine how many samples are in the FIFO. When it overflowed, the
+	// oldest samples were dropped.
+	const period = time.Second / simulatedAccelRate
+	now := time.Now()
+	available := int(now.Sub(s.fifoTime) / period)
+	if available > simulatedAccelFIFODepth {
+		s.fifoTime = s.fifoTime.Add(time.Duration(available-simulatedAccelFIFODepth) * period)
+		available = simulatedAccelFIFODepth
+	}
+	n := available
+	if n > len(buf) {
+		n = len(buf)
+	}
+	s.fifoTime = s.fifoTime.Add(time.Duration(n) * period)
+
+	for i := range buf[:n] {
+		var sample [3]int32
+		for axis := range sample {
+			sample[axis] = s.noise.sensorNoise(15_000) + int32(s.accelSource[axis]*1000_000)
+		}
+		if s.shakeFrames > 0 {
+			// Change direction every 2 samples: 12.5Hz at 50Hz, a fast shake.
+			if s.shakeFrames/2%2 == 0 {
+				sample[0] += 2000_000
+			} else {
+				sample[0] -= 2000_000
+			}
+			s.shakeFrames--
+		}
+		buf[i][0], buf[i][1], buf[i][2] = mapAcceleration(AxisMapping{}, sample[0], sample[1], sample[2])
+	}
+	return n, nil
 }
 
 // Steps returns the number of steps since the step counter started.
@@ -319,44 +1182,414 @@ func (s *simulatedSensors) Steps() (steps uint32) {
 	return s.steps
 }
 
-// Temperature returns the temperature that was last read from the sensor.
-// If there are multiple temperature sensors on a given board, the most accurate
-// result will be returned.
+// Temperature returns the temperature that was last read from the sensor, in
+// milli-degrees Celsius (so 20000 means 20°C). If there are multiple
+// temperature sensors on a given board, the most accurate result will be
+// returned. Use CelsiusToFahrenheit, CelsiusToKelvin or FormatTemperature to
+// convert it to other units.
 //
-// The simulator returns a fixed temperature, with some jitter to make it look
-// more like a real-world sensor (no sensor is without noise).
+// The temperature can be changed in the simulator window, and is 20°C by
+// default. Some jitter is added to make it look more like a real-world sensor
+// (no sensor is without noise).
 func (s *simulatedSensors) Temperature() int32 {
 	return s.temp
 }
 
-type simulatedLEDs struct {
-	data []byte
+// Light returns the ambient light level that was last read from the sensor, in
+// the range 0 (dark) to 1000 (very bright). This is a relative value, not a
+// calibrated unit like lux: the same light may give a different value on
+// different boards.
+//
+// The light level can be changed in the simulator window, and is 300 (a
+// moderately lit room) by default. Some jitter is added to it.
+func (s *simulatedSensors) Light() uint32 {
+	return s.light
 }
 
-// Initialize the addressable LEDs.
+// Proximity returns the proximity value that was last read from the sensor (as
+// a drivers.Distance measurement), in the range 0 (nothing near) to 255 (the
+// sensor is covered, for example by a palm over a watch). This is the range of
+// the 8-bit proximity value of common proximity sensors like the APDS9960.
+// Like Light, it is a relative value and not a distance in a calibrated unit:
+// it depends on the reflectivity of the object and the sensor configuration.
+// It is mostly useful to detect whether the device is covered.
 //
-// The way to determine whether there are addressable LEDs on a given board, is
-// to configure them and then check the length of board.AddressableLEDs.Data.
+// The sensor can be covered using the Covered toggle in the simulator window,
+// and isn't covered by default.
+func (s *simulatedSensors) Proximity() uint32 {
+	return s.proximity
+}
+
+// AngularVelocity returns the last read rotation speed around each axis in µ°/s
+// (micro-degrees per second), like the gyroscope drivers in the
+// tinygo.org/x/drivers package. The axes are the same as for Acceleration, and
+// a positive value is a counter-clockwise rotation when looking at the device
+// from the positive end of the axis.
+//
+// The device can be rotated around the Z axis (like turning a steering wheel)
+// using the Rotate toggle in the simulator window, and isn't rotating by
+// default.
+func (s *simulatedSensors) AngularVelocity() (x, y, z int32) {
+	return mapAcceleration(AxisMapping{}, s.gyro[0], s.gyro[1], s.gyro[2])
+}
+
+// MagneticField returns the last read magnetic field in nT (nanotesla), using
+// the same axes as Acceleration. Without magnetic interference this is the
+// field of the Earth, which is around 25-65µT and points north and (in the
+// northern hemisphere) down. It can be used as a compass, but note that it is
+// easily disturbed by nearby metal and electronics.
+//
+// The simulator returns the field of the Earth in Europe for a device that is
+// upright and facing north. The Turn button in the simulator window turns the
+// device to the right by 45°.
+func (s *simulatedSensors) MagneticField() (x, y, z int32) {
+	return mapAcceleration(AxisMapping{}, s.magnetic[0], s.magnetic[1], s.magnetic[2])
+}
+
+// Pressure returns the last read air pressure in milli-Pascal, like the
+// pressure sensor drivers in the tinygo.org/x/drivers package. The standard
+// pressure at sea level is 101325 Pa (101325000 mPa), and it decreases by
+// around 12 Pa for each meter of altitude.
+//
+// The pressure can be changed in the simulator window, and is 1013hPa (sea
+// level) by default. Some jitter is added to it.
+func (s *simulatedSensors) Pressure() int32 {
+	return s.pressure
+}
+
+// Humidity returns the last read relative humidity in hundredths of a percent,
+// so 0 (completely dry) to 10000 (condensing).
+//
+// The humidity can be changed in the simulator window, and is 50% by default.
+// Some jitter is added to it.
+func (s *simulatedSensors) Humidity() int32 {
+	return s.humidity
+}
+
+type simulatedWatchdog struct {
+	lock  sync.Mutex
+	timer *time.Timer
+}
+
+// Configure starts the watchdog. After this, Feed must be called regularly or
+// the watchdog will expire.
+//
+// The timeout and what happens when the watchdog expires can be changed in
+// the Simulator settings.
+func (w *simulatedWatchdog) Configure() {
+	if Simulator.WatchdogTimeout == 0 {
+		return // watchdog disabled
+	}
+	w.lock.Lock()
+	defer w.lock.Unlock()
+	if w.timer == nil {
+		w.timer = time.AfterFunc(Simulator.WatchdogTimeout, w.expire)
+	}
+}
+
+// Feed the watchdog, to prevent it from expiring.
+func (w *simulatedWatchdog) Feed() {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+	if w.timer != nil {
+		w.timer.Reset(Simulator.WatchdogTimeout)
+	}
+}
+
+// Called when the watchdog wasn't fed in time.
+func (w *simulatedWatchdog) expire() {
+	if Simulator.WatchdogReset {
+		fmt.Fprintln(os.Stderr, "watchdog expired, exiting")
+		os.Exit(1)
+	}
+	fmt.Fprintln(os.Stderr, "watchdog expired: Watchdog.Feed wasn't called in time")
+
+	// Restart the timer, so that we log again if the watchdog still isn't fed.
+	w.Feed()
+}
+
+type simulatedLEDs struct {
+	once   configureOnce
+	data   []byte
+	dirty  bool  // changed since the last update
+	dim    uint8 // 255 minus the brightness, so the zero value is full brightness
+	asleep bool  // turned off using Sleep
+}
+
+// Initialize the addressable LEDs. The number of LEDs is set by
+// Simulator.AddressableLEDs at the time of the first call.
 func (l *simulatedLEDs) Configure() {
 	startWindow()
-	l.data = make([]byte, Simulator.AddressableLEDs*3)
-	l.Update()
+	l.once.do(func() error {
+		l.data = make([]byte, Simulator.AddressableLEDs*3)
+		return nil
+	})
+	l.ForceUpdate()
 }
 
+// Return the number of LEDs. Before Configure, this is the number of LEDs that
+// Configure will create, so that it can be used to check whether there are any
+// LEDs without configuring them.
 func (l *simulatedLEDs) Len() int {
+	if l.data == nil {
+		return Simulator.AddressableLEDs
+	}
 	return len(l.data) / 3
 }
 
 func (l *simulatedLEDs) SetRGB(i int, r, g, b uint8) {
-	l.data[i*3+0] = r
-	l.data[i*3+1] = g
-	l.data[i*3+2] = b
+	if l.data[i*3+0] != r || l.data[i*3+1] != g || l.data[i*3+2] != b {
+		l.data[i*3+0] = r
+		l.data[i*3+1] = g
+		l.data[i*3+2] = b
+		l.dirty = true
+	}
 }
 
-// Update the LEDs with the color data.
+// Set the global brightness, which scales all colors set with SetRGB.
+func (l *simulatedLEDs) SetBrightness(brightness uint8) {
+	if l.dim != 255-brightness {
+		l.dim = 255 - brightness
+		l.dirty = true
+	}
+}
+
+// Update the LEDs with the color data, if it changed.
 func (l *simulatedLEDs) Update() {
+	if l.dirty && !l.asleep {
+		l.ForceUpdate()
+	}
+}
+
+// Update the LEDs with the color data.
+func (l *simulatedLEDs) ForceUpdate() {
 	cmd := fmt.Sprintf("addressable-leds %d", l.Len())
-	windowSendCommand(cmd, l.data)
+	buf := make([]byte, len(l.data))
+	brightness := 255 - l.dim
+	if l.asleep {
+		brightness = 0
+	}
+	scaleLEDBrightness(buf, l.data, brightness)
+	windowSendCommand(cmd, buf)
+	l.dirty = false
+}
+
+// Turn the LEDs off, or on again with the last set colors. The simulator
+// behaves like the boards that can't cut the power to the LEDs: they are made
+// black while sleeping.
+func (l *simulatedLEDs) Sleep(sleepEnabled bool) error {
+	l.asleep = sleepEnabled
+	l.ForceUpdate()
+	return nil
+}
+
+// Simulated rotary encoder. In the window, it is turned using the mouse wheel
+// over the display, the - and = (+) keys, or the PageUp and PageDown keys, and
+// pushed using the middle mouse button. Scrolling down turns it clockwise.
+//
+// Every key press is one step. One notch of a regular mouse wheel is also one
+// step, while the small scroll amounts of touchpads and smooth scrolling mouse
+// wheels are added up until they amount to a full notch. This way, scrolling
+// quickly results in multiple steps at once, like turning a real encoder
+// quickly between two reads.
+//
+// Until Encoder.Configure is called, input for the encoder is ignored, so that
+// it doesn't pile up in apps that don't use it.
+type simulatedEncoder struct {
+	lock       sync.Mutex
+	configured bool
+	delta      int // steps since the last read
+	pressed    bool
+}
+
+func (e *simulatedEncoder) Configure() {
+	e.lock.Lock()
+	defer e.lock.Unlock()
+	e.configured = true
+}
+
+// Read returns the number of steps since the last read (positive is clockwise)
+// and whether the encoder is pushed in.
+func (e *simulatedEncoder) Read() (delta int, pressed bool) {
+	e.lock.Lock()
+	defer e.lock.Unlock()
+	delta = e.delta
+	e.delta = 0
+	return delta, e.pressed
+}
+
+// Simulated vibration motor, which is shown by flashing an indicator in the
+// window.
+type simulatedVibration struct {
+	patterns patternPlayer
+}
+
+func (v *simulatedVibration) Configure() {
+	startWindow()
+}
+
+// Turn on the vibration motor for the given duration. It returns immediately.
+func (v *simulatedVibration) Pulse(duration time.Duration) {
+	windowSendCommand(fmt.Sprintf("vibrate %d", duration.Milliseconds()), nil)
+	beep()
+}
+
+// Play a vibration pattern in the background, alternating between vibrating
+// and pausing for the given durations (starting with vibrating). The window
+// shows each vibration as it happens. A new pattern cuts off the current one.
+// The returned channel is closed when the pattern is done, or when it was cut
+// off.
+func (v *simulatedVibration) Pattern(pattern []time.Duration) <-chan struct{} {
+	return v.patterns.play(pattern, v.Pulse, v.off)
+}
+
+// Stop the vibration pattern that is currently playing, if any.
+func (v *simulatedVibration) Stop() {
+	v.patterns.stop(v.off)
+}
+
+func (v *simulatedVibration) off() {
+	windowSendCommand("vibrate 0", nil)
+}
+
+// Simulated speaker, which shows the tone being played in the window.
+type simulatedSpeaker struct {
+	player tonePlayer
+}
+
+func (s *simulatedSpeaker) Configure() {
+	startWindow()
+}
+
+// Play a tone with the given frequency in Hz, blocking until it is done.
+func (s *simulatedSpeaker) Tone(frequency uint32, duration time.Duration) {
+	<-s.StartTone(frequency, duration)
+}
+
+// Start playing a tone in the background, returning a channel that is closed
+// when it is done. This is useful for sound effects in games, where Tone would
+// stall rendering.
+//
+// Only one tone plays at a time: a new tone (using either StartTone or Tone)
+// cuts off the current one, and the channel of the tone that was cut off is
+// closed immediately.
+func (s *simulatedSpeaker) StartTone(frequency uint32, duration time.Duration) <-chan struct{} {
+	return s.player.play(duration, func() {
+		windowSendCommand(fmt.Sprintf("tone %d %d", frequency, duration.Milliseconds()), nil)
+		beep()
+	}, func() {})
+}
+
+// Play the given MIDI note (see Note), blocking until it is done. The window
+// shows the name of the note being played.
+func (s *simulatedSpeaker) PlayNote(note uint8, duration time.Duration) {
+	if note == 0 {
+		time.Sleep(duration)
+		return
+	}
+	windowSendCommand(fmt.Sprintf("note %d %d %d", note, NoteFrequency(note), duration.Milliseconds()), nil)
+	beep()
+	time.Sleep(duration)
+}
+
+// Play a sequence of notes, blocking until the last note has been played.
+func (s *simulatedSpeaker) PlaySequence(notes []Note) {
+	playSequence(s, notes)
+}
+
+// Simulated microphone, which records silence.
+type simulatedMicrophone struct {
+	lock       sync.Mutex
+	sampleRate uint32
+	next       time.Time // time of the next sample to be returned
+}
+
+// Configure the microphone to record at the given sample rate (in Hz), for
+// example 16000. Recording starts right away, and continues until the program
+// exits.
+func (m *simulatedMicrophone) Configure(sampleRate uint32) error {
+	if sampleRate == 0 {
+		return errors.New("board: invalid microphone sample rate")
+	}
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	m.sampleRate = sampleRate
+	m.next = time.Now()
+	return nil
+}
+
+// Read recorded PCM samples into buf, and return the number of samples that
+// were read. It blocks until at least one sample is available, and returns
+// at most len(buf) samples. The simulator always records silence.
+//
+// Samples are recorded continuously: if Read isn't called often enough, old
+// samples are dropped. The buffer size determines the latency: a buffer of 256
+// samples at 16kHz holds 16ms of audio, so Read is called around 60 times per
+// second. Smaller buffers give a lower latency, but need more CPU time.
+func (m *simulatedMicrophone) Read(buf []int16) (int, error) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	if m.sampleRate == 0 {
+		return 0, errors.New("board: microphone not configured")
+	}
+	if len(buf) == 0 {
+		return 0, nil
+	}
+
+	// Drop samples that were recorded more than a buffer ago.
+	sampleDuration := time.Second / time.Duration(m.sampleRate)
+	now := time.Now()
+	if oldest := now.Add(-sampleDuration * time.Duration(len(buf))); m.next.Before(oldest) {
+		m.next = oldest
+	}
+
+	// Wait until at least one sample is available.
+	if wait := m.next.Add(sampleDuration).Sub(now); wait > 0 {
+		time.Sleep(wait)
+		now = now.Add(wait)
+	}
+
+	// Return all the samples that are available.
+	n := int(now.Sub(m.next) / sampleDuration)
+	if n > len(buf) {
+		n = len(buf)
+	}
+	for i := range buf[:n] {
+		buf[i] = 0
+	}
+	m.next = m.next.Add(sampleDuration * time.Duration(n))
+	return n, nil
+}
+
+// Ring the terminal bell, if enabled in the simulator settings.
+func beep() {
+	if Simulator.Beep {
+		os.Stderr.WriteString("\a")
+	}
+}
+
+// Simulated status LED, which is shown as an RGB LED below the display.
+type simulatedStatusLED struct{}
+
+// Configure the status LED, and turn it off.
+func (l *simulatedStatusLED) Configure() {
+	startWindow()
+	l.SetColor(0, 0, 0)
+}
+
+// Turn the LED on (white) or off.
+func (l *simulatedStatusLED) Set(on bool) {
+	if on {
+		l.SetColor(255, 255, 255)
+	} else {
+		l.SetColor(0, 0, 0)
+	}
+}
+
+// Set the LED color. The simulator has an RGB status LED, but on many boards
+// the status LED only has a single color.
+func (l *simulatedStatusLED) SetColor(r, g, b uint8) {
+	windowSendCommand(fmt.Sprintf("status-led %d %d %d", r, g, b), nil)
 }
 
 var (
@@ -373,7 +1606,7 @@ func startWindow() {
 	fyneStart.Do(func() {
 		// Start the separate process that manages the window.
 		go func() {
-			cmd := exec.Command(os.Args[0], runWindowCommand)
+			cmd := exec.Command(os.Args[0], append([]string{runWindowCommand}, windowArgs()...)...)
 			cmd.Stderr = os.Stderr
 			windowStdin, _ = cmd.StdinPipe()
 			windowStdout, _ = cmd.StdoutPipe()
@@ -403,6 +1636,50 @@ func startWindow() {
 	})
 }
 
+// Run the window in the current process, see Simulator.RunInProcess.
+func runInProcess(app func()) {
+	started := false
+	fyneStart.Do(func() {
+		started = true
+
+		// Connect both sides of the window protocol using in-memory pipes
+		// instead of stdin/stdout of a child process.
+		windowInput, windowStdin = io.Pipe()
+		windowStdout, windowOutput = io.Pipe()
+		go windowListenEvents()
+	})
+	if !started {
+		// The window was already started in a separate process.
+		app()
+		return
+	}
+
+	go func() {
+		// The pipes are synchronous, so this blocks until the window is
+		// running.
+		windowSendCommand("title "+Simulator.WindowTitle, nil)
+		app()
+		os.Exit(0)
+	}()
+	windowMain(windowArgs())
+
+	// The window was closed, so exit.
+	os.Exit(0)
+}
+
+// Command line arguments for the window process, for settings that are needed
+// before the window is created (so they can't be sent as a command later on).
+func windowArgs() []string {
+	var args []string
+	if pos := Simulator.WindowStartPosition; pos != nil {
+		args = append(args, fmt.Sprintf("-position=%d,%d", pos.X, pos.Y))
+	}
+	if Simulator.WindowAlwaysOnTop {
+		args = append(args, "-on-top")
+	}
+	return args
+}
+
 // Send a command to the separate process that manages the window.
 // The command is a single line (without newline). The data part is optional
 // binary data that can be sent with the command. The size of this binary data
@@ -427,67 +1704,380 @@ func windowListenEvents() {
 			}
 			fmt.Fprintln(os.Stderr, "failed to read I/O events from child process:", err)
 		}
-		cmd := strings.Fields(line)[0]
-		switch cmd {
-		case "keypress", "keyrelease":
-			// Read the key code.
-			var key KeyEvent
-			fmt.Sscanf(line, "%s %d", &cmd, &key)
-			if cmd == "keyrelease" {
-				key |= keyReleased
-			}
+		if handlePauseEvent(line) {
+			continue
+		}
+		recordInputEvent(line)
+		deliverInputEvent(line)
+	}
+}
 
-			// Add the key code to the
-			screen.keyeventsLock.Lock()
-			screen.keyevents = append(screen.keyevents, key)
-			screen.keyeventsLock.Unlock()
-		case "mousedown":
-			// Read the event.
-			var x, y int16
-			fmt.Sscanf(line, "%s %d %d", &cmd, &x, &y)
-
-			// Update the touch state.
-			screen.touchesLock.Lock()
-			screen.touchID++
-			screen.touches[0] = TouchPoint{
-				ID: screen.touchID,
-				X:  x,
-				Y:  y,
-			}
-			screen.touchesLock.Unlock()
-		case "mouseup":
-			// End the current touch.
-			screen.touchesLock.Lock()
-			screen.touches[0] = TouchPoint{} // no active touch
-			screen.touchesLock.Unlock()
-		case "mousemove":
-			// Read the event.
-			var x, y int16
-			fmt.Sscanf(line, "%s %d %d", &cmd, &x, &y)
-
-			// Update the touch state.
-			screen.touchesLock.Lock()
-			if screen.touches[0].ID != 0 {
-				screen.touches[0].X = x
-				screen.touches[0].Y = y
+// Pause state of the simulator, see Simulator.Pause.
+var simulatorPause struct {
+	lock   sync.Mutex
+	paused bool
+	steps  int      // number of frames that may still run while paused
+	events []string // input events held back while paused
+}
+
+// Signalled when the simulator is resumed or a step is allowed to run.
+var simulatorPauseCond = sync.NewCond(&simulatorPause.lock)
+
+func pauseSimulator() {
+	simulatorPause.lock.Lock()
+	defer simulatorPause.lock.Unlock()
+	simulatorPause.paused = true
+	simulatorPause.steps = 0
+}
+
+func stepSimulator() {
+	simulatorPause.lock.Lock()
+	defer simulatorPause.lock.Unlock()
+	if !simulatorPause.paused {
+		return
+	}
+	simulatorPause.steps++
+	deliverHeldInputEvents()
+	simulatorPauseCond.Broadcast()
+}
+
+func resumeSimulator() {
+	simulatorPause.lock.Lock()
+	defer simulatorPause.lock.Unlock()
+	simulatorPause.paused = false
+	deliverHeldInputEvents()
+	simulatorPauseCond.Broadcast()
+}
+
+// Deliver all input events that were held back while paused. Must be called
+// with simulatorPause.lock held.
+func deliverHeldInputEvents() {
+	for _, line := range simulatorPause.events {
+		handleInputEvent(line)
+	}
+	simulatorPause.events = nil
+}
+
+// Block while the simulator is paused, until a frame is allowed to run with
+// Step or the simulator is resumed.
+func waitWhilePaused() {
+	simulatorPause.lock.Lock()
+	defer simulatorPause.lock.Unlock()
+	for simulatorPause.paused && simulatorPause.steps == 0 {
+		simulatorPauseCond.Wait()
+	}
+	if simulatorPause.paused {
+		simulatorPause.steps--
+	}
+}
+
+// Handle the pause, step, and resume buttons in the window. These aren't
+// input events for the app, so they're not recorded or held back. Returns
+// whether the line was one of these events.
+func handlePauseEvent(line string) bool {
+	switch strings.TrimSpace(line) {
+	case "pause":
+		pauseSimulator()
+	case "step":
+		stepSimulator()
+	case "resume":
+		resumeSimulator()
+	default:
+		return false
+	}
+	return true
+}
+
+// Deliver an input event to the app, or hold it back while the simulator is
+// paused.
+func deliverInputEvent(line string) {
+	simulatorPause.lock.Lock()
+	defer simulatorPause.lock.Unlock()
+	if simulatorPause.paused {
+		simulatorPause.events = append(simulatorPause.events, line)
+		return
+	}
+	handleInputEvent(line)
+}
+
+// Number of arguments of each input event.
+var inputEventArgs = map[string]int{
+	"keypress":    1,
+	"keyrelease":  1,
+	"mousedown":   2,
+	"mousemove":   2,
+	"mouseup":     0,
+	"accel":       3,
+	"steps":       1,
+	"shake":       0,
+	"light":       1,
+	"proximity":   1,
+	"gyro":        3,
+	"magnetic":    3,
+	"temperature": 1,
+	"pressure":    1,
+	"humidity":    1,
+
+	"battery-temperature": 1,
+	"wheel":               1,
+	"encoder-press":       0,
+	"encoder-release":     0,
+}
+
+// Single event in an input script.
+type scriptEvent struct {
+	time  time.Duration // time since the start of the script
+	event string        // event, in the same format as sent by the window
+}
+
+// Parse an input script, as documented in Simulator.PlayScript.
+func parseInputScript(r io.Reader) ([]scriptEvent, error) {
+	var events []scriptEvent
+	scanner := bufio.NewScanner(r)
+	lineNumber := 0
+	for scanner.Scan() {
+		lineNumber++
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 0 || strings.HasPrefix(fields[0], "#") {
+			continue
+		}
+		ms, err := strconv.ParseUint(fields[0], 10, 32)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: invalid time %q", lineNumber, fields[0])
+		}
+		eventTime := time.Duration(ms) * time.Millisecond
+		if len(events) != 0 && eventTime < events[len(events)-1].time {
+			return nil, fmt.Errorf("line %d: time goes backwards", lineNumber)
+		}
+		if len(fields) < 2 {
+			return nil, fmt.Errorf("line %d: missing event", lineNumber)
+		}
+		numArgs, ok := inputEventArgs[fields[1]]
+		if !ok {
+			return nil, fmt.Errorf("line %d: unknown event %q", lineNumber, fields[1])
+		}
+		if len(fields)-2 != numArgs {
+			return nil, fmt.Errorf("line %d: expected %d arguments for %s", lineNumber, numArgs, fields[1])
+		}
+		for _, arg := range fields[2:] {
+			if _, err := strconv.ParseFloat(arg, 64); err != nil {
+				return nil, fmt.Errorf("line %d: invalid number %q", lineNumber, arg)
 			}
-			screen.touchesLock.Unlock()
-		case "accel":
-			var x, y, z float64
-			fmt.Sscanf(line, "%s %f %f %f", &cmd, &x, &y, &z)
-			Sensors.lock.Lock()
-			Sensors.accelSource[0] = x
-			Sensors.accelSource[1] = y
-			Sensors.accelSource[2] = z
-			Sensors.lock.Unlock()
-		case "steps":
-			var n uint32
-			fmt.Sscanf(line, "%s %d %d", &cmd, &n)
-			Sensors.lock.Lock()
-			Sensors.stepsSource = n
-			Sensors.lock.Unlock()
-		default:
-			fmt.Fprintln(os.Stderr, "unknown command:", cmd)
 		}
+		events = append(events, scriptEvent{
+			time:  eventTime,
+			event: strings.Join(fields[1:], " "),
+		})
+	}
+	return events, scanner.Err()
+}
+
+func playScript(path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	events, err := parseInputScript(f)
+	if err != nil {
+		return fmt.Errorf("%s: %w", path, err)
+	}
+
+	// Play the events in the background.
+	start := time.Now()
+	go func() {
+		for _, event := range events {
+			time.Sleep(time.Until(start.Add(event.time)))
+			deliverInputEvent(event.event)
+		}
+	}()
+	return nil
+}
+
+// Input events are recorded to this file, if set (see Simulator.RecordInput).
+var inputRecording struct {
+	lock  sync.Mutex
+	file  *os.File
+	start time.Time
+}
+
+func recordInput(path string) error {
+	var file *os.File
+	if path != "" {
+		var err error
+		file, err = os.Create(path)
+		if err != nil {
+			return err
+		}
+	}
+
+	inputRecording.lock.Lock()
+	defer inputRecording.lock.Unlock()
+	var err error
+	if inputRecording.file != nil {
+		err = inputRecording.file.Close()
+	}
+	inputRecording.file = file
+	inputRecording.start = time.Now()
+	return err
+}
+
+// Record a single input event from the window, if recording is enabled.
+func recordInputEvent(line string) {
+	event := strings.Join(strings.Fields(line), " ")
+	if event == "" {
+		return
+	}
+
+	inputRecording.lock.Lock()
+	defer inputRecording.lock.Unlock()
+	if inputRecording.file == nil {
+		return
+	}
+	ms := time.Since(inputRecording.start).Milliseconds()
+	_, err := fmt.Fprintf(inputRecording.file, "%d %s\n", ms, event)
+	if err != nil {
+		// Stop recording, but keep delivering events.
+		fmt.Fprintln(os.Stderr, "board: failed to record input, stopping:", err)
+		inputRecording.file.Close()
+		inputRecording.file = nil
+	}
+}
+
+// Handle a single input event, either from the window or from a script.
+func handleInputEvent(line string) {
+	fields := strings.Fields(line)
+	if len(fields) == 0 {
+		return
+	}
+	cmd := fields[0]
+	switch cmd {
+	case "keypress", "keyrelease":
+		// Read the key code.
+		var key KeyEvent
+		fmt.Sscanf(line, "%s %d", &cmd, &key)
+		if cmd == "keyrelease" {
+			key |= keyReleased
+		}
+
+		addKeyEvent(key)
+	case "mousedown":
+		// Read the event.
+		var x, y int16
+		fmt.Sscanf(line, "%s %d %d", &cmd, &x, &y)
+
+		// Update the touch state.
+		screen.touchesLock.Lock()
+		screen.touchID++
+		screen.touches[0] = TouchPoint{
+			ID: screen.touchID,
+			X:  x,
+			Y:  y,
+		}
+		screen.newTouch = true
+		screen.touchesLock.Unlock()
+		signalInput()
+	case "mouseup":
+		// End the current touch.
+		screen.touchesLock.Lock()
+		screen.touches[0] = TouchPoint{} // no active touch
+		screen.touchesLock.Unlock()
+	case "mousemove":
+		// Read the event.
+		var x, y int16
+		fmt.Sscanf(line, "%s %d %d", &cmd, &x, &y)
+
+		// Update the touch state.
+		screen.touchesLock.Lock()
+		if screen.touches[0].ID != 0 {
+			screen.touches[0].X = x
+			screen.touches[0].Y = y
+		}
+		screen.touchesLock.Unlock()
+	case "accel":
+		var x, y, z float64
+		fmt.Sscanf(line, "%s %f %f %f", &cmd, &x, &y, &z)
+		Sensors.lock.Lock()
+		Sensors.accelSource[0] = x
+		Sensors.accelSource[1] = y
+		Sensors.accelSource[2] = z
+		Sensors.lock.Unlock()
+	case "shake":
+		// Half a second of shaking, in the samples of ReadAccelBuffer.
+		Sensors.lock.Lock()
+		Sensors.shakeFrames = simulatedAccelRate / 2
+		Sensors.lock.Unlock()
+	case "steps":
+		var n uint32
+		fmt.Sscanf(line, "%s %d %d", &cmd, &n)
+		Sensors.lock.Lock()
+		Sensors.stepsSource = n
+		Sensors.lock.Unlock()
+	case "light":
+		var light int32
+		fmt.Sscanf(line, "%s %d", &cmd, &light)
+		Sensors.lock.Lock()
+		Sensors.lightSource = light
+		Sensors.lock.Unlock()
+	case "proximity":
+		var proximity int32
+		fmt.Sscanf(line, "%s %d", &cmd, &proximity)
+		Sensors.lock.Lock()
+		Sensors.proximitySource = proximity
+		Sensors.lock.Unlock()
+	case "gyro":
+		var x, y, z float64
+		fmt.Sscanf(line, "%s %f %f %f", &cmd, &x, &y, &z)
+		Sensors.lock.Lock()
+		Sensors.gyroSource = [3]float64{x, y, z}
+		Sensors.lock.Unlock()
+	case "magnetic":
+		var x, y, z float64
+		fmt.Sscanf(line, "%s %f %f %f", &cmd, &x, &y, &z)
+		Sensors.lock.Lock()
+		Sensors.magneticSource = [3]float64{x, y, z}
+		Sensors.lock.Unlock()
+	case "temperature":
+		var temperature int32
+		fmt.Sscanf(line, "%s %d", &cmd, &temperature)
+		Sensors.lock.Lock()
+		Sensors.tempSource = temperature
+		Sensors.lock.Unlock()
+	case "pressure":
+		var pressure int32
+		fmt.Sscanf(line, "%s %d", &cmd, &pressure)
+		Sensors.lock.Lock()
+		Sensors.pressureSource = pressure
+		Sensors.lock.Unlock()
+	case "humidity":
+		var humidity int32
+		fmt.Sscanf(line, "%s %d", &cmd, &humidity)
+		Sensors.lock.Lock()
+		Sensors.humiditySource = humidity
+		Sensors.lock.Unlock()
+	case "battery-temperature":
+		var temperature int32
+		fmt.Sscanf(line, "%s %d", &cmd, &temperature)
+		Power.lock.Lock()
+		Power.temperature = temperature
+		Power.lock.Unlock()
+	case "wheel":
+		var steps int
+		fmt.Sscanf(line, "%s %d", &cmd, &steps)
+		Encoder.lock.Lock()
+		if Encoder.configured {
+			Encoder.delta += steps
+		}
+		Encoder.lock.Unlock()
+		signalInput()
+	case "encoder-press", "encoder-release":
+		Encoder.lock.Lock()
+		if Encoder.configured {
+			Encoder.pressed = cmd == "encoder-press"
+		}
+		Encoder.lock.Unlock()
+		signalInput()
+	default:
+		fmt.Fprintln(os.Stderr, "unknown command:", cmd)
 	}
 }
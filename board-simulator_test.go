@@ -0,0 +1,1897 @@
+//go:build !baremetal
+
+package board
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"image/color"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"tinygo.org/x/drivers"
+	"tinygo.org/x/drivers/pixel"
+)
+
+func TestSimulatorSensorsConfigureTwice(t *testing.T) {
+	sensors := &simulatedSensors{}
+	for i := 0; i < 2; i++ {
+		sensors.Configure(drivers.Acceleration)
+		sensors.Configure(drivers.Temperature)
+
+		// This panics if one of the two sensors isn't configured anymore.
+		err := sensors.Update(drivers.Acceleration | drivers.Temperature)
+		if err != nil {
+			t.Errorf("unexpected error: %v", err)
+		}
+	}
+}
+
+func TestSimulatorLight(t *testing.T) {
+	// The light level must be in the documented range, like on the PyBadge.
+	sensors := &simulatedSensors{lightSource: 300}
+	if err := sensors.Configure(drivers.Luminosity); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := sensors.Update(drivers.Luminosity); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if light := sensors.Light(); light == 0 || light > 1000 {
+		t.Errorf("light level out of range: %d", light)
+	}
+	if Info().Sensors&drivers.Luminosity == 0 {
+		t.Errorf("light sensor is not listed in Info")
+	}
+}
+
+func TestSimulatorReadAccelBuffer(t *testing.T) {
+	sensors := &simulatedSensors{accelSource: [3]float64{0, 1, 0}}
+	var buf [64][3]int32
+	if n, err := sensors.ReadAccelBuffer(buf[:]); n != 0 || err != nil {
+		t.Errorf("expected no samples before Configure, got %d (%v)", n, err)
+	}
+	if err := sensors.Configure(drivers.Acceleration); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	// Pretend a second has passed: the FIFO overflowed and only holds the
+	// last 32 samples, which are around 1g on the Y axis.
+	sensors.fifoTime = time.Now().Add(-time.Second)
+	n, err := sensors.ReadAccelBuffer(buf[:])
+	if err != nil || n != simulatedAccelFIFODepth {
+		t.Fatalf("expected %d samples, got %d (%v)", simulatedAccelFIFODepth, n, err)
+	}
+	for _, sample := range buf[:n] {
+		if sample[1] < 900_000 || sample[1] > 1100_000 {
+			t.Errorf("expected around 1g on the Y axis, got %v", sample)
+		}
+	}
+
+	// A shake shows up as large movements along the X axis.
+	// The event changes the global Sensors, so move the shake from there to
+	// the sensors under test.
+	handleInputEvent("shake")
+	Sensors.lock.Lock()
+	sensors.shakeFrames, Sensors.shakeFrames = Sensors.shakeFrames, 0
+	Sensors.lock.Unlock()
+	sensors.fifoTime = time.Now().Add(-time.Second)
+	n, _ = sensors.ReadAccelBuffer(buf[:4])
+	if n != 4 || int64(buf[0][0])*int64(buf[2][0]) > -1000_000*1000_000 {
+		t.Errorf("expected a shake along the X axis, got %v", buf[:n])
+	}
+}
+
+func TestSimulatorProximity(t *testing.T) {
+	// The sensor isn't covered by default, and reads close to the maximum
+	// when covered.
+	sensors := &simulatedSensors{}
+	if err := sensors.Configure(drivers.Distance); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	sensors.Update(drivers.Distance)
+	if proximity := sensors.Proximity(); proximity > 10 {
+		t.Errorf("expected the sensor to be uncovered, got %d", proximity)
+	}
+	sensors.proximitySource = 255
+	sensors.Update(drivers.Distance)
+	if proximity := sensors.Proximity(); proximity < 245 || proximity > 255 {
+		t.Errorf("expected the sensor to be covered, got %d", proximity)
+	}
+	if Info().Sensors&drivers.Distance == 0 {
+		t.Errorf("proximity sensor is not listed in Info")
+	}
+}
+
+func TestSimulatorEnvironmentSensors(t *testing.T) {
+	t.Cleanup(func() {
+		handleInputEvent("gyro 0 0 0")
+		handleInputEvent("magnetic 0 -40 -20")
+		handleInputEvent("temperature 20000")
+		handleInputEvent("pressure 101325000")
+		handleInputEvent("humidity 5000")
+	})
+	which := drivers.AngularVelocity | drivers.MagneticField | drivers.Temperature | drivers.Pressure | drivers.Humidity
+	if Info().Sensors&which != which {
+		t.Errorf("not all sensors are listed in Info: %#x", Info().Sensors)
+	}
+	if err := Sensors.Configure(which); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	// The defaults are those of a device in a room at sea level.
+	Sensors.Update(which)
+	if _, _, z := Sensors.AngularVelocity(); z < -200_000 || z > 200_000 {
+		t.Errorf("expected no rotation, got %d", z)
+	}
+	if x, y, z := Sensors.MagneticField(); y > -39_000 || z > -19_000 {
+		t.Errorf("expected the field of the Earth, got %d %d %d", x, y, z)
+	}
+	if pressure := Sensors.Pressure(); pressure < 101_000_000 || pressure > 101_500_000 {
+		t.Errorf("expected pressure at sea level, got %d", pressure)
+	}
+
+	// Each value follows the events sent by the window, with some noise.
+	for _, event := range []string{
+		"gyro 0 0 90",
+		"magnetic -20 -40 0",
+		"temperature 30000",
+		"pressure 95000000",
+		"humidity 8000",
+	} {
+		handleInputEvent(event)
+	}
+	Sensors.Update(which)
+	if _, _, z := Sensors.AngularVelocity(); z < 89_800_000 || z > 90_200_000 {
+		t.Errorf("expected rotation of 90°/s, got %d", z)
+	}
+	if x, _, z := Sensors.MagneticField(); x < -21_000 || x > -19_000 || z < -1000 || z > 1000 {
+		t.Errorf("expected the device to face east, got x=%d z=%d", x, z)
+	}
+	if temperature := Sensors.Temperature(); temperature < 29_800 || temperature > 30_200 {
+		t.Errorf("expected 30°C, got %d", temperature)
+	}
+	if pressure := Sensors.Pressure(); pressure < 94_990_000 || pressure > 95_010_000 {
+		t.Errorf("expected 950hPa, got %d", pressure)
+	}
+	if humidity := Sensors.Humidity(); humidity < 7950 || humidity > 8050 {
+		t.Errorf("expected 80%% humidity, got %d", humidity)
+	}
+}
+
+func TestSimulatorAutoBrightness(t *testing.T) {
+	commands := recordWindowCommands(t)
+	Simulator.WindowMaxBrightness = 10
+	t.Cleanup(func() {
+		Simulator.WindowMaxBrightness = 0
+		handleInputEvent("light 300")
+	})
+	if err := Sensors.Configure(drivers.Luminosity); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	// The brightness follows the light level set in the window.
+	auto := NewAutoBrightness([]BrightnessPoint{{Light: 0, Brightness: 0}, {Light: 1000, Brightness: 100}})
+	auto.Interval = 0
+	auto.Smoothing = 1
+	for _, step := range []struct {
+		event    string
+		expected string
+	}{
+		{"light 0", "display-brightness 1 10\n"}, // never completely off
+		{"light 500", "display-brightness 5 10\n"},
+		{"light 510", ""}, // too small to change the brightness
+		{"light 1000", "display-brightness 10 10\n"},
+	} {
+		handleInputEvent(step.event)
+		if err := auto.Update(); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if got := commands.String(); got != step.expected {
+			t.Errorf("%s: expected commands %q, got %q", step.event, step.expected, got)
+		}
+		commands.Reset()
+	}
+}
+
+func TestSimulatorEncoder(t *testing.T) {
+	t.Cleanup(func() {
+		handleInputEvent("encoder-release")
+		Encoder.Read()
+	})
+
+	// Input is ignored until the encoder is configured.
+	Encoder.lock.Lock()
+	Encoder.configured = false
+	Encoder.lock.Unlock()
+	handleInputEvent("wheel 2")
+	handleInputEvent("encoder-press")
+	Encoder.Configure()
+	if delta, pressed := Encoder.Read(); delta != 0 || pressed {
+		t.Errorf("expected no change, got %d %v", delta, pressed)
+	}
+
+	// Steps are accumulated until the next read.
+	handleInputEvent("wheel 1")
+	handleInputEvent("wheel 3")
+	handleInputEvent("wheel -1")
+	handleInputEvent("encoder-press")
+	if delta, pressed := Encoder.Read(); delta != 3 || !pressed {
+		t.Errorf("expected 3 steps while pressed, got %d %v", delta, pressed)
+	}
+	handleInputEvent("encoder-release")
+	if delta, pressed := Encoder.Read(); delta != 0 || pressed {
+		t.Errorf("expected no change after release, got %d %v", delta, pressed)
+	}
+}
+
+func TestSimulatorRandSeed(t *testing.T) {
+	Simulator.RandSeed = 1234
+	t.Cleanup(func() {
+		Simulator.RandSeed = 0
+	})
+
+	// With the same seed, the noise is the same on every run.
+	read := func() (accel [3]int32, temp int32, microvolts uint32) {
+		sensors := &simulatedSensors{accelSource: [3]float64{0, 1, 0}, tempSource: 20_000}
+		sensors.Configure(drivers.Acceleration | drivers.Temperature)
+		sensors.Update(drivers.Acceleration | drivers.Temperature)
+		accel[0], accel[1], accel[2] = sensors.Acceleration()
+		_, microvolts, _ = (&simulatedPower{}).Status()
+		return accel, sensors.Temperature(), microvolts
+	}
+	accel1, temp1, microvolts1 := read()
+	accel2, temp2, microvolts2 := read()
+	if accel1 != accel2 || temp1 != temp2 || microvolts1 != microvolts2 {
+		t.Errorf("expected the same values, got %v %d %d and %v %d %d", accel1, temp1, microvolts1, accel2, temp2, microvolts2)
+	}
+
+	// Changing the seed restarts the sequence.
+	noise := &noiseSource{}
+	first := noise.Int31n(1 << 30)
+	Simulator.RandSeed = 5678
+	if noise.Int31n(1<<30) == first {
+		t.Errorf("expected a different sequence after changing the seed")
+	}
+	Simulator.RandSeed = 1234
+	if value := noise.Int31n(1 << 30); value != first {
+		t.Errorf("expected the sequence to restart, got %d instead of %d", value, first)
+	}
+}
+
+func TestSimulatorSensorNoise(t *testing.T) {
+	Simulator.SensorNoise = false
+	t.Cleanup(func() {
+		Simulator.SensorNoise = true
+	})
+
+	// Without noise, the values are exactly the source values.
+	sensors := &simulatedSensors{accelSource: [3]float64{0, 1, 0}, tempSource: 21_500, lightSource: 300}
+	sensors.Configure(drivers.Acceleration | drivers.Temperature | drivers.Luminosity)
+	sensors.Update(drivers.Acceleration | drivers.Temperature | drivers.Luminosity)
+	if x, y, z := sensors.Acceleration(); x != 0 || y != 1000_000 || z != 0 {
+		t.Errorf("expected exactly 1g on the Y axis, got %d %d %d", x, y, z)
+	}
+	if temp := sensors.Temperature(); temp != 21_500 {
+		t.Errorf("expected exactly 21.5°C, got %d", temp)
+	}
+	if light := sensors.Light(); light != 300 {
+		t.Errorf("expected a light level of exactly 300, got %d", light)
+	}
+	if _, microvolts, _ := Power.Status(); microvolts != calibrateBatteryVoltage(3700_000) {
+		t.Errorf("expected exactly 3.7V, got %dµV", microvolts)
+	}
+}
+
+func TestSimulatorBatteryTemperature(t *testing.T) {
+	t.Cleanup(func() {
+		handleInputEvent("battery-temperature 25000")
+		Power.NextEvent()
+	})
+
+	if temperature := Power.BatteryTemperature(); temperature != 25_000 {
+		t.Errorf("unexpected default temperature: %d", temperature)
+	}
+	if event := Power.NextEvent(); event != NoPowerEvent {
+		t.Errorf("expected no event, got %d", event)
+	}
+
+	// Crossing the threshold results in a single event.
+	handleInputEvent("battery-temperature 50000")
+	if temperature := Power.BatteryTemperature(); temperature != 50_000 {
+		t.Errorf("expected 50000, got %d", temperature)
+	}
+	if event := Power.NextEvent(); event != BatteryOverTemperature {
+		t.Errorf("expected over temperature event, got %d", event)
+	}
+	if event := Power.NextEvent(); event != NoPowerEvent {
+		t.Errorf("expected no event, got %d", event)
+	}
+
+	// Rising further doesn't result in another event, but cooling down does.
+	handleInputEvent("battery-temperature 55000")
+	if event := Power.NextEvent(); event != NoPowerEvent {
+		t.Errorf("expected no event, got %d", event)
+	}
+	handleInputEvent("battery-temperature 40000")
+	if event := Power.NextEvent(); event != BatteryTemperatureNormal {
+		t.Errorf("expected normal temperature event, got %d", event)
+	}
+}
+
+func TestSimulatorWaitForKey(t *testing.T) {
+	// An event that is already queued is returned immediately.
+	addKeyEvent(KeyEvent(KeyA))
+	if event := WaitForKey(); event != KeyEvent(KeyA) {
+		t.Errorf("expected KeyA press, got %#v", event)
+	}
+
+	// Without events, WaitForKeyTimeout gives up.
+	start := time.Now()
+	if event := WaitForKeyTimeout(20 * time.Millisecond); event != NoKeyEvent {
+		t.Errorf("expected no event, got %#v", event)
+	}
+	if duration := time.Since(start); duration < 20*time.Millisecond {
+		t.Errorf("WaitForKeyTimeout returned too early, after %s", duration)
+	}
+
+	// An event that arrives while waiting is returned.
+	go func() {
+		time.Sleep(5 * time.Millisecond)
+		addKeyEvent(KeyEvent(KeyB) | keyReleased)
+	}()
+	if event := WaitForKeyTimeout(time.Second); event != KeyEvent(KeyB)|keyReleased {
+		t.Errorf("expected KeyB release, got %#v", event)
+	}
+}
+
+func TestSimulatorWaitForKeyPress(t *testing.T) {
+	// Other keys and releases are skipped.
+	addKeyEvent(KeyEvent(KeyUp))
+	addKeyEvent(KeyEvent(KeyA) | keyReleased)
+	addKeyEvent(KeyEvent(KeyB))
+	addKeyEvent(KeyEvent(KeyA))
+	if key := WaitForKeyPress(KeyA, KeyEnter); key != KeyA {
+		t.Errorf("expected KeyA, got %d", key)
+	}
+
+	// Without keys, any key press is returned.
+	addKeyEvent(KeyEvent(KeyLeft) | keyReleased)
+	addKeyEvent(KeyEvent(KeyRight))
+	if key := WaitForKeyPress(); key != KeyRight {
+		t.Errorf("expected KeyRight, got %d", key)
+	}
+
+	// A key press that doesn't match doesn't stop the timeout.
+	go func() {
+		time.Sleep(5 * time.Millisecond)
+		addKeyEvent(KeyEvent(KeyB))
+	}()
+	start := time.Now()
+	if key := WaitForKeyPressTimeout(30*time.Millisecond, KeyA); key != NoKey {
+		t.Errorf("expected no key, got %d", key)
+	}
+	if duration := time.Since(start); duration < 30*time.Millisecond {
+		t.Errorf("WaitForKeyPressTimeout returned too early, after %s", duration)
+	}
+}
+
+func TestSimulatorPeekEvent(t *testing.T) {
+	t.Cleanup(func() {
+		codes = simulatorKeys
+	})
+	Buttons.Remap(7, KeyB)
+
+	// The peeked event is remapped, and returned again by NextEvent.
+	if event := Buttons.PeekEvent(); event != NoKeyEvent {
+		t.Errorf("expected no event, got %#v", event)
+	}
+	addKeyEvent(KeyEvent(KeyA))
+	addKeyEvent(KeyEvent(KeyA) | keyReleased)
+	for i := 0; i < 2; i++ {
+		if event := Buttons.PeekEvent(); event != KeyEvent(KeyB) {
+			t.Errorf("expected KeyB press, got %#v", event)
+		}
+	}
+	if event := Buttons.NextEvent(); event != KeyEvent(KeyB) {
+		t.Errorf("expected KeyB press, got %#v", event)
+	}
+	if event := Buttons.PeekEvent(); event != KeyEvent(KeyB)|keyReleased {
+		t.Errorf("expected KeyB release, got %#v", event)
+	}
+	if event := Buttons.NextEvent(); event != KeyEvent(KeyB)|keyReleased {
+		t.Errorf("expected KeyB release, got %#v", event)
+	}
+	if event := Buttons.PeekEvent(); event != NoKeyEvent {
+		t.Errorf("expected no event, got %#v", event)
+	}
+}
+
+func TestSimulatorSnapshot(t *testing.T) {
+	t.Cleanup(func() {
+		screen.keyeventsLock.Lock()
+		screen.keyeventsSnapshot = false
+		screen.keyeventsLock.Unlock()
+	})
+
+	// Events that arrive after the snapshot are only returned after the next
+	// snapshot.
+	addKeyEvent(KeyEvent(KeyA))
+	Buttons.Snapshot()
+	addKeyEvent(KeyEvent(KeyA) | keyReleased)
+	if event := Buttons.NextEvent(); event != KeyEvent(KeyA) {
+		t.Errorf("expected KeyA press, got %#v", event)
+	}
+	if event := Buttons.PeekEvent(); event != NoKeyEvent {
+		t.Errorf("expected no event until the next snapshot, got %#v", event)
+	}
+	if event := Buttons.NextEvent(); event != NoKeyEvent {
+		t.Errorf("expected no event until the next snapshot, got %#v", event)
+	}
+
+	// ReadInput also latches the events, once Snapshot has been used.
+	Buttons.ReadInput()
+	if event := Buttons.NextEvent(); event != KeyEvent(KeyA)|keyReleased {
+		t.Errorf("expected KeyA release, got %#v", event)
+	}
+	if event := Buttons.NextEvent(); event != NoKeyEvent {
+		t.Errorf("expected no more events, got %#v", event)
+	}
+}
+
+func TestSimulatorButtonsRemap(t *testing.T) {
+	t.Cleanup(func() {
+		codes = simulatorKeys
+	})
+
+	// Swap A and B.
+	Buttons.Remap(7, KeyB)
+	Buttons.Remap(8, KeyA)
+	Buttons.Remap(100, KeyEscape) // out of range, ignored
+
+	addKeyEvent(KeyEvent(KeyA))
+	addKeyEvent(KeyEvent(KeyB) | keyReleased)
+	addKeyEvent(KeyEvent(KeyUp)) // not remapped
+	if event := Buttons.NextEvent(); event != KeyEvent(KeyB) {
+		t.Errorf("expected KeyB press, got %#v", event)
+	}
+	if event := Buttons.NextEvent(); event != KeyEvent(KeyA)|keyReleased {
+		t.Errorf("expected KeyA release, got %#v", event)
+	}
+	if event := Buttons.NextEvent(); event != KeyEvent(KeyUp) {
+		t.Errorf("expected KeyUp press, got %#v", event)
+	}
+
+	// The remapped keys are also reported in Info.
+	if keys := Info().Keys; keys[7] != KeyB || keys[8] != KeyA {
+		t.Errorf("expected remapped keys in Info, got %v", keys)
+	}
+}
+
+func TestSimulatorIdle(t *testing.T) {
+	// Drop a signal that may be left over from a previous test.
+	select {
+	case <-inputSignal:
+	default:
+	}
+
+	// Without input, Idle waits for the whole duration.
+	start := time.Now()
+	Idle(20 * time.Millisecond)
+	if duration := time.Since(start); duration < 20*time.Millisecond {
+		t.Errorf("Idle returned too early, after %s", duration)
+	}
+
+	// Input wakes it up early.
+	go func() {
+		time.Sleep(5 * time.Millisecond)
+		addKeyEvent(KeyEvent(KeyA))
+	}()
+	start = time.Now()
+	Idle(time.Second)
+	if duration := time.Since(start); duration >= time.Second {
+		t.Errorf("Idle didn't wake up on input, returned after %s", duration)
+	}
+	if event := Buttons.NextEvent(); event != KeyEvent(KeyA) {
+		t.Errorf("expected KeyA press, got %#v", event)
+	}
+}
+
+func TestSimulatorUptime(t *testing.T) {
+	// Time spent idling is included, and the time scale is ignored.
+	oldTimeScale := Simulator.TimeScale
+	t.Cleanup(func() {
+		Simulator.TimeScale = oldTimeScale
+	})
+	Simulator.TimeScale = 10
+	select {
+	case <-inputSignal:
+	default:
+	}
+	start := Uptime()
+	if start <= 0 {
+		t.Errorf("expected a positive uptime, got %s", start)
+	}
+	Idle(20 * time.Millisecond)
+	if elapsed := Uptime() - start; elapsed < 20*time.Millisecond {
+		t.Errorf("expected uptime to increase by at least 20ms, got %s", elapsed)
+	}
+}
+
+func TestSimulatorInfo(t *testing.T) {
+	info := Info()
+	if info.Name != Name {
+		t.Errorf("unexpected name: %q", info.Name)
+	}
+	if info.DisplayWidth != int16(Simulator.WindowWidth) || info.DisplayHeight != int16(Simulator.WindowHeight) {
+		t.Errorf("unexpected display size: %dx%d", info.DisplayWidth, info.DisplayHeight)
+	}
+	if info.ColorDepth != 24 {
+		t.Errorf("unexpected color depth: %d", info.ColorDepth)
+	}
+	if info.Sensors == 0 || len(info.Keys) == 0 || !info.HasLEDs || !info.HasTouch || !info.HasBattery {
+		t.Errorf("simulator info is not fully populated: %+v", info)
+	}
+	if info.NeedsFlush {
+		t.Errorf("the simulator draws directly to the window, it doesn't need Display")
+	}
+
+	// Changing the returned keys doesn't change the keys of the board.
+	key := info.Keys[0]
+	info.Keys[0] = KeyEscape
+	if keys := Info().Keys; keys[0] != key {
+		t.Errorf("Info().Keys was modified through a previous result: %v", keys)
+	}
+}
+
+// Record the commands sent to the window process, without starting it.
+func recordWindowCommands(t *testing.T) *bytes.Buffer {
+	fyneStart.Do(func() {}) // don't start the window
+	buf := &bytes.Buffer{}
+	windowLock.Lock()
+	oldStdin := windowStdin
+	windowStdin = nopWriteCloser{buf}
+	windowLock.Unlock()
+	t.Cleanup(func() {
+		windowLock.Lock()
+		windowStdin = oldStdin
+		windowLock.Unlock()
+	})
+	return buf
+}
+
+type nopWriteCloser struct {
+	*bytes.Buffer
+}
+
+func (nopWriteCloser) Close() error {
+	return nil
+}
+
+func TestSimulatorDisplaySleep(t *testing.T) {
+	commands := recordWindowCommands(t)
+	display := &fyneScreen{}
+	check := func(expected string) {
+		t.Helper()
+		if got := commands.String(); got != expected {
+			t.Errorf("expected commands %q, got %q", expected, got)
+		}
+		commands.Reset()
+	}
+
+	mainDisplay{}.SetBrightness(1)
+	check("display-brightness 1 1\n")
+
+	// Sleep turns the backlight off, and waking up restores it. The window
+	// is told about sleep mode separately, so that it can show it
+	// differently from a backlight that is turned off.
+	display.Sleep(true)
+	check("display-brightness 0 1\nsleep 1\n")
+	display.Sleep(false)
+	check("sleep 0\ndisplay-brightness 1 1\n")
+
+	// Brightness changes while asleep are only applied after waking up.
+	display.Sleep(true)
+	commands.Reset()
+	mainDisplay{}.SetBrightness(0)
+	check("")
+	display.Sleep(false)
+	check("sleep 0\ndisplay-brightness 0 1\n")
+}
+
+func TestSimulatorLEDsLen(t *testing.T) {
+	recordWindowCommands(t)
+	if n := (dummyAddressableLEDs{}).Len(); n != 0 {
+		t.Errorf("expected no LEDs on boards without them, got %d", n)
+	}
+
+	// The number of LEDs is known before Configure, and doesn't change after.
+	leds := &simulatedLEDs{}
+	if n := leds.Len(); n != Simulator.AddressableLEDs {
+		t.Errorf("expected %d LEDs before Configure, got %d", Simulator.AddressableLEDs, n)
+	}
+	leds.Configure()
+	if n := leds.Len(); n != Simulator.AddressableLEDs {
+		t.Errorf("expected %d LEDs after Configure, got %d", Simulator.AddressableLEDs, n)
+	}
+}
+
+func TestSimulatorLEDsUpdate(t *testing.T) {
+	commands := recordWindowCommands(t)
+	leds := &simulatedLEDs{data: make([]byte, 2*3)}
+	check := func(expected string) {
+		t.Helper()
+		if got := commands.String(); got != expected {
+			t.Errorf("expected commands %q, got %q", expected, got)
+		}
+		commands.Reset()
+	}
+
+	// Nothing changed, so nothing is sent.
+	leds.Update()
+	check("")
+	leds.SetRGB(1, 0, 0, 0)
+	leds.Update()
+	check("")
+
+	// A changed LED is sent once.
+	leds.SetRGB(1, 0xff, 0x80, 0)
+	leds.Update()
+	check("addressable-leds 2\n\x00\x00\x00\xff\x80\x00")
+	leds.Update()
+	check("")
+
+	// ForceUpdate always sends the LEDs.
+	leds.ForceUpdate()
+	check("addressable-leds 2\n\x00\x00\x00\xff\x80\x00")
+}
+
+func TestSimulatorLEDsBrightness(t *testing.T) {
+	commands := recordWindowCommands(t)
+	leds := &simulatedLEDs{data: make([]byte, 1*3)}
+
+	// The brightness scales the linear values that are sent, while the values
+	// set with SetRGB are kept so that the brightness can be raised again.
+	leds.SetRGB(0, 255, 128, 1)
+	for _, step := range []struct {
+		brightness uint8
+		expected   string
+	}{
+		{255, "addressable-leds 1\n\xff\x80\x01"},
+		{128, "addressable-leds 1\n\x80\x40\x01"},
+		{0, "addressable-leds 1\n\x00\x00\x00"},
+		{0, ""}, // unchanged, so nothing is sent
+		{255, "addressable-leds 1\n\xff\x80\x01"},
+	} {
+		leds.SetBrightness(step.brightness)
+		leds.Update()
+		if got := commands.String(); got != step.expected {
+			t.Errorf("brightness %d: expected commands %q, got %q", step.brightness, step.expected, got)
+		}
+		commands.Reset()
+	}
+}
+
+func TestSimulatorLEDsCurrentLimit(t *testing.T) {
+	commands := recordWindowCommands(t)
+	t.Cleanup(func() {
+		LEDSettings.MaxCurrent = 0
+		LEDSettings.BatteryMaxCurrent = 0
+	})
+	leds := &simulatedLEDs{data: make([]byte, 2*3)}
+	leds.SetRGB(0, 255, 255, 255)
+	leds.SetRGB(1, 255, 0, 0)
+
+	// Both LEDs together draw 80mA, so a limit of 40mA halves all values.
+	for _, step := range []struct {
+		maxCurrent, batteryMaxCurrent int
+		expected                      string
+	}{
+		{0, 0, "addressable-leds 2\n\xff\xff\xff\xff\x00\x00"},
+		{40, 0, "addressable-leds 2\n\x7f\x7f\x7f\x7f\x00\x00"},
+		{100, 0, "addressable-leds 2\n\xff\xff\xff\xff\x00\x00"},
+		// The simulator runs on battery power, so the lowest limit is used.
+		{100, 40, "addressable-leds 2\n\x7f\x7f\x7f\x7f\x00\x00"},
+		{20, 40, "addressable-leds 2\n\x3f\x3f\x3f\x3f\x00\x00"},
+	} {
+		LEDSettings.MaxCurrent = step.maxCurrent
+		LEDSettings.BatteryMaxCurrent = step.batteryMaxCurrent
+		leds.ForceUpdate()
+		if got := commands.String(); got != step.expected {
+			t.Errorf("limits %dmA and %dmA: expected commands %q, got %q", step.maxCurrent, step.batteryMaxCurrent, step.expected, got)
+		}
+		commands.Reset()
+	}
+}
+
+func TestSimulatorLEDsSleep(t *testing.T) {
+	commands := recordWindowCommands(t)
+	leds := &simulatedLEDs{data: make([]byte, 1*3)}
+	check := func(expected string) {
+		t.Helper()
+		if got := commands.String(); got != expected {
+			t.Errorf("expected commands %q, got %q", expected, got)
+		}
+		commands.Reset()
+	}
+
+	// The LEDs are turned off while sleeping, and changes are only shown
+	// after waking up again.
+	leds.SetRGB(0, 255, 128, 1)
+	leds.Sleep(true)
+	check("addressable-leds 1\n\x00\x00\x00")
+	leds.SetRGB(0, 1, 2, 3)
+	leds.Update()
+	check("")
+	leds.Sleep(false)
+	check("addressable-leds 1\n\x01\x02\x03")
+	leds.Update()
+	check("")
+}
+
+func TestSimulatorRunInProcessStarted(t *testing.T) {
+	// Once the window has been started (here: faked by recording commands),
+	// RunInProcess can't move it into the current process anymore and must
+	// simply run the app.
+	recordWindowCommands(t)
+	called := false
+	Simulator.RunInProcess(func() {
+		called = true
+	})
+	if !called {
+		t.Error("app was not called")
+	}
+}
+
+func TestSimulatorPause(t *testing.T) {
+	t.Cleanup(Simulator.Resume)
+	vblank := make(chan struct{})
+	waitForVBlank := func() {
+		mainDisplay{}.WaitForVBlank(time.Millisecond)
+		vblank <- struct{}{}
+	}
+	expectVBlank := func(expected bool) {
+		t.Helper()
+		select {
+		case <-vblank:
+			if !expected {
+				t.Error("WaitForVBlank returned while paused")
+			}
+		case <-time.After(50 * time.Millisecond):
+			if expected {
+				t.Fatal("WaitForVBlank didn't return")
+			}
+		}
+	}
+
+	// Input is held back while paused.
+	Simulator.Pause()
+	go waitForVBlank()
+	deliverInputEvent("keypress 8")
+	expectVBlank(false)
+	if event := WaitForKeyTimeout(10 * time.Millisecond); event != NoKeyEvent {
+		t.Errorf("expected no event while paused, got %#v", event)
+	}
+
+	// A single step runs one frame, and delivers the input.
+	Simulator.Step()
+	expectVBlank(true)
+	if event := WaitForKeyTimeout(10 * time.Millisecond); event != KeyEvent(KeyA) {
+		t.Errorf("expected KeyA press after step, got %#v", event)
+	}
+	go waitForVBlank()
+	expectVBlank(false)
+
+	// Resuming lets everything continue.
+	Simulator.Resume()
+	expectVBlank(true)
+	go waitForVBlank()
+	expectVBlank(true)
+}
+
+func TestSimulatorWaitForVBlankTimeout(t *testing.T) {
+	display := mainDisplay{}
+	display.WaitForVBlank(0) // start a new frame
+
+	// The frame interval is longer than the timeout, so it times out.
+	start := time.Now()
+	if display.WaitForVBlankTimeout(time.Second, 20*time.Millisecond) {
+		t.Error("expected a timeout")
+	}
+	if duration := time.Since(start); duration < 20*time.Millisecond || duration >= time.Second {
+		t.Errorf("unexpected wait time: %s", duration)
+	}
+
+	// Once the frame interval has passed, vblank is reached.
+	if !display.WaitForVBlankTimeout(30*time.Millisecond, time.Second) {
+		t.Error("expected vblank to be reached")
+	}
+	if duration := time.Since(start); duration < 30*time.Millisecond {
+		t.Errorf("vblank reached too early, after %s", duration)
+	}
+}
+
+func TestSimulatorTimeScale(t *testing.T) {
+	Simulator.TimeScale = 4
+	t.Cleanup(func() { Simulator.TimeScale = 0 })
+
+	// A 100ms frame takes 25ms at four times the speed. The wait itself can
+	// take longer on a busy machine, so only check that it isn't shorter.
+	if duration := scaledDuration(100 * time.Millisecond); duration != 25*time.Millisecond {
+		t.Errorf("expected 25ms at four times the speed, got %s", duration)
+	}
+	display := mainDisplay{}
+	display.WaitForVBlank(100 * time.Millisecond) // start of a frame
+	start := time.Now()
+	display.WaitForVBlank(100 * time.Millisecond)
+	if duration := time.Since(start); duration < 20*time.Millisecond {
+		t.Errorf("expected a frame of around 25ms, got %s", duration)
+	}
+
+	// Slowing down works too.
+	Simulator.TimeScale = 0.5
+	if duration := scaledDuration(10 * time.Millisecond); duration != 20*time.Millisecond {
+		t.Errorf("expected 20ms at half speed, got %s", duration)
+	}
+}
+
+func TestSimulatorWindowArgs(t *testing.T) {
+	// The defaults don't need any arguments.
+	if args := windowArgs(); len(args) != 0 {
+		t.Errorf("expected no arguments by default, got %q", args)
+	}
+
+	Simulator.WindowStartPosition = &WindowPosition{X: 100, Y: -20}
+	Simulator.WindowAlwaysOnTop = true
+	t.Cleanup(func() {
+		Simulator.WindowStartPosition = nil
+		Simulator.WindowAlwaysOnTop = false
+	})
+	if args := strings.Join(windowArgs(), " "); args != "-position=100,-20 -on-top" {
+		t.Errorf("unexpected arguments: %q", args)
+	}
+}
+
+func TestSimulatorEmulateTE(t *testing.T) {
+	commands := recordWindowCommands(t)
+	Simulator.EmulateTE = true
+	Simulator.TERefreshRate = 25 // 40ms per frame
+	Simulator.TEBlankingTime = 10 * time.Millisecond
+	t.Cleanup(func() {
+		Simulator.EmulateTE = false
+		Simulator.TERefreshRate = 0
+		Simulator.TEBlankingTime = 0
+	})
+	display := mainDisplay{}
+	screen := &fyneScreen{width: 8, height: 8}
+	img := pixel.NewImage[pixel.RGB888](8, 8)
+
+	// WaitForVBlank returns at the start of a frame, even when called right
+	// at the start of the previous frame.
+	display.WaitForVBlank(0)
+	start := time.Now()
+	display.WaitForVBlank(0)
+	if duration := time.Since(start); duration < 30*time.Millisecond {
+		t.Errorf("expected to wait for the next frame, returned after %s", duration)
+	}
+	emulatedTE.lock.Lock()
+	phase := emulatedTE.frameStart.Sub(emulatedTE.epoch) % (40 * time.Millisecond)
+	emulatedTE.lock.Unlock()
+	if phase != 0 {
+		t.Errorf("expected to wait until the start of a frame, got phase %s", phase)
+	}
+
+	// The timeout is shorter than the frame time.
+	display.WaitForVBlank(0)
+	if display.WaitForVBlankTimeout(0, 10*time.Millisecond) {
+		t.Error("expected a timeout")
+	}
+
+	// Drawing within the blanking period doesn't tear, drawing after it does
+	// (but only counts once per frame).
+	torn := Simulator.TornFrames()
+	display.WaitForVBlank(0)
+	screen.DrawBitmap(0, 0, img)
+	if n := Simulator.TornFrames() - torn; n != 0 {
+		t.Errorf("expected no torn frames, got %d", n)
+	}
+	display.WaitForVBlank(0)
+	time.Sleep(20 * time.Millisecond)
+	screen.DrawBitmap(0, 0, img)
+	screen.Display()
+	if n := Simulator.TornFrames() - torn; n != 1 {
+		t.Errorf("expected 1 torn frame, got %d", n)
+	}
+	commands.Reset()
+}
+
+func TestSimulatorStandbyUntilTouch(t *testing.T) {
+	commands := recordWindowCommands(t)
+	display := &fyneScreen{}
+	mainDisplay{}.SetBrightness(1)
+	commands.Reset()
+
+	// Without a touch, the display stays asleep.
+	touched, err := StandbyUntilTouch[pixel.RGB888](display, sdltouch{}, 20*time.Millisecond)
+	if touched || err != nil {
+		t.Errorf("expected timeout, got touched=%v err=%v", touched, err)
+	}
+	if got := commands.String(); got != "display-brightness 0 1\nsleep 1\n" {
+		t.Errorf("unexpected commands: %q", got)
+	}
+	commands.Reset()
+
+	// A short tap that ended before the next poll still wakes up the display.
+	go func() {
+		time.Sleep(5 * time.Millisecond)
+		handleInputEvent("mousedown 10 10")
+		handleInputEvent("mouseup")
+	}()
+	start := time.Now()
+	touched, err = StandbyUntilTouch[pixel.RGB888](display, sdltouch{}, time.Second)
+	if !touched || err != nil {
+		t.Errorf("expected touch, got touched=%v err=%v", touched, err)
+	}
+	if duration := time.Since(start); duration >= time.Second {
+		t.Errorf("touch didn't wake up the display, returned after %s", duration)
+	}
+	if got := commands.String(); got != "display-brightness 0 1\nsleep 1\nsleep 0\ndisplay-brightness 1 1\n" {
+		t.Errorf("unexpected commands: %q", got)
+	}
+}
+
+func TestSimulatorRawTouch(t *testing.T) {
+	if _, ok := AsRawTouchReader(noTouch{}); ok {
+		t.Error("noTouch must not support raw touch readings")
+	}
+	reader, ok := AsRawTouchReader(RateLimitTouch(sdltouch{}, time.Second))
+	if !ok {
+		t.Fatal("simulator touch input (rate limited) must support raw touch readings")
+	}
+
+	// The window is mapped to the full 16-bit range.
+	handleInputEvent(fmt.Sprintf("mousedown %d 0", Simulator.WindowWidth-1))
+	if raw := reader.ReadRawTouch(); raw != (RawTouch{X: 65535, Y: 0, Z: 65535}) {
+		t.Errorf("unexpected raw touch at the top right corner: %+v", raw)
+	}
+	handleInputEvent("mouseup")
+	if raw := reader.ReadRawTouch(); raw.Z != 0 {
+		t.Errorf("expected no pressure after the touch ended, got %+v", raw)
+	}
+}
+
+func TestSimulatorTouchReportRate(t *testing.T) {
+	Simulator.TouchReportRate = 10 // one report every 100ms
+	Simulator.TouchJitter = 2
+	t.Cleanup(func() {
+		Simulator.TouchReportRate = 0
+		Simulator.TouchJitter = 0
+		handleInputEvent("mouseup")
+	})
+	touch := sdltouch{}
+
+	// The first read makes a report, so the touch that starts right after it
+	// isn't reported until the next report.
+	touch.ReadTouch()
+	handleInputEvent("mousedown 100 50")
+	if points := touch.ReadTouch(); len(points) != 0 {
+		t.Errorf("expected touch to be reported late, got %v", points)
+	}
+
+	// Once the report interval has passed, the touch is reported with some
+	// jitter. It stays the same until the next report.
+	screen.lastTouchReport = time.Time{}
+	points := touch.ReadTouch()
+	if len(points) != 1 {
+		t.Fatalf("expected a touch, got %v", points)
+	}
+	point := points[0]
+	if point.X < 98 || point.X > 102 || point.Y < 48 || point.Y > 52 {
+		t.Errorf("touch point out of jitter range: %v", point)
+	}
+	handleInputEvent("mousemove 120 60")
+	if points := touch.ReadTouch(); len(points) != 1 || points[0] != point {
+		t.Errorf("expected the previous report %v, got %v", point, points)
+	}
+
+	// Jitter doesn't move the touch off the screen.
+	handleInputEvent("mousemove 0 0")
+	for i := 0; i < 20; i++ {
+		screen.lastTouchReport = time.Time{}
+		points := touch.ReadTouch()
+		if len(points) != 1 || points[0].X < 0 || points[0].Y < 0 {
+			t.Errorf("unexpected touch report: %v", points)
+		}
+	}
+}
+
+func TestSimulatorVibrationFallback(t *testing.T) {
+	commands := recordWindowCommands(t)
+	defer func(fallback bool) {
+		VibrationSettings.SpeakerFallback = fallback
+	}(VibrationSettings.SpeakerFallback)
+
+	// Without the fallback, boards without a motor stay silent.
+	vibration := noVibration{}
+	vibration.Pulse(time.Millisecond)
+	time.Sleep(10 * time.Millisecond)
+	windowLock.Lock()
+	sent := commands.String()
+	windowLock.Unlock()
+	if sent != "" {
+		t.Errorf("expected no commands, got %q", sent)
+	}
+
+	// With the fallback, the speaker makes a low buzz.
+	VibrationSettings.SpeakerFallback = true
+	vibration.Configure()
+	vibration.Pulse(20 * time.Millisecond)
+	time.Sleep(10 * time.Millisecond)
+	windowLock.Lock()
+	sent = commands.String()
+	windowLock.Unlock()
+	if sent != "tone 100 20\n" {
+		t.Errorf("expected a 100Hz tone, got %q", sent)
+	}
+
+	// Stop also silences the buzz.
+	vibration.Pulse(time.Second)
+	vibration.Stop()
+	windowLock.Lock()
+	sent = commands.String()
+	windowLock.Unlock()
+	if sent != "tone 100 20\ntone 100 1000\ntone 0 0\n" {
+		t.Errorf("expected Stop to silence the tone, got %q", sent)
+	}
+}
+
+func TestSimulatorVibrationPattern(t *testing.T) {
+	commands := recordWindowCommands(t)
+	vibration := &simulatedVibration{}
+
+	// The pattern is played in the background, and the window shows each
+	// vibration.
+	start := time.Now()
+	done := vibration.Pattern([]time.Duration{20 * time.Millisecond, 10 * time.Millisecond, 30 * time.Millisecond})
+	select {
+	case <-done:
+		t.Errorf("Pattern blocked until the pattern was done")
+	default:
+	}
+	<-done
+	if duration := time.Since(start); duration < 60*time.Millisecond {
+		t.Errorf("pattern finished too early, after %s", duration)
+	}
+	if got, expected := commands.String(), "vibrate 20\nvibrate 0\nvibrate 30\nvibrate 0\n"; got != expected {
+		t.Errorf("expected commands %q, got %q", expected, got)
+	}
+	commands.Reset()
+
+	// Stop cuts off the pattern, and closes its channel.
+	done = vibration.Pattern(AlarmPattern)
+	time.Sleep(10 * time.Millisecond)
+	vibration.Stop()
+	select {
+	case <-done:
+	default:
+		t.Error("channel not closed after Stop")
+	}
+	time.Sleep(AlarmPattern[0])
+	if got, expected := commands.String(), "vibrate 400\nvibrate 0\n"; got != expected {
+		t.Errorf("expected commands %q, got %q", expected, got)
+	}
+}
+
+func TestSimulatorPlaySequence(t *testing.T) {
+	commands := recordWindowCommands(t)
+	Speaker.PlaySequence([]Note{
+		{Note: 69, Duration: time.Millisecond},
+		{Note: 0, Duration: time.Millisecond}, // rest
+		{Note: 72, Duration: 2 * time.Millisecond},
+	})
+	if sent := commands.String(); sent != "note 69 440 1\nnote 72 523 2\n" {
+		t.Errorf("unexpected commands: %q", sent)
+	}
+}
+
+func TestSimulatorMicrophone(t *testing.T) {
+	mic := &simulatedMicrophone{}
+	if _, err := mic.Read(make([]int16, 16)); err == nil {
+		t.Error("expected an error when reading before Configure")
+	}
+	if err := mic.Configure(16000); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	// Reading blocks until samples are available, and records silence at
+	// roughly the configured sample rate.
+	buf := make([]int16, 160)
+	start := time.Now()
+	total := 0
+	for total < 320 {
+		n, err := mic.Read(buf)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if n == 0 || n > len(buf) {
+			t.Fatalf("unexpected number of samples: %d", n)
+		}
+		for _, sample := range buf[:n] {
+			if sample != 0 {
+				t.Fatalf("expected silence, got sample %d", sample)
+			}
+		}
+		total += n
+	}
+	if duration := time.Since(start); duration < 15*time.Millisecond {
+		t.Errorf("read 20ms of samples in only %s", duration)
+	}
+
+	// Boards without a microphone return ErrNoMicrophone.
+	if _, err := (dummyMicrophone{}).Read(buf); err != ErrNoMicrophone {
+		t.Errorf("expected ErrNoMicrophone, got %v", err)
+	}
+}
+
+func TestSimulatorPlayScript(t *testing.T) {
+	// Invalid scripts are rejected.
+	for _, script := range []string{
+		"keypress 8",             // missing time
+		"10 keypress",            // missing argument
+		"10 keypress x",          // not a number
+		"10 jump 3",              // unknown event
+		"20 mouseup\n10 mouseup", // time goes backwards
+	} {
+		if _, err := parseInputScript(strings.NewReader(script)); err == nil {
+			t.Errorf("expected an error for script %q", script)
+		}
+	}
+	if err := Simulator.PlayScript(filepath.Join(t.TempDir(), "nonexistent")); err == nil {
+		t.Error("expected an error for a nonexistent file")
+	}
+
+	// A valid script is played back in the background.
+	Sensors.lock.Lock()
+	oldAccel := Sensors.accelSource
+	Sensors.lock.Unlock()
+	t.Cleanup(func() {
+		Sensors.lock.Lock()
+		Sensors.accelSource = oldAccel
+		Sensors.lock.Unlock()
+	})
+	path := filepath.Join(t.TempDir(), "script.txt")
+	script := "# Press A, then tilt the device.\n\n5 keypress 8\n10 keyrelease 8\n15 accel 0.5 0 1\n"
+	if err := os.WriteFile(path, []byte(script), 0o666); err != nil {
+		t.Fatal(err)
+	}
+	if err := Simulator.PlayScript(path); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if event := WaitForKeyTimeout(time.Second); event != KeyEvent(KeyA) {
+		t.Errorf("expected KeyA press, got %#v", event)
+	}
+	if event := WaitForKeyTimeout(time.Second); event != KeyEvent(KeyA)|keyReleased {
+		t.Errorf("expected KeyA release, got %#v", event)
+	}
+	time.Sleep(20 * time.Millisecond)
+	Sensors.lock.Lock()
+	accel := Sensors.accelSource
+	Sensors.lock.Unlock()
+	if accel != [3]float64{0.5, 0, 1} {
+		t.Errorf("unexpected acceleration: %v", accel)
+	}
+}
+
+func TestSimulatorRecordInput(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "recording.txt")
+	if err := Simulator.RecordInput(path); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	recordInputEvent("keypress 8\n")
+	time.Sleep(5 * time.Millisecond)
+	recordInputEvent("mousedown 10 20\n")
+	if err := Simulator.RecordInput(""); err != nil {
+		t.Fatalf("unexpected error while stopping: %v", err)
+	}
+	recordInputEvent("keyrelease 8\n") // not recorded anymore
+
+	// The recording can be played back with PlayScript.
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	events, err := parseInputScript(bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("recording can't be played back: %v\n%s", err, data)
+	}
+	if len(events) != 2 || events[0].event != "keypress 8" || events[1].event != "mousedown 10 20" {
+		t.Errorf("unexpected events: %+v", events)
+	}
+	if len(events) == 2 && events[1].time < 5*time.Millisecond {
+		t.Errorf("unexpected time of second event: %s", events[1].time)
+	}
+}
+
+func TestSimulatorInjectSensorError(t *testing.T) {
+	t.Cleanup(func() {
+		Simulator.InjectSensorError(drivers.AllMeasurements, nil)
+	})
+	Sensors.Configure(drivers.Acceleration | drivers.Temperature)
+
+	// The injected error is returned for every call that includes the sensor.
+	errI2C := errors.New("i2c: no ACK")
+	Simulator.InjectSensorError(drivers.Temperature, errI2C)
+	for i := 0; i < 2; i++ {
+		if err := Sensors.Update(drivers.Acceleration | drivers.Temperature); err != errI2C {
+			t.Errorf("expected injected error, got %v", err)
+		}
+	}
+	if err := Sensors.Configure(drivers.Temperature); err != errI2C {
+		t.Errorf("expected injected error from Configure, got %v", err)
+	}
+
+	// Other sensors keep working, and are still available.
+	if err := Sensors.Update(drivers.Acceleration); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+	if available := Sensors.Available(); available != Info().Sensors&^drivers.Temperature {
+		t.Errorf("expected all sensors except temperature to be available, got %#x", available)
+	}
+
+	// Clearing the error makes the sensor work again.
+	Simulator.InjectSensorError(drivers.Temperature, nil)
+	if err := Sensors.Update(drivers.Temperature); err != nil {
+		t.Errorf("unexpected error after clearing: %v", err)
+	}
+	if available := Sensors.Available(); available != Info().Sensors {
+		t.Errorf("expected all sensors to be available, got %#x", available)
+	}
+}
+
+func TestSimulatorMissingSensor(t *testing.T) {
+	t.Cleanup(func() {
+		Simulator.InjectSensorError(drivers.AllMeasurements, nil)
+	})
+
+	// A missing sensor is reported by Configure, but the other sensors are
+	// still configured.
+	Simulator.InjectSensorError(drivers.Acceleration, ErrSensorNotFound)
+	if err := Sensors.Configure(drivers.Acceleration | drivers.Luminosity); err != ErrSensorNotFound {
+		t.Fatalf("expected ErrSensorNotFound from Configure, got %v", err)
+	}
+	if err := Sensors.Update(drivers.Luminosity); err != nil {
+		t.Errorf("unexpected error for the light sensor: %v", err)
+	}
+	if err := Sensors.Update(drivers.Acceleration); err != ErrSensorNotFound {
+		t.Errorf("expected ErrSensorNotFound from Update, got %v", err)
+	}
+	if Sensors.Available()&drivers.Acceleration != 0 {
+		t.Errorf("missing accelerometer is reported as available")
+	}
+
+	// Once the sensor is back (for example, after reconnecting it),
+	// configuring it again works.
+	Simulator.InjectSensorError(drivers.Acceleration, nil)
+	if err := Sensors.Configure(drivers.Acceleration); err != nil {
+		t.Errorf("unexpected error after reconnecting: %v", err)
+	}
+	if err := Sensors.Update(drivers.Acceleration); err != nil {
+		t.Errorf("unexpected error after reconnecting: %v", err)
+	}
+}
+
+func TestSimulatorTemperature(t *testing.T) {
+	Simulator.SensorNoise = false
+	t.Cleanup(func() {
+		Simulator.SensorNoise = true
+		Simulator.InjectSensorError(drivers.AllMeasurements, nil)
+		handleInputEvent("temperature 20000")
+	})
+
+	// Like the RP2040 boards, the temperature can be read on its own, even
+	// when the accelerometer is missing.
+	Simulator.InjectSensorError(drivers.Acceleration, ErrSensorNotFound)
+	handleInputEvent("temperature 20000")
+	if err := Sensors.Configure(drivers.Temperature); err != nil {
+		t.Fatalf("unexpected error from Configure: %v", err)
+	}
+	if err := Sensors.Update(drivers.Temperature); err != nil {
+		t.Fatalf("unexpected error from Update: %v", err)
+	}
+	temp := Sensors.Temperature()
+	if temp != 20_000 {
+		t.Errorf("expected 20000 (20°C), got %d", temp)
+	}
+	if text := FormatTemperature(temp, Celsius); text != "20.0°C" {
+		t.Errorf("unexpected formatted temperature: %s", text)
+	}
+
+	// An RP2040 board at the same temperature reads the same value, in the
+	// same unit, up to the resolution of the ADC (about 0.5°C per step). The
+	// raw value is the one the sensor would output according to the
+	// datasheet: 0.706V at 27°C, and 1.721mV less per degree above that.
+	microvolts := 706_000 - (int64(temp)-27_000)*1721/1000
+	raw := uint16((microvolts*4096 + 3_300_000/2) / 3_300_000)
+	if rp2040 := rp2040DieTemperature(raw); rp2040 < temp-500 || rp2040 > temp+500 {
+		t.Errorf("expected the RP2040 to read around %d, got %d (raw value %d)", temp, rp2040, raw)
+	}
+}
+
+func TestSimulatorInjectDisplayError(t *testing.T) {
+	commands := recordWindowCommands(t)
+	display := &fyneScreen{width: 8, height: 8}
+	img := pixel.NewImage[pixel.RGB888](2, 2)
+
+	// The error is returned once, without drawing anything.
+	errBus := errors.New("spi: bus glitch")
+	Simulator.InjectDisplayError(errBus)
+	if err := display.DrawBitmap(0, 0, img); err != errBus {
+		t.Errorf("expected injected error, got %v", err)
+	}
+	if commands.Len() != 0 {
+		t.Errorf("expected nothing to be drawn, got %q", commands.String())
+	}
+	if err := display.DrawBitmap(0, 0, img); err != nil {
+		t.Errorf("unexpected error after the transient error: %v", err)
+	}
+
+	// Display can fail too.
+	Simulator.InjectDisplayError(errBus)
+	if err := display.Display(); err != errBus {
+		t.Errorf("expected injected error from Display, got %v", err)
+	}
+
+	// A pending error can be cancelled.
+	Simulator.InjectDisplayError(errBus)
+	Simulator.InjectDisplayError(nil)
+	if err := display.Display(); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
+
+func TestSimulatorLastFrameDuration(t *testing.T) {
+	recordWindowCommands(t)
+	Simulator.WindowDrawSpeed = 100 * time.Microsecond
+	t.Cleanup(func() { Simulator.WindowDrawSpeed = 0 })
+	display := &fyneScreen{width: 8, height: 8}
+	img := pixel.NewImage[pixel.RGB888](8, 4)
+	var mainDisp mainDisplay
+
+	// Drawing the frame in two parts, with some app logic in between, takes
+	// around 2*3*8*100µs = 4.8ms of drawing time.
+	mainDisp.WaitForVBlank(time.Millisecond)
+	previous := mainDisp.LastFrameDuration()
+	start := time.Now()
+	display.DrawBitmap(0, 0, img)
+	time.Sleep(20 * time.Millisecond) // app logic, not counted
+	display.DrawBitmap(0, 4, img)
+	if duration := mainDisp.LastFrameDuration(); duration != previous {
+		t.Errorf("frame is not done yet, but the duration changed to %s", duration)
+	}
+	display.Display()
+	elapsed := time.Since(start)
+	duration := mainDisp.LastFrameDuration()
+	if duration < 4*time.Millisecond {
+		t.Errorf("expected a frame duration of around 4.8ms, got %s", duration)
+	}
+	if duration > elapsed-20*time.Millisecond {
+		t.Errorf("the time spent in app logic was counted: %s of %s", duration, elapsed)
+	}
+
+	// Waiting for vblank without drawing anything keeps the last duration.
+	mainDisp.WaitForVBlank(time.Millisecond)
+	if got := mainDisp.LastFrameDuration(); got != duration {
+		t.Errorf("expected the duration to stay %s, got %s", duration, got)
+	}
+}
+
+func TestSimulatorClipDrawBitmap(t *testing.T) {
+	commands := recordWindowCommands(t)
+	display := &fyneScreen{width: 8, height: 8}
+	img := pixel.NewImage[pixel.RGB888](4, 2)
+
+	// By default, drawing past the edge is an error.
+	if err := display.DrawBitmap(6, 7, img); !errors.Is(err, ErrOutOfBounds) {
+		t.Errorf("expected an out of bounds error, got %v", err)
+	}
+
+	// With clipping enabled, only the visible part is drawn.
+	DisplaySettings.ClipDrawBitmap = true
+	defer func() {
+		DisplaySettings.ClipDrawBitmap = false
+	}()
+	commands.Reset()
+	if err := display.DrawBitmap(6, 7, img); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+	if sent := commands.String(); !strings.HasPrefix(sent, "draw 6 7 2\n") || strings.Count(sent, "draw ") != 1 {
+		t.Errorf("unexpected commands: %q", sent)
+	}
+}
+
+func TestSimulatorSetPixel(t *testing.T) {
+	commands := recordWindowCommands(t)
+	display := &fyneScreen{width: 8, height: 8}
+	setter, ok := AsPixelSetter[pixel.RGB888](display)
+	if !ok {
+		t.Fatal("simulator display must be a PixelSetter")
+	}
+
+	if err := setter.SetPixel(3, 5, pixel.NewRGB888(1, 2, 3)); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+	if got, expected := commands.String(), "draw 3 5 1\n\x01\x02\x03"; got != expected {
+		t.Errorf("expected commands %q, got %q", expected, got)
+	}
+	commands.Reset()
+
+	if err := setter.SetPixel(3, 8, pixel.NewRGB888(1, 2, 3)); !errors.Is(err, ErrOutOfBounds) {
+		t.Errorf("expected an out of bounds error, got %v", err)
+	}
+	if commands.Len() != 0 {
+		t.Errorf("unexpected commands: %q", commands.String())
+	}
+}
+
+func TestSimulatorShapes(t *testing.T) {
+	recordWindowCommands(t)
+	buffered := NewBuffered[pixel.RGB888](&fyneScreen{width: 4, height: 4})
+	white := pixel.NewRGB888(255, 255, 255)
+
+	// A rectangle partially outside the display, and a line through the
+	// bottom right corner.
+	if err := DrawRect[pixel.RGB888](buffered, -1, -1, 4, 4, white); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := DrawLine[pixel.RGB888](buffered, 1, 5, 5, 1, white); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	expected := [4]string{
+		"..#.",
+		"..#.",
+		"###.",
+		"...#",
+	}
+	for y := 0; y < 4; y++ {
+		for x := 0; x < 4; x++ {
+			if set := buffered.Get(x, y) == white; set != (expected[y][x] == '#') {
+				t.Errorf("pixel (%d, %d): expected %c", x, y, expected[y][x])
+			}
+		}
+	}
+}
+
+func TestSimulatorCircleMask(t *testing.T) {
+	commands := recordWindowCommands(t)
+	oldMask := Simulator.WindowCircleMask
+	Simulator.WindowCircleMask = CircleMask{X: 120, Y: 120, Radius: 120}
+	defer func() {
+		Simulator.WindowCircleMask = oldMask
+	}()
+
+	// The mask is sent to the window when the display is configured.
+	Display.Configure()
+	if sent := commands.String(); !strings.Contains(sent, "display-mask 120 120 120\n") {
+		t.Errorf("mask not sent to the window: %q", sent)
+	}
+}
+
+func TestSimulatorOutline(t *testing.T) {
+	commands := recordWindowCommands(t)
+	oldOutline := Simulator.WindowOutline
+	Simulator.WindowOutline = DisplayOutline{CornerRadius: 20, NotchWidth: 60, NotchHeight: 10}
+	defer func() {
+		Simulator.WindowOutline = oldOutline
+	}()
+
+	// The outline is sent to the window when the display is configured.
+	Display.Configure()
+	if sent := commands.String(); !strings.Contains(sent, "display-outline 20 60 10\n") {
+		t.Errorf("outline not sent to the window: %q", sent)
+	}
+}
+
+func TestSimulatorSwapRedBlue(t *testing.T) {
+	commands := recordWindowCommands(t)
+	DisplaySettings.SwapRedBlue = true
+	defer func() {
+		DisplaySettings.SwapRedBlue = false
+	}()
+
+	// The window is told to swap the colors when the display is configured.
+	Display.Configure()
+	if sent := commands.String(); !strings.Contains(sent, "display-swap-rb 1\n") {
+		t.Errorf("color swap not sent to the window: %q", sent)
+	}
+}
+
+func TestSimulatorWindowColorDepth(t *testing.T) {
+	commands := recordWindowCommands(t)
+	Simulator.WindowColorDepth = 18
+	defer func() {
+		Simulator.WindowColorDepth = 0
+	}()
+
+	// The window is told which color depth to preview.
+	Display.Configure()
+	if sent := commands.String(); !strings.Contains(sent, "display-depth 18\n") {
+		t.Errorf("color depth not sent to the window: %q", sent)
+	}
+
+	// An 18-bit color has more shades of red and blue than a 16-bit color.
+	c := color.RGBA{R: 0x86, G: 0x86, B: 0x86, A: 255}
+	for _, tc := range []struct {
+		depth int
+		want  color.RGBA
+	}{
+		{0, c},
+		{12, color.RGBA{R: 0x88, G: 0x88, B: 0x88, A: 255}},
+		{16, color.RGBA{R: 0x84, G: 0x86, B: 0x84, A: 255}},
+		{18, color.RGBA{R: 0x86, G: 0x86, B: 0x86, A: 255}},
+	} {
+		if got := reduceColorDepth(c, tc.depth); got != tc.want {
+			t.Errorf("reduceColorDepth(%v, %d): expected %v, got %v", c, tc.depth, tc.want, got)
+		}
+	}
+	white := color.RGBA{R: 255, G: 255, B: 255, A: 255}
+	for _, depth := range []int{12, 16, 18} {
+		if got := reduceColorDepth(white, depth); got != white {
+			t.Errorf("reduceColorDepth(white, %d): expected white, got %v", depth, got)
+		}
+	}
+}
+
+func TestSimulatorInitialBrightness(t *testing.T) {
+	commands := recordWindowCommands(t)
+	defer func() {
+		DisplaySettings.InitialBrightness = 0
+		Simulator.WindowMaxBrightness = 0
+	}()
+
+	// By default, the backlight stays off.
+	Display.Configure()
+	if sent := commands.String(); strings.Contains(sent, "display-brightness") {
+		t.Errorf("unexpected brightness change: %q", sent)
+	}
+
+	// The initial brightness is limited to the maximum brightness.
+	for _, step := range []struct {
+		initial  int
+		expected string
+	}{
+		{5, "display-brightness 5 10\n"},
+		{20, "display-brightness 10 10\n"},
+	} {
+		commands.Reset()
+		DisplaySettings.InitialBrightness = step.initial
+		Simulator.WindowMaxBrightness = 10
+		Display.Configure()
+		if sent := commands.String(); !strings.HasSuffix(sent, step.expected) {
+			t.Errorf("initial brightness %d: expected %q to be sent, got %q", step.initial, step.expected, sent)
+		}
+	}
+}
+
+func TestSimulatorStallBus(t *testing.T) {
+	recordWindowCommands(t)
+	oldTimeout := busTimeout
+	busTimeout = 10 * time.Millisecond
+	defer func() {
+		busTimeout = oldTimeout
+	}()
+	display := &fyneScreen{width: 8, height: 8}
+	img := pixel.NewImage[pixel.RGB888](1, 1)
+
+	// While the bus is stalled, drawing and reading sensors time out.
+	Simulator.StallBus(100 * time.Millisecond)
+	if err := display.DrawBitmap(0, 0, img); err != ErrBusTimeout {
+		t.Errorf("DrawBitmap: expected ErrBusTimeout, got %v", err)
+	}
+	if err := display.Display(); err != ErrBusTimeout {
+		t.Errorf("Display: expected ErrBusTimeout, got %v", err)
+	}
+	sensors := &simulatedSensors{}
+	if err := sensors.Configure(drivers.Acceleration); err != ErrBusTimeout {
+		t.Errorf("Sensors.Configure: expected ErrBusTimeout, got %v", err)
+	}
+
+	// Once the bus is released, everything works again.
+	time.Sleep(150 * time.Millisecond)
+	if err := display.DrawBitmap(0, 0, img); err != nil {
+		t.Errorf("DrawBitmap: unexpected error after the stall: %v", err)
+	}
+	if err := sensors.Configure(drivers.Acceleration); err != nil {
+		t.Errorf("Sensors.Configure: unexpected error after the stall: %v", err)
+	}
+}
+
+func TestSimulatorSecondaryDisplay(t *testing.T) {
+	commands := recordWindowCommands(t)
+	t.Cleanup(func() {
+		Simulator.SecondaryDisplayWidth = 0
+		Simulator.SecondaryDisplayHeight = 0
+	})
+
+	// There is no secondary display by default, like on real boards.
+	if display := SecondaryDisplay.Configure(); display != nil {
+		t.Fatalf("expected no secondary display, got %#v", display)
+	}
+	if display := (noSecondaryDisplay{}).Configure(); display != nil {
+		t.Fatalf("expected no secondary display, got %#v", display)
+	}
+
+	Simulator.SecondaryDisplayWidth = 4
+	Simulator.SecondaryDisplayHeight = 8
+	display := SecondaryDisplay.Configure()
+	if display == nil {
+		t.Fatal("expected a secondary display")
+	}
+	if width, height := display.Size(); width != 4 || height != 8 {
+		t.Errorf("unexpected size: %dx%d", width, height)
+	}
+	if got := commands.String(); got != "secondary-display 4 8\n" {
+		t.Errorf("unexpected commands: %q", got)
+	}
+	commands.Reset()
+
+	// Each row is sent with one byte per pixel.
+	img := pixel.NewImage[pixel.Monochrome](4, 8)
+	img.Set(1, 0, true)
+	img.Set(3, 7, true)
+	if err := display.DrawBitmap(0, 0, img); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	lines := strings.Split(commands.String(), "secondary-draw ")
+	if len(lines) != 9 || lines[1] != "0 0 4\n\x00\x01\x00\x00" || lines[8] != "0 7 4\n\x00\x00\x00\x01" {
+		t.Errorf("unexpected commands: %q", commands.String())
+	}
+
+	// The bus is shared with the main display.
+	oldTimeout := busTimeout
+	busTimeout = 10 * time.Millisecond
+	defer func() {
+		busTimeout = oldTimeout
+	}()
+	Simulator.StallBus(50 * time.Millisecond)
+	if err := display.DrawBitmap(0, 0, img); err != ErrBusTimeout {
+		t.Errorf("expected ErrBusTimeout while the bus is stalled, got %v", err)
+	}
+	time.Sleep(100 * time.Millisecond)
+}
+
+func TestSimulatorDrawTimeEstimate(t *testing.T) {
+	recordWindowCommands(t)
+	t.Cleanup(func() {
+		Simulator.WindowDrawSpeed = 0
+	})
+	if estimate := DrawTimeEstimate(100); estimate != 0 {
+		t.Errorf("expected no delay without WindowDrawSpeed, got %s", estimate)
+	}
+
+	// The estimate matches the time it actually takes to draw. The last row
+	// isn't delayed, so drawing can be up to one row faster than estimated.
+	// There is no upper bound: a busy test machine can be arbitrarily slow.
+	Simulator.WindowDrawSpeed = 200 * time.Microsecond
+	display := &fyneScreen{width: 8, height: 8}
+	img := pixel.NewImage[pixel.RGB888](8, 4)
+	estimate := DrawTimeEstimate(8 * 4)
+	if estimate != 6400*time.Microsecond {
+		t.Errorf("unexpected estimate: %s", estimate)
+	}
+	start := time.Now()
+	if err := display.DrawBitmap(0, 0, img); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if duration := time.Since(start); duration < estimate*3/4 {
+		t.Errorf("drawing took %s, estimated %s", duration, estimate)
+	}
+	if estimate := DrawTimeEstimate(0); estimate != 0 {
+		t.Errorf("expected no time for no pixels, got %s", estimate)
+	}
+}
+
+func TestSimulatorPPI(t *testing.T) {
+	if ppi := Display.PPI(); ppi != Simulator.WindowPPI {
+		t.Errorf("expected the default PPI %d, got %d", Simulator.WindowPPI, ppi)
+	}
+	DisplaySettings.PPI = 200
+	defer func() {
+		DisplaySettings.PPI = 0
+	}()
+	if ppi := Display.PPI(); ppi != 200 {
+		t.Errorf("expected the overridden PPI 200, got %d", ppi)
+	}
+}
+
+func TestSimulatorTraceHook(t *testing.T) {
+	recordWindowCommands(t)
+	screen := &fyneScreen{width: 4, height: 4}
+	img := pixel.NewImage[pixel.RGB888](2, 3)
+
+	// Nothing should be traced without a hook.
+	if err := screen.DrawBitmap(0, 0, img); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	var events []TraceEvent
+	SetTraceHook(func(event TraceEvent) {
+		events = append(events, event)
+	})
+	defer SetTraceHook(nil)
+	if err := screen.DrawBitmap(0, 0, img); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := screen.Display(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	_, microvolts, _ := Power.Status()
+	Power.Configure()
+	if len(events) != 4 {
+		t.Fatalf("expected 4 events, got %d: %v", len(events), events)
+	}
+	for i, expected := range []struct {
+		op    TraceOp
+		value int32
+	}{
+		{TraceDisplayDraw, 6},
+		{TraceDisplayFlush, 0},
+		{TraceBatteryRead, int32(microvolts)},
+		{TraceConfigure, int32(TraceBatteryRead)},
+	} {
+		event := events[i]
+		if event.Op != expected.op || event.Value != expected.value || event.Err != nil {
+			t.Errorf("event %d: expected %s with value %d, got %s with value %d (err %v)", i, expected.op, expected.value, event.Op, event.Value, event.Err)
+		}
+		if event.Start.IsZero() || event.Duration < 0 {
+			t.Errorf("event %d: invalid timing: %v %v", i, event.Start, event.Duration)
+		}
+	}
+}
+
+func TestSimulatorFrameHook(t *testing.T) {
+	recordWindowCommands(t)
+	screen := &fyneScreen{width: 4, height: 4}
+	img := pixel.NewImage[pixel.RGB888](2, 3)
+	endFrame() // end any frame left over from other tests
+
+	var frames []time.Duration
+	SetFrameHook(func(drawTime time.Duration) {
+		frames = append(frames, drawTime)
+	})
+	defer SetFrameHook(nil)
+
+	// The hook is called once per frame that was drawn, with the same time
+	// as LastFrameDuration.
+	screen.DrawBitmap(0, 0, img)
+	screen.Display()
+	Display.WaitForVBlank(0)
+	if len(frames) != 1 || frames[0] <= 0 || frames[0] != Display.LastFrameDuration() {
+		t.Errorf("expected one frame of %s, got %v", Display.LastFrameDuration(), frames)
+	}
+
+	// Waiting for vblank without drawing anything isn't a frame.
+	Display.WaitForVBlank(0)
+	if len(frames) != 1 {
+		t.Errorf("expected no new frame, got %v", frames)
+	}
+}
+
+func TestSimulatorBuffered(t *testing.T) {
+	commands := recordWindowCommands(t)
+	buffered := NewBuffered[pixel.RGB888](&fyneScreen{width: 4, height: 4})
+	white := pixel.NewRGB888(255, 255, 255)
+	key := pixel.NewRGB888(255, 0, 255)
+
+	// Draw a sprite of which only the middle pixel is not transparent.
+	sprite := pixel.NewImage[pixel.RGB888](3, 3)
+	sprite.FillSolidColor(key)
+	sprite.Set(1, 1, white)
+	if err := buffered.DrawTransparent(1, 1, sprite, key); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	// The framebuffer can be read back, and the transparent pixels were
+	// filled in from the framebuffer (which was black).
+	for y := 0; y < 4; y++ {
+		for x := 0; x < 4; x++ {
+			expected := pixel.RGB888{}
+			if x == 2 && y == 2 {
+				expected = white
+			}
+			if c := buffered.Get(x, y); c != expected {
+				t.Errorf("pixel (%d, %d): expected %v, got %v", x, y, expected, c)
+			}
+		}
+	}
+	if n := strings.Count(commands.String(), "draw 1 "); n != 3 {
+		t.Errorf("expected 3 lines to be drawn, got %d", n)
+	}
+}
+
+func TestSimulatorRenderText(t *testing.T) {
+	recordWindowCommands(t)
+	buffered := NewBuffered[pixel.RGB888](&fyneScreen{width: 16, height: 8})
+	white := pixel.NewRGB888(255, 255, 255)
+
+	// Render some text, draw it on the screen, and read it back.
+	img := RenderText(testFont{}, "LI", white, pixel.RGB888{})
+	if err := buffered.DrawBitmap(2, 1, img); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	expected := []string{
+		"                ",
+		"  #   ###       ",
+		"  #    #        ",
+		"  ### ###       ",
+		"                ",
+	}
+	for y, line := range expected {
+		for x, c := range line {
+			if (buffered.Get(x, y) == white) != (c == '#') {
+				t.Errorf("unexpected pixel at (%d, %d)", x, y)
+			}
+		}
+	}
+}
+
+// App for TestSimulatorRun, which redraws on every key press and stops after
+// the given number of presses.
+type testApp struct {
+	presses int
+	stop    int
+	updates int
+	draws   []int // number of presses at each draw
+}
+
+var errTestAppDone = errors.New("test app done")
+
+func (a *testApp) Update(events []KeyEvent) (bool, error) {
+	a.updates++
+	redraw := false
+	for _, event := range events {
+		if event.Pressed() {
+			a.presses++
+			redraw = true
+		}
+	}
+	return redraw, nil
+}
+
+func (a *testApp) Draw(display Displayer[pixel.RGB888]) error {
+	a.draws = append(a.draws, a.presses)
+	if a.presses >= a.stop {
+		return errTestAppDone
+	}
+	return nil
+}
+
+func TestSimulatorRun(t *testing.T) {
+	recordWindowCommands(t)
+	display := &fyneScreen{width: 4, height: 4}
+
+	// Press keys while the loop is running. Releases don't cause a redraw.
+	go func() {
+		for i := 0; i < 2; i++ {
+			time.Sleep(20 * time.Millisecond)
+			addKeyEvent(KeyEvent(KeyA))
+			addKeyEvent(KeyEvent(KeyA) | keyReleased)
+		}
+	}()
+	app := &testApp{stop: 2}
+	if err := Run[pixel.RGB888](display, app); err != errTestAppDone {
+		t.Fatalf("expected the error from Draw, got %v", err)
+	}
+
+	// The first frame is always drawn, after that only on a key press.
+	if fmt.Sprint(app.draws) != "[0 1 2]" {
+		t.Errorf("unexpected draws: %v", app.draws)
+	}
+
+	// Update is also called while there is no input.
+	if app.updates <= 3 {
+		t.Errorf("expected more updates than draws, got %d", app.updates)
+	}
+}
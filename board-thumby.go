@@ -3,8 +3,8 @@
 package board
 
 import (
+	"image/color"
 	"machine"
-	"math/bits"
 	"time"
 
 	"tinygo.org/x/drivers/pixel"
@@ -16,20 +16,86 @@ const (
 )
 
 var (
-	Power   = dummyBattery{state: UnknownBattery}
-	Sensors = baseSensors{}
-	Display = mainDisplay{}
-	Buttons = &gpioButtons{}
+	Power      = dummyBattery{state: UnknownBattery, reboot: reboot}
+	Sensors    = &dieSensors{}
+	Display    = mainDisplay{}
+	Buttons    = &gpioButtons{}
+	Watchdog   = noWatchdog{}
+	StatusLED  = noStatusLED{}
+	Vibration  = noVibration{}
+	Speaker    = pwmSpeaker{}
+	Microphone = dummyMicrophone{}
+	Encoder    = dummyEncoder{}
 )
 
+func boardInfo() BoardInfo {
+	return BoardInfo{
+		DisplayWidth:  72,
+		DisplayHeight: 40,
+		Keys:          append([]Key(nil), codes[:6]...),
+		NeedsFlush:    true,
+	}
+}
+
+// Piezo buzzer, driven using PWM.
+type pwmSpeaker struct{}
+
+const speakerPin = machine.GPIO28
+
+func (s pwmSpeaker) Configure() {
+	machine.PWM6.Configure(machine.PWMConfig{})
+}
+
+func (s pwmSpeaker) Tone(frequency uint32, duration time.Duration) {
+	<-s.StartTone(frequency, duration)
+}
+
+var speakerPlayer tonePlayer
+
+// Start playing a tone in the background. A new tone cuts off the current one.
+func (s pwmSpeaker) StartTone(frequency uint32, duration time.Duration) <-chan struct{} {
+	pwm := machine.PWM6
+	ch, err := pwm.Channel(speakerPin)
+	return speakerPlayer.play(duration, func() {
+		if err != nil || frequency == 0 {
+			pwm.Set(ch, 0)
+			return
+		}
+		pwm.SetPeriod(uint64(time.Second) / uint64(frequency))
+		pwm.Set(ch, pwm.Top()/2) // square wave
+	}, func() {
+		pwm.Set(ch, 0)
+	})
+}
+
+func (s pwmSpeaker) PlayNote(note uint8, duration time.Duration) {
+	playNote(s, note, duration)
+}
+
+func (s pwmSpeaker) PlaySequence(notes []Note) {
+	playSequence(s, notes)
+}
+
 type mainDisplay struct{}
 
+// Pixel format used by the display.
+type displayColor = pixel.Monochrome
+
+// Convert an sRGB color to the pixel format of the display, see Color.
+func convertDisplayColor(c color.RGBA) displayColor {
+	return convertColor[displayColor](c)
+}
+
 func (d mainDisplay) PPI() int {
-	return 192 // 72px wide display / 3/8 of an inch wide display
+	return displayPPI(192) // 72px wide display / 3/8 of an inch wide display
 }
 
 func (d mainDisplay) Configure() Displayer[pixel.Monochrome] {
-	machine.SPI0.Configure(machine.SPIConfig{})
+	machine.SPI0.Configure(machine.SPIConfig{
+		// Use the default frequency of the SPI peripheral, unless configured
+		// otherwise. The SSD1306 supports up to 10MHz (100ns clock cycle).
+		Frequency: displaySPIFrequency(0, 10*machine.MHz),
+	})
 	display := ssd1306.NewSPI(machine.SPI0, machine.THUMBY_DC_PIN, machine.THUMBY_RESET_PIN, machine.THUMBY_CS_PIN)
 	display.Configure(ssd1306.Config{
 		Width:     72,
@@ -53,45 +119,65 @@ func (d mainDisplay) WaitForVBlank(defaultInterval time.Duration) {
 	dummyWaitForVBlank(defaultInterval)
 }
 
+func (d mainDisplay) WaitForVBlankTimeout(defaultInterval, timeout time.Duration) bool {
+	endFrame()
+	return dummyWaitForVBlankTimeout(defaultInterval, timeout)
+}
+
+func (d mainDisplay) LastFrameDuration() time.Duration {
+	return lastFrameDuration()
+}
+
+// DrawBitmap only writes to the framebuffer of the driver, see
+// DrawTimeEstimate.
+func drawTimeEstimate(pixels int) time.Duration {
+	return 0
+}
+
 func (d mainDisplay) ConfigureTouch() TouchInput {
 	return noTouch{}
 }
 
 type gpioButtons struct {
-	state         uint8
-	previousState uint8
+	buttonState
+}
+
+// Button pins, in the same order as codes. The buttons are active low.
+var buttonPins = [6]machine.Pin{
+	machine.THUMBY_BTN_A_PIN,
+	machine.THUMBY_BTN_B_PIN,
+	machine.THUMBY_BTN_UDPAD_PIN,
+	machine.THUMBY_BTN_LDPAD_PIN,
+	machine.THUMBY_BTN_DDPAD_PIN,
+	machine.THUMBY_BTN_RDPAD_PIN,
 }
 
 func (b *gpioButtons) Configure() {
-	machine.THUMBY_BTN_A_PIN.Configure(machine.PinConfig{Mode: machine.PinInput})
-	machine.THUMBY_BTN_B_PIN.Configure(machine.PinConfig{Mode: machine.PinInput})
-	machine.THUMBY_BTN_UDPAD_PIN.Configure(machine.PinConfig{Mode: machine.PinInput})
-	machine.THUMBY_BTN_LDPAD_PIN.Configure(machine.PinConfig{Mode: machine.PinInput})
-	machine.THUMBY_BTN_DDPAD_PIN.Configure(machine.PinConfig{Mode: machine.PinInput})
-	machine.THUMBY_BTN_RDPAD_PIN.Configure(machine.PinConfig{Mode: machine.PinInput})
+	for _, pin := range buttonPins {
+		pin.Configure(machine.PinConfig{Mode: machine.PinInput})
+	}
+	if ButtonSettings.CaptureEdges {
+		captureButtonEdges(buttonPins[:])
+	}
 }
 
 func (b *gpioButtons) ReadInput() {
+	// Take the edges before reading the pins. Otherwise a press right after
+	// the pins were read would be taken as an edge (and reported as a short
+	// press and release) and then be reported again from the pins in the next
+	// call.
+	edges := takeButtonEdges()
 	state := uint8(0)
-	if !machine.THUMBY_BTN_A_PIN.Get() {
-		state |= 1
-	}
-	if !machine.THUMBY_BTN_B_PIN.Get() {
-		state |= 2
-	}
-	if !machine.THUMBY_BTN_UDPAD_PIN.Get() {
-		state |= 4
+	for i, pin := range buttonPins {
+		if !pin.Get() {
+			state |= 1 << i
+		}
 	}
-	if !machine.THUMBY_BTN_LDPAD_PIN.Get() {
-		state |= 8
-	}
-	if !machine.THUMBY_BTN_DDPAD_PIN.Get() {
-		state |= 16
-	}
-	if !machine.THUMBY_BTN_RDPAD_PIN.Get() {
-		state |= 32
-	}
-	b.state = state
+	b.read(state, edges)
+}
+
+func (b *gpioButtons) Snapshot() {
+	b.ReadInput()
 }
 
 var codes = [8]Key{
@@ -104,25 +190,13 @@ var codes = [8]Key{
 }
 
 func (b *gpioButtons) NextEvent() KeyEvent {
-	// The xor between the previous state and the current state is the buttons
-	// that changed.
-	change := b.state ^ b.previousState
-	if change == 0 {
-		return NoKeyEvent
-	}
-
-	// Find the index of the button with the lowest index that changed state.
-	index := bits.TrailingZeros32(uint32(change))
-	e := KeyEvent(codes[index])
-	if b.state&(1<<index) == 0 {
-		// The button state change was from 1 to 0, so it was released.
-		e |= keyReleased
-	}
+	return b.nextEvent(&codes)
+}
 
-	// This button event was read, so mark it as such.
-	// By toggling the bit, the bit will be set to the value that is currently
-	// in b.state.
-	b.previousState ^= (1 << index)
+func (b *gpioButtons) PeekEvent() KeyEvent {
+	return b.peekEvent(&codes)
+}
 
-	return e
+func (b *gpioButtons) Remap(index int, key Key) {
+	remapKey(codes[:6], index, key)
 }
@@ -0,0 +1,32 @@
+//go:build !baremetal
+
+package board
+
+// SupportedBoards returns the names of all boards supported by this package,
+// sorted alphabetically. It is only available outside of baremetal builds, for
+// tools like launchers and documentation generators.
+//
+// Most names are TinyGo target names, as passed to -target. The exceptions
+// are boards that don't have a TinyGo target of their own, which are
+// selected using a build tag on top of another target:
+//
+//   - "picodisplay": -target=pico -tags=picodisplay
+//   - "sha2017": -target=esp32 -tags=sha2017
+//   - "simulator": the simulator, which is used in regular (non-TinyGo) builds
+func SupportedBoards() []string {
+	return []string{
+		// Please keep this list sorted, and in sync with the board-*.go files!
+		"badger2040",
+		"gameboy-advance",
+		"gopher-badge",
+		"macropad-rp2040",
+		"mch2022",
+		"picodisplay",
+		"pinetime",
+		"pybadge",
+		"pyportal",
+		"sha2017",
+		"simulator",
+		"thumby",
+	}
+}
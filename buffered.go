@@ -0,0 +1,297 @@
+package board
+
+import (
+	"errors"
+
+	"tinygo.org/x/drivers"
+	"tinygo.org/x/drivers/pixel"
+)
+
+// Buffered wraps a display with a framebuffer in RAM. Most displays are
+// write-only, so drawing operations that depend on what is already on the
+// screen (like drawing a sprite with transparent pixels) need a copy of the
+// screen contents to work with. Everything drawn using Buffered is written
+// both to the framebuffer and to the display.
+//
+// The framebuffer takes up a lot of memory: a 240x240 display with 16 bits per
+// pixel needs 115kB. This is fine in the simulator, but many boards don't have
+// that much RAM available.
+type Buffered[T pixel.Color] struct {
+	Displayer[T]
+	buffer pixel.Image[T]
+	pixel  pixel.Image[T] // 1x1 image used by SetPixel, allocated when needed
+	mask   CircleMask
+}
+
+// NewBuffered returns a display with a framebuffer, that draws to the given
+// display. The framebuffer starts out zeroed (usually black), which may not
+// match what is currently shown on the display. Clear the display by drawing
+// over all of it, to keep the two in sync.
+func NewBuffered[T pixel.Color](display Displayer[T]) *Buffered[T] {
+	width, height := display.Size()
+	return &Buffered[T]{
+		Displayer: display,
+		buffer:    pixel.NewImage[T](int(width), int(height)),
+	}
+}
+
+// DrawBitmap draws the image to the display, and stores a copy in the
+// framebuffer. Pixels outside the circle mask (if set) are drawn black. When
+// DisplaySettings.ClipDrawBitmap is enabled, only the part of the image that
+// is visible on the display is stored.
+func (b *Buffered[T]) DrawBitmap(x, y int16, img pixel.Image[T]) error {
+	width, height := img.Size()
+	if !b.mask.containsRect(int(x), int(y), width, height) {
+		img = b.maskImage(x, y, img)
+	}
+	err := b.Displayer.DrawBitmap(x, y, img)
+	if err != nil {
+		return err
+	}
+	displayWidth, displayHeight := b.buffer.Size()
+	left, top, right, bottom := clipRect(x, y, width, height, int16(displayWidth), int16(displayHeight))
+	for imgY := top; imgY < bottom; imgY++ {
+		for imgX := left; imgX < right; imgX++ {
+			b.buffer.Set(int(x)+imgX, int(y)+imgY, img.Get(imgX, imgY))
+		}
+	}
+	return nil
+}
+
+// SetPixel sets a single pixel on the display and in the framebuffer. See
+// PixelSetter.
+func (b *Buffered[T]) SetPixel(x, y int16, c T) error {
+	width, height := b.Size()
+	if draw, err := checkPixel(x, y, width, height); !draw {
+		return err
+	}
+	if !b.mask.Contains(int(x), int(y)) {
+		return nil // already black
+	}
+	if setter, ok := b.Displayer.(PixelSetter[T]); ok {
+		if err := setter.SetPixel(x, y, c); err != nil {
+			return err
+		}
+	} else {
+		if b.pixel.Len() == 0 {
+			b.pixel = pixel.NewImage[T](1, 1)
+		}
+		b.pixel.Set(0, 0, c)
+		if err := b.Displayer.DrawBitmap(x, y, b.pixel); err != nil {
+			return err
+		}
+	}
+	b.buffer.Set(int(x), int(y), c)
+	return nil
+}
+
+// CircleMask is a circle on the display, for displays that should look round.
+// See Buffered.SetCircleMask and Simulator.WindowCircleMask. A zero Radius
+// means there is no mask.
+type CircleMask struct {
+	// Center of the circle. This is the corner between pixels, so that the
+	// circle is symmetric: for example, use 120, 120 for a 240x240 display.
+	X, Y int16
+
+	// Radius of the circle in pixels, for example 120 for a circle that
+	// touches the edges of a 240x240 display.
+	Radius int16
+}
+
+// Contains returns whether the pixel at (x, y) lies inside the circle. All
+// pixels lie inside a CircleMask with a zero Radius.
+func (m CircleMask) Contains(x, y int) bool {
+	if m.Radius <= 0 {
+		return true
+	}
+	// Calculate in half pixels, using the center of the pixel.
+	dx := 2*(x-int(m.X)) + 1
+	dy := 2*(y-int(m.Y)) + 1
+	r := 2 * int(m.Radius)
+	return dx*dx+dy*dy <= r*r
+}
+
+// Return whether the given rectangle lies entirely inside the circle. Because
+// a circle is convex, it is enough to check the corners.
+func (m CircleMask) containsRect(x, y, width, height int) bool {
+	return m.Contains(x, y) && m.Contains(x+width-1, y) && m.Contains(x, y+height-1) && m.Contains(x+width-1, y+height-1)
+}
+
+// SetCircleMask sets a circle outside of which nothing is drawn, to make a
+// square display look round (for example, for a watch face on the PineTime).
+// The pixels outside the circle are blanked right away, and are drawn black
+// from then on by DrawBitmap and everything else that draws using Buffered.
+// The zero CircleMask removes the mask again, but doesn't restore the corners.
+//
+// This is purely cosmetic: the display is still square, and drawing outside
+// the circle doesn't return an error. To preview how an app would look on a
+// round display in the simulator without changing what is drawn, use
+// Simulator.WindowCircleMask instead.
+func (b *Buffered[T]) SetCircleMask(mask CircleMask) error {
+	b.mask = mask
+	if mask.Radius <= 0 {
+		return nil
+	}
+	return b.DrawBitmap(0, 0, b.buffer)
+}
+
+// Return a copy of img to be drawn at (x, y), with the pixels outside the
+// circle mask set to black. Only the part that is visible on the display is
+// copied, the rest is never drawn.
+func (b *Buffered[T]) maskImage(x, y int16, img pixel.Image[T]) pixel.Image[T] {
+	width, height := img.Size()
+	masked := pixel.NewImage[T](width, height)
+	displayWidth, displayHeight := b.buffer.Size()
+	left, top, right, bottom := clipRect(x, y, width, height, int16(displayWidth), int16(displayHeight))
+	for imgY := top; imgY < bottom; imgY++ {
+		for imgX := left; imgX < right; imgX++ {
+			if b.mask.Contains(int(x)+imgX, int(y)+imgY) {
+				masked.Set(imgX, imgY, img.Get(imgX, imgY))
+			}
+		}
+	}
+	return masked
+}
+
+// Get returns the color of the pixel at the given coordinates, as stored in
+// the framebuffer.
+func (b *Buffered[T]) Get(x, y int) T {
+	return b.buffer.Get(x, y)
+}
+
+// SetRotation sets the rotation of the display. If this changes the size of
+// the display, the framebuffer is cleared.
+func (b *Buffered[T]) SetRotation(rotation drivers.Rotation) error {
+	err := b.Displayer.SetRotation(rotation)
+	if err != nil {
+		return err
+	}
+	width, height := b.Displayer.Size()
+	if bufWidth, bufHeight := b.buffer.Size(); bufWidth != int(width) || bufHeight != int(height) {
+		b.buffer = pixel.NewImage[T](int(width), int(height))
+	}
+	return nil
+}
+
+// DrawTransparent draws the image at the given coordinates like DrawBitmap,
+// except that pixels with the key color are transparent: the pixels that are
+// already on the screen (according to the framebuffer) are left unchanged.
+//
+// This is a lot slower than DrawBitmap: each pixel is compared against the key
+// color and composited in the framebuffer, and the result is sent to the
+// display line by line instead of all at once. Use DrawBitmap for images
+// without transparent pixels.
+func (b *Buffered[T]) DrawTransparent(x, y int16, img pixel.Image[T], key T) error {
+	width, height := img.Size()
+	displayWidth, displayHeight := b.Size()
+	if !fitsDisplay(x, y, width, height, displayWidth, displayHeight) {
+		return ErrOutOfBounds
+	}
+	line := pixel.NewImage[T](width, 1)
+	for imgY := 0; imgY < height; imgY++ {
+		for imgX := 0; imgX < width; imgX++ {
+			c := img.Get(imgX, imgY)
+			if c == key {
+				c = b.buffer.Get(int(x)+imgX, int(y)+imgY)
+			}
+			line.Set(imgX, 0, c)
+		}
+		err := b.DrawBitmap(x, y+int16(imgY), line)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+var errAlphaSize = errors.New("board: alpha slice doesn't match image size")
+
+// DrawBlended draws the image at the given coordinates, blending it with what
+// is already on the screen (according to the framebuffer). The alpha slice
+// contains the opacity of each pixel of the image, in the same order as the
+// pixels (row by row), so it must have one value per pixel. An alpha of 0
+// means fully transparent and 255 means fully opaque. This can be used for
+// translucent overlays and anti-aliased text.
+//
+// Blending is done with integer math in the color format of the display, so
+// the precision is limited by the number of bits per color: 16 steps for
+// RGB444, and only on/off (at an alpha of 128) for monochrome displays. Like
+// DrawTransparent, this is a lot slower than DrawBitmap.
+func (b *Buffered[T]) DrawBlended(x, y int16, img pixel.Image[T], alpha []uint8) error {
+	width, height := img.Size()
+	displayWidth, displayHeight := b.Size()
+	if !fitsDisplay(x, y, width, height, displayWidth, displayHeight) {
+		return ErrOutOfBounds
+	}
+	if len(alpha) != width*height {
+		return errAlphaSize
+	}
+	line := pixel.NewImage[T](width, 1)
+	for imgY := 0; imgY < height; imgY++ {
+		for imgX := 0; imgX < width; imgX++ {
+			dst := b.buffer.Get(int(x)+imgX, int(y)+imgY)
+			line.Set(imgX, 0, blendColor(dst, img.Get(imgX, imgY), alpha[imgY*width+imgX]))
+		}
+		err := b.DrawBitmap(x, y+int16(imgY), line)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Blend the src color over the dst color with the given alpha (0-255), in the
+// native color format.
+func blendColor[T pixel.Color](dst, src T, alpha uint8) T {
+	switch alpha {
+	case 0:
+		return dst
+	case 255:
+		return src
+	}
+	switch dst := any(dst).(type) {
+	case pixel.RGB888:
+		src := any(src).(pixel.RGB888)
+		return any(pixel.RGB888{
+			R: uint8(blendComponent(uint32(dst.R), uint32(src.R), alpha)),
+			G: uint8(blendComponent(uint32(dst.G), uint32(src.G), alpha)),
+			B: uint8(blendComponent(uint32(dst.B), uint32(src.B), alpha)),
+		}).(T)
+	case pixel.RGB565BE:
+		// Swap to native endianness, blend, and swap back.
+		d := uint32(dst<<8 | dst>>8)
+		s := uint32(any(src).(pixel.RGB565BE))
+		s = (s<<8 | s>>8) & 0xffff
+		result := blendFields(d&0xffff, s, alpha, [3]uint8{11, 5, 0}, [3]uint8{5, 6, 5})
+		return any(pixel.RGB565BE(result<<8 | result>>8)).(T)
+	case pixel.RGB555:
+		s := uint32(any(src).(pixel.RGB555))
+		return any(pixel.RGB555(blendFields(uint32(dst), s, alpha, [3]uint8{10, 5, 0}, [3]uint8{5, 5, 5}))).(T)
+	case pixel.RGB444BE:
+		s := uint32(any(src).(pixel.RGB444BE))
+		return any(pixel.RGB444BE(blendFields(uint32(dst), s, alpha, [3]uint8{8, 4, 0}, [3]uint8{4, 4, 4}))).(T)
+	default:
+		// Monochrome: there is nothing to blend.
+		if alpha >= 128 {
+			return src
+		}
+		return any(dst).(T)
+	}
+}
+
+// Blend the three color fields at the given bit positions and widths.
+func blendFields(dst, src uint32, alpha uint8, shifts, widths [3]uint8) uint32 {
+	var result uint32
+	for i := range shifts {
+		mask := uint32(1)<<widths[i] - 1
+		d := dst >> shifts[i] & mask
+		s := src >> shifts[i] & mask
+		result |= blendComponent(d, s, alpha) << shifts[i]
+	}
+	return result
+}
+
+// Blend a single color component, rounding to the nearest value.
+func blendComponent(dst, src uint32, alpha uint8) uint32 {
+	return (src*uint32(alpha) + dst*(255-uint32(alpha)) + 127) / 255
+}
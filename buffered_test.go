@@ -0,0 +1,314 @@
+package board
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"tinygo.org/x/drivers"
+	"tinygo.org/x/drivers/pixel"
+)
+
+// Write-only display for testing, which stores what is drawn to it so that it
+// can be compared with the framebuffer.
+type testDisplay[T pixel.Color] struct {
+	screen pixel.Image[T]
+	draws  int
+}
+
+func newTestDisplay[T pixel.Color](width, height int) *testDisplay[T] {
+	return &testDisplay[T]{screen: pixel.NewImage[T](width, height)}
+}
+
+func (d *testDisplay[T]) Size() (width, height int16) {
+	w, h := d.screen.Size()
+	return int16(w), int16(h)
+}
+
+func (d *testDisplay[T]) DrawBitmap(x, y int16, img pixel.Image[T]) error {
+	width, height := img.Size()
+	displayWidth, displayHeight := d.Size()
+	if DisplaySettings.ClipDrawBitmap && !fitsDisplay(x, y, width, height, displayWidth, displayHeight) {
+		// Like the boards that support DisplaySettings.ClipDrawBitmap.
+		return drawClipped(x, y, img, displayWidth, displayHeight, d.DrawBitmap)
+	}
+	if x < 0 || y < 0 || x+int16(width) > displayWidth || y+int16(height) > displayHeight {
+		return errors.New("out of bounds")
+	}
+	d.draws++
+	for imgY := 0; imgY < height; imgY++ {
+		for imgX := 0; imgX < width; imgX++ {
+			d.screen.Set(int(x)+imgX, int(y)+imgY, img.Get(imgX, imgY))
+		}
+	}
+	return nil
+}
+
+func (d *testDisplay[T]) Display() error                     { return nil }
+func (d *testDisplay[T]) Sleep(bool) error                   { return nil }
+func (d *testDisplay[T]) Rotation() drivers.Rotation         { return drivers.Rotation0 }
+func (d *testDisplay[T]) SetRotation(drivers.Rotation) error { return nil }
+
+func TestBufferedDrawTransparent(t *testing.T) {
+	black := pixel.NewColor[pixel.RGB565BE](0, 0, 0)
+	red := pixel.NewColor[pixel.RGB565BE](255, 0, 0)
+	blue := pixel.NewColor[pixel.RGB565BE](0, 0, 255)
+	magenta := pixel.NewColor[pixel.RGB565BE](255, 0, 255) // key color
+
+	display := newTestDisplay[pixel.RGB565BE](8, 8)
+	buffered := NewBuffered[pixel.RGB565BE](display)
+
+	// Draw a red background.
+	background := pixel.NewImage[pixel.RGB565BE](8, 8)
+	background.FillSolidColor(red)
+	if err := buffered.DrawBitmap(0, 0, background); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	// Draw a 3x3 blue sprite with a transparent border, except for the top
+	// left pixel which is black.
+	sprite := pixel.NewImage[pixel.RGB565BE](3, 3)
+	sprite.FillSolidColor(magenta)
+	sprite.Set(1, 1, blue)
+	sprite.Set(0, 0, black)
+	if err := buffered.DrawTransparent(2, 3, sprite, magenta); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	// Check the framebuffer and the display contents.
+	for y := 0; y < 8; y++ {
+		for x := 0; x < 8; x++ {
+			expected := red
+			if x == 3 && y == 4 {
+				expected = blue
+			} else if x == 2 && y == 3 {
+				expected = black
+			}
+			if c := buffered.Get(x, y); c != expected {
+				t.Errorf("framebuffer pixel (%d, %d): expected %v, got %v", x, y, expected, c)
+			}
+			if c := display.screen.Get(x, y); c != expected {
+				t.Errorf("display pixel (%d, %d): expected %v, got %v", x, y, expected, c)
+			}
+		}
+	}
+
+	// Sprites that don't fit are not drawn.
+	draws := display.draws
+	if err := buffered.DrawTransparent(6, 6, sprite, magenta); err != ErrOutOfBounds {
+		t.Errorf("expected an out of bounds error, got %v", err)
+	}
+	if display.draws != draws {
+		t.Error("sprite was partially drawn")
+	}
+}
+
+// Blend two colors given as RGB values, and return the result as RGBA value.
+func testBlend[T pixel.Color](dst, src [3]uint8, alpha uint8) [3]uint8 {
+	c := blendColor(pixel.NewColor[T](dst[0], dst[1], dst[2]), pixel.NewColor[T](src[0], src[1], src[2]), alpha).RGBA()
+	return [3]uint8{c.R, c.G, c.B}
+}
+
+func TestBlendColor(t *testing.T) {
+	black := [3]uint8{0, 0, 0}
+	white := [3]uint8{255, 255, 255}
+	red := [3]uint8{255, 0, 0}
+	blue := [3]uint8{0, 0, 255}
+	for _, tc := range []struct {
+		name     string
+		blend    func(dst, src [3]uint8, alpha uint8) [3]uint8
+		dst, src [3]uint8
+		alpha    uint8
+		expected [3]uint8
+	}{
+		{"RGB888 transparent", testBlend[pixel.RGB888], red, blue, 0, red},
+		{"RGB888 opaque", testBlend[pixel.RGB888], red, blue, 255, blue},
+		{"RGB888 half", testBlend[pixel.RGB888], black, white, 128, [3]uint8{128, 128, 128}},
+		{"RGB888 mix", testBlend[pixel.RGB888], red, blue, 64, [3]uint8{191, 0, 64}},
+		{"RGB565 half", testBlend[pixel.RGB565BE], black, white, 128, [3]uint8{132, 130, 132}},
+		{"RGB565 mix", testBlend[pixel.RGB565BE], red, blue, 64, [3]uint8{189, 0, 66}},
+		{"RGB565 opaque", testBlend[pixel.RGB565BE], red, blue, 255, blue},
+		{"RGB555 half", testBlend[pixel.RGB555], black, white, 128, [3]uint8{132, 132, 132}},
+		{"RGB444 half", testBlend[pixel.RGB444BE], black, white, 128, [3]uint8{136, 136, 136}},
+		{"RGB444 mix", testBlend[pixel.RGB444BE], red, blue, 64, [3]uint8{187, 0, 68}},
+		{"monochrome low", testBlend[pixel.Monochrome], black, white, 127, black},
+		{"monochrome high", testBlend[pixel.Monochrome], black, white, 128, white},
+	} {
+		if result := tc.blend(tc.dst, tc.src, tc.alpha); result != tc.expected {
+			t.Errorf("%s: expected %v, got %v", tc.name, tc.expected, result)
+		}
+	}
+}
+
+func TestBufferedDrawBlended(t *testing.T) {
+	display := newTestDisplay[pixel.RGB888](4, 4)
+	buffered := NewBuffered[pixel.RGB888](display)
+
+	// Draw a white 2x1 image over the black screen, with a different alpha
+	// for each pixel.
+	img := pixel.NewImage[pixel.RGB888](2, 1)
+	img.FillSolidColor(pixel.NewRGB888(255, 255, 255))
+	if err := buffered.DrawBlended(1, 1, img, []uint8{51, 204}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if c := display.screen.Get(1, 1); c != pixel.NewRGB888(51, 51, 51) {
+		t.Errorf("unexpected first pixel: %v", c)
+	}
+	if c := buffered.Get(2, 1); c != pixel.NewRGB888(204, 204, 204) {
+		t.Errorf("unexpected second pixel: %v", c)
+	}
+
+	// The alpha slice must match the image.
+	if err := buffered.DrawBlended(1, 1, img, []uint8{255}); err == nil {
+		t.Error("expected an error for a short alpha slice")
+	}
+}
+
+func TestBufferedSetPixel(t *testing.T) {
+	red := pixel.NewColor[pixel.RGB565BE](255, 0, 0)
+	display := newTestDisplay[pixel.RGB565BE](8, 8)
+	buffered := NewBuffered[pixel.RGB565BE](display)
+
+	if _, ok := AsPixelSetter[pixel.RGB565BE](display); ok {
+		t.Error("display without framebuffer must not be a PixelSetter")
+	}
+	setter, ok := AsPixelSetter[pixel.RGB565BE](buffered)
+	if !ok {
+		t.Fatal("buffered display must be a PixelSetter")
+	}
+
+	// The pixel is set both in the framebuffer and on the display.
+	if err := setter.SetPixel(7, 2, red); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if c := buffered.Get(7, 2); c != red {
+		t.Errorf("framebuffer pixel: expected %v, got %v", red, c)
+	}
+	if c := display.screen.Get(7, 2); c != red {
+		t.Errorf("display pixel: expected %v, got %v", red, c)
+	}
+
+	// Pixels outside the display are an error, unless clipping is enabled.
+	draws := display.draws
+	if err := setter.SetPixel(8, 2, red); err != ErrOutOfBounds {
+		t.Errorf("expected an out of bounds error, got %v", err)
+	}
+	DisplaySettings.ClipDrawBitmap = true
+	defer func() {
+		DisplaySettings.ClipDrawBitmap = false
+	}()
+	if err := setter.SetPixel(-1, 2, red); err != nil {
+		t.Errorf("unexpected error with clipping enabled: %v", err)
+	}
+	if display.draws != draws {
+		t.Error("pixel outside the display was drawn")
+	}
+}
+
+func TestBufferedDrawBitmapClipped(t *testing.T) {
+	white := pixel.NewRGB565BE(255, 255, 255)
+	display := newTestDisplay[pixel.RGB565BE](8, 8)
+	buffered := NewBuffered[pixel.RGB565BE](display)
+	DisplaySettings.ClipDrawBitmap = true
+	defer func() {
+		DisplaySettings.ClipDrawBitmap = false
+	}()
+
+	// Only the visible part of an image that sticks out of the display is
+	// drawn, and stored in the framebuffer.
+	img := pixel.NewImage[pixel.RGB565BE](4, 4)
+	img.FillSolidColor(white)
+	if err := buffered.DrawBitmap(-2, 6, img); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := buffered.DrawBitmap(6, -2, img); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	const clipped = "" +
+		"......##\n" +
+		"......##\n" +
+		"........\n" +
+		"........\n" +
+		"........\n" +
+		"........\n" +
+		"##......\n" +
+		"##......\n"
+	if got := testDisplayString(display); got != clipped {
+		t.Errorf("unexpected result:\n%s\nexpected:\n%s", got, clipped)
+	}
+	for y := 0; y < 8; y++ {
+		for x := 0; x < 8; x++ {
+			if c := buffered.Get(x, y); c != display.screen.Get(x, y) {
+				t.Errorf("framebuffer pixel (%d, %d): expected %v, got %v", x, y, display.screen.Get(x, y), c)
+			}
+		}
+	}
+
+	// The same with a circle mask, which blanks the corner of the display.
+	if err := buffered.SetCircleMask(CircleMask{X: 4, Y: 4, Radius: 4}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := buffered.DrawBitmap(-2, 6, img); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if c := buffered.Get(0, 7); c != pixel.NewRGB565BE(0, 0, 0) {
+		t.Errorf("corner in the framebuffer is not black: %v", c)
+	}
+	if c := buffered.Get(1, 6); c != white {
+		t.Errorf("pixel inside the mask is not white: %v", c)
+	}
+}
+
+func TestBufferedCircleMask(t *testing.T) {
+	white := pixel.NewRGB565BE(255, 255, 255)
+	display := newTestDisplay[pixel.RGB565BE](8, 8)
+	buffered := NewBuffered[pixel.RGB565BE](display)
+	FillRect[pixel.RGB565BE](buffered, 0, 0, 8, 8, white)
+
+	// Setting the mask blanks the corners.
+	if err := buffered.SetCircleMask(CircleMask{X: 4, Y: 4, Radius: 4}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	const round = "" +
+		"..####..\n" +
+		".######.\n" +
+		"########\n" +
+		"########\n" +
+		"########\n" +
+		"########\n" +
+		".######.\n" +
+		"..####..\n"
+	if got := testDisplayString(display); got != round {
+		t.Errorf("unexpected result after setting the mask:\n%s\nexpected:\n%s", got, round)
+	}
+
+	// Drawing over the entire display leaves the corners black, both on the
+	// display and in the framebuffer.
+	FillRect[pixel.RGB565BE](buffered, 0, 0, 8, 8, white)
+	if got := testDisplayString(display); got != round {
+		t.Errorf("unexpected result after drawing:\n%s\nexpected:\n%s", got, round)
+	}
+	if c := buffered.Get(0, 0); c != pixel.NewRGB565BE(0, 0, 0) {
+		t.Errorf("corner in the framebuffer is not black: %v", c)
+	}
+
+	// Images that lie entirely inside the circle are drawn as-is, and pixels
+	// outside of it are not drawn at all.
+	draws := display.draws
+	if err := buffered.SetPixel(0, 0, white); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+	if err := buffered.SetPixel(4, 4, white); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+	if display.draws != draws+1 {
+		t.Errorf("expected 1 draw, got %d", display.draws-draws)
+	}
+
+	// Removing the mask makes the entire display available again.
+	buffered.SetCircleMask(CircleMask{})
+	FillRect[pixel.RGB565BE](buffered, 0, 0, 8, 8, white)
+	if got := testDisplayString(display); strings.Contains(got, ".") {
+		t.Errorf("display not filled after removing the mask:\n%s", got)
+	}
+}
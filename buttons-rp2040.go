@@ -0,0 +1,37 @@
+//go:build rp2040
+
+package board
+
+import (
+	"machine"
+	"runtime/interrupt"
+)
+
+// Buttons that were pressed since the last call to takeButtonEdges, as a
+// bitmask in the same order as the pins passed to captureButtonEdges. It is
+// modified from the GPIO interrupt.
+var buttonEdges uint8
+
+// Record presses (falling edges) of the given active low button pins using pin
+// interrupts, for ButtonSettings.CaptureEdges. A recorded press also wakes up
+// Idle.
+func captureButtonEdges(pins []machine.Pin) {
+	for i, pin := range pins {
+		bit := uint8(1) << i
+		pin.SetInterrupt(machine.PinFalling, func(machine.Pin) {
+			buttonEdges |= bit
+		})
+	}
+	wakeSources[wakeButtons] = func() bool {
+		return buttonEdges != 0
+	}
+}
+
+// Return the buttons that were pressed since the last call, and reset them.
+func takeButtonEdges() uint8 {
+	mask := interrupt.Disable()
+	edges := buttonEdges
+	buttonEdges = 0
+	interrupt.Restore(mask)
+	return edges
+}
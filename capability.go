@@ -0,0 +1,107 @@
+package board
+
+import "tinygo.org/x/drivers/pixel"
+
+// This file contains optional display capabilities: features that only some
+// displays support, beyond what is in the Displayer interface. Use the As*
+// functions to check whether a display supports a given capability, for
+// example:
+//
+//	if scroller, ok := board.AsScroller(display); ok {
+//		scroller.SetScrollArea(0, 0)
+//	}
+//
+// These checks don't allocate, so they can be done while drawing.
+//
+// Rotation isn't an optional capability: every display has SetRotation, which
+// returns ErrRotationUnsupported on displays that can't be rotated (the Game
+// Boy Advance and the simulator).
+
+// Scroller is a display that supports hardware scrolling: the area between the
+// top and bottom fixed areas can be scrolled vertically without redrawing it.
+//
+// Supported on the Gopher Badge, MCH2022 badge, PineTime, PyBadge, PyPortal,
+// and the simulator.
+type Scroller interface {
+	// Set the height of the top and bottom areas that don't scroll.
+	SetScrollArea(topFixedArea, bottomFixedArea int16)
+
+	// Set the line of the scroll area that is shown at the top of the scroll
+	// area.
+	SetScroll(line int16)
+
+	// Stop scrolling, and show the display as usual.
+	StopScroll()
+}
+
+// ColorInverter is a display that can invert all colors on the screen.
+//
+// Supported on the Gopher Badge, PineTime, and PyBadge.
+type ColorInverter interface {
+	InvertColors(invert bool)
+}
+
+// ScanlineSyncer is a display that can report which line is currently being
+// refreshed, so that drawing can be synchronized with the refresh to avoid
+// tearing.
+//
+// Supported on the Gopher Badge and the PineTime.
+type ScanlineSyncer interface {
+	// Return the line that is currently being refreshed.
+	GetScanLine() uint16
+
+	// Wait until the given line is being refreshed.
+	SyncToScanLine(scanline uint16)
+}
+
+// PixelSetter is a display that can set a single pixel directly, without
+// creating a pixel.Image first. This is convenient for plotting and pixel art,
+// but slow when drawing many pixels: use DrawBitmap for that. Pixels outside
+// the display are handled like in DrawBitmap: they're an error unless
+// DisplaySettings.ClipDrawBitmap is enabled.
+//
+// Supported by displays with a framebuffer: the Game Boy Advance, the
+// simulator, and any display wrapped in Buffered. Other displays (which are
+// written over a bus like SPI) can be wrapped in Buffered to support it.
+type PixelSetter[T pixel.Color] interface {
+	SetPixel(x, y int16, c T) error
+}
+
+// AsScroller returns the display as a Scroller, if it supports hardware
+// scrolling.
+func AsScroller[T pixel.Color](display Displayer[T]) (Scroller, bool) {
+	scroller, ok := unwrapDisplay(display).(Scroller)
+	return scroller, ok
+}
+
+// AsColorInverter returns the display as a ColorInverter, if it can invert
+// colors.
+func AsColorInverter[T pixel.Color](display Displayer[T]) (ColorInverter, bool) {
+	inverter, ok := unwrapDisplay(display).(ColorInverter)
+	return inverter, ok
+}
+
+// AsScanlineSyncer returns the display as a ScanlineSyncer, if it can report
+// the current scanline.
+func AsScanlineSyncer[T pixel.Color](display Displayer[T]) (ScanlineSyncer, bool) {
+	syncer, ok := unwrapDisplay(display).(ScanlineSyncer)
+	return syncer, ok
+}
+
+// AsPixelSetter returns the display as a PixelSetter, if it can set single
+// pixels.
+func AsPixelSetter[T pixel.Color](display Displayer[T]) (PixelSetter[T], bool) {
+	// Don't unwrap Buffered displays: their SetPixel also needs to update the
+	// framebuffer.
+	setter, ok := display.(PixelSetter[T])
+	return setter, ok
+}
+
+// Return the underlying display of a Buffered display, which is where the
+// optional capabilities are implemented. Other displays are returned as-is.
+func unwrapDisplay[T pixel.Color](display Displayer[T]) Displayer[T] {
+	if buffered, ok := display.(*Buffered[T]); ok {
+		return buffered.Displayer
+	}
+	return display
+}
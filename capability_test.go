@@ -0,0 +1,52 @@
+package board
+
+import (
+	"testing"
+
+	"tinygo.org/x/drivers/pixel"
+)
+
+// Test display that supports scrolling, but nothing else.
+type scrollingTestDisplay struct {
+	*testDisplay[pixel.RGB565BE]
+	scroll int16
+}
+
+func (d *scrollingTestDisplay) SetScrollArea(topFixedArea, bottomFixedArea int16) {}
+func (d *scrollingTestDisplay) SetScroll(line int16)                              { d.scroll = line }
+func (d *scrollingTestDisplay) StopScroll()                                       { d.scroll = 0 }
+
+func TestCapabilities(t *testing.T) {
+	plain := newTestDisplay[pixel.RGB565BE](8, 8)
+	scrolling := &scrollingTestDisplay{testDisplay: plain}
+
+	if _, ok := AsScroller[pixel.RGB565BE](plain); ok {
+		t.Error("plain display must not be a Scroller")
+	}
+	if _, ok := AsColorInverter[pixel.RGB565BE](scrolling); ok {
+		t.Error("scrolling display must not be a ColorInverter")
+	}
+	if _, ok := AsScanlineSyncer[pixel.RGB565BE](scrolling); ok {
+		t.Error("scrolling display must not be a ScanlineSyncer")
+	}
+
+	// Capabilities of a display wrapped in Buffered must still be found.
+	scroller, ok := AsScroller[pixel.RGB565BE](NewBuffered[pixel.RGB565BE](scrolling))
+	if !ok {
+		t.Fatal("buffered scrolling display must be a Scroller")
+	}
+	scroller.SetScroll(3)
+	if scrolling.scroll != 3 {
+		t.Errorf("SetScroll didn't reach the display")
+	}
+
+	// Checking for capabilities must not allocate.
+	var display Displayer[pixel.RGB565BE] = scrolling
+	allocs := testing.AllocsPerRun(10, func() {
+		AsScroller(display)
+		AsColorInverter(display)
+	})
+	if allocs != 0 {
+		t.Errorf("expected no allocations, got %.1f", allocs)
+	}
+}
@@ -1,6 +1,10 @@
 package board
 
 import (
+	"errors"
+	"image/color"
+	"math/bits"
+	"sync"
 	"time"
 	"unsafe"
 
@@ -9,7 +13,56 @@ import (
 )
 
 var (
-	AddressableLEDs LEDArray = dummyAddressableLEDs{}
+	AddressableLEDs  LEDArray           = dummyAddressableLEDs{}
+	SecondaryDisplay SecondaryDisplayer = noSecondaryDisplay{}
+)
+
+// Errors returned by this package, so that callers can check for them using
+// errors.Is. Errors from the underlying drivers (for example the display
+// controller driver on a board) are returned as-is.
+//
+// Missing touch input or a missing battery are not errors: Display.ConfigureTouch
+// returns a TouchInput that never reports any touches, and Power.Status
+// returns NoBattery or UnknownBattery.
+var (
+	// ErrOutOfBounds is returned when drawing (partially) outside of the
+	// display or buffer.
+	ErrOutOfBounds = errors.New("board: drawing out of bounds")
+
+	// ErrRotationUnsupported is returned by Display.SetRotation on displays
+	// that can't be rotated.
+	ErrRotationUnsupported = errors.New("board: rotation not supported")
+
+	// ErrOnlySimulator is returned by functions that only work in the
+	// simulator, like Simulator.PlayScript, when called on a real board.
+	ErrOnlySimulator = errors.New("board: only supported in the simulator")
+
+	// ErrNoMicrophone is returned by Microphone.Configure and Microphone.Read
+	// on boards without a microphone.
+	ErrNoMicrophone = errors.New("board: no microphone")
+
+	// ErrNoShutdown is returned by Power.Shutdown on boards that can't power
+	// themselves off, or that can't do so right now (for example, because
+	// they're powered over USB).
+	ErrNoShutdown = errors.New("board: shutdown not supported")
+
+	// ErrNoReboot is returned by Power.Reboot on boards where rebooting (or
+	// entering the bootloader) isn't supported.
+	ErrNoReboot = errors.New("board: reboot not supported")
+
+	// ErrBusTimeout is returned when a bus that is shared between several
+	// chips (like SPI0 and I2C1 on the PineTime) stays busy for too long, or
+	// when a transaction on it failed in a way that left the bus stuck. The bus
+	// is recovered where possible before returning this error, so the call
+	// can be retried.
+	ErrBusTimeout = errors.New("board: bus timeout")
+
+	// ErrSensorNotFound is returned by Sensors.Configure when one of the
+	// requested sensors doesn't respond, for example because it is missing on
+	// this variant of the board or because it is broken. The other sensors are
+	// still configured and can be used. Sensors.Update also returns it for
+	// measurements of a missing sensor, without trying to talk to it.
+	ErrSensorNotFound = errors.New("board: sensor not found")
 )
 
 // Settings for the simulator. These can be modified at any time, but it is
@@ -18,7 +71,27 @@ var (
 // These can be modified to match whatever board your main target is. For
 // example, if your board has a display that's only 160 by 128 pixels, you can
 // modify the window size here to get a realistic simulation.
-var Simulator = struct {
+var Simulator = SimulatorSettings{
+	WindowTitle:  "Simulator",
+	WindowWidth:  240,
+	WindowHeight: 240,
+	WindowPPI:    120, // common on many modern displays (for example Retina is 254 / 2 = 127)
+
+	// This matches common event badges like the PyBadge and the MCH2022 badge
+	// (but not the SHA2017 badge which uses 6 RGBW LEDs).
+	AddressableLEDs: 5,
+
+	// Similar to the watchdog timeout on the PineTime.
+	WatchdogTimeout: 5 * time.Second,
+	WatchdogReset:   true,
+
+	SensorNoise: true,
+}
+
+// SimulatorSettings is the type of the Simulator settings variable. It also has
+// methods to control the simulator, which return ErrOnlySimulator on real
+// boards.
+type SimulatorSettings struct {
 	WindowTitle string
 
 	// Width and height in virtual pixels (matching Size()). The window will
@@ -35,17 +108,794 @@ var Simulator = struct {
 	//     time.Second * 16 / 8e6
 	WindowDrawSpeed time.Duration
 
+	// Highest backlight brightness level of the display, as returned by
+	// Display.MaxBrightness. The default 0 means 1: the backlight can only be
+	// turned on or off, like on most boards. The window dims the display
+	// accordingly.
+	WindowMaxBrightness int
+
+	// Circle to preview a round display, by darkening the corners of the
+	// display in the window. This only changes how the window shows the
+	// display, not what is drawn on it (see Buffered.SetCircleMask for that).
+	WindowCircleMask CircleMask
+
+	// Outline of the visible area of the display, for displays that aren't
+	// plain rectangles (like displays with rounded corners or a notch). The
+	// window darkens the parts of the display outside the outline, to show
+	// which parts would be invisible on the real display. The zero value is a
+	// plain rectangle.
+	WindowOutline DisplayOutline
+
+	// Color depth in bits per pixel to preview in the window, for example to
+	// compare a gradient in 16-bit color (RGB565, used by most boards) with
+	// the same gradient in 18-bit color (RGB666, which the ILI9341 on the
+	// PyPortal and MCH2022 badge supports but this package doesn't use yet).
+	// Supported values are 12 (RGB444), 16 (RGB565) and 18 (RGB666). The
+	// default 0 shows the full 24-bit color that is drawn. This only changes
+	// how the window shows the display, not the pixel format or the time it
+	// takes to draw (see WindowDrawSpeed for that).
+	WindowColorDepth int
+
+	// Position of the top left corner of the window on the screen of the
+	// host, in screen coordinates. The default nil lets the OS choose the
+	// position, like for any other window. The window is moved when it is
+	// first drawn, so it may briefly show up elsewhere. Not all platforms
+	// allow apps to position their windows (Wayland for example doesn't),
+	// and it is ignored on Intel Macs.
+	WindowStartPosition *WindowPosition
+
+	// Keep the window above other windows, so that it stays visible while
+	// editing code. Like WindowStartPosition, this only has an effect when
+	// the window is started.
+	WindowAlwaysOnTop bool
+
 	// Number of addressable LEDs used by default.
 	AddressableLEDs int
-}{
-	WindowTitle:  "Simulator",
-	WindowWidth:  240,
-	WindowHeight: 240,
-	WindowPPI:    120, // common on many modern displays (for example Retina is 254 / 2 = 127)
 
-	// This matches common event badges like the PyBadge and the MCH2022 badge
-	// (but not the SHA2017 badge which uses 6 RGBW LEDs).
-	AddressableLEDs: 5,
+	// Size in pixels of the secondary display (see SecondaryDisplay), which
+	// is shown below the main display in the window. The default of 0 means
+	// there is no secondary display, like on all supported boards. For
+	// example, use 128 by 32 to simulate a small status OLED.
+	SecondaryDisplayWidth  int
+	SecondaryDisplayHeight int
+
+	// Watchdog timeout. When Watchdog.Feed isn't called within this time
+	// (after Watchdog.Configure), the watchdog expires. The value 0 disables
+	// the simulated watchdog.
+	WatchdogTimeout time.Duration
+
+	// What to do when the watchdog expires. If true, the simulator exits like
+	// a real board would reset. If false, it only logs a message to stderr.
+	WatchdogReset bool
+
+	// Ring the terminal bell when Vibration.Pulse or Speaker.Tone is called,
+	// in addition to showing it in the window.
+	Beep bool
+
+	// Number of touch reports per second, like the report rate of a real
+	// touch controller (capacitive touch panels typically report at 60-120Hz).
+	// ReadTouch only returns new touch data at this rate, and returns the
+	// previous report in between. This also means that touches are reported a
+	// little late, like on real hardware. The value 0 means ReadTouch always
+	// returns the current touch state.
+	TouchReportRate int
+
+	// Maximum offset in pixels that is randomly added to each reported touch
+	// position in both directions, to simulate noise from the touch panel.
+	// The value 0 disables it.
+	TouchJitter int
+
+	// Add random noise to the simulated sensor values, like the noise of real
+	// sensors. This affects all measurements of Sensors (including the
+	// samples of ReadAccelBuffer) and the battery voltage returned by
+	// Power.Status. Set it to false to get exactly the values that were set in
+	// the window or using input events, for example to check exact values in
+	// tests. Noise of touch positions is controlled by TouchJitter instead.
+	SensorNoise bool
+
+	// Seed for the random noise that is added to the simulated sensor values,
+	// the battery voltage, and touch positions (see TouchJitter). The default
+	// 0 uses a different seed on every run. Any other value makes the noise
+	// the same on every run, so that tests of code that depends on these
+	// values are reproducible. Changing the seed restarts the sequence of
+	// random numbers.
+	RandSeed int64
+
+	// Emulate vblank timing based on a tearing effect (TE) signal, like on the
+	// PyPortal and the Gopher Badge. Normally, WaitForVBlank in the simulator
+	// waits for the default interval since the previous call. With TE
+	// emulation, the display refreshes continuously at TERefreshRate and
+	// WaitForVBlank waits for the start of the next blanking period, like it
+	// does on these boards: even when it is called during a blanking period,
+	// it waits for the next one. Drawing then has TEBlankingTime to finish
+	// before the display starts refreshing again, see TornFrames.
+	EmulateTE bool
+
+	// Refresh rate in Hz used by EmulateTE. The value 0 means 60Hz.
+	TERefreshRate int
+
+	// Duration of the blanking period at the start of each frame used by
+	// EmulateTE. The value 0 means a tenth of the frame time.
+	TEBlankingTime time.Duration
+
+	// How fast simulated time runs compared to real time: 2 makes the board's
+	// pacing run twice as fast, 0.5 makes it run at half speed. The value 0
+	// means real time (the same as 1). This can be changed at any time, and
+	// is useful to speed up long animations or to slow down timing bugs.
+	//
+	// This affects WaitForVBlank and WaitForVBlankTimeout (including the
+	// EmulateTE timing), WindowDrawSpeed, and TouchReportRate. It does not
+	// affect time.Now, time.Sleep, or other timing done by the app itself, so
+	// apps that measure time using time.Now won't see any difference.
+	TimeScale float64
+}
+
+// WindowPosition is a position on the screen of the host, for use in
+// Simulator.WindowStartPosition.
+type WindowPosition struct {
+	X, Y int
+}
+
+// DisplayOutline is the shape of the visible area of a display, for use in
+// Simulator.WindowOutline. All sizes are in pixels.
+type DisplayOutline struct {
+	// Radius of the rounded corners. The value 0 means square corners.
+	CornerRadius int
+
+	// Size of the notch (cutout) in the middle of the top edge of the
+	// display. A zero width or height means there is no notch.
+	NotchWidth, NotchHeight int
+}
+
+// Contains returns whether the pixel at (x, y) lies within the outline, on a
+// display of the given size.
+func (o DisplayOutline) Contains(x, y, width, height int) bool {
+	// Notch.
+	notchLeft := (width - o.NotchWidth) / 2
+	if o.NotchWidth > 0 && y < o.NotchHeight && x >= notchLeft && x < notchLeft+o.NotchWidth {
+		return false
+	}
+
+	// Rounded corners: mirror the pixel to the top left corner, and check
+	// whether it lies inside the circle of that corner (calculated in half
+	// pixels, using the center of the pixel).
+	r := o.CornerRadius
+	if x >= width-x {
+		x = width - 1 - x
+	}
+	if y >= height-y {
+		y = height - 1 - y
+	}
+	if x >= r || y >= r {
+		return true
+	}
+	dx := 2*(x-r) + 1
+	dy := 2*(y-r) + 1
+	return dx*dx+dy*dy <= 4*r*r
+}
+
+// PlayScript reads a script of timed input events from the given file, and
+// plays them back in the background as if they were entered in the simulator
+// window. This is useful to reproduce bugs and to record demos. It returns an
+// error if the file can't be read or isn't valid, without playing any events.
+//
+// The script is a text file with one event per line, in the following format:
+//
+//	<milliseconds> <event> [arguments...]
+//
+// The time is the number of milliseconds since PlayScript was called, and must
+// not decrease from one line to the next. Empty lines and lines starting with
+// # are ignored. These are the supported events:
+//
+//	keypress <key>      press a key, where <key> is the numeric Key value
+//	                    (for example 8 for KeyA)
+//	keyrelease <key>    release a key
+//	mousedown <x> <y>   start touching the screen at the given position
+//	mousemove <x> <y>   move the current touch to a new position
+//	mouseup             stop touching the screen
+//	accel <x> <y> <z>   set the acceleration in g, for example 0 1 0 when the
+//	                    device is upright
+//	steps <n>           set the step count
+//	shake               shake the device for half a second, as seen in the
+//	                    samples of Sensors.ReadAccelBuffer
+//	light <level>       set the ambient light level (0-1000)
+//	proximity <value>   set the proximity sensor value (0-255, where 255
+//	                    means the sensor is covered)
+//	gyro <x> <y> <z>    set the angular velocity in degrees per second
+//	magnetic <x> <y> <z>
+//	                    set the magnetic field in µT
+//	temperature <t>     set the temperature in milli-degrees Celsius
+//	pressure <p>        set the air pressure in milli-Pascal
+//	humidity <h>        set the relative humidity in hundredths of a percent
+//	battery-temperature <t>
+//	                    set the battery temperature in milli-degrees Celsius
+//	wheel <n>           turn the rotary encoder by n steps (negative is
+//	                    counterclockwise), ignored unless Encoder.Configure
+//	                    was called
+//	encoder-press       push the rotary encoder in
+//	encoder-release     release the rotary encoder
+//
+// For example, this script presses and releases KeyA after one second:
+//
+//	1000 keypress 8
+//	1100 keyrelease 8
+func (s *SimulatorSettings) PlayScript(path string) error {
+	return playScript(path)
+}
+
+// RecordInput records all input events from the simulator window (key
+// presses, touches, and accelerometer and step count changes) to the given
+// file, in the format used by PlayScript. This way, a manual session can be
+// captured and replayed later. Times are relative to the call to RecordInput.
+//
+// Recording continues until the program exits, or until RecordInput is called
+// again: with another path to record to a new file, or with an empty path to
+// stop recording. The file is overwritten if it already exists. Events are
+// delivered as usual while recording.
+func (s *SimulatorSettings) RecordInput(path string) error {
+	return recordInput(path)
+}
+
+// InjectSensorError makes Sensors.Configure and Sensors.Update return the
+// given error whenever they're called with one of the sensors in which, to
+// test how an app handles a failing sensor (for example, a broken I2C
+// connection). The sensor values are not updated while the error is active,
+// but the other sensors in the same call are configured and updated as usual.
+// Use ErrSensorNotFound to simulate a sensor that is missing entirely, like
+// the accelerometer on a board variant without one. Sensors.Available doesn't
+// include sensors with an injected error.
+//
+// The error stays active until it is cleared by passing a nil error for the
+// same sensors, for example:
+//
+//	board.Simulator.InjectSensorError(drivers.AllMeasurements, nil)
+//
+// This does nothing on real boards.
+func (s *SimulatorSettings) InjectSensorError(which drivers.Measurement, err error) {
+	injectSensorError(which, err)
+}
+
+// InjectDisplayError makes the next call to DrawBitmap or Display on the
+// simulated display fail with the given error, without drawing anything. This
+// is a transient error: the call after that works as usual again. Passing nil
+// cancels an error that hasn't been returned yet.
+//
+// Real hardware rarely fails in the middle of drawing, but it can happen, for
+// example because of glitches on the SPI bus or (on the PineTime) when the bus
+// is shared with another device. Use this to check that an app handles these
+// errors instead of ignoring them.
+//
+// This does nothing on real boards.
+func (s *SimulatorSettings) InjectDisplayError(err error) {
+	injectDisplayError(err)
+}
+
+// StallBus keeps the simulated bus that is shared by the display and the
+// sensors busy for the given duration, like a bus on a real board that is stuck
+// or held for too long by another chip (see ErrBusTimeout). Display and sensor
+// calls that need the bus during that time wait for it, and return
+// ErrBusTimeout when it stays busy for more than a second. Use this to check
+// that an app recovers from a stuck bus, for example by retrying later.
+//
+// This does nothing on real boards.
+func (s *SimulatorSettings) StallBus(duration time.Duration) {
+	stallBus(duration)
+}
+
+// Pause freezes the simulator for debugging, for example to inspect a single
+// frame of a render loop. While paused:
+//
+//   - WaitForVBlank and WaitForVBlankTimeout block (without timing out), so
+//     that a render loop that waits for vblank stops at a frame boundary.
+//   - Input events (keys, touches, sensor changes) are held back, and are
+//     delivered on the next Step or Resume.
+//   - Drawing still works as usual, so a frame that was being drawn when
+//     pausing is finished and can be examined in the window.
+//
+// Time itself doesn't stop: calls like time.Sleep and Idle in the app, and
+// the timing of PlayScript, continue as usual. Uptime and time.Now also keep
+// counting, so an app that animates based on them sees a jump after Resume
+// (or Step) by the time spent paused. Frame timing isn't affected:
+// LastFrameDuration and SetFrameHook only count the time spent in DrawBitmap
+// and Display, which don't wait while paused, and not the time spent waiting
+// in WaitForVBlank. The simulator window has Pause, Step, and Resume buttons
+// that do the same thing as these methods.
+//
+// This does nothing on real boards.
+func (s *SimulatorSettings) Pause() {
+	pauseSimulator()
+}
+
+// Step lets a paused simulator continue for a single frame: the next
+// WaitForVBlank call returns, and input events that were held back are
+// delivered. It does nothing when the simulator isn't paused.
+//
+// This does nothing on real boards.
+func (s *SimulatorSettings) Step() {
+	stepSimulator()
+}
+
+// Resume continues a simulator that was paused with Pause, delivering any
+// input events that were held back.
+//
+// This does nothing on real boards.
+func (s *SimulatorSettings) Resume() {
+	resumeSimulator()
+}
+
+// RunInProcess runs the simulator window in the current process instead of in
+// a separate child process, and runs app in a separate goroutine. This makes
+// it easier to debug or profile the window code, because everything runs in a
+// single process. It doesn't return: the program exits when app returns or
+// when the window is closed.
+//
+// It must be called from the main goroutine (usually at the start of main),
+// before using any other part of the board package: GUI toolkits like the one
+// used by the simulator require running on the main thread on some systems,
+// notably macOS. That's also why the window runs in a separate process by
+// default, since the board API doesn't have a main loop that could run on the
+// main goroutine. If the window was already started, app is simply called
+// directly.
+//
+// On real boards, this simply calls app.
+func (s *SimulatorSettings) RunInProcess(app func()) {
+	runInProcess(app)
+}
+
+// TornFrames returns the number of frames where drawing (with DrawBitmap or
+// Display) continued after the blanking period that started when
+// WaitForVBlank returned, with EmulateTE enabled. On real hardware, these
+// frames may show tearing. It returns 0 on real boards.
+func (s *SimulatorSettings) TornFrames() int {
+	return tornFrames()
+}
+
+// Settings for the display. Unless noted otherwise, these must be modified
+// before calling Display.Configure, changes afterwards have no effect.
+var DisplaySettings = struct {
+	// SPI clock frequency in Hz for displays connected over SPI. The value 0
+	// means the board default, which is usually the highest frequency known
+	// to work reliably. Lower it when signal integrity is a problem (long
+	// wires, level shifters). Values above the maximum supported by the
+	// display controller or the microcontroller are clamped to that maximum.
+	// It is ignored on boards without an SPI display (like the PyPortal, which
+	// uses a parallel bus).
+	SPIFrequency uint32
+
+	// Clip images passed to DrawBitmap to the display, instead of returning an
+	// error when they don't fit. This includes images that extend past the
+	// right or bottom edge of the display, and images with a negative x or y
+	// coordinate (that extend past the left or top edge). Only the visible
+	// part of the image is drawn. This is convenient for sprites near the edge
+	// of the screen and for scrolling game worlds, but it hides bugs where an
+	// image is drawn in the wrong place, which is why it is disabled by
+	// default. This setting can be changed at any time.
+	//
+	// Supported on the simulator, the Game Boy Advance, the Gopher Badge, the
+	// MacroPad, the Pico Display Pack, the PineTime, the PyBadge, the
+	// PyPortal and the SHA2017 badge.
+	ClipDrawBitmap bool
+
+	// Swap the red and blue color channels, for display panels that are wired
+	// BGR where the board normally has an RGB panel (or the other way
+	// around). Such panels show red as blue and blue as red. By default, each
+	// board uses the color order of the panel it ships with. The colors are
+	// swapped by the display controller, so this doesn't slow down drawing.
+	//
+	// Supported on the boards with an ST7735 or ST7789 display controller
+	// (Gopher Badge, Pico Display Pack, PineTime, PyBadge). In the simulator, the window shows
+	// what the swapped colors look like, to preview the effect of a wrongly
+	// configured panel.
+	SwapRedBlue bool
+
+	// Override for the value returned by Display.PPI, for boards with a
+	// different display panel than the one the board usually ships with (or
+	// when the default value isn't accurate enough). The value 0 means the
+	// board default. This setting can be changed at any time.
+	PPI int
+
+	// Brightness level at which Display.Configure turns on the backlight, so
+	// that for example a watch face appears at the right brightness right
+	// away, without the backlight being off until the first SetBrightness
+	// call. Levels above Display.MaxBrightness are lowered to it. The default
+	// 0 leaves the backlight off until SetBrightness is called. It must be set
+	// before calling Display.Configure.
+	//
+	// Supported on the boards with a backlight (Gopher Badge, Pico Display
+	// Pack, PineTime, PyBadge, PyPortal) and the simulator.
+	InitialBrightness int
+}{}
+
+// Time spent drawing, see Display.LastFrameDuration. Apps may draw and read
+// LastFrameDuration from different goroutines, so it is guarded by lock.
+var frameTime struct {
+	lock    sync.Mutex
+	current time.Duration // time spent drawing since the end of the last frame
+	last    time.Duration // time spent drawing the last frame
+}
+
+// Add the time since start to the time spent drawing the current frame. It is
+// meant to be deferred at the start of a draw function:
+//
+//	defer addFrameTime(time.Now())
+func addFrameTime(start time.Time) {
+	duration := time.Since(start)
+	frameTime.lock.Lock()
+	frameTime.current += duration
+	frameTime.lock.Unlock()
+}
+
+// Function called at the end of each frame, or nil if not set.
+var frameHook func(drawTime time.Duration)
+
+// SetFrameHook sets a function that is called at the end of every frame in
+// which something was drawn, with the time spent drawing it (the value that
+// Display.LastFrameDuration returns from then on). This can be used to collect
+// timing information, or to run logic once per frame without polling. Passing
+// nil removes the hook again.
+//
+// A frame ends when Display is called, or at the next WaitForVBlank when the
+// display doesn't need Display to be called. The hook is called synchronously
+// from that call, so on the goroutine that is drawing. It should be fast, as it
+// delays the next frame. Like LastFrameDuration, it isn't called on boards
+// where drawing isn't measured (the MCH2022 badge, Badger 2040, and Thumby).
+//
+// When no hook is set, this costs a single check per frame.
+func SetFrameHook(hook func(drawTime time.Duration)) {
+	frameHook = hook
+}
+
+// End the current frame, if anything was drawn in it. This is called on
+// WaitForVBlank and after Display.
+func endFrame() {
+	frameTime.lock.Lock()
+	drawTime := frameTime.current
+	if drawTime != 0 {
+		frameTime.last = drawTime
+		frameTime.current = 0
+	}
+	frameTime.lock.Unlock()
+	if drawTime != 0 && frameHook != nil {
+		frameHook(drawTime)
+	}
+}
+
+// Return the time it took to draw the last frame.
+func lastFrameDuration() time.Duration {
+	frameTime.lock.Lock()
+	defer frameTime.lock.Unlock()
+	return frameTime.last
+}
+
+// DrawTimeEstimate returns roughly how long it takes to draw the given number
+// of pixels to the main display using DrawBitmap. Apps can use it to decide how
+// much to redraw in a single frame, for example to finish drawing before the
+// display refresh catches up with it (which would cause tearing).
+//
+// The estimate is based on the clock frequency of the display bus and the
+// number of bits per pixel. It doesn't include the time the app needs to
+// prepare the image, or overhead like short pauses between bytes on the bus,
+// so drawing is usually a bit slower in practice: use
+// Display.LastFrameDuration to measure it. In the simulator, it is based on
+// Simulator.WindowDrawSpeed.
+//
+// It returns 0 on boards where DrawBitmap only writes to memory: the Game Boy
+// Advance, which has the framebuffer in RAM, and the boards that need a call to
+// Display to send the image to the display (see BoardInfo.NeedsFlush). It also
+// returns 0 on the PyPortal, where the speed of the parallel bus (which is
+// driven by the CPU) isn't known, and before Display.Configure on boards where
+// the bus frequency is only known after configuring the display.
+func DrawTimeEstimate(pixels int) time.Duration {
+	if pixels <= 0 {
+		return 0
+	}
+	return drawTimeEstimate(pixels)
+}
+
+// Return how long it takes to send the given number of pixels over a display
+// bus with the given clock frequency in Hz, where each byte takes
+// clocksPerByte clock cycles. A frequency of 0 means the display hasn't been
+// configured yet, which returns 0.
+func busDrawTime(pixels, bitsPerPixel int, frequency uint32, clocksPerByte int) time.Duration {
+	if frequency == 0 {
+		return 0
+	}
+	bytes := (int64(pixels)*int64(bitsPerPixel) + 7) / 8
+	return time.Duration(bytes * int64(clocksPerByte) * int64(time.Second) / int64(frequency))
+}
+
+// Draw img at (x, y) using the draw function of a display driver. If the image
+// doesn't fit on the display and DisplaySettings.ClipDrawBitmap is enabled,
+// only the visible part is drawn. Otherwise, the image is passed to the driver
+// as-is (which will return an error if it doesn't fit).
+func drawBitmapClipped[T pixel.Color](x, y int16, img pixel.Image[T], displayWidth, displayHeight int16, draw func(x, y int16, img pixel.Image[T]) error) error {
+	defer addFrameTime(time.Now())
+	start := traceStart()
+	width, height := img.Size()
+	var err error
+	if DisplaySettings.ClipDrawBitmap && !fitsDisplay(x, y, width, height, displayWidth, displayHeight) {
+		err = drawClipped(x, y, img, displayWidth, displayHeight, draw)
+	} else {
+		err = draw(x, y, img)
+	}
+	traceEnd(TraceDisplayDraw, start, int32(width*height), err)
+	return err
+}
+
+// Return the part of a width by height image at (x, y) that is visible on a
+// display of the given size, in image coordinates. The right and bottom edges
+// are exclusive, so the visible part is empty (nothing needs to be drawn) when
+// left >= right or top >= bottom.
+func clipRect(x, y int16, width, height int, displayWidth, displayHeight int16) (left, top, right, bottom int) {
+	if x < 0 {
+		left = -int(x)
+	}
+	if y < 0 {
+		top = -int(y)
+	}
+	right = int(displayWidth) - int(x)
+	if right > width {
+		right = width
+	}
+	bottom = int(displayHeight) - int(y)
+	if bottom > height {
+		bottom = height
+	}
+	return
+}
+
+// Return whether a width by height image at (x, y) fits entirely on a display
+// of the given size. Empty images never fit: drawing them is most likely a bug.
+func fitsDisplay(x, y int16, width, height int, displayWidth, displayHeight int16) bool {
+	left, top, right, bottom := clipRect(x, y, width, height, displayWidth, displayHeight)
+	return width > 0 && height > 0 && left == 0 && top == 0 && right == width && bottom == height
+}
+
+// Draw the part of img at (x, y) that is visible on a display of the given
+// size, for displays where DisplaySettings.ClipDrawBitmap is enabled. The draw
+// function is only called with images that fit on the display.
+func drawClipped[T pixel.Color](x, y int16, img pixel.Image[T], displayWidth, displayHeight int16, draw func(x, y int16, img pixel.Image[T]) error) error {
+	width, height := img.Size()
+	left, top, right, bottom := clipRect(x, y, width, height, displayWidth, displayHeight)
+	if left >= right || top >= bottom {
+		return nil // nothing to draw
+	}
+	if left == 0 && top == 0 && right == width {
+		// Only the bottom part is cut off, which doesn't need a copy.
+		return draw(x, y, img.LimitHeight(bottom))
+	}
+
+	// Draw the visible part line by line, which only needs a small buffer.
+	line := pixel.NewImage[T](right-left, 1)
+	for lineY := top; lineY < bottom; lineY++ {
+		for lineX := left; lineX < right; lineX++ {
+			line.Set(lineX-left, 0, img.Get(lineX, lineY))
+		}
+		err := draw(x+int16(left), y+int16(lineY), line)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Check whether the pixel at (x, y) should be drawn by SetPixel. Like with
+// DrawBitmap, pixels outside the display are an error unless
+// DisplaySettings.ClipDrawBitmap is enabled, in which case they're skipped.
+func checkPixel(x, y int16, displayWidth, displayHeight int16) (draw bool, err error) {
+	if fitsDisplay(x, y, 1, 1, displayWidth, displayHeight) {
+		return true, nil
+	}
+	if DisplaySettings.ClipDrawBitmap {
+		return false, nil
+	}
+	return false, ErrOutOfBounds
+}
+
+// Draw the image one pixel at a time using setPixel, for display drivers that
+// only have a SetPixel method. It returns ErrOutOfBounds if the image doesn't
+// fit on the display, like DrawBitmap in other drivers.
+func drawBitmapPixels[T pixel.Color](x, y int16, img pixel.Image[T], displayWidth, displayHeight int16, setPixel func(x, y int16, c color.RGBA)) error {
+	width, height := img.Size()
+	if !fitsDisplay(x, y, width, height, displayWidth, displayHeight) {
+		return ErrOutOfBounds
+	}
+	for iy := 0; iy < height; iy++ {
+		for ix := 0; ix < width; ix++ {
+			setPixel(x+int16(ix), y+int16(iy), img.Get(ix, iy).RGBA())
+		}
+	}
+	return nil
+}
+
+// Return the SPI frequency to use for the display: the board default when no
+// frequency was set in DisplaySettings, or the configured frequency clamped to
+// the maximum.
+func displaySPIFrequency(defaultFrequency, maxFrequency uint32) uint32 {
+	frequency := DisplaySettings.SPIFrequency
+	if frequency == 0 {
+		return defaultFrequency
+	}
+	if frequency > maxFrequency {
+		println("board: display SPI frequency", frequency, "is above the maximum, using", maxFrequency, "instead")
+		return maxFrequency
+	}
+	return frequency
+}
+
+// Return the PPI of the display: the override in DisplaySettings if there is
+// one, or the default PPI for the board otherwise.
+func displayPPI(defaultPPI int) int {
+	if DisplaySettings.PPI != 0 {
+		return DisplaySettings.PPI
+	}
+	return defaultPPI
+}
+
+// How long to wait for a shared bus before giving up with ErrBusTimeout. This is
+// far longer than any single transaction: drawing the entire screen of the
+// PineTime takes around 100ms.
+var busTimeout = time.Second
+
+// Lock for a bus that is shared between several chips. Unlike a plain mutex,
+// acquiring it gives up after busTimeout, so that a bus that is held for too
+// long (for example, because a goroutine hung in the middle of a transaction)
+// results in an error instead of a deadlock.
+type busLock struct {
+	lock sync.Mutex
+}
+
+// Get exclusive access to the bus, or return ErrBusTimeout if that takes too
+// long. release must be called afterwards, but only if there was no error.
+func (b *busLock) acquire() error {
+	if b.lock.TryLock() {
+		return nil
+	}
+	deadline := time.Now().Add(busTimeout)
+	for !b.lock.TryLock() {
+		if time.Now().After(deadline) {
+			return ErrBusTimeout
+		}
+		time.Sleep(time.Millisecond)
+	}
+	return nil
+}
+
+// Release the bus after a successful call to acquire.
+func (b *busLock) release() {
+	b.lock.Unlock()
+}
+
+// Settings for the sensors on the board. They are read every time the sensor
+// values are read, so they can be changed at any time.
+var SensorSettings = struct {
+	// Axis mapping for the accelerometer, gyroscope and magnetometer, to
+	// correct for a board that is mounted in a non-standard orientation. It
+	// is applied after the board specific mapping from the sensor chip to the
+	// standard axes (documented in Sensors.Acceleration), so the zero value
+	// keeps the standard axes. For example, AxisMapping{-1, 2, -3} is a board mounted
+	// upside down: lying with the display facing down, Acceleration returns
+	// the values of a board lying with the display facing up. A mapping
+	// with an invalid axis panics when the sensor values are read.
+	AxisMapping AxisMapping
+}{}
+
+// Settings for the buttons.
+var ButtonSettings = struct {
+	// Capture button presses using pin interrupts, so that a button that is
+	// pressed and released again between two calls to Buttons.ReadInput
+	// still results in a press and a release event. Without it, such short
+	// presses are missed when ReadInput isn't called often enough (for
+	// example in a slow game loop). It must be set before calling
+	// Buttons.Configure.
+	//
+	// Supported on the boards that read buttons directly from GPIO pins with
+	// pin interrupts (Badger 2040, Gopher Badge, Thumby). It is ignored on
+	// other boards: the PyBadge reads its buttons through a shift register,
+	// the button of the PineTime can only be read while it is powered during
+	// the read, and the simulator never misses key events.
+	CaptureEdges bool
+}{}
+
+// Settings for haptic feedback using the Vibration device.
+var VibrationSettings = struct {
+	// Use the speaker for Vibration.Pulse on boards without a vibration motor
+	// but with a speaker or buzzer, so that apps that rely on haptic feedback
+	// still give some cue. Instead of vibrating, the speaker makes a short low
+	// buzz. This is disabled by default, as an unexpected sound may be
+	// surprising. It must be set before calling Vibration.Configure, which
+	// then also configures the speaker.
+	SpeakerFallback bool
+
+	// Frequency in Hz of the buzz used by SpeakerFallback. The value 0 means
+	// the default of 100Hz.
+	FallbackFrequency uint32
+}{}
+
+// Settings for the addressable LEDs (AddressableLEDs). They are applied the
+// next time the LEDs are updated.
+var LEDSettings = struct {
+	// Maximum current in mA that all addressable LEDs together may draw, or 0
+	// for no limit (the default). When the colors and brightness that were set
+	// would draw more, all LEDs are dimmed by the same factor to stay within
+	// the limit, so that the colors stay the same. Many LEDs at full
+	// brightness can draw more current than the board can supply, which makes
+	// the supply voltage drop until the board browns out (resets).
+	//
+	// The current is estimated using a simple model: each color of an LED
+	// (red, green, blue, and white on RGBW LEDs) draws 20mA at full
+	// brightness, and proportionally less at lower values after applying
+	// SetBrightness. So a WS2812 that is fully white draws 60mA. The current
+	// drawn by the LEDs while they are black (around 1mA each) isn't included,
+	// as dimming doesn't change it.
+	MaxCurrent int
+
+	// Like MaxCurrent, but only used while running on battery power, where
+	// the supply usually can't deliver as much current. If both are set, the
+	// lowest of the two is used on battery power. The value 0 (the default)
+	// means the power source is ignored.
+	//
+	// The battery status is read using Power.Status once every few seconds,
+	// so Power.Configure must have been called before. Like the colors, a
+	// change in power source only takes effect when the LEDs are updated, so
+	// call ForceUpdate to apply it to LEDs that don't change.
+	BatteryMaxCurrent int
+}{}
+
+// Map the raw accelerometer values to the standard axes, using the board
+// specific mapping followed by the mapping in SensorSettings.
+func mapAcceleration(boardAxes AxisMapping, x, y, z int32) (int32, int32, int32) {
+	x, y, z = boardAxes.Apply(x, y, z)
+	return SensorSettings.AxisMapping.Apply(x, y, z)
+}
+
+// Backlight state of a display, shared between SetBrightness and Sleep. While
+// the display is asleep the backlight is kept off, and the brightness that was
+// last set is restored when it wakes up again.
+type backlight struct {
+	level    int             // brightness level set with SetBrightness
+	sleeping bool            // whether the display is in sleep mode
+	set      func(level int) // change the hardware brightness level
+}
+
+// Set the brightness level, which is applied immediately unless the display is
+// asleep.
+func (b *backlight) setBrightness(level int) {
+	b.level = level
+	if !b.sleeping {
+		b.set(level)
+	}
+}
+
+// Turn on the backlight at DisplaySettings.InitialBrightness, if it is set. This
+// is called at the end of Display.Configure.
+func (b *backlight) setInitialBrightness(maxBrightness int) {
+	level := DisplaySettings.InitialBrightness
+	if level <= 0 {
+		return
+	}
+	if level > maxBrightness {
+		level = maxBrightness
+	}
+	b.setBrightness(level)
+}
+
+// Put the display in sleep mode (or wake it up), using the given function to
+// change the sleep mode of the display controller.
+//
+// When going to sleep, the backlight is turned off before the controller goes
+// to sleep. When waking up, the controller is woken up before the backlight is
+// turned on. This avoids briefly showing garbage on the screen.
+func (b *backlight) sleep(sleepEnabled bool, setSleep func(bool) error) error {
+	if sleepEnabled {
+		b.sleeping = true
+		b.set(0)
+		return setSleep(true)
+	}
+	err := setSleep(false)
+	b.sleeping = false
+	b.set(b.level)
+	return err
 }
 
 // ChargeState is the charging status of a battery.
@@ -91,7 +941,95 @@ func (c ChargeState) String() string {
 	}
 }
 
+// Return whether the board runs on battery power with the given charge state.
+// An unknown state is treated as running on battery, to be on the safe side.
+func onBatteryPower(state ChargeState) bool {
+	switch state {
+	case Charging, NotCharging, NoBattery, BatteryUnavailable:
+		return false
+	default:
+		return true
+	}
+}
+
+// PowerEvent is an event about the power supply, as returned by
+// Power.NextEvent.
+type PowerEvent uint8
+
+const (
+	NoPowerEvent PowerEvent = iota // No power event was available.
+
+	// The battery temperature rose to or above PowerSettings.OverTemperature.
+	// Chargers typically stop or slow down charging at this point, so this is
+	// a good moment to reduce power consumption or warn the user.
+	BatteryOverTemperature
+
+	// The battery temperature dropped below PowerSettings.OverTemperature
+	// again.
+	BatteryTemperatureNormal
+)
+
+// Settings for the power supply.
+var PowerSettings = struct {
+	// Battery temperature in milli-degrees Celsius (as returned by
+	// Power.BatteryTemperature) at or above which Power.NextEvent reports
+	// BatteryOverTemperature. The default is 45°C, a common limit for charging
+	// lithium batteries. This setting can be changed at any time.
+	OverTemperature int32
+}{
+	OverTemperature: 45_000,
+}
+
+// Calibration applied to the battery voltage, see SetBatteryCalibration.
+var batteryCalibration = struct {
+	scale            float32
+	offsetMicrovolts int32
+}{
+	scale: 1,
+}
+
+// SetBatteryCalibration corrects the battery voltage returned by Power.Status
+// (and the percentage derived from it) for tolerances in the voltage divider
+// that is used to measure it, which can easily cause an error of a few percent.
+// The calibrated voltage is:
+//
+//	microvolts*scale + offsetMicrovolts
+//
+// To calibrate, compare the voltage reported by Power.Status against a
+// multimeter reading, preferably at two different battery voltages to
+// calculate both values. The default is a scale of 1 and an offset of 0,
+// meaning no correction. A voltage of 0 (no battery) is never corrected.
+func SetBatteryCalibration(scale float32, offsetMicrovolts int32) {
+	batteryCalibration.scale = scale
+	batteryCalibration.offsetMicrovolts = offsetMicrovolts
+}
+
+// Apply the battery calibration to a measured battery voltage.
+func calibrateBatteryVoltage(microvolts uint32) uint32 {
+	if microvolts == 0 {
+		return 0
+	}
+	calibrated := int64(float32(microvolts)*batteryCalibration.scale+0.5) + int64(batteryCalibration.offsetMicrovolts)
+	if calibrated < 0 {
+		return 0
+	}
+	return uint32(calibrated)
+}
+
 // A LED array is a sequence of individually addressable LEDs (like WS2812).
+//
+// Colors go through the following steps before they become visible:
+//
+//  1. SetRGB stores the color as linear light intensity: 128 is half as bright
+//     as 255 (unlike sRGB colors used on displays).
+//  2. The global brightness set with SetBrightness scales these values, which
+//     is a simple multiplication because the values are linear.
+//  3. Update sends the scaled values to the LEDs. Physical LEDs emit light
+//     linearly proportional to these values, while the simulator applies gamma
+//     encoding to them as the very last step to show them on a (sRGB) screen.
+//
+// This way, colors and brightness levels look the same on hardware and in the
+// simulator.
 type LEDArray interface {
 	// Configure the LED array. This needs to be called before any other method
 	// (except Len).
@@ -107,8 +1045,50 @@ type LEDArray interface {
 	// data is sent to them.
 	SetRGB(index int, r, g, b uint8)
 
-	// Update the pixel array to the values previously set in SetRGB.
+	// Set the global brightness of all LEDs, where 255 (the default) is full
+	// brightness and 0 is off. Like SetRGB, this becomes visible after the next
+	// call to Update.
+	SetBrightness(brightness uint8)
+
+	// Update the pixel array to the values previously set in SetRGB. Nothing
+	// is sent to the LEDs if no value changed since the last update, so it is
+	// cheap to call Update every frame of an animation loop.
 	Update()
+
+	// Send the values previously set in SetRGB to the LEDs, even if nothing
+	// changed. This can be used to restore the LEDs after they were reset
+	// externally, for example after a power glitch.
+	ForceUpdate()
+
+	// Turn the LEDs off to save power, or turn them on again with the colors
+	// that were last set. Addressable LEDs draw around 1mA each even when they
+	// are black, so boards that can switch the power to the LEDs (the MCH2022
+	// and SHA2017 badges) cut it while sleeping. On other boards the LEDs are
+	// only made black. While sleeping, SetRGB and SetBrightness can still be
+	// used but Update doesn't change the LEDs.
+	//
+	// The LED power is the only peripheral power rail that this package
+	// switches on its own. Display backlights are switched by Display.Sleep,
+	// and no supported board can switch the power to its sensors.
+	Sleep(sleepEnabled bool) error
+}
+
+// RGBWLEDArray is an LEDArray of RGBW LEDs, which have a separate white LED
+// next to the red, green, and blue ones. Use a type assertion to check for it:
+//
+//	if leds, ok := board.AddressableLEDs.(board.RGBWLEDArray); ok {
+//		leds.SetRGBW(0, 0, 0, 0, 255) // white, using only the white LED
+//	}
+//
+// SetRGB on these LEDs turns the white LED off.
+//
+// Supported on the SHA2017 badge.
+type RGBWLEDArray interface {
+	LEDArray
+
+	// Set a given pixel to the RGBW value. Like SetRGB, the index must be in
+	// bounds and the value becomes visible after the next call to Update.
+	SetRGBW(index int, r, g, b, w uint8)
 }
 
 // The display interface shared by all supported displays.
@@ -122,10 +1102,16 @@ type Displayer[T pixel.Color] interface {
 	DrawBitmap(x, y int16, buf pixel.Image[T]) error
 
 	// Display the written image on screen. This call may or may not be
-	// necessary depending on the screen, but it's better to call it anyway.
+	// necessary depending on the screen (see BoardInfo.NeedsFlush), but it's
+	// better to call it anyway.
 	Display() error
 
-	// Enter or exit sleep mode.
+	// Enter or exit sleep mode. On boards with a backlight (where most of the
+	// power of a TFT display goes), the backlight is switched off while the
+	// display sleeps. None of the supported boards can cut the power to the
+	// display controller itself, so its sleep mode is the lowest it goes. On
+	// the Badger 2040 for example, the display shares the main 3.3V rail
+	// with the microcontroller.
 	Sleep(sleepEnabled bool) error
 
 	// Return the current screen rotation.
@@ -142,6 +1128,40 @@ type Displayer[T pixel.Color] interface {
 	SetRotation(drivers.Rotation) error
 }
 
+// SecondaryDisplayer is a second display on a board, next to the main display
+// (Display). This is usually a small monochrome status display, like an OLED
+// next to a color TFT. Check whether there is one by configuring it:
+//
+//	if status := board.SecondaryDisplay.Configure(); status != nil {
+//		// draw to status, like to any other display
+//	}
+//
+// For now, only the simulator implements a secondary display: none of the
+// supported boards have one, so Configure returns nil on all of them. The
+// simulator shows one when Simulator.SecondaryDisplayWidth and
+// Simulator.SecondaryDisplayHeight are set, so apps can already be written to
+// use one where it exists.
+//
+// In the simulator, both displays share a simulated bus. Drawing to one
+// display waits until the other one is done using the bus, the same way as the
+// display and the flash chip that share SPI0 on the PineTime. So both displays
+// can be used from different goroutines, but a call that has to wait too long
+// for the bus returns ErrBusTimeout. A board that gets a secondary display
+// later should arbitrate a shared bus in the same way. Frame timing
+// (WaitForVBlank, LastFrameDuration, and SetFrameHook) only applies to the
+// main display.
+type SecondaryDisplayer interface {
+	// Configure the secondary display and return it, or return nil if there
+	// is no secondary display.
+	Configure() Displayer[pixel.Monochrome]
+}
+
+type noSecondaryDisplay struct{}
+
+func (d noSecondaryDisplay) Configure() Displayer[pixel.Monochrome] {
+	return nil
+}
+
 // TouchInput reads the touch screen (resistive/capacitive) on a display and
 // returns the current list of touch points.
 type TouchInput interface {
@@ -161,9 +1181,11 @@ type TouchPoint struct {
 }
 
 // Key is a single keyboard key (not to be confused with a single character).
+// Being a uint8, it always fits in the lower 8 bits of a KeyEvent.
 type Key uint8
 
-// List of all supported key codes.
+// List of all supported key codes. New keys are only ever added at the end, so
+// that the numeric values (as used in input scripts) stay the same.
 const (
 	NoKey = iota
 
@@ -187,6 +1209,37 @@ const (
 	// Special keys, used on some boards.
 	KeySelect
 	KeyStart
+
+	// Function keys, used for the keys of macro keypads.
+	KeyF1
+	KeyF2
+	KeyF3
+	KeyF4
+	KeyF5
+	KeyF6
+	KeyF7
+	KeyF8
+	KeyF9
+	KeyF10
+	KeyF11
+	KeyF12
+
+	// Number keys, for boards with a number pad or a full keyboard.
+	Key0
+	Key1
+	Key2
+	Key3
+	Key4
+	Key5
+	Key6
+	Key7
+	Key8
+	Key9
+
+	// Editing keys, for boards with a full keyboard.
+	KeyTab
+	KeyBackspace
+	KeyDelete
 )
 
 // KeyEvent is a single key press or release event.
@@ -209,6 +1262,81 @@ func (k KeyEvent) Pressed() bool {
 	return k&keyReleased == 0
 }
 
+// remapKey changes the key code for the physical button at the given index, as
+// used by the Remap method of the various Buttons implementations. Indices that
+// are out of range are ignored.
+func remapKey(codes []Key, index int, key Key) {
+	if uint(index) < uint(len(codes)) {
+		codes[index] = key
+	}
+}
+
+// buttonState tracks up to 8 buttons that are read all at once as a bitmask,
+// for example from a shift register.
+type buttonState struct {
+	previous, current uint8
+
+	// Buttons that were pressed and released again before the press was
+	// reported, see ButtonSettings.CaptureEdges.
+	pulses uint8
+}
+
+// read updates the current button state. The pressed bitmask contains the
+// buttons that were pressed at some point since the last read (as captured by
+// an edge interrupt), or is zero if this isn't supported.
+func (b *buttonState) read(state, pressed uint8) {
+	b.current = state
+
+	// A button that was pressed and released again between two reads isn't
+	// visible in the state, so remember it to report it separately. A button
+	// that is currently pressed doesn't need this, its press is reported
+	// anyway.
+	b.pulses = (b.pulses | pressed) &^ state &^ b.previous
+}
+
+// nextEvent returns the next key event, or NoKeyEvent when all changes have
+// been reported. When multiple buttons changed in the same read, repeated calls
+// will return an event for each of them, lowest index first.
+func (b *buttonState) nextEvent(codes *[8]Key) KeyEvent {
+	// The xor between the previous state and the current state is the buttons
+	// that changed.
+	change := b.current ^ b.previous
+	if change == 0 {
+		if b.pulses == 0 {
+			return NoKeyEvent
+		}
+
+		// Report the press of a button that was already released again. By
+		// marking it as pressed, the release is reported in the next call.
+		index := bits.TrailingZeros8(b.pulses)
+		b.pulses &^= 1 << index
+		b.previous |= 1 << index
+		return KeyEvent(codes[index])
+	}
+
+	// Find the index of the button with the lowest index that changed state.
+	index := bits.TrailingZeros8(change)
+	e := KeyEvent(codes[index])
+	if b.current&(1<<index) == 0 {
+		// The button state change was from 1 to 0, so it was released.
+		e |= keyReleased
+	}
+
+	// This button event was read, so mark it as such.
+	// By toggling the bit, the bit will be set to the value that is currently
+	// in b.current.
+	b.previous ^= (1 << index)
+
+	return e
+}
+
+// peekEvent returns the event that the next call to nextEvent will return,
+// without consuming it.
+func (b *buttonState) peekEvent(codes *[8]Key) KeyEvent {
+	state := *b
+	return state.nextEvent(codes)
+}
+
 // Default lithium battery charge curve.
 // This data is taken from the InfiniTime project:
 // https://github.com/InfiniTimeOrg/InfiniTime/pull/1444
@@ -266,6 +1394,27 @@ func (approx *batteryApproximation) approximatePPM(microvolts uint32) int32 {
 	return 1000_000
 }
 
+// Guard to make sure a bus or peripheral is only initialized once, even when
+// it is configured from multiple places (for example, a bus shared between
+// the touch controller and the accelerometer). Peripherals are configured from
+// a single goroutine, so unlike sync.Once this guard isn't goroutine safe.
+type configureOnce struct {
+	done bool
+}
+
+// Run f, unless it has already run successfully before. If f returns an error,
+// it will be run again on the next call.
+func (o *configureOnce) do(f func() error) error {
+	if o.done {
+		return nil
+	}
+	err := f()
+	if err == nil {
+		o.done = true
+	}
+	return err
+}
+
 type dummyAddressableLEDs struct {
 }
 
@@ -281,16 +1430,30 @@ func (l dummyAddressableLEDs) SetRGB(i int, r, g, b uint8) {
 	panic("no LEDs on this board")
 }
 
+func (l dummyAddressableLEDs) SetBrightness(brightness uint8) {
+	// Nothing to do here.
+}
+
 func (l dummyAddressableLEDs) Update() {
 	// Nothing to do here.
 }
 
+func (l dummyAddressableLEDs) ForceUpdate() {
+	// Nothing to do here.
+}
+
+func (l dummyAddressableLEDs) Sleep(sleepEnabled bool) error {
+	return nil
+}
+
 type colorFormat interface {
-	colorGRB
+	colorGRB | colorGRBW
 }
 
 type colorGRB struct{ G, R, B uint8 }
 
+type colorGRBW struct{ G, R, B, W uint8 }
+
 // Convert pixel data to a byte slice, for sending it to WS2812 LEDs for
 // example.
 func pixelsToBytes[T colorFormat](pix []T) []byte {
@@ -302,10 +1465,77 @@ func pixelsToBytes[T colorFormat](pix []T) []byte {
 	return unsafe.Slice((*byte)(ptr), len(pix)*int(unsafe.Sizeof(zeroColor)))
 }
 
+// Scale the linear LED color values in src by the given brightness and store
+// the result in dst. A brightness of 255 leaves the values unchanged, unless
+// that would exceed the current limit in LEDSettings.
+func scaleLEDBrightness(dst, src []byte, brightness uint8) {
+	brightness = limitLEDBrightness(src, brightness, ledCurrentLimit())
+	for i, value := range src {
+		dst[i] = uint8((uint32(value)*uint32(brightness) + 127) / 255)
+	}
+}
+
+// Current in mA drawn by a single color of an addressable LED at full
+// brightness, see LEDSettings.
+const ledChannelCurrent = 20
+
+// How often the battery status is read for LEDSettings.BatteryMaxCurrent.
+const ledBatteryInterval = 5 * time.Second
+
+// Power source last read by ledCurrentLimit.
+var ledBattery struct {
+	lastRead  time.Time
+	onBattery bool
+}
+
+// Return the current limit in mA for the addressable LEDs according to
+// LEDSettings, or 0 if there is no limit.
+func ledCurrentLimit() int {
+	limit := LEDSettings.MaxCurrent
+	if LEDSettings.BatteryMaxCurrent > 0 {
+		now := time.Now()
+		if ledBattery.lastRead.IsZero() || now.Sub(ledBattery.lastRead) >= ledBatteryInterval {
+			ledBattery.lastRead = now
+			state, _, _ := Power.Status()
+			ledBattery.onBattery = onBatteryPower(state)
+		}
+		if ledBattery.onBattery && (limit == 0 || LEDSettings.BatteryMaxCurrent < limit) {
+			limit = LEDSettings.BatteryMaxCurrent
+		}
+	}
+	return limit
+}
+
+// Return the brightness to use for LEDs with the linear color values in src so
+// that they draw at most limit mA, which is lower than the given brightness if
+// needed. A limit of 0 means no limit.
+func limitLEDBrightness(src []byte, brightness uint8, limit int) uint8 {
+	if limit <= 0 {
+		return brightness
+	}
+	var sum uint64
+	for _, value := range src {
+		sum += uint64(value)
+	}
+	if sum == 0 {
+		return brightness
+	}
+	// The LEDs draw sum*brightness/255 * ledChannelCurrent/255 mA.
+	maxBrightness := uint64(limit) * 255 * 255 / (sum * ledChannelCurrent)
+	if maxBrightness < uint64(brightness) {
+		return uint8(maxBrightness)
+	}
+	return brightness
+}
+
 // Dummy sensor value, to be embedded in actual drivers.Sensor implementations.
 type baseSensors struct {
 }
 
+func (s baseSensors) Available() drivers.Measurement {
+	return 0
+}
+
 func (s baseSensors) Configure(which drivers.Measurement) error {
 	return nil
 }
@@ -325,3 +1555,290 @@ func (s baseSensors) Steps() uint32 {
 func (s baseSensors) Temperature() int32 {
 	return 0
 }
+
+func (s baseSensors) Light() uint32 {
+	return 0
+}
+
+func (s baseSensors) Proximity() uint32 {
+	return 0
+}
+
+func (s baseSensors) AngularVelocity() (x, y, z int32) {
+	return 0, 0, 0
+}
+
+func (s baseSensors) MagneticField() (x, y, z int32) {
+	return 0, 0, 0
+}
+
+func (s baseSensors) Pressure() int32 {
+	return 0
+}
+
+func (s baseSensors) Humidity() int32 {
+	return 0
+}
+
+func (s baseSensors) ReadAccelBuffer(buf [][3]int32) (int, error) {
+	return 0, nil
+}
+
+// ConfigureOptions lists the peripherals that Configure should leave alone.
+// The zero value configures all peripherals.
+type ConfigureOptions struct {
+	NoPower   bool // don't configure Power
+	NoDisplay bool // don't configure Display (Configure will return nil)
+	NoButtons bool // don't configure Buttons
+	NoSensors bool // don't configure Sensors
+	NoLEDs    bool // don't configure AddressableLEDs
+}
+
+// Configure all peripherals on the board, except for those disabled in the
+// options, and return the configured display. Peripherals that aren't needed
+// can be left unconfigured to save power.
+//
+// Peripherals are configured in the following order:
+//
+//  1. Power, so that the battery can be read early.
+//  2. Display. On some boards, this also initializes a bus that is shared with
+//     other chips. For example on the PineTime, SPI0 is shared between the
+//     display and the external flash chip, and configuring the display puts
+//     the flash chip in deep power-down mode.
+//  3. Buttons.
+//  4. Sensors, with all measurements the board supports.
+//  5. AddressableLEDs.
+//
+// The touch screen and the watchdog are never configured here: touch input is
+// returned by Display.ConfigureTouch and the watchdog must be fed regularly
+// once configured, so both need to be configured explicitly.
+//
+// An error from Sensors.Configure (like ErrSensorNotFound) is returned, but
+// doesn't stop the other peripherals from being configured.
+//
+// The individual Configure methods can still be used instead of this function.
+func Configure(options ConfigureOptions) (display Displayer[displayColor], err error) {
+	if !options.NoPower {
+		Power.Configure()
+	}
+	if !options.NoDisplay {
+		display = Display.Configure()
+	}
+	if !options.NoButtons {
+		Buttons.Configure()
+	}
+	if !options.NoSensors {
+		// A missing or broken sensor shouldn't stop the rest of the board
+		// from working, so the error is only returned at the end.
+		err = Sensors.Configure(drivers.AllMeasurements)
+	}
+	if !options.NoLEDs {
+		AddressableLEDs.Configure()
+	}
+	return
+}
+
+// Time between two polls of the buttons in WaitForKey.
+const keyPollInterval = 10 * time.Millisecond
+
+// WaitForKey blocks until a key is pressed or released, and returns the key
+// event. It reads the buttons itself, so Buttons.Configure must have been
+// called before.
+//
+// This is intended for simple apps and menus. It blocks the calling goroutine,
+// so don't use it in a render loop. While waiting, the board sleeps between
+// polls to save power. Touch input is not checked.
+func WaitForKey() KeyEvent {
+	return WaitForKeyTimeout(0)
+}
+
+// WaitForKeyTimeout is like WaitForKey, but gives up after the given timeout
+// and returns NoKeyEvent. A timeout of 0 means no timeout.
+func WaitForKeyTimeout(timeout time.Duration) KeyEvent {
+	var deadline time.Time
+	if timeout > 0 {
+		deadline = time.Now().Add(timeout)
+	}
+	for {
+		Buttons.ReadInput()
+		if event := Buttons.NextEvent(); event != NoKeyEvent {
+			return event
+		}
+		wait := keyPollInterval
+		if timeout > 0 {
+			remaining := time.Until(deadline)
+			if remaining <= 0 {
+				return NoKeyEvent
+			}
+			if remaining < wait {
+				wait = remaining
+			}
+		}
+		waitForInput(wait)
+	}
+}
+
+// WaitForKeyPress blocks until one of the given keys is pressed, and returns
+// that key. Other key events, including the release of the given keys, are
+// dropped. Without any keys, it waits for any key to be pressed. This is
+// useful for prompts like "press A to continue":
+//
+//	board.WaitForKeyPress(board.KeyA, board.KeyEnter)
+//
+// Like WaitForKey, it blocks the calling goroutine while the board sleeps
+// between polls, so don't call it from a render loop that is expected to keep
+// drawing.
+func WaitForKeyPress(keys ...Key) Key {
+	return WaitForKeyPressTimeout(0, keys...)
+}
+
+// WaitForKeyPressTimeout is like WaitForKeyPress, but gives up after the given
+// timeout and returns NoKey. A timeout of 0 means no timeout.
+func WaitForKeyPressTimeout(timeout time.Duration, keys ...Key) Key {
+	var deadline time.Time
+	if timeout > 0 {
+		deadline = time.Now().Add(timeout)
+	}
+	for {
+		remaining := time.Duration(0)
+		if timeout > 0 {
+			remaining = time.Until(deadline)
+			if remaining <= 0 {
+				return NoKey
+			}
+		}
+		event := WaitForKeyTimeout(remaining)
+		if event == NoKeyEvent {
+			return NoKey
+		}
+		if !event.Pressed() {
+			continue
+		}
+		if len(keys) == 0 {
+			return event.Key()
+		}
+		for _, key := range keys {
+			if event.Key() == key {
+				return key
+			}
+		}
+	}
+}
+
+// Idle puts the board in a low-power state until something happens that may
+// need the attention of the app, or until maxDuration has passed. It is meant
+// for main loops that have nothing to do, for example:
+//
+//	for {
+//		board.Buttons.ReadInput()
+//		// handle input, update the screen
+//		board.Idle(time.Second)
+//	}
+//
+// The only wake source that is always armed is the timer for maxDuration.
+// Other wake sources depend on the board:
+//
+//   - Simulator: key presses and the start of a touch.
+//   - Badger 2040, Gopher Badge, Pico Display, Thumby: button presses, but
+//     only when ButtonSettings.CaptureEdges is set (the presses are recorded
+//     in pin interrupts).
+//   - PineTime: the start of a touch, once the touch screen is configured (the
+//     touch controller sets a bit in the LATCH register). The button doesn't
+//     wake it up.
+//   - Other boards: nothing, their input is read by polling.
+//
+// On baremetal boards, these wake sources are checked every 10ms, so Idle may
+// return up to 10ms after the input arrived. Peripherals like the buttons need
+// to be configured before calling Idle, and it is up to the caller to read
+// their state afterwards: input that hasn't been read makes Idle return
+// immediately.
+//
+// While idling, TinyGo puts the CPU in a sleep mode (such as WFI on ARM) until
+// the next interrupt, so this saves power compared to busy waiting.
+func Idle(maxDuration time.Duration) {
+	if maxDuration <= 0 {
+		return
+	}
+	waitForInput(maxDuration)
+}
+
+// Time at which the program started, used by Uptime.
+var startTime = time.Now()
+
+// Clock used by Uptime on boards that have a separate RTC for it, or nil to
+// use the monotonic clock of the Go runtime.
+var boardUptime func() time.Duration
+
+// Uptime returns the time since the program started, which on real boards is
+// the time since the last reset (after power on, Power.Reboot, or a watchdog
+// reset). It is useful for things like "last synced 5 minutes ago" in a watch
+// app, or to timestamp log messages.
+//
+// On the PineTime, Uptime reads RTC2, which is started before main runs and
+// counts at 32768Hz from the low frequency clock. On other boards it is
+// time.Since the start of the program, using the monotonic clock of the Go
+// runtime. Either way it keeps counting while the board is idle (in Idle,
+// time.Sleep, WaitForKey and so on), since the CPU is only put in a sleep mode
+// and the clock keeps running. It is not affected by changes to the wall
+// clock, for example when setting the time using runtime.AdjustTimeOffset:
+// use time.Now for the wall clock.
+//
+// Uptime doesn't survive anything that ends the program, not even on the
+// PineTime: Power.Shutdown turns the board off (including the RTC), and uptime
+// starts from zero again when the board is turned back on.
+//
+// In the simulator, it is the time since the app was started, in real time
+// (it is not affected by Simulator.TimeScale or Simulator.Pause).
+func Uptime() time.Duration {
+	if boardUptime != nil {
+		return boardUptime()
+	}
+	return time.Since(startTime)
+}
+
+// BoardInfo describes the hardware available on a board, so that generic apps
+// can adapt to the board at runtime instead of relying on build tags.
+type BoardInfo struct {
+	// Board name, the same as the Name constant.
+	Name string
+
+	// Display size in pixels, in the default rotation.
+	DisplayWidth, DisplayHeight int16
+
+	// Bits per pixel of the display color format.
+	ColorDepth int
+
+	// Sensor measurements supported by Sensors.
+	Sensors drivers.Measurement
+
+	// All keys that can be returned by Buttons.NextEvent, one per physical
+	// button. The index of a button in this list is the index to pass to
+	// Buttons.Remap to change the key it produces. Every call to Info returns
+	// a new copy, so the caller may modify it.
+	Keys []Key
+
+	// Whether the board has addressable LEDs, a touch screen, a battery whose
+	// status can be read using Power.Status, and a rotary encoder that can be
+	// read using Encoder.Read.
+	HasLEDs    bool
+	HasTouch   bool
+	HasBattery bool
+	HasEncoder bool
+
+	// Whether Display must be called on the display after drawing before
+	// anything becomes visible. This is the case for displays that are drawn
+	// to a framebuffer in RAM first: the e-paper displays of the Badger 2040
+	// and SHA2017 badge, and the OLED displays of the MacroPad RP2040 and
+	// Thumby. On other displays, DrawBitmap updates the screen directly and
+	// calling Display isn't needed (but it doesn't hurt either).
+	NeedsFlush bool
+}
+
+// Info returns information about the hardware on the current board.
+func Info() BoardInfo {
+	info := boardInfo()
+	info.Name = Name
+	var pixelColor displayColor
+	info.ColorDepth = pixelColor.BitsPerPixel()
+	return info
+}
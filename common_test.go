@@ -1,6 +1,16 @@
 package board
 
-import "testing"
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"image/color"
+	"strings"
+	"testing"
+	"time"
+
+	"tinygo.org/x/drivers/pixel"
+)
 
 func TestBatteryApprox(t *testing.T) {
 	for _, tc := range []struct {
@@ -27,3 +37,489 @@ func TestBatteryApprox(t *testing.T) {
 		}
 	}
 }
+
+func TestBatteryCalibration(t *testing.T) {
+	defer SetBatteryCalibration(1, 0)
+	for _, tc := range []struct {
+		scale      float32
+		offset     int32
+		microvolts uint32
+		expected   uint32
+	}{
+		{1, 0, 3700_000, 3700_000},         // default: no correction
+		{1.02, 0, 3700_000, 3774_000},      // divider reads 2% low
+		{0.98, 0, 4200_000, 4116_000},      // divider reads 2% high
+		{1, -50_000, 3700_000, 3650_000},   // constant offset
+		{1.01, 10_000, 4000_000, 4050_000}, // both
+		{1, -50_000, 30_000, 0},            // no negative voltages
+		{1.02, 10_000, 0, 0},               // no battery
+	} {
+		SetBatteryCalibration(tc.scale, tc.offset)
+		if got := calibrateBatteryVoltage(tc.microvolts); got != tc.expected {
+			t.Errorf("scale %v, offset %d: expected %dµV for %dµV, got %dµV", tc.scale, tc.offset, tc.expected, tc.microvolts, got)
+		}
+	}
+}
+
+func TestConfigureOnce(t *testing.T) {
+	var once configureOnce
+	calls := 0
+	errFailed := errors.New("failed")
+
+	// A failed configure must be retried.
+	err := once.do(func() error {
+		calls++
+		return errFailed
+	})
+	if err != errFailed {
+		t.Errorf("expected error %v, got %v", errFailed, err)
+	}
+
+	// After a successful configure, f must not be called anymore.
+	for i := 0; i < 3; i++ {
+		err := once.do(func() error {
+			calls++
+			return nil
+		})
+		if err != nil {
+			t.Errorf("unexpected error: %v", err)
+		}
+	}
+	if calls != 2 {
+		t.Errorf("expected 2 calls, got %d", calls)
+	}
+}
+
+func TestDrawClipped(t *testing.T) {
+	// Image of 4x3 pixels, where each pixel has a unique color.
+	img := pixel.NewImage[pixel.RGB888](4, 3)
+	for y := 0; y < 3; y++ {
+		for x := 0; x < 4; x++ {
+			img.Set(x, y, pixel.RGB888{R: uint8(x), G: uint8(y)})
+		}
+	}
+
+	c := func(x, y uint8) pixel.RGB888 {
+		return pixel.RGB888{R: x, G: y}
+	}
+
+	type drawCall struct {
+		x, y          int16
+		width, height int
+		first, last   pixel.RGB888 // first and last pixel
+	}
+	for _, tc := range []struct {
+		name  string
+		x, y  int16
+		calls []drawCall
+	}{
+		{"inside", 0, 0, []drawCall{{0, 0, 4, 3, c(0, 0), c(3, 2)}}},
+		{"bottom", 2, 8, []drawCall{{2, 8, 4, 2, c(0, 0), c(3, 1)}}},
+		{"right", 8, 0, []drawCall{
+			{8, 0, 2, 1, c(0, 0), c(1, 0)},
+			{8, 1, 2, 1, c(0, 1), c(1, 1)},
+			{8, 2, 2, 1, c(0, 2), c(1, 2)},
+		}},
+		{"corner", 9, 9, []drawCall{{9, 9, 1, 1, c(0, 0), c(0, 0)}}},
+		{"left", -2, 5, []drawCall{
+			{0, 5, 2, 1, c(2, 0), c(3, 0)},
+			{0, 6, 2, 1, c(2, 1), c(3, 1)},
+			{0, 7, 2, 1, c(2, 2), c(3, 2)},
+		}},
+		{"top", 1, -2, []drawCall{{1, 0, 4, 1, c(0, 2), c(3, 2)}}},
+		{"top left", -3, -2, []drawCall{{0, 0, 1, 1, c(3, 2), c(3, 2)}}},
+		{"outside", 10, 0, nil},
+		{"outside left", -4, 0, nil},
+		{"outside top", 0, -3, nil},
+	} {
+		var calls []drawCall
+		err := drawClipped(tc.x, tc.y, img, 10, 10, func(x, y int16, img pixel.Image[pixel.RGB888]) error {
+			width, height := img.Size()
+			calls = append(calls, drawCall{x, y, width, height, img.Get(0, 0), img.Get(width-1, height-1)})
+			return nil
+		})
+		if err != nil {
+			t.Errorf("%s: unexpected error: %v", tc.name, err)
+		}
+		if len(calls) != len(tc.calls) {
+			t.Errorf("%s: expected %d draw calls, got %d: %+v", tc.name, len(tc.calls), len(calls), calls)
+			continue
+		}
+		for i := range calls {
+			if calls[i] != tc.calls[i] {
+				t.Errorf("%s: expected draw call %+v, got %+v", tc.name, tc.calls[i], calls[i])
+			}
+		}
+	}
+}
+
+func TestDrawClippedAllSides(t *testing.T) {
+	// Image that is larger than the display in both directions.
+	img := pixel.NewImage[pixel.RGB888](4, 3)
+	img.Set(1, 1, pixel.RGB888{R: 1})
+	img.Set(2, 1, pixel.RGB888{R: 2})
+	calls := 0
+	drawClipped(-1, -1, img, 2, 1, func(x, y int16, img pixel.Image[pixel.RGB888]) error {
+		calls++
+		width, height := img.Size()
+		if x != 0 || y != 0 || width != 2 || height != 1 || img.Get(0, 0).R != 1 || img.Get(1, 0).R != 2 {
+			t.Errorf("unexpected draw call at (%d, %d) of %dx%d pixels", x, y, width, height)
+		}
+		return nil
+	})
+	if calls != 1 {
+		t.Errorf("expected 1 draw call, got %d", calls)
+	}
+}
+
+func TestDrawBitmapClipped(t *testing.T) {
+	img := pixel.NewImage[pixel.RGB888](4, 3)
+	errOutOfBounds := errors.New("out of bounds")
+	draw := func(x, y int16, img pixel.Image[pixel.RGB888]) error {
+		width, height := img.Size()
+		if x < 0 || y < 0 || int(x)+width > 10 || int(y)+height > 10 {
+			return errOutOfBounds
+		}
+		return nil
+	}
+
+	// Without clipping, the driver returns an error.
+	if err := drawBitmapClipped(-1, 8, img, 10, 10, draw); err != errOutOfBounds {
+		t.Errorf("expected driver error, got %v", err)
+	}
+
+	// With clipping, sprites straddling each edge can be drawn.
+	DisplaySettings.ClipDrawBitmap = true
+	defer func() {
+		DisplaySettings.ClipDrawBitmap = false
+	}()
+	for _, pos := range [][2]int16{{-1, 3}, {8, 3}, {3, -1}, {3, 8}, {-2, -2}, {8, 8}} {
+		if err := drawBitmapClipped(pos[0], pos[1], img, 10, 10, draw); err != nil {
+			t.Errorf("unexpected error drawing at %v: %v", pos, err)
+		}
+	}
+}
+
+func TestDrawBitmapPixels(t *testing.T) {
+	img := pixel.NewImage[pixel.RGB565BE](2, 2)
+	img.Set(1, 0, pixel.NewRGB565BE(255, 255, 255))
+	var pixels []string
+	setPixel := func(x, y int16, c color.RGBA) {
+		pixels = append(pixels, fmt.Sprintf("%d,%d:%d", x, y, c.R))
+	}
+	if err := drawBitmapPixels(3, 4, img, 10, 10, setPixel); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got, expected := strings.Join(pixels, " "), "3,4:0 4,4:255 3,5:0 4,5:0"; got != expected {
+		t.Errorf("unexpected pixels:\nexpected: %s\ngot:      %s", expected, got)
+	}
+
+	// Images that don't fit are rejected, without drawing anything.
+	pixels = nil
+	if err := drawBitmapPixels(9, 4, img, 10, 10, setPixel); err != ErrOutOfBounds {
+		t.Errorf("expected ErrOutOfBounds, got %v", err)
+	}
+	if len(pixels) != 0 {
+		t.Errorf("expected no pixels to be drawn, got %v", pixels)
+	}
+}
+
+func TestButtonStateSimultaneous(t *testing.T) {
+	codes := [8]Key{KeyLeft, KeyUp, KeyDown, KeyRight, KeySelect, KeyStart, KeyA, KeyB}
+	var b buttonState
+
+	// Press two buttons in the same read: both must be reported.
+	b.current = 1<<1 | 1<<6 // up, A
+	if e := b.nextEvent(&codes); e.Key() != KeyUp || !e.Pressed() {
+		t.Errorf("expected up pressed, got %#x", e)
+	}
+	if e := b.nextEvent(&codes); e.Key() != KeyA || !e.Pressed() {
+		t.Errorf("expected A pressed, got %#x", e)
+	}
+	if e := b.nextEvent(&codes); e != NoKeyEvent {
+		t.Errorf("expected no more events, got %#x", e)
+	}
+
+	// Release one button and press another in the same read.
+	b.current = 1<<6 | 1<<7 // A, B
+	if e := b.nextEvent(&codes); e.Key() != KeyUp || e.Pressed() {
+		t.Errorf("expected up released, got %#x", e)
+	}
+	if e := b.nextEvent(&codes); e.Key() != KeyB || !e.Pressed() {
+		t.Errorf("expected B pressed, got %#x", e)
+	}
+	if e := b.nextEvent(&codes); e != NoKeyEvent {
+		t.Errorf("expected no more events, got %#x", e)
+	}
+
+	// A new read halfway through draining the events: only the net change
+	// since the last reported state must be reported.
+	b.current = 0xff
+	if e := b.nextEvent(&codes); e.Key() != KeyLeft || !e.Pressed() {
+		t.Errorf("expected left pressed, got %#x", e)
+	}
+	b.current = 1<<6 | 1<<7 // back to A, B
+	if e := b.nextEvent(&codes); e.Key() != KeyLeft || e.Pressed() {
+		t.Errorf("expected left released, got %#x", e)
+	}
+	if e := b.nextEvent(&codes); e != NoKeyEvent {
+		t.Errorf("expected no more events, got %#x", e)
+	}
+
+	// All buttons released at once.
+	b.current = 0
+	var released []Key
+	for e := b.nextEvent(&codes); e != NoKeyEvent; e = b.nextEvent(&codes) {
+		if e.Pressed() {
+			t.Errorf("unexpected press event: %#x", e)
+		}
+		released = append(released, e.Key())
+	}
+	if len(released) != 2 || released[0] != KeyA || released[1] != KeyB {
+		t.Errorf("expected A and B released, got %v", released)
+	}
+}
+
+func TestButtonStatePulse(t *testing.T) {
+	codes := [8]Key{KeyA, KeyB, KeyUp, KeyLeft, KeyDown, KeyRight}
+	var b buttonState
+
+	// Without edge capture, a press and release between two reads is missed.
+	b.read(0, 0)
+	if e := b.nextEvent(&codes); e != NoKeyEvent {
+		t.Errorf("expected no event, got %#x", e)
+	}
+
+	// With edge capture, the short press of B is reported as a press followed
+	// by a release, after the other changes in the same read.
+	b.read(1<<0, 1<<0|1<<1) // A pressed and held, B pressed and released
+	for _, expected := range []KeyEvent{
+		KeyEvent(KeyA),
+		KeyEvent(KeyB),
+		KeyEvent(KeyB) | keyReleased,
+		NoKeyEvent,
+	} {
+		if e := b.nextEvent(&codes); e != expected {
+			t.Errorf("expected event %#x, got %#x", expected, e)
+		}
+	}
+
+	// A pulse of a button that is held down again at the next read is just a
+	// press.
+	b.read(1<<0, 1<<2)
+	b.read(1<<0|1<<2, 1<<2)
+	if e := b.nextEvent(&codes); e != KeyEvent(KeyUp) {
+		t.Errorf("expected up pressed, got %#x", e)
+	}
+	if e := b.nextEvent(&codes); e != NoKeyEvent {
+		t.Errorf("expected no more events, got %#x", e)
+	}
+
+	// A pulse of a button that was reported as pressed is only reported as a
+	// release.
+	b.read(1<<0, 1<<2)
+	if e := b.nextEvent(&codes); e != KeyEvent(KeyUp)|keyReleased {
+		t.Errorf("expected up released, got %#x", e)
+	}
+	if e := b.nextEvent(&codes); e != NoKeyEvent {
+		t.Errorf("expected no more events, got %#x", e)
+	}
+}
+
+func TestButtonStatePeek(t *testing.T) {
+	codes := [8]Key{KeyA, KeyB, KeyUp, KeyLeft, KeyDown, KeyRight}
+	var b buttonState
+
+	// Peeking doesn't consume the event, also when several buttons changed
+	// and when a short press is reported.
+	b.read(1<<0|1<<1, 1<<2) // A and B pressed, up pressed and released
+	for _, expected := range []KeyEvent{
+		KeyEvent(KeyA),
+		KeyEvent(KeyB),
+		KeyEvent(KeyUp),
+		KeyEvent(KeyUp) | keyReleased,
+		NoKeyEvent,
+	} {
+		for i := 0; i < 2; i++ {
+			if e := b.peekEvent(&codes); e != expected {
+				t.Errorf("expected peeked event %#x, got %#x", expected, e)
+			}
+		}
+		if e := b.nextEvent(&codes); e != expected {
+			t.Errorf("expected event %#x, got %#x", expected, e)
+		}
+	}
+}
+
+func TestClipRect(t *testing.T) {
+	// Compare against a pixel-by-pixel check of every position and size of an
+	// image around a small display.
+	const displayWidth, displayHeight = 8, 5
+	for width := 0; width <= 10; width++ {
+		for height := 0; height <= 7; height++ {
+			for x := -12; x <= 12; x++ {
+				for y := -9; y <= 9; y++ {
+					// Find the visible part by checking each pixel.
+					left, top, right, bottom := width, height, 0, 0
+					for imgY := 0; imgY < height; imgY++ {
+						for imgX := 0; imgX < width; imgX++ {
+							if x+imgX < 0 || x+imgX >= displayWidth || y+imgY < 0 || y+imgY >= displayHeight {
+								continue
+							}
+							if imgX < left {
+								left = imgX
+							}
+							if imgY < top {
+								top = imgY
+							}
+							if imgX+1 > right {
+								right = imgX + 1
+							}
+							if imgY+1 > bottom {
+								bottom = imgY + 1
+							}
+						}
+					}
+					visible := left < right && top < bottom
+					fits := width > 0 && height > 0 && visible && left == 0 && top == 0 && right == width && bottom == height
+
+					gotLeft, gotTop, gotRight, gotBottom := clipRect(int16(x), int16(y), width, height, displayWidth, displayHeight)
+					gotVisible := gotLeft < gotRight && gotTop < gotBottom
+					if gotVisible != visible {
+						t.Errorf("%dx%d at (%d, %d): expected visible=%v, got %v", width, height, x, y, visible, gotVisible)
+					} else if visible && (gotLeft != left || gotTop != top || gotRight != right || gotBottom != bottom) {
+						t.Errorf("%dx%d at (%d, %d): expected (%d, %d)-(%d, %d), got (%d, %d)-(%d, %d)", width, height, x, y, left, top, right, bottom, gotLeft, gotTop, gotRight, gotBottom)
+					}
+					if gotFits := fitsDisplay(int16(x), int16(y), width, height, displayWidth, displayHeight); gotFits != fits {
+						t.Errorf("%dx%d at (%d, %d): expected fits=%v, got %v", width, height, x, y, fits, gotFits)
+					}
+				}
+			}
+		}
+	}
+}
+
+func TestScaleLEDBrightness(t *testing.T) {
+	src := []byte{0, 1, 2, 128, 255}
+	for _, tc := range []struct {
+		brightness uint8
+		expected   []byte
+	}{
+		{255, []byte{0, 1, 2, 128, 255}}, // unchanged
+		{128, []byte{0, 1, 1, 64, 128}},  // rounded to the nearest value
+		{1, []byte{0, 0, 0, 1, 1}},
+		{0, []byte{0, 0, 0, 0, 0}},
+	} {
+		dst := make([]byte, len(src))
+		scaleLEDBrightness(dst, src, tc.brightness)
+		if !bytes.Equal(dst, tc.expected) {
+			t.Errorf("brightness %d: expected %v, got %v", tc.brightness, tc.expected, dst)
+		}
+	}
+}
+
+func TestLimitLEDBrightness(t *testing.T) {
+	white := []byte{255, 255, 255, 255, 255, 255} // two LEDs, 120mA
+	for _, tc := range []struct {
+		src        []byte
+		brightness uint8
+		limit      int
+		expected   uint8
+	}{
+		{white, 255, 0, 255},           // no limit
+		{white, 255, 120, 255},         // exactly at the limit
+		{white, 255, 60, 127},          // half the current
+		{white, 100, 60, 100},          // already below the limit
+		{white, 255, 1, 2},             // very low limit
+		{[]byte{0, 0, 0}, 255, 1, 255}, // black LEDs draw nothing
+		{[]byte{255, 0, 0}, 255, 10, 127},
+	} {
+		if brightness := limitLEDBrightness(tc.src, tc.brightness, tc.limit); brightness != tc.expected {
+			t.Errorf("%v at brightness %d, limit %dmA: expected brightness %d, got %d", tc.src, tc.brightness, tc.limit, tc.expected, brightness)
+		}
+	}
+}
+
+func TestBusDrawTime(t *testing.T) {
+	for _, tc := range []struct {
+		pixels, bitsPerPixel int
+		frequency            uint32
+		clocksPerByte        int
+		expected             time.Duration
+	}{
+		{320 * 240, 16, 62_500_000, 9, 22_118_400 * time.Nanosecond}, // full screen, Gopher Badge
+		{240 * 240, 12, 8_000_000, 8, 86_400 * time.Microsecond},     // full screen, PineTime
+		{1, 12, 8_000_000, 8, 2 * time.Microsecond},                  // rounded up to whole bytes
+		{0, 16, 8_000_000, 8, 0},
+		{100, 16, 0, 8, 0}, // display not configured yet
+	} {
+		if duration := busDrawTime(tc.pixels, tc.bitsPerPixel, tc.frequency, tc.clocksPerByte); duration != tc.expected {
+			t.Errorf("%d pixels at %dbpp, %dHz: expected %s, got %s", tc.pixels, tc.bitsPerPixel, tc.frequency, tc.expected, duration)
+		}
+	}
+}
+
+func TestDummyBatteryShutdown(t *testing.T) {
+	if err := (dummyBattery{}).Shutdown(); err != ErrNoShutdown {
+		t.Errorf("expected ErrNoShutdown, got %v", err)
+	}
+	called := false
+	battery := dummyBattery{shutdown: func() error {
+		called = true
+		return nil
+	}}
+	if err := battery.Shutdown(); err != nil || !called {
+		t.Errorf("shutdown function not used (err=%v, called=%v)", err, called)
+	}
+}
+
+func TestDummyBatteryReboot(t *testing.T) {
+	if err := (dummyBattery{}).Reboot(true); err != ErrNoReboot {
+		t.Errorf("expected ErrNoReboot, got %v", err)
+	}
+	var toBootloader bool
+	battery := dummyBattery{reboot: func(b bool) error {
+		toBootloader = b
+		return nil
+	}}
+	if err := battery.Reboot(true); err != nil || !toBootloader {
+		t.Errorf("reboot function not used (err=%v, toBootloader=%v)", err, toBootloader)
+	}
+}
+
+func TestDisplayOutline(t *testing.T) {
+	outline := DisplayOutline{CornerRadius: 2, NotchWidth: 2, NotchHeight: 1}
+	expected := []string{
+		".##..##.",
+		"########",
+		"########",
+		"########",
+		"########",
+		".######.",
+	}
+	for y, line := range expected {
+		for x := range line {
+			if visible := outline.Contains(x, y, 8, 6); visible != (line[x] == '#') {
+				t.Errorf("pixel (%d, %d): expected visible=%v", x, y, !visible)
+			}
+		}
+	}
+
+	// The zero value is a plain rectangle.
+	if !(DisplayOutline{}).Contains(0, 0, 8, 6) {
+		t.Error("corner pixel not visible without an outline")
+	}
+}
+
+func TestKeyEventPacking(t *testing.T) {
+	// Every key code, including the highest, must survive being packed into a
+	// KeyEvent in both the pressed and released state.
+	for _, key := range []Key{KeyEscape, KeyF12, Key0, Key9, KeyDelete} {
+		if e := KeyEvent(key); e.Key() != key || !e.Pressed() {
+			t.Errorf("key %d: expected pressed event, got %#x", key, e)
+		}
+		if e := KeyEvent(key) | keyReleased; e.Key() != key || e.Pressed() {
+			t.Errorf("key %d: expected released event, got %#x", key, e)
+		}
+	}
+}
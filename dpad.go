@@ -0,0 +1,119 @@
+package board
+
+// Direction is one of 8 directions (or none) of a D-pad.
+type Direction uint8
+
+// List of all directions, clockwise starting from up.
+const (
+	DirectionNone Direction = iota
+	DirectionUp
+	DirectionUpRight
+	DirectionRight
+	DirectionDownRight
+	DirectionDown
+	DirectionDownLeft
+	DirectionLeft
+	DirectionUpLeft
+)
+
+// String returns a human readable name of the direction.
+func (d Direction) String() string {
+	switch d {
+	case DirectionUp:
+		return "up"
+	case DirectionUpRight:
+		return "up-right"
+	case DirectionRight:
+		return "right"
+	case DirectionDownRight:
+		return "down-right"
+	case DirectionDown:
+		return "down"
+	case DirectionDownLeft:
+		return "down-left"
+	case DirectionLeft:
+		return "left"
+	case DirectionUpLeft:
+		return "up-left"
+	default:
+		return "none"
+	}
+}
+
+// DPad combines the up/down/left/right key events into a single 8-way
+// direction. Pressing up and left at the same time for example results in
+// DirectionUpLeft instead of two separate key events. This is useful for games
+// that move in 8 directions.
+//
+// It works on top of the normal key events, so the raw key events remain
+// available: pass every event from Buttons.NextEvent to Update and use the
+// returned direction (and the event itself, if needed).
+//
+// The zero value is ready to use, with no direction keys pressed.
+type DPad struct {
+	pressed uint8 // bitmask of dpadUp etc.
+}
+
+// Bits in DPad.pressed.
+const (
+	dpadUp = 1 << iota
+	dpadDown
+	dpadLeft
+	dpadRight
+)
+
+// Update processes a single key event and returns the direction after this
+// event, and whether the direction changed. Events for keys other than the
+// four direction keys are ignored.
+//
+// Opposite directions cancel each other out: pressing left and right at the
+// same time is the same as pressing neither.
+func (d *DPad) Update(e KeyEvent) (dir Direction, changed bool) {
+	var bit uint8
+	switch e.Key() {
+	case KeyUp:
+		bit = dpadUp
+	case KeyDown:
+		bit = dpadDown
+	case KeyLeft:
+		bit = dpadLeft
+	case KeyRight:
+		bit = dpadRight
+	default:
+		return d.Direction(), false
+	}
+	old := d.Direction()
+	if e.Pressed() {
+		d.pressed |= bit
+	} else {
+		d.pressed &^= bit
+	}
+	dir = d.Direction()
+	return dir, dir != old
+}
+
+// Direction returns the current direction, based on the direction keys that
+// are currently pressed.
+func (d *DPad) Direction() Direction {
+	var dx, dy int
+	if d.pressed&dpadUp != 0 {
+		dy--
+	}
+	if d.pressed&dpadDown != 0 {
+		dy++
+	}
+	if d.pressed&dpadLeft != 0 {
+		dx--
+	}
+	if d.pressed&dpadRight != 0 {
+		dx++
+	}
+	return dpadDirections[dy+1][dx+1]
+}
+
+// Direction for each combination of dy and dx (offset by one).
+var dpadDirections = [3][3]Direction{
+	{DirectionUpLeft, DirectionUp, DirectionUpRight},
+	{DirectionLeft, DirectionNone, DirectionRight},
+	{DirectionDownLeft, DirectionDown, DirectionDownRight},
+}
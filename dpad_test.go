@@ -0,0 +1,37 @@
+package board
+
+import "testing"
+
+func TestDPad(t *testing.T) {
+	press := func(key Key) KeyEvent { return KeyEvent(key) }
+	release := func(key Key) KeyEvent { return KeyEvent(key) | keyReleased }
+
+	var d DPad
+	for _, step := range []struct {
+		event   KeyEvent
+		dir     Direction
+		changed bool
+	}{
+		{press(KeyUp), DirectionUp, true},
+		{press(KeyLeft), DirectionUpLeft, true},
+		{press(KeyA), DirectionUpLeft, false}, // not a direction key
+		{release(KeyUp), DirectionLeft, true},
+		{press(KeyDown), DirectionDownLeft, true},
+		{press(KeyRight), DirectionDown, true}, // left and right cancel out
+		{release(KeyLeft), DirectionDownRight, true},
+		{press(KeyUp), DirectionRight, true}, // up and down cancel out
+		{release(KeyDown), DirectionUpRight, true},
+		{release(KeyA), DirectionUpRight, false},
+		{release(KeyUp), DirectionRight, true},
+		{release(KeyRight), DirectionNone, true},
+		{release(KeyRight), DirectionNone, false}, // spurious release
+	} {
+		dir, changed := d.Update(step.event)
+		if dir != step.dir || changed != step.changed {
+			t.Errorf("event %#x: expected %s (changed=%v), got %s (changed=%v)", step.event, step.dir, step.changed, dir, changed)
+		}
+		if d.Direction() != dir {
+			t.Errorf("event %#x: Direction() returned %s, expected %s", step.event, d.Direction(), dir)
+		}
+	}
+}
@@ -1,6 +1,9 @@
 package board
 
-import "time"
+import (
+	"sync"
+	"time"
+)
 
 // This file contains dummy devices, for devices which don't support a
 // particular kind of device.
@@ -15,10 +18,20 @@ func (b noButtons) Configure() {
 func (b noButtons) ReadInput() {
 }
 
+func (b noButtons) Snapshot() {
+}
+
 func (b noButtons) NextEvent() KeyEvent {
 	return NoKeyEvent
 }
 
+func (b noButtons) PeekEvent() KeyEvent {
+	return NoKeyEvent
+}
+
+func (b noButtons) Remap(index int, key Key) {
+}
+
 // Dummy touch object that doesn't read any input.
 // Used for displays without touch capabilities.
 type noTouch struct{}
@@ -31,21 +44,34 @@ var lastWaitForVBlank time.Time
 
 // Utility function for all those boards that don't support vblank.
 func dummyWaitForVBlank(defaultInterval time.Duration) {
+	dummyWaitForVBlankTimeout(defaultInterval, 0)
+}
+
+// Like dummyWaitForVBlank, but give up (and return false) when the default
+// interval doesn't end within the timeout. A timeout of 0 means no timeout.
+func dummyWaitForVBlankTimeout(defaultInterval, timeout time.Duration) bool {
 	waitUntil := lastWaitForVBlank.Add(defaultInterval)
 	now := time.Now()
 	duration := waitUntil.Sub(now)
 	if duration < 0 {
 		lastWaitForVBlank = now
-		return
+		return true
+	}
+	if timeout > 0 && duration > timeout {
+		time.Sleep(timeout)
+		return false
 	}
 	time.Sleep(duration)
 	lastWaitForVBlank = waitUntil
+	return true
 }
 
 // Dummy implementation of the Power value, for devices with no battery or where
 // the battery status cannot be read.
 type dummyBattery struct {
-	state ChargeState
+	state    ChargeState
+	shutdown func() error                  // cut power to the board, or nil if not supported
+	reboot   func(toBootloader bool) error // reset the board, or nil if not supported
 }
 
 func (b dummyBattery) Configure() {
@@ -55,3 +81,157 @@ func (b dummyBattery) Configure() {
 func (b dummyBattery) Status() (ChargeState, uint32, int8) {
 	return b.state, 0, -1
 }
+
+func (b dummyBattery) BatteryTemperature() int32 {
+	return 0
+}
+
+func (b dummyBattery) NextEvent() PowerEvent {
+	return NoPowerEvent
+}
+
+func (b dummyBattery) Shutdown() error {
+	if b.shutdown == nil {
+		return ErrNoShutdown
+	}
+	return b.shutdown()
+}
+
+func (b dummyBattery) Reboot(toBootloader bool) error {
+	if b.reboot == nil {
+		return ErrNoReboot
+	}
+	return b.reboot(toBootloader)
+}
+
+// Dummy status LED, for boards without a (non-addressable) LED.
+type noStatusLED struct{}
+
+func (l noStatusLED) Configure() {
+}
+
+func (l noStatusLED) Set(on bool) {
+}
+
+func (l noStatusLED) SetColor(r, g, b uint8) {
+}
+
+// Dummy vibration motor, for boards without one. If enabled in
+// VibrationSettings, it uses the speaker instead.
+type noVibration struct{}
+
+func (v noVibration) Configure() {
+	if VibrationSettings.SpeakerFallback {
+		Speaker.Configure()
+	}
+}
+
+// The tone started by Pulse for the speaker fallback, so that it can be
+// stopped again.
+var noVibrationTone struct {
+	lock sync.Mutex
+	done <-chan struct{}
+}
+
+func (v noVibration) Pulse(duration time.Duration) {
+	if VibrationSettings.SpeakerFallback {
+		frequency := VibrationSettings.FallbackFrequency
+		if frequency == 0 {
+			frequency = 100
+		}
+		noVibrationTone.lock.Lock()
+		noVibrationTone.done = Speaker.StartTone(frequency, duration)
+		noVibrationTone.lock.Unlock()
+	}
+}
+
+// Silence the tone started by Pulse, if it is still playing. A tone that was
+// already cut off by another tone (for example, one started by the app) is
+// left alone.
+func (v noVibration) off() {
+	noVibrationTone.lock.Lock()
+	defer noVibrationTone.lock.Unlock()
+	if noVibrationTone.done == nil {
+		return
+	}
+	select {
+	case <-noVibrationTone.done:
+	default:
+		Speaker.StartTone(0, 0)
+	}
+	noVibrationTone.done = nil
+}
+
+var noVibrationPatterns patternPlayer
+
+// Play the pattern using Pulse, so that the speaker fallback works and the
+// returned channel has the same timing as on boards with a vibration motor.
+func (v noVibration) Pattern(pattern []time.Duration) <-chan struct{} {
+	return noVibrationPatterns.play(pattern, v.Pulse, v.off)
+}
+
+// Stop the pattern that is currently playing, and the fallback tone of the
+// last Pulse.
+func (v noVibration) Stop() {
+	noVibrationPatterns.stop(v.off)
+	v.off()
+}
+
+// Dummy speaker, for boards without a speaker or buzzer. It keeps the timing
+// of the tones (by sleeping), so that code playing a melody behaves the same.
+type noSpeaker struct{}
+
+func (s noSpeaker) Configure() {
+}
+
+func (s noSpeaker) Tone(frequency uint32, duration time.Duration) {
+	time.Sleep(duration)
+}
+
+var noSpeakerPlayer tonePlayer
+
+func (s noSpeaker) StartTone(frequency uint32, duration time.Duration) <-chan struct{} {
+	return noSpeakerPlayer.play(duration, func() {}, func() {})
+}
+
+func (s noSpeaker) PlayNote(note uint8, duration time.Duration) {
+	time.Sleep(duration)
+}
+
+func (s noSpeaker) PlaySequence(notes []Note) {
+	playSequence(s, notes)
+}
+
+// Dummy microphone, for boards without a microphone.
+type dummyMicrophone struct{}
+
+func (m dummyMicrophone) Configure(sampleRate uint32) error {
+	return ErrNoMicrophone
+}
+
+func (m dummyMicrophone) Read(buf []int16) (int, error) {
+	return 0, ErrNoMicrophone
+}
+
+// Dummy rotary encoder, for boards without one. It is never turned or pushed.
+type dummyEncoder struct{}
+
+func (e dummyEncoder) Configure() {
+	// nothing to do here
+}
+
+func (e dummyEncoder) Read() (delta int, pressed bool) {
+	return 0, false
+}
+
+// Dummy watchdog, for boards where the watchdog isn't running or isn't
+// supported yet. Feeding it does nothing.
+type noWatchdog struct{}
+
+func (w noWatchdog) Configure() {
+	// nothing to do here
+}
+
+func (w noWatchdog) Feed() {
+	// nothing to do here
+}
@@ -0,0 +1,80 @@
+package board
+
+import "sync/atomic"
+
+// This file contains helpers for rotary encoders, read with Encoder.Read.
+//
+// Encoder.Read returns the number of steps (detents) the encoder was turned
+// since the last call, where positive is clockwise, and whether the encoder is
+// currently pushed in (for encoders with a push switch). Boards without a
+// rotary encoder always return 0 and false. For example, to scroll through a
+// menu:
+//
+//	delta, pressed := board.Encoder.Read()
+//	selected += delta
+//	if pressed {
+//		// activate the selected item
+//	}
+
+// States of the quadrature decoder. The rest state is when both signals are
+// high (as they're pulled up), a step in either direction goes through the
+// other three states before returning to the rest state.
+const (
+	quadratureRest uint8 = iota
+	quadratureCWBegin
+	quadratureCWNext
+	quadratureCWFinal
+	quadratureCCWBegin
+	quadratureCCWNext
+	quadratureCCWFinal
+
+	// Flags set in the transition table when a step was completed.
+	quadratureCW  = 0x10
+	quadratureCCW = 0x20
+)
+
+// State transition table, indexed by the current state and the signals as
+// (b << 1 | a). This is the full step decoder described here:
+// http://www.buxtronix.net/2011/10/rotary-encoders-done-properly.html
+var quadratureTransitions = [7][4]uint8{
+	quadratureRest:     {quadratureRest, quadratureCWBegin, quadratureCCWBegin, quadratureRest},
+	quadratureCWBegin:  {quadratureCWNext, quadratureCWBegin, quadratureRest, quadratureRest},
+	quadratureCWNext:   {quadratureCWNext, quadratureCWBegin, quadratureCWFinal, quadratureRest},
+	quadratureCWFinal:  {quadratureCWNext, quadratureRest, quadratureCWFinal, quadratureRest | quadratureCW},
+	quadratureCCWBegin: {quadratureCCWNext, quadratureRest, quadratureCCWBegin, quadratureRest},
+	quadratureCCWNext:  {quadratureCCWNext, quadratureCCWFinal, quadratureCCWBegin, quadratureRest},
+	quadratureCCWFinal: {quadratureCCWNext, quadratureCCWFinal, quadratureRest, quadratureRest | quadratureCCW},
+}
+
+// Decoder for the two quadrature signals of a rotary encoder with detents.
+// A step is only counted after the signals went through all four states of a
+// step in order. Contact bounce only moves the decoder back and forth between
+// neighbouring states, so it is filtered out without needing any delays.
+type quadratureDecoder struct {
+	state    uint8 // only modified from update
+	position int32 // steps, positive is clockwise
+}
+
+// Update the decoder with the current state of the two signals. It is usually
+// called from a pin interrupt, whenever one of the signals changed.
+func (d *quadratureDecoder) update(a, b bool) {
+	signals := 0
+	if a {
+		signals |= 1
+	}
+	if b {
+		signals |= 2
+	}
+	d.state = quadratureTransitions[d.state&0x0f][signals]
+	switch d.state &^ 0x0f {
+	case quadratureCW:
+		atomic.AddInt32(&d.position, 1)
+	case quadratureCCW:
+		atomic.AddInt32(&d.position, -1)
+	}
+}
+
+// Return the current position in steps since the decoder was started.
+func (d *quadratureDecoder) steps() int {
+	return int(atomic.LoadInt32(&d.position))
+}
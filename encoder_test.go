@@ -0,0 +1,42 @@
+package board
+
+import "testing"
+
+func TestQuadratureDecoder(t *testing.T) {
+	// Signals as (a, b), starting and ending at rest (both high).
+	clockwise := [][2]bool{{true, false}, {false, false}, {false, true}, {true, true}}
+	counterclockwise := [][2]bool{{false, true}, {false, false}, {true, false}, {true, true}}
+	for _, tc := range []struct {
+		name     string
+		signals  [][][2]bool
+		expected int
+	}{
+		{"clockwise", [][][2]bool{clockwise}, 1},
+		{"counterclockwise", [][][2]bool{counterclockwise}, -1},
+		{"multiple", [][][2]bool{clockwise, clockwise, counterclockwise, clockwise}, 2},
+		{"bounce", [][][2]bool{{
+			{true, false}, {true, true}, {true, false}, // bounce at the start
+			{false, false}, {true, false}, {false, false}, // bounce halfway
+			{false, true}, {true, true},
+		}}, 1},
+		{"reverse halfway", [][][2]bool{{
+			{true, false}, {false, false}, // start clockwise
+			{true, false}, {true, true}, // and go back
+		}}, 0},
+		{"invalid", [][][2]bool{{
+			{false, false}, {true, true}, // skipped states, not a step
+		}}, 0},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			var d quadratureDecoder
+			for _, sequence := range tc.signals {
+				for _, signal := range sequence {
+					d.update(signal[0], signal[1])
+				}
+			}
+			if steps := d.steps(); steps != tc.expected {
+				t.Errorf("expected %d steps, got %d", tc.expected, steps)
+			}
+		})
+	}
+}
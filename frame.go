@@ -0,0 +1,101 @@
+package board
+
+import "time"
+
+// FramePolicy determines the frame rate used by a FramePacer, depending on the
+// power source. Lower frame rates save power (the CPU and display bus are idle
+// for longer) at the cost of less smooth animations.
+type FramePolicy struct {
+	// Frame rate when running on external power (charging, fully charged, or
+	// no battery at all).
+	Powered int
+
+	// Frame rate when running on battery power.
+	Discharging int
+
+	// Frame rate when running on battery power and the battery percentage is
+	// below LowBatteryPercent.
+	LowBattery        int
+	LowBatteryPercent int8
+}
+
+// DefaultFramePolicy is a reasonable frame policy for most apps.
+var DefaultFramePolicy = FramePolicy{
+	Powered:           60,
+	Discharging:       30,
+	LowBattery:        15,
+	LowBatteryPercent: 20,
+}
+
+// Return the frame rate for the given battery status.
+func (p FramePolicy) fps(state ChargeState, percent int8) int {
+	if !onBatteryPower(state) {
+		return p.Powered
+	}
+	// Discharging, or unknown (in which case assume the worst).
+	if percent >= 0 && percent < p.LowBatteryPercent {
+		return p.LowBattery
+	}
+	return p.Discharging
+}
+
+// How often a FramePacer reads the battery status.
+const framePacerBatteryInterval = 5 * time.Second
+
+// FramePacer limits the frame rate of an app, and lowers it automatically when
+// running on battery power. Power.Configure must have been called before
+// using it.
+type FramePacer struct {
+	// The policy used to determine the frame rate.
+	Policy FramePolicy
+
+	// Whether the frame rate depends on the battery status. If false, the
+	// Powered frame rate from the policy is always used. Set to true by
+	// NewFramePacer.
+	Adaptive bool
+
+	fps         int
+	lastFrame   time.Time
+	lastBattery time.Time
+}
+
+// NewFramePacer returns a new adaptive frame pacer using the given policy.
+func NewFramePacer(policy FramePolicy) *FramePacer {
+	return &FramePacer{
+		Policy:   policy,
+		Adaptive: true,
+	}
+}
+
+// FPS returns the current target frame rate. The battery status is read
+// once every few seconds, to avoid the overhead of reading it every frame.
+func (p *FramePacer) FPS() int {
+	if !p.Adaptive {
+		return p.Policy.Powered
+	}
+	now := time.Now()
+	if p.fps == 0 || now.Sub(p.lastBattery) >= framePacerBatteryInterval {
+		p.lastBattery = now
+		state, _, percent := Power.Status()
+		p.fps = p.Policy.fps(state, percent)
+	}
+	return p.fps
+}
+
+// Wait until it is time to draw the next frame. It sleeps until the next frame
+// is due according to the target frame rate, and then waits for the next
+// vblank (see Display.WaitForVBlank) to avoid tearing.
+func (p *FramePacer) Wait() {
+	fps := p.FPS()
+	if fps <= 0 {
+		fps = 1
+	}
+	interval := time.Second / time.Duration(fps)
+	if !p.lastFrame.IsZero() {
+		if wait := time.Until(p.lastFrame.Add(interval)); wait > 0 {
+			time.Sleep(wait)
+		}
+	}
+	Display.WaitForVBlank(interval)
+	p.lastFrame = time.Now()
+}
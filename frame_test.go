@@ -0,0 +1,27 @@
+package board
+
+import "testing"
+
+func TestFramePolicy(t *testing.T) {
+	for _, tc := range []struct {
+		state   ChargeState
+		percent int8
+		fps     int
+	}{
+		{Charging, 10, 60},
+		{NotCharging, 100, 60},
+		{NoBattery, -1, 60},
+		{BatteryUnavailable, -1, 60},
+		{Discharging, 80, 30},
+		{Discharging, 20, 30},
+		{Discharging, 19, 15},
+		{Discharging, -1, 30},
+		{UnknownBattery, 50, 30},
+		{UnknownBattery, 5, 15},
+	} {
+		fps := DefaultFramePolicy.fps(tc.state, tc.percent)
+		if fps != tc.fps {
+			t.Errorf("%s at %d%%: expected %dfps, got %dfps", tc.state, tc.percent, tc.fps, fps)
+		}
+	}
+}
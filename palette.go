@@ -0,0 +1,47 @@
+package board
+
+import (
+	"image/color"
+
+	"tinygo.org/x/drivers/pixel"
+)
+
+// A small palette of named colors, in the sRGB color space. Use Color to
+// convert them to the color format of the display.
+var (
+	Black   = color.RGBA{R: 0, G: 0, B: 0, A: 255}
+	White   = color.RGBA{R: 255, G: 255, B: 255, A: 255}
+	Gray    = color.RGBA{R: 128, G: 128, B: 128, A: 255}
+	Red     = color.RGBA{R: 255, G: 0, B: 0, A: 255}
+	Green   = color.RGBA{R: 0, G: 255, B: 0, A: 255}
+	Blue    = color.RGBA{R: 0, G: 0, B: 255, A: 255}
+	Yellow  = color.RGBA{R: 255, G: 255, B: 0, A: 255}
+	Cyan    = color.RGBA{R: 0, G: 255, B: 255, A: 255}
+	Magenta = color.RGBA{R: 255, G: 0, B: 255, A: 255}
+	Orange  = color.RGBA{R: 255, G: 128, B: 0, A: 255}
+)
+
+// Color converts an sRGB color (for example, one of the named colors like
+// Red) to the native color format of the display on this board, so that
+// portable code doesn't need to know which color format the display uses:
+//
+//	img.FillSolidColor(board.Color(board.Red))
+//
+// The alpha channel is ignored. On monochrome displays, light colors become
+// white and dark colors become black. This takes into account that a set pixel
+// is white on some monochrome displays (OLED) and black on others (e-paper).
+func Color(c color.RGBA) displayColor {
+	return convertDisplayColor(c)
+}
+
+// Convert an sRGB color to the given color format. For pixel.Monochrome, light
+// colors are set (which is white on an OLED display).
+func convertColor[T pixel.Color](c color.RGBA) T {
+	return pixel.NewColor[T](c.R, c.G, c.B)
+}
+
+// Convert an sRGB color to a monochrome color for an e-paper display, where a
+// set pixel is black. So unlike convertColor, dark colors are set.
+func convertEpaperColor(c color.RGBA) pixel.Monochrome {
+	return !convertColor[pixel.Monochrome](c)
+}
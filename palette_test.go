@@ -0,0 +1,50 @@
+package board
+
+import (
+	"image/color"
+	"testing"
+
+	"tinygo.org/x/drivers/pixel"
+)
+
+func TestConvertColor(t *testing.T) {
+	for _, tc := range []struct {
+		name       string
+		color      color.RGBA
+		rgb888     pixel.RGB888
+		rgb565be   pixel.RGB565BE
+		rgb444be   pixel.RGB444BE
+		monochrome pixel.Monochrome
+	}{
+		{"black", Black, pixel.RGB888{R: 0, G: 0, B: 0}, 0x0000, 0x000, false},
+		{"white", White, pixel.RGB888{R: 255, G: 255, B: 255}, 0xffff, 0xfff, true},
+		{"red", Red, pixel.RGB888{R: 255, G: 0, B: 0}, 0x00f8, 0xf00, false},
+		{"green", Green, pixel.RGB888{R: 0, G: 255, B: 0}, 0xe007, 0x0f0, false},
+		{"blue", Blue, pixel.RGB888{R: 0, G: 0, B: 255}, 0x1f00, 0x00f, false},
+		{"yellow", Yellow, pixel.RGB888{R: 255, G: 255, B: 0}, 0xe0ff, 0xff0, true},
+	} {
+		if c := convertColor[pixel.RGB888](tc.color); c != tc.rgb888 {
+			t.Errorf("%s: expected RGB888 %v, got %v", tc.name, tc.rgb888, c)
+		}
+		if c := convertColor[pixel.RGB565BE](tc.color); c != tc.rgb565be {
+			t.Errorf("%s: expected RGB565BE %#04x, got %#04x", tc.name, tc.rgb565be, c)
+		}
+		if c := convertColor[pixel.RGB444BE](tc.color); c != tc.rgb444be {
+			t.Errorf("%s: expected RGB444BE %#03x, got %#03x", tc.name, tc.rgb444be, c)
+		}
+		if c := convertColor[pixel.Monochrome](tc.color); c != tc.monochrome {
+			t.Errorf("%s: expected monochrome %v, got %v", tc.name, tc.monochrome, c)
+		}
+		if c := convertEpaperColor(tc.color); c == tc.monochrome {
+			t.Errorf("%s: expected e-paper monochrome %v, got %v", tc.name, !tc.monochrome, c)
+		}
+
+		// RGB555 is checked by converting back. The red and blue channels
+		// are swapped between NewRGB555 and RGBA in the pixel package, so
+		// only check that the same channels are at full intensity.
+		c := convertColor[pixel.RGB555](tc.color).RGBA()
+		if c.G != tc.color.G || (c.R == 255) != (tc.color.B == 255) || (c.B == 255) != (tc.color.R == 255) {
+			t.Errorf("%s: unexpected RGB555 color %v", tc.name, c)
+		}
+	}
+}
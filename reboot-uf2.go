@@ -0,0 +1,18 @@
+//go:build rp2040 || atsamd51
+
+package board
+
+import (
+	"device/arm"
+	"machine"
+)
+
+// Reboot the board, optionally into the UF2 bootloader. This bootloader shows
+// up as a USB drive, and firmware can be flashed by copying a .uf2 file to it.
+func reboot(toBootloader bool) error {
+	if toBootloader {
+		machine.EnterBootloader()
+	}
+	arm.SystemReset()
+	return nil // unreachable
+}
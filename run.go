@@ -0,0 +1,79 @@
+package board
+
+import (
+	"time"
+
+	"tinygo.org/x/drivers/pixel"
+)
+
+// App is an app that can be run using Run.
+type App[T pixel.Color] interface {
+	// Update the state of the app with the key events since the last call
+	// (which may be none), and return whether the screen needs to be redrawn.
+	// It is called regularly, also when there is no input, so it can be used
+	// for things like timers.
+	Update(events []KeyEvent) (redraw bool, err error)
+
+	// Draw the current state of the app to the display. It is only called
+	// when Update asked for it, and after the first Update. Run calls
+	// Display() on the display afterwards.
+	Draw(display Displayer[T]) error
+}
+
+// Frame interval passed to Display.WaitForVBlank by Run, for displays that
+// can't report vblank.
+const runFrameInterval = time.Second / 60
+
+// Run is a main loop for apps that follow the usual structure of reading
+// input, updating state, and drawing the result. Using it is entirely
+// optional: it's a convenience built on top of Buttons, Display.WaitForVBlank
+// and Idle, which can just as well be used directly.
+//
+// The peripherals the app needs (at least the display and the buttons) must be
+// configured before calling Run, for example using Configure:
+//
+//	display, _ := board.Configure(board.ConfigureOptions{})
+//	board.Run(display, newApp(display))
+//
+// Every iteration, Run reads the buttons and passes the key events to
+// app.Update. When the app asks for a redraw, Run waits for vblank to avoid
+// tearing and then calls app.Draw. Otherwise, the board idles for a short
+// while (see Idle) to save power. This means an app that redraws every frame
+// runs at the display refresh rate, and an app that is waiting for input
+// spends most of its time in a low-power state.
+//
+// Run only returns on an error from app.Update or app.Draw, and returns that
+// error. To stop the loop (for example to exit to a menu), return an error of
+// your own from Update and check for it.
+func Run[T pixel.Color](display Displayer[T], app App[T]) error {
+	var events []KeyEvent
+	redraw := true // always draw the first frame
+	for {
+		Buttons.ReadInput()
+		events = events[:0]
+		for {
+			event := Buttons.NextEvent()
+			if event == NoKeyEvent {
+				break
+			}
+			events = append(events, event)
+		}
+
+		needsRedraw, err := app.Update(events)
+		if err != nil {
+			return err
+		}
+		if redraw || needsRedraw {
+			redraw = false
+			Display.WaitForVBlank(runFrameInterval)
+			if err := app.Draw(display); err != nil {
+				return err
+			}
+			if err := display.Display(); err != nil {
+				return err
+			}
+		} else {
+			Idle(keyPollInterval)
+		}
+	}
+}
@@ -0,0 +1,71 @@
+//go:build rp2040
+
+package board
+
+import (
+	"device/rp"
+	"machine"
+
+	"tinygo.org/x/drivers"
+)
+
+// Sensors for RP2040 boards that don't have any other sensors. The RP2040 has
+// a temperature sensor built in (on ADC channel 4), which can be read by
+// configuring and updating drivers.Temperature.
+//
+// TODO: the temperature isn't advertised in Available or BoardInfo.Sensors,
+// because it hasn't been shown to be usable. Reading it using
+// machine.ReadTemperature() was so inaccurate that it wasn't even usable
+// (around -23°C in a >25°C room). This reads the ADC directly and converts it
+// using rp2040DieTemperature instead, but that still needs to be checked
+// against a thermometer on real hardware.
+//
+// Note that this is the temperature of the chip itself (the die), not the
+// ambient temperature. It is usually a few degrees warmer than the room, more
+// so when the CPU is busy.
+type dieSensors struct {
+	baseSensors
+	temp int32
+}
+
+func (s *dieSensors) Configure(which drivers.Measurement) error {
+	if which&drivers.Temperature != 0 {
+		configureDieTemperature()
+	}
+	return nil
+}
+
+func (s *dieSensors) Update(which drivers.Measurement) error {
+	if which&drivers.Temperature != 0 {
+		s.temp = readDieTemperature()
+	}
+	return nil
+}
+
+// Temperature returns the temperature of the RP2040 die in milli-degrees
+// Celsius, as read in the last call to Update. See dieSensors for how accurate
+// it is.
+func (s *dieSensors) Temperature() int32 {
+	return s.temp
+}
+
+var dieTemperatureOnce configureOnce
+
+// Initialize the ADC and enable the temperature sensor.
+func configureDieTemperature() {
+	dieTemperatureOnce.do(func() error {
+		machine.InitADC()
+		rp.ADC.CS.SetBits(rp.ADC_CS_TS_EN)
+		return nil
+	})
+}
+
+// Read the temperature sensor inside the RP2040, in milli-degrees Celsius.
+func readDieTemperature() int32 {
+	configureDieTemperature()
+	rp.ADC.CS.ReplaceBits(4<<rp.ADC_CS_AINSEL_Pos, rp.ADC_CS_AINSEL_Msk, 0)
+	rp.ADC.CS.SetBits(rp.ADC_CS_START_ONCE)
+	for !rp.ADC.CS.HasBits(rp.ADC_CS_READY) {
+	}
+	return rp2040DieTemperature(uint16(rp.ADC.RESULT.Get()))
+}
@@ -0,0 +1,183 @@
+package board
+
+import "tinygo.org/x/drivers/pixel"
+
+// This file contains helpers to draw simple shapes, for apps that don't need a
+// full graphics library.
+//
+// Unlike DrawBitmap, these helpers clip shapes to the display: the parts of a
+// shape outside of the display are not drawn, and it is not an error for a
+// shape to extend past the edge of the display.
+
+// Maximum number of pixels drawn at once by FillRect, to limit the size of the
+// temporary image.
+const fillRectMaxPixels = 1024
+
+// FillRect fills the rectangle with its top left corner at (x, y) with the
+// given color.
+func FillRect[T pixel.Color](display Displayer[T], x, y, width, height int16, c T) error {
+	displayWidth, displayHeight := display.Size()
+	left, top, right, bottom := clipRect(x, y, int(width), int(height), displayWidth, displayHeight)
+	if left >= right || top >= bottom {
+		return nil // nothing to draw
+	}
+	x += int16(left)
+	y += int16(top)
+	clippedWidth := right - left
+	clippedHeight := bottom - top
+
+	// Draw the rectangle a few lines at a time, using a single image.
+	rows := fillRectMaxPixels / clippedWidth
+	if rows < 1 {
+		rows = 1
+	}
+	if rows > clippedHeight {
+		rows = clippedHeight
+	}
+	img := pixel.NewImage[T](clippedWidth, rows)
+	img.FillSolidColor(c)
+	for row := 0; row < clippedHeight; row += rows {
+		if remaining := clippedHeight - row; remaining < rows {
+			img = img.LimitHeight(remaining)
+		}
+		err := display.DrawBitmap(x, y+int16(row), img)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Clear fills the entire display with the given color, for example to start
+// from a blank screen. It doesn't need a framebuffer, and uses the most
+// efficient way the display supports: displays that keep their own buffer in
+// RAM (the e-paper displays on the Badger 2040 and the SHA2017 badge, and the
+// OLED display on the Thumby) are cleared directly when the color is the zero
+// value (black, or white on e-paper). Like any other drawing on these
+// displays, Display must be called afterwards to show the result.
+func Clear[T pixel.Color](display Displayer[T], c T) error {
+	var zero T
+	if clearer, ok := display.(interface{ ClearBuffer() }); ok && c == zero {
+		clearer.ClearBuffer()
+		return nil
+	}
+	width, height := display.Size()
+	return FillRect(display, 0, 0, width, height, c)
+}
+
+// DrawRect draws the outline of the rectangle with its top left corner at
+// (x, y), one pixel wide.
+func DrawRect[T pixel.Color](display Displayer[T], x, y, width, height int16, c T) error {
+	if width <= 0 || height <= 0 {
+		return nil
+	}
+	if width <= 2 || height <= 2 {
+		// No inside, so the outline is the same as the filled rectangle.
+		return FillRect(display, x, y, width, height, c)
+	}
+	for _, r := range [4][4]int16{
+		{x, y, width, 1},                      // top
+		{x, y + height - 1, width, 1},         // bottom
+		{x, y + 1, 1, height - 2},             // left
+		{x + width - 1, y + 1, 1, height - 2}, // right
+	} {
+		if err := FillRect(display, r[0], r[1], r[2], r[3], c); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// DrawLine draws a one pixel wide line from (x0, y0) to (x1, y1), including
+// both end points. Horizontal and vertical lines are drawn at once, other lines
+// are drawn pixel by pixel (using SetPixel if the display supports it).
+func DrawLine[T pixel.Color](display Displayer[T], x0, y0, x1, y1 int16, c T) error {
+	displayWidth, displayHeight := display.Size()
+
+	// Horizontal and vertical lines can be longer than fits in an int16, so
+	// clip them to the display before passing them to FillRect.
+	if y0 == y1 {
+		if x1 < x0 {
+			x0, x1 = x1, x0
+		}
+		left, right := int(x0), int(x1)+1
+		if left < 0 {
+			left = 0
+		}
+		if right > int(displayWidth) {
+			right = int(displayWidth)
+		}
+		if left >= right {
+			return nil // outside of the display
+		}
+		return FillRect(display, int16(left), y0, int16(right-left), 1, c)
+	}
+	if x0 == x1 {
+		if y1 < y0 {
+			y0, y1 = y1, y0
+		}
+		top, bottom := int(y0), int(y1)+1
+		if top < 0 {
+			top = 0
+		}
+		if bottom > int(displayHeight) {
+			bottom = int(displayHeight)
+		}
+		if top >= bottom {
+			return nil // outside of the display
+		}
+		return FillRect(display, x0, int16(top), 1, int16(bottom-top), c)
+	}
+
+	// Determine how to draw a single pixel.
+	setter, hasSetter := AsPixelSetter(display)
+	var img pixel.Image[T]
+	if !hasSetter {
+		img = pixel.NewImage[T](1, 1)
+		img.Set(0, 0, c)
+	}
+
+	// Bresenham's line algorithm, using integer math only.
+	dx := int(x1) - int(x0)
+	if dx < 0 {
+		dx = -dx
+	}
+	dy := int(y1) - int(y0)
+	if dy > 0 {
+		dy = -dy
+	}
+	sx, sy := 1, 1
+	if x1 < x0 {
+		sx = -1
+	}
+	if y1 < y0 {
+		sy = -1
+	}
+	x, y := int(x0), int(y0)
+	e := dx + dy
+	for {
+		if x >= 0 && y >= 0 && x < int(displayWidth) && y < int(displayHeight) {
+			var err error
+			if hasSetter {
+				err = setter.SetPixel(int16(x), int16(y), c)
+			} else {
+				err = display.DrawBitmap(int16(x), int16(y), img)
+			}
+			if err != nil {
+				return err
+			}
+		}
+		if x == int(x1) && y == int(y1) {
+			return nil
+		}
+		e2 := 2 * e
+		if e2 >= dy {
+			e += dy
+			x += sx
+		}
+		if e2 <= dx {
+			e += dx
+			y += sy
+		}
+	}
+}
@@ -0,0 +1,161 @@
+package board
+
+import (
+	"strings"
+	"testing"
+
+	"tinygo.org/x/drivers/pixel"
+)
+
+// Return the screen of the test display as text, with one line per row and
+// '#' for every pixel that is not black.
+func testDisplayString(d *testDisplay[pixel.RGB565BE]) string {
+	var s strings.Builder
+	width, height := d.screen.Size()
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			if d.screen.Get(x, y) != pixel.NewRGB565BE(0, 0, 0) {
+				s.WriteByte('#')
+			} else {
+				s.WriteByte('.')
+			}
+		}
+		s.WriteByte('\n')
+	}
+	return s.String()
+}
+
+func TestShapes(t *testing.T) {
+	white := pixel.NewRGB565BE(255, 255, 255)
+	for _, tc := range []struct {
+		name     string
+		draw     func(d Displayer[pixel.RGB565BE]) error
+		expected string
+	}{
+		{"fill", func(d Displayer[pixel.RGB565BE]) error { return FillRect(d, 1, 1, 3, 2, white) }, "" +
+			"......\n" +
+			".###..\n" +
+			".###..\n" +
+			"......\n"},
+		{"fill-clipped", func(d Displayer[pixel.RGB565BE]) error { return FillRect(d, -2, 2, 10, 5, white) }, "" +
+			"......\n" +
+			"......\n" +
+			"######\n" +
+			"######\n"},
+		{"fill-outside", func(d Displayer[pixel.RGB565BE]) error { return FillRect(d, 6, 0, 2, 2, white) }, "" +
+			"......\n" +
+			"......\n" +
+			"......\n" +
+			"......\n"},
+		{"rect", func(d Displayer[pixel.RGB565BE]) error { return DrawRect(d, 0, 0, 4, 4, white) }, "" +
+			"####..\n" +
+			"#..#..\n" +
+			"#..#..\n" +
+			"####..\n"},
+		{"rect-clipped", func(d Displayer[pixel.RGB565BE]) error { return DrawRect(d, 3, -1, 5, 4, white) }, "" +
+			"...#..\n" +
+			"...#..\n" +
+			"...###\n" +
+			"......\n"},
+		{"line-horizontal", func(d Displayer[pixel.RGB565BE]) error { return DrawLine(d, 4, 1, 1, 1, white) }, "" +
+			"......\n" +
+			".####.\n" +
+			"......\n" +
+			"......\n"},
+		{"line-vertical", func(d Displayer[pixel.RGB565BE]) error { return DrawLine(d, 5, -3, 5, 10, white) }, "" +
+			".....#\n" +
+			".....#\n" +
+			".....#\n" +
+			".....#\n"},
+		{"line-diagonal", func(d Displayer[pixel.RGB565BE]) error { return DrawLine(d, 0, 0, 3, 3, white) }, "" +
+			"#.....\n" +
+			".#....\n" +
+			"..#...\n" +
+			"...#..\n"},
+		{"line-shallow", func(d Displayer[pixel.RGB565BE]) error { return DrawLine(d, 5, 3, 0, 1, white) }, "" +
+			"......\n" +
+			"##....\n" +
+			"..##..\n" +
+			"....##\n"},
+		{"line-clipped", func(d Displayer[pixel.RGB565BE]) error { return DrawLine(d, -2, 5, 6, -3, white) }, "" +
+			"...#..\n" +
+			"..#...\n" +
+			".#....\n" +
+			"#.....\n"},
+		{"line-horizontal-long", func(d Displayer[pixel.RGB565BE]) error { return DrawLine(d, 32767, 2, -32768, 2, white) }, "" +
+			"......\n" +
+			"......\n" +
+			"######\n" +
+			"......\n"},
+		{"line-vertical-long", func(d Displayer[pixel.RGB565BE]) error { return DrawLine(d, 1, -32768, 1, 32767, white) }, "" +
+			".#....\n" +
+			".#....\n" +
+			".#....\n" +
+			".#....\n"},
+	} {
+		// The test display returns an error when drawing outside of it, so
+		// this also checks that shapes are clipped correctly.
+		display := newTestDisplay[pixel.RGB565BE](6, 4)
+		if err := tc.draw(display); err != nil {
+			t.Errorf("%s: unexpected error: %v", tc.name, err)
+			continue
+		}
+		if got := testDisplayString(display); got != tc.expected {
+			t.Errorf("%s: unexpected result:\n%s\nexpected:\n%s", tc.name, got, tc.expected)
+		}
+
+		// The same shape drawn using SetPixel must look the same.
+		display = newTestDisplay[pixel.RGB565BE](6, 4)
+		if err := tc.draw(NewBuffered[pixel.RGB565BE](display)); err != nil {
+			t.Errorf("%s: unexpected error using Buffered: %v", tc.name, err)
+			continue
+		}
+		if got := testDisplayString(display); got != tc.expected {
+			t.Errorf("%s: unexpected result using Buffered:\n%s\nexpected:\n%s", tc.name, got, tc.expected)
+		}
+	}
+}
+
+func TestFillRectChunks(t *testing.T) {
+	// Large rectangles are drawn a few lines at a time.
+	display := newTestDisplay[pixel.RGB565BE](300, 10)
+	if err := FillRect[pixel.RGB565BE](display, 0, 0, 300, 10, pixel.NewRGB565BE(255, 255, 255)); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if display.draws != 4 {
+		t.Errorf("expected 4 draws (3 lines at a time), got %d", display.draws)
+	}
+	if c := display.screen.Get(299, 9); c != pixel.NewRGB565BE(255, 255, 255) {
+		t.Errorf("last pixel wasn't filled: %v", c)
+	}
+}
+
+func TestClear(t *testing.T) {
+	white := pixel.NewRGB565BE(255, 255, 255)
+	display := newTestDisplay[pixel.RGB565BE](6, 4)
+	if err := Clear[pixel.RGB565BE](display, white); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got := testDisplayString(display); strings.Contains(got, ".") {
+		t.Errorf("display not filled:\n%s", got)
+	}
+
+	// Displays with their own buffer are cleared directly.
+	clearing := &clearingTestDisplay{testDisplay: display}
+	if err := Clear[pixel.RGB565BE](clearing, pixel.NewRGB565BE(0, 0, 0)); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !clearing.cleared {
+		t.Error("ClearBuffer wasn't used")
+	}
+}
+
+// Test display that can clear its buffer.
+type clearingTestDisplay struct {
+	*testDisplay[pixel.RGB565BE]
+	cleared bool
+}
+
+func (d *clearingTestDisplay) ClearBuffer() {
+	d.cleared = true
+}
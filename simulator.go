@@ -16,18 +16,25 @@ package board
 // around this the simulator is actually run in a separate process by starting
 // the current process again and communicating over pipes (stdin/stdout in the
 // simulator process).
+// Alternatively, the window can be run in the same process on the main
+// goroutine (see SimulatorSettings.RunInProcess), in which case the same
+// protocol is used over in-memory pipes.
 
 import (
 	"bufio"
+	"flag"
 	"fmt"
 	"image"
 	"image/color"
 	"io"
+	"math"
 	"math/rand"
 	"os"
+	"runtime"
 	"strconv"
 	"strings"
 	"sync"
+	"time"
 
 	"fyne.io/fyne/v2"
 	"fyne.io/fyne/v2/app"
@@ -36,6 +43,7 @@ import (
 	"fyne.io/fyne/v2/driver/desktop"
 	"fyne.io/fyne/v2/layout"
 	"fyne.io/fyne/v2/widget"
+	"github.com/go-gl/glfw/v3.3/glfw"
 	"golang.org/x/image/draw"
 )
 
@@ -46,11 +54,19 @@ func init() {
 		// This is the simulator process.
 		// Run the entire window in an init function, because that's the only
 		// way to do this with the API that is exposed by the board package.
-		windowMain()
+		windowMain(os.Args[2:])
 		os.Exit(0)
 	}
 }
 
+// Where the window reads commands from and writes input events to. These are
+// stdin and stdout in the window process, or in-memory pipes when the window
+// runs in the same process as the app.
+var (
+	windowInput  io.Reader = os.Stdin
+	windowOutput io.Writer = os.Stdout
+)
+
 var (
 	displayImageLock         sync.Mutex
 	displayImage             *image.RGBA
@@ -59,18 +75,89 @@ var (
 	displayScrollLine        int
 	displayMaxBrightness     = 1
 	displayBrightness        = 0
+	displaySleeping          bool
+	displayMask              CircleMask
+	displayOutline           DisplayOutline
+	displaySwapRedBlue       bool
+	displayColorDepth        int
+
+	secondaryLock     sync.Mutex
+	secondaryImage    *image.RGBA
+	secondarySleeping bool
 
 	ledsLock   sync.Mutex
 	leds       []color.RGBA
 	ledsPerRow = 6
 )
 
-// The main function for the window process.
-func windowMain() {
+// Reduce the color to the given color depth (see
+// SimulatorSettings.WindowColorDepth), to show what it would look like on a
+// display with that color depth. Like display controllers do when converting
+// to 24-bit color internally, the lowest bits of each channel are filled with
+// copies of the highest bits, so that white stays white.
+func reduceColorDepth(c color.RGBA, depth int) color.RGBA {
+	var rbits, gbits, bbits uint
+	switch depth {
+	case 12:
+		rbits, gbits, bbits = 4, 4, 4
+	case 16:
+		rbits, gbits, bbits = 5, 6, 5
+	case 18:
+		rbits, gbits, bbits = 6, 6, 6
+	default:
+		return c
+	}
+	reduce := func(value uint8, bits uint) uint8 {
+		value &^= 0xff >> bits
+		return value | value>>bits
+	}
+	return color.RGBA{
+		R: reduce(c.R, rbits),
+		G: reduce(c.G, gbits),
+		B: reduce(c.B, bbits),
+		A: c.A,
+	}
+}
+
+// Scale of the secondary display in the window. These displays are usually
+// small, so they're shown at twice their size.
+const secondaryScale = 2
+
+// The main function for the window process. It must run on the main goroutine.
+// The arguments are the ones returned by windowArgs.
+func windowMain(args []string) {
+	flags := flag.NewFlagSet(runWindowCommand, flag.ExitOnError)
+	position := flags.String("position", "", "initial window position as x,y")
+	onTop := flags.Bool("on-top", false, "keep the window above other windows")
+	flags.Parse(args)
+
+	// Fyne (as of v2.3) has no API to position a window, and GLFW 3.3 has no
+	// window hint for it either. But while the window is drawn, its GL context
+	// is current, so the GLFW window can be moved the first time the display
+	// is drawn. This depends on Fyne using its GLFW driver, like the Floating
+	// hint below. Fyne draws on a separate thread except on Apple Silicon.
+	// X11 and Windows allow moving a window from there, but macOS only allows
+	// it from the main thread, so the position is ignored on Intel Macs.
+	var moveWindow func()
+	if *position != "" && !(runtime.GOOS == "darwin" && runtime.GOARCH != "arm64") {
+		var x, y int
+		fmt.Sscanf(*position, "%d,%d", &x, &y)
+		moveWindow = func() {
+			if view := glfw.GetCurrentContext(); view != nil {
+				view.SetPos(x, y)
+			}
+		}
+	}
+
 	// Create a raster image to use as a display buffer.
 	displayImage = image.NewRGBA(image.Rect(0, 0, 240, 240))
 	display := &displayWidget{}
 	display.Generator = func(w, h int) image.Image {
+		if moveWindow != nil {
+			// Only called from the draw thread, so no lock is needed.
+			moveWindow()
+			moveWindow = nil
+		}
 		displayImageLock.Lock()
 		defer displayImageLock.Unlock()
 		img := image.NewRGBA(image.Rect(0, 0, w, h))
@@ -87,12 +174,13 @@ func windowMain() {
 		x := (w - width) / 2
 		y := (h - height) / 2
 		displayRect := image.Rect(x, y, x+width, y+height)
-		if displayBrightness <= 0 {
-			// The backlight is off, so indicate this by making the screen gray.
+		if displaySleeping {
+			// The display controller is asleep, so there is nothing to show.
+			// Make it a darker gray than when only the backlight is off.
 			draw.Draw(img, displayRect, image.NewUniform(color.RGBA{
-				R: 96,
-				G: 96,
-				B: 96,
+				R: 48,
+				G: 48,
+				B: 48,
 				A: 255,
 			}), image.Pt(0, 0), draw.Src)
 		} else {
@@ -114,10 +202,68 @@ func windowMain() {
 				draw.Copy(scrolledImage, image.Pt(0, rect.Dy()-bottomH), displayImage, image.Rect(0, rect.Dy()-bottomH, rect.Dx(), bottomH), draw.Over, nil) // bottom fixed area
 			}
 			draw.NearestNeighbor.Scale(img, displayRect, scrolledImage, scrolledImage.Bounds(), draw.Src, nil)
+			if displayBrightness <= 0 {
+				// The backlight is off, so indicate this by making the screen
+				// gray. The image is still faintly visible, to make it clear
+				// that the display itself is still on.
+				draw.Draw(img, displayRect, image.NewUniform(color.RGBA{
+					R: 84, // 96 * 224 / 255 (premultiplied alpha)
+					G: 84,
+					B: 84,
+					A: 224,
+				}), image.Pt(0, 0), draw.Over)
+			} else if displayBrightness < displayMaxBrightness {
+				// Dim the display, by drawing a partially transparent black
+				// layer over it.
+				alpha := 255 - 255*displayBrightness/displayMaxBrightness
+				draw.Draw(img, displayRect, image.NewUniform(color.RGBA{A: uint8(alpha)}), image.Pt(0, 0), draw.Over)
+			}
+			if displayMask.Radius > 0 || displayOutline != (DisplayOutline{}) {
+				// Preview a round or otherwise non-rectangular display, by
+				// darkening the pixels that wouldn't be visible. This is done
+				// per run of invisible pixels on each line.
+				dark := image.NewUniform(color.RGBA{A: 192})
+				visible := func(px, py int) bool {
+					return displayMask.Contains(px, py) && displayOutline.Contains(px, py, rect.Dx(), rect.Dy())
+				}
+				for row := 0; row < rect.Dy(); row++ {
+					y0 := y + row*scale
+					for col := 0; col < rect.Dx(); {
+						if visible(col, row) {
+							col++
+							continue
+						}
+						start := col
+						for col < rect.Dx() && !visible(col, row) {
+							col++
+						}
+						draw.Draw(img, image.Rect(x+start*scale, y0, x+col*scale, y0+scale), dark, image.Pt(0, 0), draw.Over)
+					}
+				}
+			}
 		}
 		return img
 	}
 
+	// Create the secondary display, hidden until it is configured.
+	secondaryWidget := canvas.NewRaster(func(w, h int) image.Image {
+		secondaryLock.Lock()
+		defer secondaryLock.Unlock()
+		img := image.NewRGBA(image.Rect(0, 0, w, h))
+		if secondaryImage == nil || secondarySleeping {
+			// Nothing to show, the display stays black.
+			draw.Draw(img, img.Rect, image.NewUniform(color.RGBA{A: 255}), image.Pt(0, 0), draw.Src)
+			return img
+		}
+		rect := secondaryImage.Bounds()
+		scale := h / rect.Dy()
+		x := (w - rect.Dx()*scale) / 2
+		y := (h - rect.Dy()*scale) / 2
+		draw.NearestNeighbor.Scale(img, image.Rect(x, y, x+rect.Dx()*scale, y+rect.Dy()*scale), secondaryImage, rect, draw.Src, nil)
+		return img
+	})
+	secondaryWidget.Hidden = true
+
 	// Create LEDs.
 	ledsWidget := canvas.NewRaster(func(w, h int) image.Image {
 		ledsLock.Lock()
@@ -154,8 +300,10 @@ func windowMain() {
 	accelContainer := container.New(layout.NewHBoxLayout(),
 		widget.NewLabel(strconv.FormatFloat(accelX, 'f', 2, 64)),
 		widget.NewLabel(strconv.FormatFloat(accelY, 'f', 2, 64)),
-		widget.NewLabel(strconv.FormatFloat(accelZ, 'f', 2, 64)))
-	fmt.Printf("accel %f %f %f\n", accelX, accelY, accelZ)
+		widget.NewLabel(strconv.FormatFloat(accelZ, 'f', 2, 64)),
+		layout.NewSpacer(),
+		widget.NewButton("Shake", func() { fmt.Fprintf(windowOutput, "shake\n") }))
+	fmt.Fprintf(windowOutput, "accel %f %f %f\n", accelX, accelY, accelZ)
 
 	// Step count.
 	var stepCount uint32
@@ -163,47 +311,256 @@ func windowMain() {
 	stepCountIncrementButton := widget.NewButton("+", func() {
 		stepCount++
 		stepCountWidget.SetText(strconv.FormatUint(uint64(stepCount), 10))
-		fmt.Printf("steps %d\n", stepCount)
+		fmt.Fprintf(windowOutput, "steps %d\n", stepCount)
 	})
 	stepCountContainer := container.New(layout.NewHBoxLayout(), stepCountWidget, layout.NewSpacer(), stepCountIncrementButton)
 
+	// Ambient light level, in the range 0-1000.
+	lightLevel := 300
+	lightWidget := widget.NewLabel("300")
+	changeLightLevel := func(delta int) {
+		lightLevel += delta
+		if lightLevel < 0 {
+			lightLevel = 0
+		} else if lightLevel > 1000 {
+			lightLevel = 1000
+		}
+		lightWidget.SetText(strconv.Itoa(lightLevel))
+		fmt.Fprintf(windowOutput, "light %d\n", lightLevel)
+	}
+	lightContainer := container.New(layout.NewHBoxLayout(),
+		lightWidget,
+		layout.NewSpacer(),
+		widget.NewButton("-", func() { changeLightLevel(-50) }),
+		widget.NewButton("+", func() { changeLightLevel(50) }))
+
+	// Proximity sensor, which is either covered (the maximum value of 255) or
+	// not (0).
+	proximityWidget := widget.NewCheck("Covered", func(covered bool) {
+		proximity := 0
+		if covered {
+			proximity = 255
+		}
+		fmt.Fprintf(windowOutput, "proximity %d\n", proximity)
+	})
+
+	// Gyroscope, which either rotates the device around the Z axis like a
+	// steering wheel (counter-clockwise at 90°/s) or doesn't rotate.
+	gyroWidget := widget.NewCheck("Rotate", func(rotating bool) {
+		speed := 0
+		if rotating {
+			speed = 90
+		}
+		fmt.Fprintf(windowOutput, "gyro 0 0 %d\n", speed)
+	})
+
+	// Magnetometer. The device is upright (see the acceleration above) and
+	// can be turned to the right in steps of 45°. The magnetic field is the
+	// field of the Earth in Europe: around 20µT to the north, and 40µT down.
+	heading := 0
+	headings := []string{"N", "NE", "E", "SE", "S", "SW", "W", "NW"}
+	headingWidget := widget.NewLabel("N")
+	magneticContainer := container.New(layout.NewHBoxLayout(),
+		headingWidget,
+		layout.NewSpacer(),
+		widget.NewButton("Turn", func() {
+			heading = (heading + 45) % 360
+			headingWidget.SetText(headings[heading/45])
+			// North is in front of the device (-Z) when facing north, and to
+			// the left (-X) when facing east.
+			angle := float64(heading) * math.Pi / 180
+			fmt.Fprintf(windowOutput, "magnetic %f %f %f\n", -20*math.Sin(angle), -40.0, -20*math.Cos(angle))
+		}))
+
+	// Temperature, in whole degrees Celsius.
+	temperature := 20
+	temperatureWidget := widget.NewLabel("20°C")
+	changeTemperature := func(delta int) {
+		temperature += delta
+		temperatureWidget.SetText(strconv.Itoa(temperature) + "°C")
+		fmt.Fprintf(windowOutput, "temperature %d\n", temperature*1000)
+	}
+	temperatureContainer := container.New(layout.NewHBoxLayout(),
+		temperatureWidget,
+		layout.NewSpacer(),
+		widget.NewButton("-", func() { changeTemperature(-1) }),
+		widget.NewButton("+", func() { changeTemperature(1) }))
+
+	// Air pressure, in hPa. The default is the standard pressure at sea
+	// level.
+	pressure := 1013
+	pressureWidget := widget.NewLabel("1013hPa")
+	changePressure := func(delta int) {
+		pressure += delta
+		pressureWidget.SetText(strconv.Itoa(pressure) + "hPa")
+		fmt.Fprintf(windowOutput, "pressure %d\n", pressure*100_000)
+	}
+	pressureContainer := container.New(layout.NewHBoxLayout(),
+		pressureWidget,
+		layout.NewSpacer(),
+		widget.NewButton("-", func() { changePressure(-10) }),
+		widget.NewButton("+", func() { changePressure(10) }))
+
+	// Relative humidity, in whole percents.
+	humidity := 50
+	humidityWidget := widget.NewLabel("50%")
+	changeHumidity := func(delta int) {
+		humidity += delta
+		if humidity < 0 {
+			humidity = 0
+		} else if humidity > 100 {
+			humidity = 100
+		}
+		humidityWidget.SetText(strconv.Itoa(humidity) + "%")
+		fmt.Fprintf(windowOutput, "humidity %d\n", humidity*100)
+	}
+	humidityContainer := container.New(layout.NewHBoxLayout(),
+		humidityWidget,
+		layout.NewSpacer(),
+		widget.NewButton("-", func() { changeHumidity(-5) }),
+		widget.NewButton("+", func() { changeHumidity(5) }))
+
+	// Battery temperature, in whole degrees Celsius.
+	batteryTemperature := 25
+	batteryTemperatureWidget := widget.NewLabel("25°C")
+	changeBatteryTemperature := func(delta int) {
+		batteryTemperature += delta
+		batteryTemperatureWidget.SetText(strconv.Itoa(batteryTemperature) + "°C")
+		fmt.Fprintf(windowOutput, "battery-temperature %d\n", batteryTemperature*1000)
+	}
+	batteryTemperatureContainer := container.New(layout.NewHBoxLayout(),
+		batteryTemperatureWidget,
+		layout.NewSpacer(),
+		widget.NewButton("-", func() { changeBatteryTemperature(-5) }),
+		widget.NewButton("+", func() { changeBatteryTemperature(5) }))
+
+	// Debug controls to pause the app (see Simulator.Pause).
+	debugContainer := container.New(layout.NewHBoxLayout(),
+		widget.NewButton("Pause", func() { fmt.Fprintf(windowOutput, "pause\n") }),
+		widget.NewButton("Step", func() { fmt.Fprintf(windowOutput, "step\n") }),
+		widget.NewButton("Resume", func() { fmt.Fprintf(windowOutput, "resume\n") }))
+
+	// Status LED, hidden until it is configured.
+	statusLED := canvas.NewCircle(color.RGBA{A: 255})
+	statusLED.StrokeColor = color.RGBA{R: 96, G: 96, B: 96, A: 255}
+	statusLED.StrokeWidth = 1
+	statusLEDLabel := widget.NewLabel("Status LED:")
+	statusLEDContainer := container.New(layout.NewHBoxLayout(), container.New(layout.NewGridWrapLayout(fyne.NewSize(16, 16)), statusLED))
+	statusLEDLabel.Hide()
+	statusLEDContainer.Hide()
+
+	// Vibration motor and speaker output, which show what they're doing while
+	// active.
+	vibrationWidget := widget.NewLabel("")
+	speakerWidget := widget.NewLabel("")
+
 	paramGrid := container.New(layout.NewGridLayout(2),
 		widget.NewLabel("Accel X/Y/Z:"), accelContainer,
-		widget.NewLabel("Steps:"), stepCountContainer)
+		widget.NewLabel("Steps:"), stepCountContainer,
+		widget.NewLabel("Light:"), lightContainer,
+		widget.NewLabel("Proximity:"), proximityWidget,
+		widget.NewLabel("Gyroscope:"), gyroWidget,
+		widget.NewLabel("Compass:"), magneticContainer,
+		widget.NewLabel("Temperature:"), temperatureContainer,
+		widget.NewLabel("Pressure:"), pressureContainer,
+		widget.NewLabel("Humidity:"), humidityContainer,
+		widget.NewLabel("Battery:"), batteryTemperatureContainer,
+		widget.NewLabel("Vibration:"), vibrationWidget,
+		widget.NewLabel("Speaker:"), speakerWidget,
+		widget.NewLabel("Debug:"), debugContainer,
+		statusLEDLabel, statusLEDContainer)
 
 	// Create a window.
 	a := app.New()
 	w := a.NewWindow("Simulator")
 	w.SetPadded(false)
 	w.SetFixedSize(true)
-	w.SetContent(fyne.NewContainerWithLayout(layout.NewVBoxLayout(), display, ledsWidget, paramGrid))
+	w.SetContent(fyne.NewContainerWithLayout(layout.NewVBoxLayout(), display, secondaryWidget, ledsWidget, paramGrid))
+
+	// Fyne (as of v2.3) has no API to keep a window on top, so set the GLFW
+	// window hint directly. This depends on Fyne using its GLFW driver (which
+	// it does on desktop systems): with another driver, the hint is ignored.
+	if *onTop {
+		// GLFW was initialized when creating the window above, but the
+		// actual window is only created in ShowAndRun so the hint still
+		// applies.
+		glfw.WindowHint(glfw.Floating, glfw.True)
+	}
 
 	// Listen for keyboard events, and translate them to board API keycodes.
 	if deskCanvas, ok := w.Canvas().(desktop.Canvas); ok {
 		deskCanvas.SetOnKeyDown(func(event *fyne.KeyEvent) {
+			// Some keys turn the rotary encoder, like the mouse wheel.
+			switch event.Name {
+			case fyne.KeyMinus, fyne.KeyPageUp:
+				fmt.Fprintf(windowOutput, "wheel -1\n")
+				return
+			case fyne.KeyEqual, fyne.KeyPlus, fyne.KeyPageDown:
+				fmt.Fprintf(windowOutput, "wheel 1\n")
+				return
+			}
 			key := decodeFyneKey(event.Name)
 			if key != NoKey {
-				fmt.Printf("keypress %d\n", key)
+				fmt.Fprintf(windowOutput, "keypress %d\n", key)
 			}
 		})
 		deskCanvas.SetOnKeyUp(func(event *fyne.KeyEvent) {
 			key := decodeFyneKey(event.Name)
 			if key != NoKey {
-				fmt.Printf("keyrelease %d\n", key)
+				fmt.Fprintf(windowOutput, "keyrelease %d\n", key)
 			}
 		})
 	}
 
 	// Listen for events from the parent process (which includes display data).
-	go windowReceiveEvents(w, display, ledsWidget)
+	go windowReceiveEvents(w, display, secondaryWidget, ledsWidget, func(c color.RGBA) {
+		statusLEDLabel.Show()
+		statusLEDContainer.Show()
+		statusLED.FillColor = c
+		statusLED.Refresh()
+	}, func(output string, text string, duration time.Duration) {
+		label := vibrationWidget
+		if output == "speaker" {
+			label = speakerWidget
+		}
+		showOutput(label, text, duration)
+	})
 
 	// Show the window.
 	w.ShowAndRun()
 }
 
+// Number of times showOutput changed each label, so that a timer only clears
+// the text it was started for and not a newer text.
+var (
+	outputLock        sync.Mutex
+	outputGenerations = make(map[*widget.Label]uint64)
+)
+
+// Show some text in the given label for the given duration. A zero duration
+// clears the label, for example when a vibration pattern is stopped.
+func showOutput(label *widget.Label, text string, duration time.Duration) {
+	outputLock.Lock()
+	defer outputLock.Unlock()
+	outputGenerations[label]++
+	if duration <= 0 {
+		label.SetText("")
+		return
+	}
+	label.SetText(text)
+	generation := outputGenerations[label]
+	time.AfterFunc(duration, func() {
+		outputLock.Lock()
+		defer outputLock.Unlock()
+		if outputGenerations[label] == generation {
+			label.SetText("")
+		}
+	})
+}
+
 // Goroutine that listens for commands from the parent process.
-func windowReceiveEvents(w fyne.Window, display *displayWidget, ledsWidget *canvas.Raster) {
-	r := bufio.NewReader(os.Stdin)
+func windowReceiveEvents(w fyne.Window, display *displayWidget, secondaryWidget, ledsWidget *canvas.Raster, setStatusLED func(color.RGBA), setOutput func(output, text string, duration time.Duration)) {
+	r := bufio.NewReader(windowInput)
 	for {
 		line, err := r.ReadString('\n')
 		if err != nil {
@@ -237,9 +594,36 @@ func windowReceiveEvents(w fyne.Window, display *displayWidget, ledsWidget *canv
 			displayImageLock.Unlock()
 		case "display-brightness":
 			displayImageLock.Lock()
-			fmt.Sscanf(line, "%s %d %d\n", &cmd, &displayBrightness, displayMaxBrightness)
+			fmt.Sscanf(line, "%s %d %d\n", &cmd, &displayBrightness, &displayMaxBrightness)
 			displayImageLock.Unlock()
 			display.Refresh()
+		case "sleep":
+			var sleeping int
+			fmt.Sscanf(line, "%s %d\n", &cmd, &sleeping)
+			displayImageLock.Lock()
+			displaySleeping = sleeping != 0
+			displayImageLock.Unlock()
+			display.Refresh()
+		case "display-mask":
+			displayImageLock.Lock()
+			fmt.Sscanf(line, "%s %d %d %d\n", &cmd, &displayMask.X, &displayMask.Y, &displayMask.Radius)
+			displayImageLock.Unlock()
+			display.Refresh()
+		case "display-outline":
+			displayImageLock.Lock()
+			fmt.Sscanf(line, "%s %d %d %d\n", &cmd, &displayOutline.CornerRadius, &displayOutline.NotchWidth, &displayOutline.NotchHeight)
+			displayImageLock.Unlock()
+			display.Refresh()
+		case "display-swap-rb":
+			var swap int
+			fmt.Sscanf(line, "%s %d\n", &cmd, &swap)
+			displayImageLock.Lock()
+			displaySwapRedBlue = swap != 0
+			displayImageLock.Unlock()
+		case "display-depth":
+			displayImageLock.Lock()
+			fmt.Sscanf(line, "%s %d\n", &cmd, &displayColorDepth)
+			displayImageLock.Unlock()
 		case "title":
 			w.SetTitle(strings.TrimSpace(line[len("title"):]))
 		case "draw":
@@ -252,15 +636,55 @@ func windowReceiveEvents(w fyne.Window, display *displayWidget, ledsWidget *canv
 			// Draw the image data to the image buffer.
 			displayImageLock.Lock()
 			for x := 0; x < width; x++ {
-				displayImage.SetRGBA(startX+x, startY, color.RGBA{
+				c := color.RGBA{
 					R: buf[x*3+0],
 					G: buf[x*3+1],
 					B: buf[x*3+2],
 					A: 255,
-				})
+				}
+				if displaySwapRedBlue {
+					// Show what a panel with a different color order
+					// looks like.
+					c.R, c.B = c.B, c.R
+				}
+				displayImage.SetRGBA(startX+x, startY, reduceColorDepth(c, displayColorDepth))
 			}
 			displayImageLock.Unlock()
 			display.Refresh()
+		case "secondary-display":
+			var width, height int
+			fmt.Sscanf(line, "%s %d %d\n", &cmd, &width, &height)
+			secondaryLock.Lock()
+			secondaryImage = image.NewRGBA(image.Rect(0, 0, width, height))
+			draw.Draw(secondaryImage, secondaryImage.Rect, image.NewUniform(color.RGBA{A: 255}), image.Pt(0, 0), draw.Src)
+			secondaryLock.Unlock()
+			secondaryWidget.SetMinSize(fyne.NewSize(float32(width*secondaryScale), float32(height*secondaryScale)))
+			secondaryWidget.Show()
+		case "secondary-draw":
+			// Read the image data, one byte per pixel.
+			var startX, startY, width int
+			fmt.Sscanf(line, "%s %d %d %d\n", &cmd, &startX, &startY, &width)
+			buf := make([]byte, width)
+			io.ReadFull(r, buf)
+
+			secondaryLock.Lock()
+			for x, on := range buf {
+				// Pixels that are on are white, like on many OLED displays.
+				c := color.RGBA{A: 255}
+				if on != 0 {
+					c = color.RGBA{R: 255, G: 255, B: 255, A: 255}
+				}
+				secondaryImage.SetRGBA(startX+x, startY, c)
+			}
+			secondaryLock.Unlock()
+			secondaryWidget.Refresh()
+		case "secondary-sleep":
+			var sleeping int
+			fmt.Sscanf(line, "%s %d\n", &cmd, &sleeping)
+			secondaryLock.Lock()
+			secondarySleeping = sleeping != 0
+			secondaryLock.Unlock()
+			secondaryWidget.Refresh()
 		case "scroll-start":
 			displayImageLock.Lock()
 			fmt.Sscanf(line, "%s %d %d\n", &cmd, &displayScrollTopFixed, &displayScrollBottomFixed)
@@ -299,6 +723,9 @@ func windowReceiveEvents(w fyne.Window, display *displayWidget, ledsWidget *canv
 				ledsWidget.SetMinSize(fyne.NewSize(float32(cols*32+8), float32(rows*32)))
 				ledsWidget.Show()
 			}
+			// The LED values are linear, so they need to be gamma encoded
+			// to look right on the screen. This must be done last, after
+			// the brightness was applied (see LEDArray).
 			for i := range leds {
 				leds[len(leds)-i-1] = color.RGBA{
 					R: gammaEncodeTable[buf[i*3+0]],
@@ -309,6 +736,28 @@ func windowReceiveEvents(w fyne.Window, display *displayWidget, ledsWidget *canv
 			}
 			ledsLock.Unlock()
 			ledsWidget.Refresh()
+		case "vibrate":
+			var ms int
+			fmt.Sscanf(line, "%s %d\n", &cmd, &ms)
+			setOutput("vibration", "bzzz", time.Duration(ms)*time.Millisecond)
+		case "tone":
+			var frequency, ms int
+			fmt.Sscanf(line, "%s %d %d\n", &cmd, &frequency, &ms)
+			setOutput("speaker", fmt.Sprintf("%dHz", frequency), time.Duration(ms)*time.Millisecond)
+		case "note":
+			var note uint8
+			var frequency, ms int
+			fmt.Sscanf(line, "%s %d %d %d\n", &cmd, &note, &frequency, &ms)
+			setOutput("speaker", fmt.Sprintf("%s (%dHz)", noteName(note), frequency), time.Duration(ms)*time.Millisecond)
+		case "status-led":
+			var r, g, b uint8
+			fmt.Sscanf(line, "%s %d %d %d\n", &cmd, &r, &g, &b)
+			setStatusLED(color.RGBA{
+				R: gammaEncodeTable[r],
+				G: gammaEncodeTable[g],
+				B: gammaEncodeTable[b],
+				A: 255,
+			})
 		default:
 			fmt.Fprintln(os.Stderr, "unknown command:", cmd)
 		}
@@ -336,6 +785,56 @@ func decodeFyneKey(key fyne.KeyName) KeyEvent {
 		e = KeyA
 	case fyne.KeyB:
 		e = KeyB
+	case fyne.KeyF1:
+		e = KeyF1
+	case fyne.KeyF2:
+		e = KeyF2
+	case fyne.KeyF3:
+		e = KeyF3
+	case fyne.KeyF4:
+		e = KeyF4
+	case fyne.KeyF5:
+		e = KeyF5
+	case fyne.KeyF6:
+		e = KeyF6
+	case fyne.KeyF7:
+		e = KeyF7
+	case fyne.KeyF8:
+		e = KeyF8
+	case fyne.KeyF9:
+		e = KeyF9
+	case fyne.KeyF10:
+		e = KeyF10
+	case fyne.KeyF11:
+		e = KeyF11
+	case fyne.KeyF12:
+		e = KeyF12
+	case fyne.Key0:
+		e = Key0
+	case fyne.Key1:
+		e = Key1
+	case fyne.Key2:
+		e = Key2
+	case fyne.Key3:
+		e = Key3
+	case fyne.Key4:
+		e = Key4
+	case fyne.Key5:
+		e = Key5
+	case fyne.Key6:
+		e = Key6
+	case fyne.Key7:
+		e = Key7
+	case fyne.Key8:
+		e = Key8
+	case fyne.Key9:
+		e = Key9
+	case fyne.KeyTab:
+		e = KeyTab
+	case fyne.KeyBackspace:
+		e = KeyBackspace
+	case fyne.KeyDelete:
+		e = KeyDelete
 	default:
 		return NoKeyEvent
 	}
@@ -344,30 +843,54 @@ func decodeFyneKey(key fyne.KeyName) KeyEvent {
 
 var _ desktop.Mouseable = (*displayWidget)(nil)
 var _ fyne.Draggable = (*displayWidget)(nil)
+var _ fyne.Scrollable = (*displayWidget)(nil)
 
 // Wrapper for canvas.Render that sends mouse events to the parent process.
 type displayWidget struct {
 	canvas.Raster
+
+	// Scroll amount that didn't add up to a full encoder step yet.
+	wheel float32
 }
 
+// Amount of scrolling that turns the rotary encoder by one step. Fyne reports
+// 10 units for one notch of a regular mouse wheel.
+const wheelStepSize = 10
+
 func (r *displayWidget) CreateRenderer() fyne.WidgetRenderer {
 	return widget.NewSimpleRenderer(&r.Raster)
 }
 
 func (r *displayWidget) MouseDown(event *desktop.MouseEvent) {
-	if event.Button == desktop.MouseButtonPrimary {
-		fmt.Printf("mousedown %d %d\n", int(event.Position.X), int(event.Position.Y))
+	switch event.Button {
+	case desktop.MouseButtonPrimary:
+		fmt.Fprintf(windowOutput, "mousedown %d %d\n", int(event.Position.X), int(event.Position.Y))
+	case desktop.MouseButtonTertiary:
+		fmt.Fprintf(windowOutput, "encoder-press\n")
 	}
 }
 
 func (r *displayWidget) MouseUp(event *desktop.MouseEvent) {
-	if event.Button == desktop.MouseButtonPrimary {
-		fmt.Printf("mouseup\n")
+	switch event.Button {
+	case desktop.MouseButtonPrimary:
+		fmt.Fprintf(windowOutput, "mouseup\n")
+	case desktop.MouseButtonTertiary:
+		fmt.Fprintf(windowOutput, "encoder-release\n")
+	}
+}
+
+// Turn the rotary encoder by scrolling, see simulatedEncoder. Scrolling down
+// (a negative DY) turns it clockwise.
+func (r *displayWidget) Scrolled(event *fyne.ScrollEvent) {
+	r.wheel -= event.Scrolled.DY
+	if steps := int(r.wheel / wheelStepSize); steps != 0 {
+		r.wheel -= float32(steps) * wheelStepSize
+		fmt.Fprintf(windowOutput, "wheel %d\n", steps)
 	}
 }
 
 func (r *displayWidget) Dragged(event *fyne.DragEvent) {
-	fmt.Printf("mousemove %d %d\n", int(event.PointEvent.Position.X), int(event.PointEvent.Position.Y))
+	fmt.Fprintf(windowOutput, "mousemove %d %d\n", int(event.PointEvent.Position.X), int(event.PointEvent.Position.Y))
 }
 
 func (r *displayWidget) DragEnd() {
@@ -0,0 +1,122 @@
+package board
+
+import (
+	"strconv"
+	"sync"
+	"time"
+)
+
+// This file contains helpers to play simple melodies on the Speaker.
+
+// Note is a single note in a melody, to be played with Speaker.PlaySequence.
+type Note struct {
+	// MIDI note number, where 60 is middle C (C4) and 69 is A4 (440Hz). The
+	// value 0 is a rest: nothing is played for the duration of the note.
+	Note uint8
+
+	// How long the note is played.
+	Duration time.Duration
+}
+
+// Frequencies of the notes in the 4th octave (MIDI notes 60-71), in
+// centihertz.
+var noteFrequencies = [12]uint32{
+	26163, // C4
+	27718, // C#4
+	29366, // D4
+	31113, // D#4
+	32963, // E4
+	34923, // F4
+	36999, // F#4
+	39200, // G4
+	41530, // G#4
+	44000, // A4
+	46616, // A#4
+	49388, // B4
+}
+
+// NoteFrequency returns the frequency in Hz of the given MIDI note number,
+// rounded to the nearest integer. For example, it returns 440 for A4 (note 69).
+func NoteFrequency(note uint8) uint32 {
+	frequency := noteFrequencies[note%12]
+	octave := int(note/12) - 5 // relative to the 4th octave
+	if octave >= 0 {
+		frequency <<= uint(octave)
+	} else {
+		frequency >>= uint(-octave)
+	}
+	return (frequency + 50) / 100
+}
+
+// Name of the given MIDI note, like "A4" or "C#5".
+func noteName(note uint8) string {
+	const names = "C C#D D#E F F#G G#A A#B "
+	name := names[note%12*2 : note%12*2+2]
+	if name[1] == ' ' {
+		name = name[:1]
+	}
+	octave := int(note/12) - 1
+	return name + strconv.Itoa(octave)
+}
+
+// Play the given note using the Tone method of the speaker.
+func playNote(speaker interface {
+	Tone(frequency uint32, duration time.Duration)
+}, note uint8, duration time.Duration) {
+	if note == 0 {
+		time.Sleep(duration)
+		return
+	}
+	speaker.Tone(NoteFrequency(note), duration)
+}
+
+// Play all the notes in a sequence using the PlayNote method of the speaker.
+func playSequence(speaker interface {
+	PlayNote(note uint8, duration time.Duration)
+}, notes []Note) {
+	for _, note := range notes {
+		speaker.PlayNote(note.Note, note.Duration)
+	}
+}
+
+// Plays tones in the background. Only one tone can be played at a time: a new
+// tone cuts off the tone that is currently playing.
+type tonePlayer struct {
+	lock       sync.Mutex
+	generation uint32
+	done       chan struct{}
+}
+
+// Start playing a tone by calling start, and call stop after the given
+// duration unless another tone was started in the meantime. The stop function
+// should silence the speaker and disable the amplifier, if there is one.
+//
+// The returned channel is closed when the tone has finished playing, or when
+// it was cut off by a new tone.
+func (p *tonePlayer) play(duration time.Duration, start, stop func()) <-chan struct{} {
+	p.lock.Lock()
+	if p.done != nil {
+		// Cut off the current tone.
+		close(p.done)
+	}
+	p.generation++
+	generation := p.generation
+	done := make(chan struct{})
+	p.done = done
+	start()
+	p.lock.Unlock()
+
+	go func() {
+		time.Sleep(duration)
+		p.lock.Lock()
+		defer p.lock.Unlock()
+		if p.generation != generation {
+			// Cut off by a new tone, which also closed the channel.
+			return
+		}
+		stop()
+		close(done)
+		p.done = nil
+	}()
+	return done
+}
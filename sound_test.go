@@ -0,0 +1,70 @@
+package board
+
+import (
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestNoteFrequency(t *testing.T) {
+	for _, tc := range []struct {
+		note      uint8
+		name      string
+		frequency uint32
+	}{
+		{0, "C-1", 8},
+		{21, "A0", 28}, // lowest note on a piano (27.5Hz)
+		{57, "A3", 220},
+		{60, "C4", 262}, // middle C
+		{61, "C#4", 277},
+		{69, "A4", 440},
+		{81, "A5", 880},
+		{108, "C8", 4186}, // highest note on a piano
+		{120, "C9", 8372},
+		{127, "G9", 12544},
+	} {
+		if frequency := NoteFrequency(tc.note); frequency != tc.frequency {
+			t.Errorf("NoteFrequency(%d): expected %dHz, got %dHz", tc.note, tc.frequency, frequency)
+		}
+		if name := noteName(tc.note); name != tc.name {
+			t.Errorf("noteName(%d): expected %q, got %q", tc.note, tc.name, name)
+		}
+	}
+}
+
+func TestTonePlayer(t *testing.T) {
+	var player tonePlayer
+	var lock sync.Mutex
+	var started, stopped int
+	start := func() {
+		lock.Lock()
+		started++
+		lock.Unlock()
+	}
+	stop := func() {
+		lock.Lock()
+		stopped++
+		lock.Unlock()
+	}
+
+	// A new tone cuts off the current one, closing its channel right away.
+	first := player.play(time.Second, start, stop)
+	second := player.play(10*time.Millisecond, start, stop)
+	select {
+	case <-first:
+	default:
+		t.Error("first tone was not cut off")
+	}
+
+	// The second tone finishes normally, and only then the speaker is stopped.
+	select {
+	case <-second:
+	case <-time.After(time.Second):
+		t.Fatal("second tone did not finish")
+	}
+	lock.Lock()
+	defer lock.Unlock()
+	if started != 2 || stopped != 1 {
+		t.Errorf("expected 2 starts and 1 stop, got %d and %d", started, stopped)
+	}
+}
@@ -0,0 +1,81 @@
+package board
+
+import "strconv"
+
+// This file contains helper functions to work with temperatures as returned by
+// Sensors.Temperature and Power.BatteryTemperature. They are pure functions, so
+// they work on every board (and in tests).
+//
+// Temperatures are always in milli-degrees Celsius: 20000 means 20°C, and
+// -5500 means -5.5°C. The simulator returns around 20000 by default.
+
+// CelsiusToFahrenheit converts a temperature in milli-degrees Celsius to
+// milli-degrees Fahrenheit. For example, 0 (0°C) becomes 32000 (32°F). The
+// result is rounded towards zero.
+func CelsiusToFahrenheit(milliCelsius int32) int32 {
+	// Add the offset before dividing, so that the whole result (and not just
+	// the scaled part) is rounded towards zero.
+	return int32((int64(milliCelsius)*9 + 160000) / 5)
+}
+
+// CelsiusToKelvin converts a temperature in milli-degrees Celsius to
+// millikelvin. For example, 0 (0°C) becomes 273150 (273.15K).
+func CelsiusToKelvin(milliCelsius int32) int32 {
+	return milliCelsius + 273150
+}
+
+// TemperatureUnit is the unit used by FormatTemperature.
+type TemperatureUnit uint8
+
+const (
+	Celsius TemperatureUnit = iota
+	Fahrenheit
+	Kelvin
+)
+
+// FormatTemperature formats a temperature in milli-degrees Celsius in the
+// given unit, rounded to one decimal. For example, 20000 is formatted as
+// "20.0°C", "68.0°F" or "293.2K".
+func FormatTemperature(milliCelsius int32, unit TemperatureUnit) string {
+	value := milliCelsius
+	suffix := "°C"
+	switch unit {
+	case Fahrenheit:
+		value = CelsiusToFahrenheit(milliCelsius)
+		suffix = "°F"
+	case Kelvin:
+		value = CelsiusToKelvin(milliCelsius)
+		suffix = "K"
+	}
+
+	// Round to tenths, away from zero.
+	tenths := int64(value)
+	if tenths < 0 {
+		tenths = (tenths - 50) / 100
+	} else {
+		tenths = (tenths + 50) / 100
+	}
+
+	var buf []byte
+	if tenths < 0 {
+		buf = append(buf, '-')
+		tenths = -tenths
+	}
+	buf = strconv.AppendInt(buf, tenths/10, 10)
+	buf = append(buf, '.', byte('0'+tenths%10))
+	buf = append(buf, suffix...)
+	return string(buf)
+}
+
+// Convert a raw 12-bit reading of the temperature sensor inside the RP2040
+// (ADC channel 4) to milli-degrees Celsius, using the formula from section
+// 4.9.5 of the RP2040 datasheet:
+//
+//	T = 27 - (V - 0.706) / 0.001721
+//
+// where V is the voltage on the sensor, assuming a 3.3V ADC reference. It
+// lives here instead of in sensors-rp2040.go so that it can be tested.
+func rp2040DieTemperature(raw uint16) int32 {
+	microvolts := int64(raw) * 3_300_000 / 4096
+	return int32(27_000 - (microvolts-706_000)*1000/1721)
+}
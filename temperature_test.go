@@ -0,0 +1,69 @@
+package board
+
+import "testing"
+
+func TestTemperatureConversion(t *testing.T) {
+	for _, tc := range []struct {
+		celsius    int32
+		fahrenheit int32
+		kelvin     int32
+	}{
+		{0, 32000, 273150},        // freezing point of water
+		{100_000, 212000, 373150}, // boiling point of water
+		{-40_000, -40000, 233150}, // same in Celsius and Fahrenheit
+		{-273150, -459670, 0},     // absolute zero
+		{20_000, 68000, 293150},   // default in the simulator
+		{37_500, 99500, 310650},
+		{1, 32001, 273151},   // 32.0018°F
+		{-17_777, 1, 255373}, // 0.0014°F
+		{-17_778, 0, 255372}, // -0.0004°F
+	} {
+		if fahrenheit := CelsiusToFahrenheit(tc.celsius); fahrenheit != tc.fahrenheit {
+			t.Errorf("CelsiusToFahrenheit(%d): expected %d, got %d", tc.celsius, tc.fahrenheit, fahrenheit)
+		}
+		if kelvin := CelsiusToKelvin(tc.celsius); kelvin != tc.kelvin {
+			t.Errorf("CelsiusToKelvin(%d): expected %d, got %d", tc.celsius, tc.kelvin, kelvin)
+		}
+	}
+}
+
+func TestFormatTemperature(t *testing.T) {
+	for _, tc := range []struct {
+		celsius int32
+		unit    TemperatureUnit
+		text    string
+	}{
+		{0, Celsius, "0.0°C"},
+		{0, Fahrenheit, "32.0°F"},
+		{0, Kelvin, "273.2K"},
+		{20_000, Celsius, "20.0°C"},
+		{21_449, Celsius, "21.4°C"},
+		{21_450, Celsius, "21.5°C"},
+		{-5_500, Celsius, "-5.5°C"},
+		{-5_550, Celsius, "-5.6°C"},
+		{-40, Celsius, "0.0°C"},
+		{-40_000, Fahrenheit, "-40.0°F"},
+		{100_000, Fahrenheit, "212.0°F"},
+	} {
+		if text := FormatTemperature(tc.celsius, tc.unit); text != tc.text {
+			t.Errorf("FormatTemperature(%d, %d): expected %q, got %q", tc.celsius, tc.unit, tc.text, text)
+		}
+	}
+}
+
+func TestRP2040DieTemperature(t *testing.T) {
+	for _, tc := range []struct {
+		raw         uint16
+		temperature int32
+	}{
+		{876, 27138}, // 0.706V, which is 27°C according to the datasheet
+		{900, 15904}, // higher voltage means lower temperature
+		{850, 39310},
+		{0, 437226},
+		{4095, -1479794},
+	} {
+		if temperature := rp2040DieTemperature(tc.raw); temperature != tc.temperature {
+			t.Errorf("rp2040DieTemperature(%d): expected %d, got %d", tc.raw, tc.temperature, temperature)
+		}
+	}
+}
@@ -12,9 +12,25 @@ func main() {
 	// Verify board name constant.
 	var _ string = board.Name
 
+	// Verify board information is available.
+	var _ board.BoardInfo = board.Info()
+
 	// Assert that board.Display implements board.Displayer.
 	checkScreen(board.Display.Configure())
 
+	// Assert that board.Configure returns the same kind of display.
+	display, _ := board.Configure(board.ConfigureOptions{})
+	checkScreen(display)
+
+	// Assert that board.Color returns the color format of the display.
+	checkColor(display, board.Color(board.Red))
+
+	// Assert that the display can be cleared using the same color format.
+	board.Clear(display, board.Color(board.Black))
+
+	// Assert that the secondary display (if any) is a monochrome display.
+	var _ board.Displayer[pixel.Monochrome] = board.SecondaryDisplay.Configure()
+
 	// Assert that Display uses the usual interface.
 	var _ interface {
 		//Configure() // already checked above
@@ -23,31 +39,91 @@ func main() {
 		MaxBrightness() int
 		SetBrightness(int)
 		WaitForVBlank(time.Duration)
+		WaitForVBlankTimeout(defaultInterval, timeout time.Duration) bool
+		LastFrameDuration() time.Duration
 	} = board.Display
 
 	// Assert that board.Buttons uses the usual interface.
 	var _ interface {
 		Configure()
 		ReadInput()
+		Snapshot()
 		NextEvent() board.KeyEvent
+		PeekEvent() board.KeyEvent
+		Remap(index int, key board.Key)
 	} = board.Buttons
 
 	// Assert that board.Power uses the usual interface.
 	var _ interface {
 		Configure()
 		Status() (state board.ChargeState, microvolts uint32, percent int8)
+		BatteryTemperature() int32
+		NextEvent() board.PowerEvent
+		Shutdown() error
+		Reboot(toBootloader bool) error
 	} = board.Power
 
+	// Assert that board.Watchdog uses the usual interface.
+	var _ interface {
+		Configure()
+		Feed()
+	} = board.Watchdog
+
+	// Assert that board.StatusLED uses the usual interface.
+	var _ interface {
+		Configure()
+		Set(on bool)
+		SetColor(r, g, b uint8)
+	} = board.StatusLED
+
+	// Assert that board.Vibration and board.Speaker use the usual interface.
+	var _ interface {
+		Configure()
+		Pulse(duration time.Duration)
+		Pattern(pattern []time.Duration) <-chan struct{}
+		Stop()
+	} = board.Vibration
+	var _ interface {
+		Configure()
+		Tone(frequency uint32, duration time.Duration)
+		StartTone(frequency uint32, duration time.Duration) <-chan struct{}
+		PlayNote(note uint8, duration time.Duration)
+		PlaySequence(notes []board.Note)
+	} = board.Speaker
+
+	// Assert that board.Microphone uses the usual interface.
+	var _ interface {
+		Configure(sampleRate uint32) error
+		Read(buf []int16) (int, error)
+	} = board.Microphone
+
+	// Assert that board.Encoder uses the usual interface.
+	var _ interface {
+		Configure()
+		Read() (delta int, pressed bool)
+	} = board.Encoder
+
 	// All sensors must implement the exact same interface, even if some methods
 	// are unsupported.
 	var _ interface {
+		Available() drivers.Measurement
 		Configure(which drivers.Measurement) error
 		Update(which drivers.Measurement) error
 		Acceleration() (x, y, z int32)
 		Steps() uint32
 		Temperature() int32
+		Light() uint32
+		Proximity() uint32
+		AngularVelocity() (x, y, z int32)
+		MagneticField() (x, y, z int32)
+		Pressure() int32
+		Humidity() int32
+		ReadAccelBuffer(buf [][3]int32) (int, error)
 	} = board.Sensors
 }
 
 func checkScreen[T pixel.Color](display board.Displayer[T]) {
 }
+
+func checkColor[T pixel.Color](display board.Displayer[T], color T) {
+}
@@ -0,0 +1,79 @@
+package board
+
+import (
+	"unicode/utf8"
+
+	"tinygo.org/x/drivers/pixel"
+)
+
+// Font is a bitmap font, used by RenderText. This package doesn't include any
+// fonts to avoid pulling in large font data into every app: the app provides a
+// font by implementing this interface, for example as a wrapper around an
+// existing font package or a small table of glyph bitmaps.
+type Font interface {
+	// Height of a line of text in pixels. All glyphs have this height.
+	Height() int
+
+	// Width of the glyph for the given character in pixels, including spacing
+	// to the next character. It returns 0 if the font doesn't contain the
+	// character, in which case it is skipped.
+	GlyphWidth(r rune) int
+
+	// Whether the pixel at the given coordinates in the glyph for the given
+	// character is set. It is only called for characters that have a width,
+	// and for coordinates within the width and height of the glyph.
+	GlyphPixel(r rune, x, y int) bool
+}
+
+// TextSize returns the size in pixels of the given text when rendered with
+// RenderText. A newline character starts a new line.
+func TextSize(font Font, text string) (width, height int) {
+	lineWidth := 0
+	height = font.Height()
+	for _, r := range text {
+		if r == '\n' {
+			lineWidth = 0
+			height += font.Height()
+			continue
+		}
+		lineWidth += font.GlyphWidth(r)
+		if lineWidth > width {
+			width = lineWidth
+		}
+	}
+	return width, height
+}
+
+// RenderText renders the text into a new image in the color format of the
+// display, so that it can be drawn using DrawBitmap. Pixels that are set in
+// the font get the foreground color, other pixels get the background color. A
+// newline character starts a new line. If there is nothing to render (for
+// example, because the text is empty), an image of size 0x0 is returned.
+func RenderText[T pixel.Color](font Font, text string, foreground, background T) pixel.Image[T] {
+	width, height := TextSize(font, text)
+	if width == 0 || height == 0 {
+		return pixel.Image[T]{}
+	}
+	img := pixel.NewImage[T](width, height)
+	img.FillSolidColor(background)
+	x, y := 0, 0
+	for len(text) != 0 {
+		r, size := utf8.DecodeRuneInString(text)
+		text = text[size:]
+		if r == '\n' {
+			x = 0
+			y += font.Height()
+			continue
+		}
+		glyphWidth := font.GlyphWidth(r)
+		for glyphY := 0; glyphY < font.Height(); glyphY++ {
+			for glyphX := 0; glyphX < glyphWidth; glyphX++ {
+				if font.GlyphPixel(r, glyphX, glyphY) {
+					img.Set(x+glyphX, y+glyphY, foreground)
+				}
+			}
+		}
+		x += glyphWidth
+	}
+	return img
+}
@@ -0,0 +1,86 @@
+package board
+
+import (
+	"testing"
+
+	"tinygo.org/x/drivers/pixel"
+)
+
+// Tiny 3x3 test font (plus one column of spacing), with just a few glyphs.
+type testFont struct{}
+
+var testFontGlyphs = map[rune][3]string{
+	'I': {"###", " # ", "###"},
+	'L': {"#  ", "#  ", "###"},
+	'-': {"   ", "###", "   "},
+}
+
+func (f testFont) Height() int {
+	return 3
+}
+
+func (f testFont) GlyphWidth(r rune) int {
+	if _, ok := testFontGlyphs[r]; ok {
+		return 4
+	}
+	return 0
+}
+
+func (f testFont) GlyphPixel(r rune, x, y int) bool {
+	return x < 3 && testFontGlyphs[r][y][x] == '#'
+}
+
+// Convert an image back to text, for easy comparison.
+func imageToText[T pixel.Color](img pixel.Image[T], foreground T) []string {
+	width, height := img.Size()
+	var lines []string
+	for y := 0; y < height; y++ {
+		line := ""
+		for x := 0; x < width; x++ {
+			if img.Get(x, y) == foreground {
+				line += "#"
+			} else {
+				line += " "
+			}
+		}
+		lines = append(lines, line)
+	}
+	return lines
+}
+
+func TestRenderText(t *testing.T) {
+	white := pixel.NewColor[pixel.RGB565BE](255, 255, 255)
+	black := pixel.NewColor[pixel.RGB565BE](0, 0, 0)
+	for _, tc := range []struct {
+		text     string
+		expected []string
+	}{
+		{"", nil},
+		{"?", nil}, // unknown characters are skipped
+		{"IL", []string{
+			"### #   ",
+			" #  #   ",
+			"### ### ",
+		}},
+		{"L-?I\nI", []string{
+			"#       ### ",
+			"#   ###  #  ",
+			"###     ### ",
+			"###         ",
+			" #          ",
+			"###         ",
+		}},
+	} {
+		img := RenderText(testFont{}, tc.text, white, black)
+		lines := imageToText(img, white)
+		if len(lines) != len(tc.expected) {
+			t.Errorf("%q: expected %d lines, got %d: %q", tc.text, len(tc.expected), len(lines), lines)
+			continue
+		}
+		for i := range lines {
+			if lines[i] != tc.expected[i] {
+				t.Errorf("%q: line %d: expected %q, got %q", tc.text, i, tc.expected[i], lines[i])
+			}
+		}
+	}
+}
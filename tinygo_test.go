@@ -7,41 +7,64 @@ import (
 	"go/parser"
 	"go/token"
 	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
 	"testing"
+
+	"github.com/aykevl/board"
 )
 
-var boards = []string{
-	// Please keep this list sorted!
-	"badger2040",
-	"gameboy-advance",
-	"gopher-badge",
-	"mch2022",
-	"pinetime",
-	"pybadge",
-	"pyportal",
-	"simulator",
-	"thumby",
-}
+var boards = board.SupportedBoards()
 
 func isXtensa(board string) bool {
-	return board == "mch2022"
+	return board == "mch2022" || board == "sha2017"
+}
+
+// Return the TinyGo flags to select the given board. Most boards have a TinyGo
+// target of the same name.
+func targetFlags(board string) []string {
+	switch board {
+	case "sha2017":
+		// There is no target for the SHA2017 badge, see board-sha2017.go.
+		return []string{"-target=esp32", "-tags=sha2017"}
+	case "picodisplay":
+		// The Pico Display Pack is an add-on for the Pico, see
+		// board-picodisplay.go.
+		return []string{"-target=pico", "-tags=picodisplay"}
+	default:
+		return []string{"-target=" + board}
+	}
 }
 
 var flagXtensa = flag.Bool("xtensa", false, "test Xtensa based boards")
 
 // These method names should match the ones in testdata/smoketest.go, so that no
-// method goes unchecked!
+// method goes unchecked! This is verified by TestSmokeTestMethods, and
+// TestExported verifies that every board implements exactly these methods.
 var definedGlobals = map[string][]string{
 	"Power": []string{
 		"Configure",
 		"Status",
+		"BatteryTemperature",
+		"NextEvent",
+		"Shutdown",
+		"Reboot",
 	},
 	"Sensors": []string{
+		"Available",
 		"Configure",
 		"Update",
 		"Acceleration",
 		"Steps",
 		"Temperature",
+		"Light",
+		"Proximity",
+		"AngularVelocity",
+		"MagneticField",
+		"Pressure",
+		"Humidity",
+		"ReadAccelBuffer",
 	},
 	"Display": []string{
 		"Configure",
@@ -50,14 +73,70 @@ var definedGlobals = map[string][]string{
 		"MaxBrightness",
 		"SetBrightness",
 		"WaitForVBlank",
+		"WaitForVBlankTimeout",
+		"LastFrameDuration",
 	},
 	"Buttons": []string{
 		"Configure",
 		"ReadInput",
+		"Snapshot",
 		"NextEvent",
+		"PeekEvent",
+		"Remap",
+	},
+	"Watchdog": []string{
+		"Configure",
+		"Feed",
+	},
+	"StatusLED": []string{
+		"Configure",
+		"Set",
+		"SetColor",
+	},
+	"Vibration": []string{
+		"Configure",
+		"Pulse",
+		"Pattern",
+		"Stop",
+	},
+	"Microphone": []string{
+		"Configure",
+		"Read",
+	},
+	"Speaker": []string{
+		"Configure",
+		"Tone",
+		"StartTone",
+		"PlayNote",
+		"PlaySequence",
+	},
+	"Encoder": []string{
+		"Configure",
+		"Read",
 	},
 }
 
+// Check that SupportedBoards matches the board files in this package.
+func TestSupportedBoards(t *testing.T) {
+	files, err := filepath.Glob("board-*.go")
+	if err != nil {
+		t.Fatal("could not list board files:", err)
+	}
+	var found []string
+	for _, file := range files {
+		if strings.HasSuffix(file, "_test.go") {
+			continue
+		}
+		found = append(found, strings.TrimSuffix(strings.TrimPrefix(file, "board-"), ".go"))
+	}
+	if !sort.StringsAreSorted(boards) {
+		t.Errorf("SupportedBoards is not sorted: %v", boards)
+	}
+	if strings.Join(found, " ") != strings.Join(boards, " ") {
+		t.Errorf("SupportedBoards doesn't match the board files:\nSupportedBoards: %v\nboard files:     %v", boards, found)
+	}
+}
+
 func TestBoards(t *testing.T) {
 	for _, board := range boards {
 		board := board
@@ -71,7 +150,8 @@ func TestBoards(t *testing.T) {
 			if board == "simulator" {
 				cmd = exec.Command("go", "build", "-o="+t.TempDir()+"/output", "./testdata/smoketest.go")
 			} else {
-				cmd = exec.Command("tinygo", "build", "-o="+t.TempDir()+"/output", "-target="+board, "./testdata/smoketest.go")
+				args := append([]string{"build", "-o=" + t.TempDir() + "/output"}, targetFlags(board)...)
+				cmd = exec.Command("tinygo", append(args, "./testdata/smoketest.go")...)
 			}
 			cmd.Stderr = outbuf
 			cmd.Stdout = outbuf
@@ -83,6 +163,128 @@ func TestBoards(t *testing.T) {
 	}
 }
 
+// Check that testdata/smoketest.go checks exactly the methods in
+// definedGlobals, so that they don't get out of sync when a method is added.
+func TestSmokeTestMethods(t *testing.T) {
+	fset := token.NewFileSet()
+	f, err := parser.ParseFile(fset, "testdata/smoketest.go", nil, parser.SkipObjectResolution)
+	if err != nil {
+		t.Fatal("could not parse smoke test:", err)
+	}
+
+	// Collect the methods that are checked for each global: either called
+	// directly (board.Display.Configure()) or listed in an interface that the
+	// global is assigned to (var _ interface{...} = board.Power).
+	checked := make(map[string][]string)
+	ast.Inspect(f, func(node ast.Node) bool {
+		switch node := node.(type) {
+		case *ast.SelectorExpr:
+			if global := boardGlobal(node.X); global != "" {
+				checked[global] = append(checked[global], node.Sel.Name)
+			}
+		case *ast.ValueSpec:
+			iface, ok := node.Type.(*ast.InterfaceType)
+			if !ok || len(node.Values) != 1 {
+				break
+			}
+			global := boardGlobal(node.Values[0])
+			if global == "" {
+				break
+			}
+			for _, method := range iface.Methods.List {
+				for _, name := range method.Names {
+					checked[global] = append(checked[global], name.Name)
+				}
+			}
+		}
+		return true
+	})
+
+	for global, methods := range definedGlobals {
+		for _, method := range methods {
+			if !contains(checked[global], method) {
+				t.Errorf("board.%s.%s is not checked in the smoke test", global, method)
+			}
+		}
+	}
+	for global, methods := range checked {
+		if _, ok := definedGlobals[global]; !ok {
+			t.Errorf("board.%s is checked in the smoke test but missing from definedGlobals", global)
+			continue
+		}
+		for _, method := range methods {
+			if !contains(definedGlobals[global], method) {
+				t.Errorf("board.%s.%s is checked in the smoke test but missing from definedGlobals", global, method)
+			}
+		}
+	}
+}
+
+// Return the name of the global if the expression is one of the globals in
+// definedGlobals (like board.Power), or the empty string otherwise.
+func boardGlobal(x ast.Expr) string {
+	sel, ok := x.(*ast.SelectorExpr)
+	if !ok {
+		return ""
+	}
+	if pkg, ok := sel.X.(*ast.Ident); !ok || pkg.Name != "board" {
+		return ""
+	}
+	if _, ok := definedGlobals[sel.Sel.Name]; !ok {
+		return ""
+	}
+	return sel.Sel.Name
+}
+
+// Boards with a display that is drawn to a framebuffer in RAM, and only shows
+// the result after a call to Display: e-paper and small OLED displays. All
+// other boards have TFT displays (or a framebuffer that is shown directly), so
+// they must not report BoardInfo.NeedsFlush.
+var flushedDisplays = map[string]bool{
+	"badger2040":      true, // e-paper
+	"macropad-rp2040": true, // OLED
+	"sha2017":         true, // e-paper
+	"thumby":          true, // OLED
+}
+
+// Check BoardInfo.NeedsFlush in boardInfo of every board file.
+func TestNeedsFlush(t *testing.T) {
+	for _, board := range boards {
+		filename := "board-" + board + ".go"
+		fset := token.NewFileSet()
+		f, err := parser.ParseFile(fset, filename, nil, parser.SkipObjectResolution)
+		if err != nil {
+			t.Errorf("could not open/parse %s: %v", filename, err)
+			continue
+		}
+		found := false
+		needsFlush := false
+		for _, decl := range f.Decls {
+			if decl, ok := decl.(*ast.FuncDecl); !ok || decl.Name.Name != "boardInfo" {
+				continue
+			}
+			found = true
+			ast.Inspect(decl, func(node ast.Node) bool {
+				if kv, ok := node.(*ast.KeyValueExpr); ok {
+					key, _ := kv.Key.(*ast.Ident)
+					value, _ := kv.Value.(*ast.Ident)
+					if key != nil && key.Name == "NeedsFlush" && value != nil {
+						needsFlush = value.Name == "true"
+					}
+				}
+				return true
+			})
+		}
+		if !found {
+			t.Errorf("%s: boardInfo not found", filename)
+			continue
+		}
+		if needsFlush != flushedDisplays[board] {
+			t.Errorf("%s: expected NeedsFlush to be %v, got %v", board, flushedDisplays[board], needsFlush)
+		}
+	}
+}
+
 // Test for exported names: all of them have to adhere to a strict API so that
 // the API for all boards is the same.
 func TestExported(t *testing.T) {
@@ -97,23 +299,18 @@ func TestExported(t *testing.T) {
 				t.Errorf("could not open/parse %s: %v", filename, err)
 			}
 
-			// Collect method names for (typically unexported) named types.
-			// Also set some defaults that aren't defined in board files (but in
-			// common.go, probably).
-			methodNames := map[string][]string{
-				"baseSensors":  definedGlobals["Sensors"],
-				"dummyBattery": definedGlobals["Power"],
-				"noButtons":    definedGlobals["Buttons"],
-			}
-			for _, decl := range f.Decls {
-				if decl, ok := decl.(*ast.FuncDecl); ok {
-					if decl.Name.IsExported() && decl.Recv != nil && len(decl.Recv.List) > 0 {
-						recvType := decl.Recv.List[0].Type
-						name := extractTypeName(recvType)
-						methodNames[name] = append(methodNames[name], decl.Name.Name)
-					}
+			// Collect the methods of all named types that can be used by this
+			// board: the ones in common files (like dummyBattery in
+			// common.go) and the ones in the board file itself.
+			types := make(map[string]*typeInfo)
+			for name, info := range sharedTypes {
+				// Copy, so that the board file doesn't modify sharedTypes.
+				types[name] = &typeInfo{
+					methods: append([]string(nil), info.methods...),
+					embeds:  append([]string(nil), info.embeds...),
 				}
 			}
+			collectTypes(f, types)
 
 			// Check all exported types, variables, etc.
 			for _, decl := range f.Decls {
@@ -172,21 +369,21 @@ func TestExported(t *testing.T) {
 										continue
 									}
 									typeName := extractTypeName(spec.Values[0])
-									if _, ok := methodNames[typeName]; !ok {
+									if _, ok := types[typeName]; !ok {
 										t.Errorf("%s: could not find methods for type %#v", pos, typeName)
 										continue
 									}
-									for _, typeMethod := range methodNames[typeName] {
-										found := false
-										for _, expectedMethod := range definedGlobals[name.Name] {
-											if typeMethod == expectedMethod {
-												found = true
-											}
-										}
-										if !found {
+									methods := methodSet(types, typeName)
+									for _, typeMethod := range methods {
+										if !contains(definedGlobals[name.Name], typeMethod) {
 											t.Errorf("%s: unexpected method %s on board.%s", pos, typeMethod, name)
 										}
 									}
+									for _, expectedMethod := range definedGlobals[name.Name] {
+										if !contains(methods, expectedMethod) {
+											t.Errorf("%s: missing method %s on board.%s", pos, expectedMethod, name)
+										}
+									}
 								}
 							default:
 								t.Errorf("%s: unexpected spec: %#v", pos, spec)
@@ -217,6 +414,108 @@ func TestExported(t *testing.T) {
 	}
 }
 
+// Methods and embedded types of a named type in this package.
+type typeInfo struct {
+	methods []string // exported methods
+	embeds  []string // embedded types defined in this package
+}
+
+// Named types defined outside of the board files, and thus available to every
+// board.
+var sharedTypes = func() map[string]*typeInfo {
+	files, err := filepath.Glob("*.go")
+	if err != nil {
+		panic("could not list files: " + err.Error())
+	}
+	types := make(map[string]*typeInfo)
+	fset := token.NewFileSet()
+	for _, filename := range files {
+		if strings.HasPrefix(filename, "board-") || strings.HasSuffix(filename, "_test.go") {
+			continue
+		}
+		f, err := parser.ParseFile(fset, filename, nil, parser.SkipObjectResolution)
+		if err != nil {
+			panic("could not parse " + filename + ": " + err.Error())
+		}
+		collectTypes(f, types)
+	}
+	return types
+}()
+
+// Add the exported methods and embedded types of all named types in the given
+// file to the types map.
+func collectTypes(f *ast.File, types map[string]*typeInfo) {
+	get := func(name string) *typeInfo {
+		if types[name] == nil {
+			types[name] = &typeInfo{}
+		}
+		return types[name]
+	}
+	for _, decl := range f.Decls {
+		switch decl := decl.(type) {
+		case *ast.FuncDecl:
+			if decl.Name.IsExported() && decl.Recv != nil && len(decl.Recv.List) > 0 {
+				name := extractTypeName(decl.Recv.List[0].Type)
+				if name == "<unknown>" {
+					continue // generic type, like Buffered[T]
+				}
+				info := get(name)
+				info.methods = append(info.methods, decl.Name.Name)
+			}
+		case *ast.GenDecl:
+			if decl.Tok != token.TYPE {
+				continue
+			}
+			for _, spec := range decl.Specs {
+				spec := spec.(*ast.TypeSpec)
+				info := get(spec.Name.Name)
+				st, ok := spec.Type.(*ast.StructType)
+				if !ok {
+					continue
+				}
+				for _, field := range st.Fields.List {
+					if len(field.Names) != 0 {
+						continue
+					}
+					// Embedded field. Types from other packages (like
+					// shifter.Device) are ignored, as their methods aren't
+					// known here.
+					if name := extractTypeName(field.Type); name != "<unknown>" {
+						info.embeds = append(info.embeds, name)
+					}
+				}
+			}
+		}
+	}
+}
+
+// Return all exported methods of the given type, including those promoted from
+// embedded types.
+func methodSet(types map[string]*typeInfo, name string) []string {
+	info := types[name]
+	if info == nil {
+		return nil
+	}
+	methods := append([]string(nil), info.methods...)
+	for _, embed := range info.embeds {
+		for _, method := range methodSet(types, embed) {
+			if !contains(methods, method) {
+				methods = append(methods, method)
+			}
+		}
+	}
+	return methods
+}
+
+func contains(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
+
 // Extract the named type from the given AST expression (resolving things like
 // *ast.StarExpr).
 func extractTypeName(x ast.Expr) string {
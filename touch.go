@@ -0,0 +1,182 @@
+package board
+
+import (
+	"time"
+
+	"tinygo.org/x/drivers/pixel"
+)
+
+// RateLimitTouch returns a TouchInput that reads the touch hardware at most
+// once per interval while the screen isn't touched. Once a touch is detected,
+// every call reads the hardware so that dragging remains smooth. Calls in
+// between return no touch points.
+//
+// Touch input is normally polled as often as the main loop runs, which may
+// waste power. How much power is saved by rate limiting differs per board (the
+// numbers below are estimates based on the datasheets, not measurements):
+//
+//   - On the PyPortal, every read does four ADC conversions on the resistive
+//     touch screen (two for the position and two for the pressure), also when
+//     the screen isn't touched. Including switching the pins between them, a
+//     read keeps the SAMD51 awake for around 100µs at around 10mA, so polling
+//     at 60Hz costs around 60µA on average. A 50ms interval brings that down
+//     to around 20µA.
+//   - On the PineTime, the touch controller is only read over I2C while a
+//     touch is in progress (detected through the latched interrupt pin), so a
+//     read without a touch is just a register read of well under 1µs and
+//     there is little to gain. A read during a touch transfers 9 bytes over
+//     the 400kHz I2C bus, which takes around 200µs at around 4mA: around 50µA
+//     at 60Hz. Compare this to the 0.19mA of the whole watch in standby (see
+//     StandbyUntilTouch). The touch controller itself sleeps when not touched.
+//   - In the simulator there is no power to save, but it can be used to check
+//     whether an app still feels responsive with a given interval.
+//
+// The app still has to sleep between reads to actually save power, for
+// example with Display.WaitForVBlank or time.Sleep. An interval of around 50ms
+// is usually short enough not to miss the start of a tap.
+func RateLimitTouch(input TouchInput, interval time.Duration) TouchInput {
+	return &rateLimitedTouch{
+		input:    input,
+		interval: interval,
+	}
+}
+
+type rateLimitedTouch struct {
+	input    TouchInput
+	interval time.Duration
+	lastRead time.Time
+	touching bool
+}
+
+func (t *rateLimitedTouch) ReadTouch() []TouchPoint {
+	now := time.Now()
+	if !t.touching && now.Sub(t.lastRead) < t.interval {
+		return nil
+	}
+	t.lastRead = now
+	points := t.input.ReadTouch()
+	t.touching = len(points) != 0
+	return points
+}
+
+// Touch inputs that can report a touch that started since the last check, even
+// when it has already ended and ReadTouch wouldn't return it anymore.
+type touchLatch interface {
+	touchStarted() bool
+}
+
+// How often StandbyUntilTouch polls the touch input.
+const standbyPollInterval = 50 * time.Millisecond
+
+// StandbyUntilTouch puts the display in sleep mode (which also turns off the
+// backlight) and waits until the screen is touched, while the touch input
+// stays active. When touched, the display is woken up again and true is
+// returned. If the screen isn't touched within maxDuration, it returns false
+// and leaves the display in sleep mode, so that the app can for example update
+// the display contents while it is off and call StandbyUntilTouch again.
+//
+// The touch that woke up the display may still be in progress when this
+// function returns, in which case ReadTouch will keep reporting it. Apps
+// usually want to ignore it, so that the tap to wake up the display doesn't
+// also press a button on the screen. Touches that were in progress before the
+// call also wake up the display, so only call this function when the screen
+// isn't touched.
+//
+// In between polls of the touch input, the board is put in a low power state
+// using Idle. Short taps between two polls are not lost on the PineTime and
+// in the simulator. On the PineTime, the touch controller keeps working while
+// the display sleeps: its interrupt line is latched by the GPIO peripheral
+// (see ConfigureTouch) without using pin change interrupts, which would raise
+// the current consumption from around 0.19mA to 0.65mA. Meanwhile, the display
+// controller is in sleep mode and the backlight is off.
+func StandbyUntilTouch[T pixel.Color](display Displayer[T], touch TouchInput, maxDuration time.Duration) (touched bool, err error) {
+	// Ignore touches that ended before standby started.
+	latch, hasLatch := touch.(touchLatch)
+	touch.ReadTouch()
+	if hasLatch {
+		latch.touchStarted()
+	}
+
+	err = display.Sleep(true)
+	if err != nil {
+		return false, err
+	}
+	deadline := time.Now().Add(maxDuration)
+	for {
+		// Check the latch first, because reading the touch input may reset
+		// it.
+		latched := hasLatch && latch.touchStarted()
+		if len(touch.ReadTouch()) != 0 || latched {
+			return true, display.Sleep(false)
+		}
+		remaining := time.Until(deadline)
+		if remaining <= 0 {
+			return false, nil
+		}
+		if remaining > standbyPollInterval {
+			remaining = standbyPollInterval
+		}
+		Idle(remaining)
+	}
+}
+
+// RawTouch is a single uncalibrated reading from a resistive touch screen, see
+// RawTouchReader.
+type RawTouch struct {
+	// Raw ADC values on a 16-bit scale, before any filtering or calibration.
+	// X and Y are the position along the axes of the touch panel (which may
+	// not match the display axes, depending on the rotation), and Z is the
+	// pressure. A low Z value means the screen isn't touched.
+	X, Y, Z uint16
+}
+
+// RawTouchReader is a touch input that can return raw readings, for example to
+// build a calibration UI: ask the user to tap each corner of the screen, and
+// derive calibration constants from the raw values. Use AsRawTouchReader to
+// check whether a touch input supports it.
+//
+// Raw readings are read separately from ReadTouch, and don't affect the
+// filtering done by ReadTouch.
+//
+// Supported on the PyPortal and the simulator. On the PyPortal, raw X (along
+// the short side of the display) goes from about 48000 to 22000 and raw Y
+// (along the long side) from about 54000 to 16000 across the visible area.
+// The screen is considered touched when Z is above 8192. These values differ
+// a bit between panels, which is why calibration can be useful. The simulator
+// maps the window linearly to the full 0-65535 range, with a Z of 65535 while
+// touched.
+type RawTouchReader interface {
+	ReadRawTouch() RawTouch
+}
+
+// AsRawTouchReader returns the touch input as a RawTouchReader, if it supports
+// raw readings. Touch inputs wrapped using RateLimitTouch are unwrapped first.
+func AsRawTouchReader(touch TouchInput) (RawTouchReader, bool) {
+	if limited, ok := touch.(*rateLimitedTouch); ok {
+		touch = limited.input
+	}
+	reader, ok := touch.(RawTouchReader)
+	return reader, ok
+}
+
+// TouchSupported returns whether the touch input reads actual touch hardware.
+// On boards without a touch screen, Display.ConfigureTouch returns a touch
+// input that never reports a touch, which can't be told apart from a touch
+// screen that isn't being touched by calling ReadTouch. Use this function
+// instead, for example to hide controls that can only be used by touch:
+//
+//	touch := board.Display.ConfigureTouch()
+//	if !board.TouchSupported(touch) {
+//		// only show controls that work with the buttons
+//	}
+//
+// Touch inputs wrapped using RateLimitTouch are unwrapped first. The same
+// information is available before configuring touch input in
+// Info().HasTouch.
+func TouchSupported(touch TouchInput) bool {
+	if limited, ok := touch.(*rateLimitedTouch); ok {
+		touch = limited.input
+	}
+	_, none := touch.(noTouch)
+	return !none
+}
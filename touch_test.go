@@ -0,0 +1,71 @@
+package board
+
+import (
+	"testing"
+	"time"
+)
+
+// Touch input that counts the number of reads.
+type countingTouch struct {
+	reads  int
+	points []TouchPoint
+}
+
+func (t *countingTouch) ReadTouch() []TouchPoint {
+	t.reads++
+	return t.points
+}
+
+func TestRateLimitTouch(t *testing.T) {
+	input := &countingTouch{}
+	limited := RateLimitTouch(input, time.Hour)
+
+	// Without a touch, only the first read goes to the hardware.
+	for i := 0; i < 3; i++ {
+		if points := limited.ReadTouch(); len(points) != 0 {
+			t.Errorf("expected no touch points, got %v", points)
+		}
+	}
+	if input.reads != 1 {
+		t.Errorf("expected 1 read while not touched, got %d", input.reads)
+	}
+
+	// While touching, every read goes to the hardware.
+	input.points = []TouchPoint{{ID: 1, X: 10, Y: 20}}
+	limited = RateLimitTouch(input, 0)
+	limited.ReadTouch()
+	limited.(*rateLimitedTouch).interval = time.Hour
+	for i := 0; i < 3; i++ {
+		if points := limited.ReadTouch(); len(points) != 1 || points[0] != input.points[0] {
+			t.Errorf("expected touch point, got %v", points)
+		}
+	}
+	if input.reads != 5 {
+		t.Errorf("expected 5 reads, got %d", input.reads)
+	}
+
+	// After releasing, the rate limit applies again.
+	input.points = nil
+	limited.ReadTouch()
+	limited.ReadTouch()
+	if input.reads != 6 {
+		t.Errorf("expected 6 reads, got %d", input.reads)
+	}
+}
+
+func TestTouchSupported(t *testing.T) {
+	for _, tc := range []struct {
+		name      string
+		touch     TouchInput
+		supported bool
+	}{
+		{"none", noTouch{}, false},
+		{"rate limited none", RateLimitTouch(noTouch{}, time.Second), false},
+		{"hardware", &countingTouch{}, true},
+		{"rate limited hardware", RateLimitTouch(&countingTouch{}, time.Second), true},
+	} {
+		if supported := TouchSupported(tc.touch); supported != tc.supported {
+			t.Errorf("%s: expected %v, got %v", tc.name, tc.supported, supported)
+		}
+	}
+}
@@ -0,0 +1,109 @@
+package board
+
+import "time"
+
+// TraceOp is the kind of peripheral operation reported in a TraceEvent.
+type TraceOp uint8
+
+const (
+	// Power.Status. The value is the battery voltage in microvolts.
+	TraceBatteryRead TraceOp = iota + 1
+
+	// ReadTouch on the touch input. The value is the number of touches.
+	TraceTouchRead
+
+	// Sensors.Update. The value is the drivers.Measurement that was updated.
+	TraceSensorUpdate
+
+	// DrawBitmap on the display. The value is the number of pixels in the
+	// image.
+	TraceDisplayDraw
+
+	// Display on the display, which sends the contents of the display buffer
+	// (if there is one) to the screen.
+	TraceDisplayFlush
+
+	// Configure of a peripheral. The value is the TraceOp that the peripheral
+	// is otherwise traced with, to tell them apart: TraceBatteryRead for
+	// Power.Configure, TraceTouchRead for Display.ConfigureTouch,
+	// TraceSensorUpdate for Sensors.Configure, and TraceDisplayDraw for
+	// Display.Configure.
+	TraceConfigure
+)
+
+// String returns a short name for the operation, like "touch-read".
+func (op TraceOp) String() string {
+	switch op {
+	case TraceBatteryRead:
+		return "battery-read"
+	case TraceTouchRead:
+		return "touch-read"
+	case TraceSensorUpdate:
+		return "sensor-update"
+	case TraceDisplayDraw:
+		return "display-draw"
+	case TraceDisplayFlush:
+		return "display-flush"
+	case TraceConfigure:
+		return "configure"
+	default:
+		return "unknown"
+	}
+}
+
+// TraceEvent is a single peripheral operation, as reported to the hook set
+// with SetTraceHook.
+type TraceEvent struct {
+	Op       TraceOp
+	Start    time.Time     // when the operation started
+	Duration time.Duration // how long the operation took
+	Value    int32         // operation specific, see TraceOp
+	Err      error         // error returned by the operation, if any
+}
+
+// Function called for every traced operation, or nil when tracing is
+// disabled.
+var traceHook func(TraceEvent)
+
+// SetTraceHook sets a function that is called after each peripheral operation,
+// for debugging on real hardware: configuring the peripherals, battery
+// readings, touch reads, sensor updates, and drawing to the display (with
+// timing). Passing nil disables
+// tracing again. It should be set before configuring the board peripherals,
+// and not be changed while they're in use.
+//
+// Tracing is supported on the PineTime, the PyBadge, and the simulator.
+// Drawing is also traced on the other boards with a TFT display.
+//
+// When no hook is set, tracing costs a single check per operation. When a hook
+// is set, every traced operation also reads the time twice and calls the hook
+// synchronously, in the goroutine that did the operation. Touch input is
+// usually read every frame, so the hook is called many times per second: keep
+// it fast. For example, store events in a buffer and print them later instead
+// of printing them over a slow serial connection directly.
+func SetTraceHook(hook func(TraceEvent)) {
+	traceHook = hook
+}
+
+// Return the start time for an operation that is traced, or the zero time if
+// tracing is disabled (to avoid reading the time needlessly).
+func traceStart() time.Time {
+	if traceHook == nil {
+		return time.Time{}
+	}
+	return time.Now()
+}
+
+// Report a traced operation that started at the time returned by traceStart.
+func traceEnd(op TraceOp, start time.Time, value int32, err error) {
+	if traceHook == nil || start.IsZero() {
+		return
+	}
+	traceHook(TraceEvent{
+		Op:       op,
+		Start:    start,
+		Duration: time.Since(start),
+		Value:    value,
+		Err:      err,
+	})
+}
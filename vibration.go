@@ -0,0 +1,108 @@
+package board
+
+import (
+	"sync"
+	"time"
+)
+
+// This file contains helpers for vibration patterns, played with
+// Vibration.Pattern.
+//
+// A vibration motor uses a lot of power compared to the rest of a smartwatch
+// (tens of milliamps on the PineTime, while the watch itself uses well under a
+// milliamp when idle). A few short notifications a day don't matter much, but
+// an alarm that keeps vibrating for minutes does: keep patterns short, and
+// stop repeating an alarm after a while even if it isn't acknowledged.
+
+// Predefined vibration patterns, for use with Vibration.Pattern. A pattern
+// alternates between vibrating and pausing, starting with vibrating.
+var (
+	// Two short pulses, for example for an incoming message.
+	NotificationPattern = []time.Duration{
+		100 * time.Millisecond, 100 * time.Millisecond,
+		100 * time.Millisecond,
+	}
+
+	// Three long pulses followed by a pause, for alarms and timers. Play it
+	// repeatedly until the user acknowledges the alarm, for example:
+	//
+	//	for !acknowledged() {
+	//		<-board.Vibration.Pattern(board.AlarmPattern)
+	//	}
+	AlarmPattern = []time.Duration{
+		400 * time.Millisecond, 200 * time.Millisecond,
+		400 * time.Millisecond, 200 * time.Millisecond,
+		400 * time.Millisecond, 1000 * time.Millisecond,
+	}
+)
+
+// Plays vibration patterns in the background. Only one pattern can be played
+// at a time: a new pattern cuts off the pattern that is currently playing.
+type patternPlayer struct {
+	lock       sync.Mutex
+	generation uint32
+	done       chan struct{}
+}
+
+// Start playing the given pattern. The on function is called at the start of
+// each vibration (with its duration) and the off function at the end of it,
+// or when the pattern is cut off by a new pattern or by stop.
+//
+// The returned channel is closed when the pattern has finished playing, or
+// when it was cut off.
+func (p *patternPlayer) play(pattern []time.Duration, on func(duration time.Duration), off func()) <-chan struct{} {
+	p.lock.Lock()
+	p.cancel(off)
+	generation := p.generation
+	done := make(chan struct{})
+	p.done = done
+	p.lock.Unlock()
+
+	go func() {
+		for i, duration := range pattern {
+			p.lock.Lock()
+			if p.generation != generation {
+				// Cut off, which also closed the channel.
+				p.lock.Unlock()
+				return
+			}
+			vibrating := i%2 == 0
+			if vibrating {
+				on(duration)
+			} else {
+				off()
+			}
+			p.lock.Unlock()
+			time.Sleep(duration)
+		}
+		p.lock.Lock()
+		defer p.lock.Unlock()
+		if p.generation != generation {
+			return
+		}
+		if len(pattern)%2 != 0 {
+			// The pattern ended while vibrating.
+			off()
+		}
+		close(done)
+		p.done = nil
+	}()
+	return done
+}
+
+// Stop the pattern that is currently playing, if any.
+func (p *patternPlayer) stop(off func()) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	p.cancel(off)
+}
+
+// Cut off the current pattern. Must be called with the lock held.
+func (p *patternPlayer) cancel(off func()) {
+	p.generation++
+	if p.done != nil {
+		off()
+		close(p.done)
+		p.done = nil
+	}
+}